@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"oauth-golang/internal/storage"
+)
+
+// admins dispatches the "admins" subcommands
+// The RBAC admin API itself requires the admin role, so the first administrator is granted here
+func (e *env) admins(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: oauthctl admins grant|revoke <user>")
+	}
+
+	found, err := e.findUser(args[1])
+	if err != nil {
+		return err
+	}
+	_, repos, err := e.database()
+	if err != nil {
+		return err
+	}
+	role, err := adminRole(e.ctx, repos.RBAC)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "grant":
+		if err := repos.RBAC.AssignUserRole(e.ctx, found.ID, role.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Granted the %s role to %s\n", storage.AdminRole, found.Email)
+		return nil
+	case "revoke":
+		if err := repos.RBAC.UnassignUserRole(e.ctx, found.ID, role.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked the %s role from %s\n", storage.AdminRole, found.Email)
+		return nil
+	default:
+		return fmt.Errorf("unknown admins subcommand %q", args[0])
+	}
+}
+
+// adminRole returns the global admin role, seeding it first when the database predates it
+// DB INTERACTION: Queries and inserts roles via rbacRepo
+func adminRole(ctx context.Context, rbacRepo storage.RBACRepository) (*storage.Role, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		roles, err := rbacRepo.ListRoles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range roles {
+			if role.ClientID == "" && role.Name == storage.AdminRole {
+				return role, nil
+			}
+		}
+		storage.SeedAdminRole(ctx, rbacRepo)
+	}
+	return nil, fmt.Errorf("the %s role could not be created", storage.AdminRole)
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+)
+
+// clientFile is the YAML document written by "clients export" and read by "clients import"
+type clientFile struct {
+	Clients []clientYAML `yaml:"clients"`
+}
+
+// clientYAML is the YAML form of a client; field names follow the client table columns
+type clientYAML struct {
+	ClientID                          string   `yaml:"client_id"`
+	ClientSecret                      string   `yaml:"client_secret,omitempty"`
+	ClientName                        string   `yaml:"client_name"`
+	ClientType                        string   `yaml:"client_type"`
+	RedirectURIs                      []string `yaml:"redirect_uris,omitempty"`
+	PostLogoutRedirectURIs            []string `yaml:"post_logout_redirect_uris,omitempty"`
+	GrantTypes                        []string `yaml:"grant_types"`
+	Scope                             string   `yaml:"scope,omitempty"`
+	RequireMFA                        bool     `yaml:"require_mfa,omitempty"`
+	FirstParty                        bool     `yaml:"first_party,omitempty"`
+	SubjectType                       string   `yaml:"subject_type,omitempty"`
+	SectorIdentifierURI               string   `yaml:"sector_identifier_uri,omitempty"`
+	BackchannelLogoutURI              string   `yaml:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired  bool     `yaml:"backchannel_logout_session_required,omitempty"`
+	FrontchannelLogoutURI             string   `yaml:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool     `yaml:"frontchannel_logout_session_required,omitempty"`
+	AccessTokenLifetime               int      `yaml:"access_token_lifetime,omitempty"`
+	RefreshTokenLifetime              int      `yaml:"refresh_token_lifetime,omitempty"`
+	RefreshTokenIdleLifetime          int      `yaml:"refresh_token_idle_lifetime,omitempty"`
+	IDTokenLifetime                   int      `yaml:"id_token_lifetime,omitempty"`
+	AuthCodeLifetime                  int      `yaml:"auth_code_lifetime,omitempty"`
+	AccessTokenFormat                 string   `yaml:"access_token_format,omitempty"`
+	ResourceServer                    bool     `yaml:"resource_server,omitempty"`
+	Audiences                         []string `yaml:"audiences,omitempty"`
+	IntrospectionEncryptionKey        string   `yaml:"introspection_encryption_key,omitempty"`
+	AuthorizationDetailsTypes         []string `yaml:"authorization_details_types,omitempty"`
+}
+
+// clients dispatches the "clients" subcommands
+func (e *env) clients(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing clients subcommand; see oauthctl help")
+	}
+
+	_, repos, err := e.database()
+	if err != nil {
+		return err
+	}
+	registry := oauth.NewClientRegistry(repos.Clients)
+	tokenRepo := repos.Tokens
+
+	switch args[0] {
+	case "list":
+		return listClients(e.ctx, registry)
+	case "get":
+		client, err := requireClient(e.ctx, registry, args[1:])
+		if err != nil {
+			return err
+		}
+		return writeClients(os.Stdout, []*storage.OAuthClient{client}, false)
+	case "create":
+		return createClient(e.ctx, registry, args[1:])
+	case "rotate-secret":
+		client, err := requireClient(e.ctx, registry, args[1:])
+		if err != nil {
+			return err
+		}
+		secret, err := registry.RotateSecret(e.ctx, client.ClientID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("client_id:     %s\nclient_secret: %s\n", client.ClientID, secret)
+		return nil
+	case "delete":
+		client, err := requireClient(e.ctx, registry, args[1:])
+		if err != nil {
+			return err
+		}
+		// Revoke first: a refresh token of an unknown client would otherwise recreate it on use
+		if err := tokenRepo.RevokeAllClientRefreshTokens(e.ctx, client.ClientID); err != nil {
+			return err
+		}
+		if err := tokenRepo.RevokeAllClientAccessTokens(e.ctx, client.ClientID); err != nil {
+			return err
+		}
+		if err := registry.DeleteClient(e.ctx, client.ClientID); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted client %s\n", client.ClientID)
+		return nil
+	case "export":
+		return exportClients(e.ctx, registry, args[1:])
+	case "import":
+		return importClients(e.ctx, registry, repos.Clients, args[1:])
+	default:
+		return fmt.Errorf("unknown clients subcommand %q", args[0])
+	}
+}
+
+// requireClient loads the registered client named by the first argument
+// INPUT FROM DB: Queries client via registry
+func requireClient(ctx context.Context, registry *oauth.ClientRegistry, args []string) (*storage.OAuthClient, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected exactly one client_id")
+	}
+	client, err := registry.FindClient(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("client %s not found", args[0])
+	}
+	return client, nil
+}
+
+// listClients prints one line per registered client
+// INPUT FROM DB: Queries clients via registry
+func listClients(ctx context.Context, registry *oauth.ClientRegistry) error {
+	clients, err := registry.ListClients(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLIENT_ID\tTYPE\tNAME\tSCOPE")
+	for _, client := range clients {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", client.ClientID, client.ClientType, client.ClientName, client.Scope)
+	}
+	return tw.Flush()
+}
+
+// createClient registers a client from flags and prints its credentials
+// OUTPUT TO DB: Inserts client via registry
+func createClient(ctx context.Context, registry *oauth.ClientRegistry, args []string) error {
+	flags := flag.NewFlagSet("clients create", flag.ContinueOnError)
+	id := flags.String("id", "", "client_id; generated when empty")
+	name := flags.String("name", "", "client name shown to users")
+	clientType := flags.String("type", "confidential", "public or confidential")
+	scope := flags.String("scope", "openid profile email", "scopes the client may request")
+	firstParty := flags.Bool("first-party", false, "skip the consent screen")
+	var redirectURIs, grantTypes stringList
+	flags.Var(&redirectURIs, "redirect-uri", "redirect URI (repeatable)")
+	flags.Var(&grantTypes, "grant-type", "grant type (repeatable; default authorization_code,refresh_token)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(grantTypes) == 0 {
+		grantTypes = stringList{"authorization_code", "refresh_token"}
+	}
+
+	client := &storage.OAuthClient{
+		ClientID:     *id,
+		ClientName:   *name,
+		ClientType:   *clientType,
+		RedirectURIs: pq.StringArray(redirectURIs),
+		GrantTypes:   pq.StringArray(grantTypes),
+		Scope:        *scope,
+		FirstParty:   *firstParty,
+	}
+	if err := registry.CreateClient(ctx, client); err != nil {
+		return err
+	}
+
+	fmt.Printf("client_id:     %s\n", client.ClientID)
+	if client.ClientSecret != "" {
+		fmt.Printf("client_secret: %s\n", client.ClientSecret)
+	}
+	return nil
+}
+
+// exportClients writes every registered client as YAML
+// INPUT FROM DB: Queries clients via registry
+func exportClients(ctx context.Context, registry *oauth.ClientRegistry, args []string) error {
+	flags := flag.NewFlagSet("clients export", flag.ContinueOnError)
+	file := flags.String("file", "", "output file; stdout when empty")
+	withSecrets := flags.Bool("secrets", false, "include client secrets")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	clients, err := registry.ListClients(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *file != "" {
+		f, err := os.OpenFile(*file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return writeClients(out, clients, *withSecrets)
+}
+
+// importClients creates or updates clients from a YAML file
+// Existing clients keep their secret unless the file sets one; new confidential clients without
+// a secret in the file get a generated one, which is printed
+// OUTPUT TO DB: Inserts and updates clients via registry
+func importClients(ctx context.Context, registry *oauth.ClientRegistry, clientRepo storage.ClientRepository, args []string) error {
+	flags := flag.NewFlagSet("clients import", flag.ContinueOnError)
+	file := flags.String("file", "", "YAML file written by clients export")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var document clientFile
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", *file, err)
+	}
+
+	for _, entry := range document.Clients {
+		if entry.ClientID == "" {
+			return fmt.Errorf("every client in %s needs a client_id", *file)
+		}
+
+		existing, err := registry.FindClient(ctx, entry.ClientID)
+		if err != nil {
+			return err
+		}
+
+		client := entry.toClient()
+		action := "Updated"
+		if existing == nil {
+			action = "Created"
+			err = registry.CreateClient(ctx, client)
+		} else {
+			err = registry.UpdateClient(ctx, client)
+		}
+		if err != nil {
+			return fmt.Errorf("client %s: %w", entry.ClientID, err)
+		}
+
+		switch {
+		case entry.ClientSecret != "" && client.IsConfidential():
+			// Keep the exported secret so existing deployments of the client keep working
+			if entry.ClientSecret != client.ClientSecret {
+				client.ClientSecret = entry.ClientSecret
+				if err := clientRepo.SaveClient(ctx, client); err != nil {
+					return fmt.Errorf("client %s: %w", entry.ClientID, err)
+				}
+			}
+		case existing == nil && client.ClientSecret != "":
+			fmt.Printf("%s client %s (client_secret: %s)\n", action, client.ClientID, client.ClientSecret)
+			continue
+		}
+		fmt.Printf("%s client %s\n", action, client.ClientID)
+	}
+	return nil
+}
+
+// writeClients writes clients as a YAML clientFile
+func writeClients(out io.Writer, clients []*storage.OAuthClient, withSecrets bool) error {
+	document := clientFile{Clients: make([]clientYAML, 0, len(clients))}
+	for _, client := range clients {
+		entry := toClientYAML(client)
+		if withSecrets {
+			entry.ClientSecret = client.ClientSecret
+		}
+		document.Clients = append(document.Clients, entry)
+	}
+
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// toClient converts the YAML form to a client; the secret is handled separately
+func (c *clientYAML) toClient() *storage.OAuthClient {
+	return &storage.OAuthClient{
+		ClientID:                          c.ClientID,
+		ClientName:                        c.ClientName,
+		ClientType:                        c.ClientType,
+		RedirectURIs:                      pq.StringArray(c.RedirectURIs),
+		PostLogoutRedirectURIs:            pq.StringArray(c.PostLogoutRedirectURIs),
+		GrantTypes:                        pq.StringArray(c.GrantTypes),
+		Scope:                             c.Scope,
+		RequireMFA:                        c.RequireMFA,
+		FirstParty:                        c.FirstParty,
+		SubjectType:                       c.SubjectType,
+		SectorIdentifierURI:               c.SectorIdentifierURI,
+		BackchannelLogoutURI:              c.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  c.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             c.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: c.FrontchannelLogoutSessionRequired,
+		AccessTokenLifetime:               c.AccessTokenLifetime,
+		RefreshTokenLifetime:              c.RefreshTokenLifetime,
+		RefreshTokenIdleLifetime:          c.RefreshTokenIdleLifetime,
+		IDTokenLifetime:                   c.IDTokenLifetime,
+		AuthCodeLifetime:                  c.AuthCodeLifetime,
+		AccessTokenFormat:                 c.AccessTokenFormat,
+		ResourceServer:                    c.ResourceServer,
+		Audiences:                         pq.StringArray(c.Audiences),
+		IntrospectionEncryptionKey:        c.IntrospectionEncryptionKey,
+		AuthorizationDetailsTypes:         pq.StringArray(c.AuthorizationDetailsTypes),
+	}
+}
+
+// toClientYAML converts a client to its YAML form without the secret
+func toClientYAML(client *storage.OAuthClient) clientYAML {
+	return clientYAML{
+		ClientID:                          client.ClientID,
+		ClientName:                        client.ClientName,
+		ClientType:                        client.ClientType,
+		RedirectURIs:                      client.RedirectURIs,
+		PostLogoutRedirectURIs:            client.PostLogoutRedirectURIs,
+		GrantTypes:                        client.GrantTypes,
+		Scope:                             client.Scope,
+		RequireMFA:                        client.RequireMFA,
+		FirstParty:                        client.FirstParty,
+		SubjectType:                       client.SubjectType,
+		SectorIdentifierURI:               client.SectorIdentifierURI,
+		BackchannelLogoutURI:              client.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  client.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             client.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: client.FrontchannelLogoutSessionRequired,
+		AccessTokenLifetime:               client.AccessTokenLifetime,
+		RefreshTokenLifetime:              client.RefreshTokenLifetime,
+		RefreshTokenIdleLifetime:          client.RefreshTokenIdleLifetime,
+		IDTokenLifetime:                   client.IDTokenLifetime,
+		AuthCodeLifetime:                  client.AuthCodeLifetime,
+		AccessTokenFormat:                 client.AccessTokenFormat,
+		ResourceServer:                    client.ResourceServer,
+		Audiences:                         client.Audiences,
+		IntrospectionEncryptionKey:        client.IntrospectionEncryptionKey,
+		AuthorizationDetailsTypes:         client.AuthorizationDetailsTypes,
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/pkg/utils"
+)
+
+// pkce prints a fresh PKCE code_verifier and its code_challenge (RFC 7636)
+func (e *env) pkce(args []string) error {
+	flags := flag.NewFlagSet("pkce", flag.ContinueOnError)
+	method := flags.String("method", "S256", "code_challenge_method: S256 or plain")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *method != "S256" && *method != "plain" {
+		return fmt.Errorf("unsupported method %q", *method)
+	}
+
+	verifier := utils.GenerateCodeVerifier()
+	challenge := oauth.NewPKCEValidator().GenerateCodeChallenge(verifier, *method)
+	fmt.Printf("code_verifier:         %s\ncode_challenge:        %s\ncode_challenge_method: %s\n", verifier, challenge, *method)
+	return nil
+}
+
+// token issues a JWT access token for a user, signed with the SIGNING_KEY_FILE key like the server's own
+// Only scopes the client is registered for are allowed, never role-bound ones such as admin, and the
+// token is recorded in access_tokens so the server accepts it and it can be revoked like any other
+// DB INTERACTION: Loads the user, client and scopes; stores the token via tokenRepo
+func (e *env) token(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: oauthctl token <user> -client C [-scope S] [-audience A]")
+	}
+
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	clientID := flags.String("client", "", "client_id the token is issued to")
+	scope := flags.String("scope", "openid profile email", "granted scope")
+	audience := flags.String("audience", "", "aud claim; this service when empty")
+	ttl := flags.Duration("ttl", e.cfg.AccessTokenTTL, "lifetime")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *clientID == "" {
+		return fmt.Errorf("-client is required")
+	}
+
+	found, err := e.findUser(args[0])
+	if err != nil {
+		return err
+	}
+	if found.Disabled {
+		return fmt.Errorf("user %s is disabled", found.Email)
+	}
+	_, repos, err := e.database()
+	if err != nil {
+		return err
+	}
+
+	client, err := repos.Clients.FindClientByID(e.ctx, *clientID)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf("client %s not found", *clientID)
+	}
+	if client.UsesPairwiseSubject() {
+		return fmt.Errorf("client %s uses pairwise subjects and only gets opaque access tokens", *clientID)
+	}
+	if err := checkDebugScope(e.ctx, repos.Scopes, client, *scope); err != nil {
+		return err
+	}
+
+	// An ephemeral key would sign a token the running server cannot verify
+	if e.cfg.SigningKeyFile == "" {
+		return fmt.Errorf("SIGNING_KEY_FILE is not set; the server uses an ephemeral key")
+	}
+	signingKey, err := security.LoadSigningKey(e.cfg.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+	jwtService := security.NewJWTService(e.cfg.Issuer, signingKey)
+	now := time.Now()
+	claims := &security.TokenClaims{
+		Subject:   found.ID,
+		Scope:     *scope,
+		ClientID:  client.ClientID,
+		Issuer:    jwtService.Issuer(),
+		Audience:  *audience,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(*ttl),
+		ID:        uuid.NewString(),
+	}
+	if claims.Audience == "" {
+		claims.Audience = security.AccessTokenAudience
+	}
+	for _, name := range strings.Fields(*scope) {
+		switch name {
+		case "email":
+			claims.Email = found.Email
+		case "profile":
+			claims.Name = found.Name
+		}
+	}
+
+	token, err := jwtService.GenerateAccessToken(claims, *ttl)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	if err := repos.Tokens.StoreAccessToken(e.ctx, token, &storage.AccessToken{
+		UserID:    found.ID,
+		ClientID:  client.ClientID,
+		Scope:     *scope,
+		Claims:    string(encoded),
+		ExpiresAt: claims.ExpiresAt,
+	}); err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
+
+// checkDebugScope allows only registered scopes the client may request and that are not bound to a role
+// INPUT FROM DB: Queries scope definitions via scopeRepo
+func checkDebugScope(ctx context.Context, scopeRepo storage.ScopeRepository, client *storage.OAuthClient, scope string) error {
+	allowed := make(map[string]bool)
+	for _, name := range strings.Fields(client.Scope) {
+		allowed[name] = true
+	}
+
+	for _, name := range strings.Fields(scope) {
+		if !allowed[name] {
+			return fmt.Errorf("client %s may not request scope %q", client.ClientID, name)
+		}
+		definition, err := scopeRepo.GetScope(ctx, name)
+		if err != nil {
+			return err
+		}
+		if definition == nil {
+			return fmt.Errorf("unknown scope %q", name)
+		}
+		if definition.RequiredRole != "" {
+			return fmt.Errorf("scope %q requires the %s role; obtain it through /authorize", name, definition.RequiredRole)
+		}
+	}
+	return nil
+}
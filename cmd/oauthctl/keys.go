@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"oauth-golang/internal/security"
+)
+
+// keys dispatches the "keys" subcommands
+func (e *env) keys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing keys subcommand; see oauthctl help")
+	}
+
+	switch args[0] {
+	case "show":
+		if e.cfg.SigningKeyFile == "" {
+			return fmt.Errorf("SIGNING_KEY_FILE is not set; the server uses an ephemeral key")
+		}
+		key, err := security.LoadSigningKey(e.cfg.SigningKeyFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("file: %s\nkid:  %s\nalg:  ES256\n", e.cfg.SigningKeyFile, key.ID)
+		if key.Previous != nil {
+			fmt.Printf("previous kid: %s (from %s.prev, published for verification only)\n", key.Previous.ID, e.cfg.SigningKeyFile)
+		}
+		return nil
+	case "rotate":
+		return e.rotateKey(args[1:])
+	default:
+		return fmt.Errorf("unknown keys subcommand %q", args[0])
+	}
+}
+
+// rotateKey writes a new signing key, moving the current one to <file>.prev
+// The server reads both at startup, so it has to be restarted to use the new one; it signs with
+// the new key and keeps publishing the previous one in the JWKS
+func (e *env) rotateKey(args []string) error {
+	flags := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	file := flags.String("file", e.cfg.SigningKeyFile, "key file; defaults to SIGNING_KEY_FILE")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required when SIGNING_KEY_FILE is not set")
+	}
+
+	key, err := security.GenerateSigningKey()
+	if err != nil {
+		return err
+	}
+	data, err := key.EncodePEM()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*file); err == nil {
+		if err := os.Rename(*file, *file+".prev"); err != nil {
+			return fmt.Errorf("failed to keep the previous key: %w", err)
+		}
+		fmt.Printf("Previous key moved to %s.prev\n", *file)
+	}
+	if err := os.WriteFile(*file, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+
+	fmt.Printf("Wrote new signing key %s (kid %s); restart the server to use it\n", *file, key.ID)
+	fmt.Printf("The server keeps publishing %s.prev so tokens signed with it still verify; the next rotation replaces it\n", *file)
+	return nil
+}
@@ -0,0 +1,166 @@
+// Command oauthctl is the operator tool for the OAuth service
+// It talks to the service's database directly, using the same configuration (.env / environment)
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/storage"
+)
+
+const usage = `Usage: oauthctl <command> [arguments]
+
+Clients:
+  clients list                              List registered clients
+  clients get <client_id>                   Show a client as YAML
+  clients create -name N -type T [flags]    Register a client; prints its secret once
+  clients rotate-secret <client_id>         Replace a confidential client's secret
+  clients delete <client_id>                Revoke a client's tokens and remove it
+  clients export [-file F] [-secrets]       Write all clients as YAML (stdout by default)
+  clients import -file F                    Create or update clients from YAML
+
+Tokens:
+  tokens list <user>                        List a user's active refresh tokens
+  tokens revoke <user> [-id ID]             Revoke one refresh token, or all of the user's tokens
+
+Administrators:
+  admins grant <user>                       Give a user the admin role (required for the admin scope)
+  admins revoke <user>                      Take the admin role away
+
+Keys:
+  keys show                                 Show the signing key in SIGNING_KEY_FILE
+  keys rotate [-file F]                     Write a new signing key; the old one stays published as F.prev
+
+Database:
+  migrate [up]                              Apply pending schema migrations and seed defaults
+  migrate down [-steps N]                   Revert the latest N migrations (default 1)
+  migrate status                            Show which migrations are applied
+
+Debugging:
+  pkce [-method S256|plain]                 Generate a PKCE code_verifier and code_challenge
+  token <user> -client C [-scope S] [-audience A] [-ttl D]
+                                            Issue a recorded JWT access token for testing
+
+<user> is a user ID or an email address.
+`
+
+// env holds what commands need: the configuration and the lazily opened database
+type env struct {
+	ctx   context.Context
+	cfg   *config.Config
+	db    *sql.DB
+	repos *storage.Repositories
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "help" {
+		fmt.Print(usage)
+		return
+	}
+
+	cfg, err := config.LoadToolConfig()
+	if err != nil {
+		fatalf("Failed to load configuration: %v", err)
+	}
+	e := &env{ctx: context.Background(), cfg: cfg}
+	defer e.close()
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "clients":
+		err = e.clients(args)
+	case "tokens":
+		err = e.tokens(args)
+	case "admins":
+		err = e.admins(args)
+	case "keys":
+		err = e.keys(args)
+	case "migrate":
+		err = e.migrate(args)
+	case "pkce":
+		err = e.pkce(args)
+	case "token":
+		err = e.token(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		e.close()
+		fatalf("%v", err)
+	}
+}
+
+// database opens the database on first use, without touching the schema
+func (e *env) database() (*sql.DB, *storage.Repositories, error) {
+	if e.db != nil {
+		return e.db, e.repos, nil
+	}
+
+	db, err := storage.Open(e.cfg.DatabaseDriver, e.cfg.DatabaseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect database: %w", err)
+	}
+
+	e.db, e.repos = db, storage.NewRepositories(db)
+	return e.db, e.repos, nil
+}
+
+// close closes the database connection if one was opened
+func (e *env) close() {
+	if e.db != nil {
+		e.db.Close()
+		e.db = nil
+	}
+}
+
+// findUser resolves a user by ID or, when the argument contains "@", by email
+// INPUT FROM DB: Queries users table
+func (e *env) findUser(idOrEmail string) (*storage.User, error) {
+	_, repos, err := e.database()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *storage.User
+	if strings.Contains(idOrEmail, "@") {
+		found, err = repos.Users.GetUserByEmail(e.ctx, idOrEmail)
+	} else {
+		found, err = repos.Users.GetUserByID(e.ctx, idOrEmail)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("user %s not found", idOrEmail)
+	}
+	return found, nil
+}
+
+// stringList is a flag that may be repeated or given as a comma-separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// fatalf prints an error and exits
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "oauthctl: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// migrate dispatches the "migrate" subcommands; without one it migrates up
+func (e *env) migrate(args []string) error {
+	subcommand := "up"
+	if len(args) > 0 {
+		subcommand, args = args[0], args[1:]
+	}
+
+	db, repos, err := e.database()
+	if err != nil {
+		return err
+	}
+	ctx := e.ctx
+
+	switch subcommand {
+	case "up":
+		applied, err := storage.MigrateUp(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied %s\n", migration)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		storage.Seed(ctx, repos)
+		return nil
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1")
+		}
+		reverted, err := storage.MigrateDown(ctx, db, *steps)
+		if err != nil {
+			return err
+		}
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %s\n", migration)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations to revert")
+		}
+		return nil
+	case "status":
+		states, err := storage.MigrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "MIGRATION\tAPPLIED")
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", state, applied)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q", subcommand)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// tokens dispatches the "tokens" subcommands
+func (e *env) tokens(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: oauthctl tokens list|revoke <user>")
+	}
+
+	found, err := e.findUser(args[1])
+	if err != nil {
+		return err
+	}
+	_, repos, err := e.database()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return listTokens(e.ctx, repos.Tokens, found)
+	case "revoke":
+		return revokeTokens(e.ctx, repos.Tokens, found, args[2:])
+	default:
+		return fmt.Errorf("unknown tokens subcommand %q", args[0])
+	}
+}
+
+// listTokens prints a user's active refresh tokens; the token values themselves are never shown
+// INPUT FROM DB: Queries refresh_tokens via tokenRepo
+func listTokens(ctx context.Context, tokenRepo storage.TokenRepository, found *storage.User) error {
+	tokens, err := tokenRepo.ListActiveByUser(ctx, found.ID)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCLIENT_ID\tSCOPE\tCREATED\tLAST_USED\tEXPIRES")
+	for _, rt := range tokens {
+		lastUsed := "-"
+		if rt.LastUsedAt != nil {
+			lastUsed = rt.LastUsedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", rt.ID, rt.ClientID, rt.Scope,
+			rt.CreatedAt.Format(time.RFC3339), lastUsed, rt.ExpiresAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// revokeTokens revokes one refresh token by ID, or every refresh and access token of the user
+// OUTPUT TO DB: Updates revoked flags via tokenRepo
+func revokeTokens(ctx context.Context, tokenRepo storage.TokenRepository, found *storage.User, args []string) error {
+	flags := flag.NewFlagSet("tokens revoke", flag.ContinueOnError)
+	id := flags.String("id", "", "ID of one refresh token (from tokens list)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *id != "" {
+		if err := tokenRepo.RevokeRefreshTokenByID(ctx, found.ID, *id); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked refresh token %s\n", *id)
+		return nil
+	}
+
+	if err := tokenRepo.RevokeUserRefreshTokens(ctx, found.ID); err != nil {
+		return err
+	}
+	if err := tokenRepo.RevokeUserAccessTokens(ctx, found.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Revoked all tokens of %s\n", found.Email)
+	return nil
+}
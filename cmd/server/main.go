@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,23 +22,20 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Initialize database connection with GORM (includes auto-migration)
-	storage.InitDB(cfg.DatabaseURL)
-
-	// Get the underlying *sql.DB for repository initialization
-	sqlDB, err := storage.DB.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database instance: %v", err)
-	}
-	defer sqlDB.Close()
+	// Initialize database connection and check (or migrate) the schema
+	db := storage.InitDB(cfg.DatabaseDriver, cfg.DatabaseURL, cfg.AutoMigrate)
+	defer db.Close()
 
 	// Initialize repositories (DB interaction layer)
-	userRepo := storage.NewUserRepository(sqlDB)
-	storageService := &storage.Storage{DB: storage.DB}
-	tokenRepo := storage.NewTokenRepository(sqlDB)
+	repos := storage.NewRepositories(db)
+
+	// Every request context derives from baseCtx, so cancelling it aborts in-flight
+	// database queries and calls to Google; background work such as logout notifications stops too
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	// Initialize HTTP router with all handlers (API input layer)
-	handler := router.NewRouter(cfg, userRepo, storageService, tokenRepo)
+	handler := router.NewRouter(baseCtx, cfg, repos)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -46,6 +44,7 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
 	}
 
 	// Start server in a goroutine
@@ -65,9 +64,13 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Requests still running when the grace period ends are cancelled rather than abandoned
 	if err := srv.Shutdown(ctx); err != nil {
+		cancelRequests()
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	// Pending back-channel logout retries are abandoned once the server has stopped
+	cancelRequests()
 
 	log.Println("Server exited")
 }
@@ -2,57 +2,178 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret is used when JWT_SECRET is not set; it must never be used in production
+const DefaultJWTSecret = "default-jwt-secret-change-in-production"
+
 // Config holds all configuration for the OAuth microservice
 type Config struct {
 	// Server configuration
 	Port string
 
 	// Database configuration
-	DatabaseURL string
+	DatabaseDriver string // "postgres" or "sqlite"
+	DatabaseURL    string // Postgres connection string, or the SQLite file path
+	AutoMigrate    bool   // apply pending schema migrations at startup instead of refusing to start
 
 	// Google OAuth configuration
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectURL  string
+	GoogleClientID        string
+	GoogleClientSecret    string
+	GoogleRedirectURL     string
+	GoogleWorkspaceGroups bool // fetch the user's Workspace groups at login and mirror them into local groups
 
 	// JWT configuration
-	JWTSecret string
+	JWTSecret string // fallback for PairwiseSalt and SessionSecret; tokens are signed with SigningKeyFile
+	Issuer    string // "iss" of every token this service issues: an http(s) URL without query or fragment
+
+	// PEM file with the P-256 key signing tokens and responses; empty generates an ephemeral key
+	SigningKeyFile string
+
+	// Default token lifetimes; clients may override each of them
+	AccessTokenTTL      time.Duration
+	RefreshTokenTTL     time.Duration // absolute: counted from the original grant, not extended by refreshing
+	RefreshTokenIdleTTL time.Duration // refresh tokens unused for this long expire; 0 disables the idle limit
+	IDTokenTTL          time.Duration
+	AuthCodeTTL         time.Duration
+	AccessTokenFormat   string // "jwt" or "opaque"
+
+	// Salt mixed into pairwise subject identifiers; changing it changes every pairwise sub
+	PairwiseSalt string
+
+	// SSO session configuration
+	SessionSecret       string        // key material for the encrypted session cookie
+	SessionTTL          time.Duration // lifetime of a login session
+	SessionCookieSecure bool          // set the Secure flag; enable whenever served over HTTPS
+
+	// Logout configuration
+	LogoutRevokesRefreshTokens bool // revoke refresh tokens issued under a session when it is logged out
+
+	// MFA configuration
+	MFAIssuer string // issuer label shown in authenticator apps
+
+	// WebAuthn relying party configuration
+	WebAuthnRPID      string   // usually the registrable domain, e.g. "auth.example.com"
+	WebAuthnRPOrigins []string // full origins allowed to run ceremonies
 }
 
 // LoadConfig loads configuration from environment variables
 // It reads from .env file in the project root
 func LoadConfig() (*Config, error) {
+	cfg, err := LoadToolConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.GoogleClientID == "" {
+		return nil, fmt.Errorf("GOOGLE_CLIENT_ID is required")
+	}
+	if cfg.GoogleClientSecret == "" {
+		return nil, fmt.Errorf("GOOGLE_CLIENT_SECRET is required")
+	}
+
+	return cfg, nil
+}
+
+// LoadToolConfig loads the same configuration as LoadConfig for command-line tools
+// that only talk to the database: the Google credentials are not required
+func LoadToolConfig() (*Config, error) {
 	// Load .env file (optional - won't error if file doesn't exist)
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		Port:               getEnv("PORT", "8080"),
-		DatabaseURL:        getEnv("DATABASE_URL", ""),
-		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
-		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
-		GoogleRedirectURL:  getEnv("GOOGLE_REDIRECT_URL", "http://localhost:8080/callback"),
-		JWTSecret:          getEnv("JWT_SECRET", "default-jwt-secret-change-in-production"),
+		Port:                       getEnv("PORT", "8080"),
+		DatabaseDriver:             getEnv("DATABASE_DRIVER", "postgres"),
+		DatabaseURL:                getEnv("DATABASE_URL", ""),
+		AutoMigrate:                getEnv("AUTO_MIGRATE", "true") == "true",
+		GoogleClientID:             getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:         getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GoogleRedirectURL:          getEnv("GOOGLE_REDIRECT_URL", "http://localhost:8080/callback"),
+		GoogleWorkspaceGroups:      getEnv("GOOGLE_WORKSPACE_GROUPS", "false") == "true",
+		JWTSecret:                  getEnv("JWT_SECRET", DefaultJWTSecret),
+		Issuer:                     os.Getenv("ISSUER"),
+		SigningKeyFile:             os.Getenv("SIGNING_KEY_FILE"),
+		AccessTokenFormat:          getEnv("ACCESS_TOKEN_FORMAT", "jwt"),
+		MFAIssuer:                  getEnv("MFA_ISSUER", "OAuth Service"),
+		PairwiseSalt:               os.Getenv("PAIRWISE_SALT"),
+		SessionSecret:              os.Getenv("SESSION_SECRET"),
+		SessionCookieSecure:        getEnv("SESSION_COOKIE_SECURE", "false") == "true",
+		LogoutRevokesRefreshTokens: getEnv("LOGOUT_REVOKE_REFRESH_TOKENS", "true") == "true",
+		WebAuthnRPID:               getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPOrigins:          strings.Split(getEnv("WEBAUTHN_RP_ORIGINS", "http://localhost:8080"), ","),
 	}
 
 	// Validate required fields
+	if cfg.DatabaseDriver != "postgres" && cfg.DatabaseDriver != "sqlite" {
+		return nil, fmt.Errorf("DATABASE_DRIVER must be postgres or sqlite")
+	}
 	if cfg.DatabaseURL == "" {
 		return nil, fmt.Errorf("DATABASE_URL is required")
 	}
-	if cfg.GoogleClientID == "" {
-		return nil, fmt.Errorf("GOOGLE_CLIENT_ID is required")
+	issuer, err := resolveIssuer(cfg.Issuer, cfg.GoogleRedirectURL)
+	if err != nil {
+		return nil, err
 	}
-	if cfg.GoogleClientSecret == "" {
-		return nil, fmt.Errorf("GOOGLE_CLIENT_SECRET is required")
+	cfg.Issuer = issuer
+	if cfg.PairwiseSalt == "" {
+		cfg.PairwiseSalt = cfg.JWTSecret
+	}
+	if cfg.SessionSecret == "" {
+		cfg.SessionSecret = cfg.JWTSecret
+	}
+
+	durations := []struct {
+		key          string
+		defaultValue string
+		target       *time.Duration
+	}{
+		{"SESSION_TTL", "24h", &cfg.SessionTTL},
+		{"ACCESS_TOKEN_TTL", "1h", &cfg.AccessTokenTTL},
+		{"REFRESH_TOKEN_TTL", "720h", &cfg.RefreshTokenTTL},
+		{"REFRESH_TOKEN_IDLE_TTL", "0", &cfg.RefreshTokenIdleTTL},
+		{"ID_TOKEN_TTL", "1h", &cfg.IDTokenTTL},
+		{"AUTH_CODE_TTL", "10m", &cfg.AuthCodeTTL},
+	}
+	for _, d := range durations {
+		value, err := time.ParseDuration(getEnv(d.key, d.defaultValue))
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid %s: %q", d.key, os.Getenv(d.key))
+		}
+		*d.target = value
+	}
+
+	if cfg.AccessTokenFormat != "jwt" && cfg.AccessTokenFormat != "opaque" {
+		return nil, fmt.Errorf("ACCESS_TOKEN_FORMAT must be jwt or opaque")
 	}
 
 	return cfg, nil
 }
 
+// resolveIssuer validates ISSUER, defaulting to the scheme and host of the Google redirect URL,
+// which is where this service is reachable
+func resolveIssuer(issuer, redirectURL string) (string, error) {
+	if issuer == "" {
+		redirect, err := url.Parse(redirectURL)
+		if err != nil || redirect.Host == "" {
+			return "", fmt.Errorf("ISSUER is not set and GOOGLE_REDIRECT_URL is not an absolute URL")
+		}
+		issuer = redirect.Scheme + "://" + redirect.Host
+	}
+
+	parsed, err := url.Parse(issuer)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" ||
+		parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("ISSUER must be an http(s) URL without query or fragment: %q", issuer)
+	}
+	return strings.TrimSuffix(issuer, "/"), nil
+}
+
 // getEnv gets an environment variable with a fallback default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
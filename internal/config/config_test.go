@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestResolveIssuer(t *testing.T) {
+	tests := []struct {
+		issuer, redirect, want string
+	}{
+		{"", "http://localhost:8080/callback", "http://localhost:8080"},
+		{"", "https://auth.example.com/callback", "https://auth.example.com"},
+		{"https://auth.example.com/", "http://localhost:8080/callback", "https://auth.example.com"},
+		{"https://example.com/tenant", "", "https://example.com/tenant"},
+	}
+	for _, tt := range tests {
+		got, err := resolveIssuer(tt.issuer, tt.redirect)
+		if err != nil || got != tt.want {
+			t.Errorf("resolveIssuer(%q, %q) = %q, %v; want %q", tt.issuer, tt.redirect, got, err, tt.want)
+		}
+	}
+
+	for _, issuer := range []string{"oauth-service", "ftp://auth.example.com", "https://auth.example.com?x=1", "https://auth.example.com#f"} {
+		if _, err := resolveIssuer(issuer, "http://localhost:8080/callback"); err == nil {
+			t.Errorf("resolveIssuer(%q) accepted an invalid issuer", issuer)
+		}
+	}
+	if _, err := resolveIssuer("", "/callback"); err == nil {
+		t.Error("resolveIssuer accepted a relative redirect URL as the default")
+	}
+}
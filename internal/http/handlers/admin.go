@@ -0,0 +1,601 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/user"
+)
+
+// Paging limits for /admin/api/users
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// AdminHandler serves the administrative API: clients, users, their tokens and key status
+// API INPUT: Bearer access token with the admin scope; request bodies are JSON
+type AdminHandler struct {
+	config         *config.Config
+	clientRegistry *oauth.ClientRegistry
+	userAuth       *user.AuthService
+	tokenService   *oauth.TokenService
+	sessionService *oauth.SessionService
+	signingKey     *security.SigningKey
+}
+
+func NewAdminHandler(
+	cfg *config.Config,
+	clientRegistry *oauth.ClientRegistry,
+	userAuth *user.AuthService,
+	tokenService *oauth.TokenService,
+	sessionService *oauth.SessionService,
+	signingKey *security.SigningKey,
+) *AdminHandler {
+	return &AdminHandler{
+		config:         cfg,
+		clientRegistry: clientRegistry,
+		userAuth:       userAuth,
+		tokenService:   tokenService,
+		sessionService: sessionService,
+		signingKey:     signingKey,
+	}
+}
+
+// adminClient is the admin API view of a client; the secret is only returned when it is generated
+type adminClient struct {
+	ClientID                          string   `json:"client_id"`
+	ClientSecret                      string   `json:"client_secret,omitempty"`
+	ClientName                        string   `json:"client_name"`
+	ClientType                        string   `json:"client_type"`
+	RedirectURIs                      []string `json:"redirect_uris"`
+	PostLogoutRedirectURIs            []string `json:"post_logout_redirect_uris,omitempty"`
+	GrantTypes                        []string `json:"grant_types"`
+	Scope                             string   `json:"scope"`
+	RequireMFA                        bool     `json:"require_mfa"`
+	FirstParty                        bool     `json:"first_party"`
+	SubjectType                       string   `json:"subject_type,omitempty"`
+	SectorIdentifierURI               string   `json:"sector_identifier_uri,omitempty"`
+	BackchannelLogoutURI              string   `json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired  bool     `json:"backchannel_logout_session_required,omitempty"`
+	FrontchannelLogoutURI             string   `json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool     `json:"frontchannel_logout_session_required,omitempty"`
+	AccessTokenLifetime               int      `json:"access_token_lifetime,omitempty"`
+	RefreshTokenLifetime              int      `json:"refresh_token_lifetime,omitempty"`
+	RefreshTokenIdleLifetime          int      `json:"refresh_token_idle_lifetime,omitempty"`
+	IDTokenLifetime                   int      `json:"id_token_lifetime,omitempty"`
+	AuthCodeLifetime                  int      `json:"auth_code_lifetime,omitempty"`
+	AccessTokenFormat                 string   `json:"access_token_format,omitempty"`
+	ResourceServer                    bool     `json:"resource_server,omitempty"`
+	Audiences                         []string `json:"audiences,omitempty"`
+	IntrospectionEncryptionKey        string   `json:"introspection_encryption_key,omitempty"`
+	AuthorizationDetailsTypes         []string `json:"authorization_details_types,omitempty"`
+	CreatedAt                         int64    `json:"created_at,omitempty"`
+	UpdatedAt                         int64    `json:"updated_at,omitempty"`
+}
+
+// adminUser is the admin API view of a user
+type adminUser struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	Disabled      bool   `json:"disabled"`
+	CreatedAt     int64  `json:"created_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+}
+
+// keyStatusResponse describes the keys and secrets the server runs with, never their values
+type keyStatusResponse struct {
+	SigningKey struct {
+		KeyID     string `json:"kid"`
+		Algorithm string `json:"alg"`
+		Ephemeral bool   `json:"ephemeral"`
+		LoadedAt  int64  `json:"loaded_at"`
+		JWKSURI   string `json:"jwks_uri"`
+		// PreviousKeyID is the key retired by the last rotation, still published for verification
+		PreviousKeyID string `json:"previous_kid,omitempty"`
+	} `json:"signing_key"`
+	Issuer string `json:"issuer"`
+	// JWTSecretDefault reports the built-in JWT_SECRET; it only matters while a secret falls back to it
+	JWTSecretDefault           bool     `json:"jwt_secret_default"`
+	SessionSecretFromJWTSecret bool     `json:"session_secret_from_jwt_secret"`
+	PairwiseSaltFromJWTSecret  bool     `json:"pairwise_salt_from_jwt_secret"`
+	Warnings                   []string `json:"warnings"`
+}
+
+// HandleClients processes the /admin/api/clients endpoint
+// API INPUT: GET lists clients, or returns one with the client_id query param; POST registers a
+// client; PUT replaces the metadata of the client named by client_id; DELETE removes it
+// API OUTPUT: Clients without their secrets, except the generated secret in the POST response
+// DB INTERACTION: Reads, inserts, updates and deletes clients; DELETE revokes the client's tokens
+func (h *AdminHandler) HandleClients(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+
+	clientID := r.URL.Query().Get("client_id")
+	switch r.Method {
+	case http.MethodGet:
+		if clientID != "" {
+			client, ok := h.loadClient(r.Context(), w, clientID)
+			if !ok {
+				return
+			}
+			h.writeJSON(w, http.StatusOK, toAdminClient(client))
+			return
+		}
+		clients, err := h.clientRegistry.ListClients(r.Context())
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list clients", http.StatusInternalServerError)
+			return
+		}
+		response := make([]adminClient, 0, len(clients))
+		for _, client := range clients {
+			response = append(response, toAdminClient(client))
+		}
+		h.writeJSON(w, http.StatusOK, map[string]interface{}{"clients": response})
+	case http.MethodPost:
+		var req adminClient
+		if !h.decode(w, r, &req) {
+			return
+		}
+		client := req.toClient()
+		if err := h.clientRegistry.CreateClient(r.Context(), client); err != nil {
+			h.writeClientError(w, err)
+			return
+		}
+		response := toAdminClient(client)
+		response.ClientSecret = client.ClientSecret
+		h.writeJSON(w, http.StatusCreated, response)
+	case http.MethodPut:
+		var req adminClient
+		if !h.decode(w, r, &req) {
+			return
+		}
+		if req.ClientID != "" && req.ClientID != clientID {
+			h.writeError(w, "invalid_request", "client_id in the body does not match the query", http.StatusBadRequest)
+			return
+		}
+		if _, ok := h.loadClient(r.Context(), w, clientID); !ok {
+			return
+		}
+		req.ClientID = clientID
+		client := req.toClient()
+		if err := h.clientRegistry.UpdateClient(r.Context(), client); err != nil {
+			h.writeClientError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, toAdminClient(client))
+	case http.MethodDelete:
+		if _, ok := h.loadClient(r.Context(), w, clientID); !ok {
+			return
+		}
+		// Revoke first: a refresh token of an unknown client would otherwise recreate it on use
+		if err := h.tokenService.RevokeClientTokens(r.Context(), clientID); err != nil {
+			h.writeError(w, "server_error", "Failed to revoke client tokens", http.StatusInternalServerError)
+			return
+		}
+		if err := h.clientRegistry.DeleteClient(r.Context(), clientID); err != nil {
+			h.writeError(w, "server_error", "Failed to delete client", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleClientSecret processes the /admin/api/clients/secret endpoint
+// API INPUT: POST with the client_id query param of a confidential client
+// API OUTPUT: The new secret; the old one stops working immediately
+// OUTPUT TO DB: Updates the client's secret
+func (h *AdminHandler) HandleClientSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+
+	clientID := r.URL.Query().Get("client_id")
+	if _, ok := h.loadClient(r.Context(), w, clientID); !ok {
+		return
+	}
+	secret, err := h.clientRegistry.RotateSecret(r.Context(), clientID)
+	if err != nil {
+		h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]string{"client_id": clientID, "client_secret": secret})
+}
+
+// HandleUsers processes the /admin/api/users endpoint
+// API INPUT: GET returns the user named by user_id, or searches with q, limit and offset;
+// DELETE takes the user_id query param
+// DB INTERACTION: Reads users; DELETE signs the user out, revokes their tokens and deletes them
+func (h *AdminHandler) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	caller, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		if query.Get("user_id") != "" {
+			target, ok := h.loadUser(r.Context(), w, query.Get("user_id"))
+			if !ok {
+				return
+			}
+			h.writeJSON(w, http.StatusOK, toAdminUser(target))
+			return
+		}
+
+		limit, offset, ok := h.paging(w, query.Get("limit"), query.Get("offset"))
+		if !ok {
+			return
+		}
+		users, err := h.userAuth.ListUsers(r.Context(), query.Get("q"), limit, offset)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list users", http.StatusInternalServerError)
+			return
+		}
+		response := make([]adminUser, 0, len(users))
+		for _, u := range users {
+			response = append(response, toAdminUser(u))
+		}
+		h.writeJSON(w, http.StatusOK, map[string]interface{}{"users": response, "limit": limit, "offset": offset})
+	case http.MethodDelete:
+		target, ok := h.loadUser(r.Context(), w, query.Get("user_id"))
+		if !ok {
+			return
+		}
+		if target.ID == caller.ID {
+			h.writeError(w, "invalid_request", "You cannot delete your own account", http.StatusBadRequest)
+			return
+		}
+		if err := h.signOutEverywhere(r.Context(), target.ID); err != nil {
+			h.writeError(w, "server_error", "Failed to revoke the user's sessions and tokens", http.StatusInternalServerError)
+			return
+		}
+		if err := h.userAuth.DeleteUser(r.Context(), target.ID); err != nil {
+			h.writeError(w, "server_error", "Failed to delete user", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleDisableUser processes the /admin/api/users/disable endpoint
+// API INPUT: POST with the user_id query param
+// OUTPUT TO DB: Disables the user, ends their sessions and revokes their tokens
+func (h *AdminHandler) HandleDisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// HandleEnableUser processes the /admin/api/users/enable endpoint
+// API INPUT: POST with the user_id query param
+// OUTPUT TO DB: Re-enables the user; they must sign in again
+func (h *AdminHandler) HandleEnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+// setDisabled disables or re-enables the user named by the user_id query param
+func (h *AdminHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	caller, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	target, ok := h.loadUser(r.Context(), w, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+	if disabled && target.ID == caller.ID {
+		h.writeError(w, "invalid_request", "You cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userAuth.SetUserDisabled(r.Context(), target.ID, disabled); err != nil {
+		h.writeError(w, "server_error", "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if disabled {
+		if err := h.signOutEverywhere(r.Context(), target.ID); err != nil {
+			h.writeError(w, "server_error", "Failed to revoke the user's sessions and tokens", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	target.Disabled = disabled
+	h.writeJSON(w, http.StatusOK, toAdminUser(target))
+}
+
+// HandleTokens processes the /admin/api/tokens endpoint
+// API INPUT: user_id query param; GET lists the user's active refresh tokens; DELETE revokes the
+// refresh token named by id or, without it, every refresh and access token of the user
+// DB INTERACTION: Reads and revokes tokens
+func (h *AdminHandler) HandleTokens(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	target, ok := h.loadUser(r.Context(), w, query.Get("user_id"))
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := h.tokenService.ListUserRefreshTokens(r.Context(), target.ID)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list tokens", http.StatusInternalServerError)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"user_id":        target.ID,
+			"refresh_tokens": refreshTokenResponses(r.Context(), h.clientRegistry, tokens),
+		})
+	case http.MethodDelete:
+		var err error
+		if query.Get("id") != "" {
+			err = h.sessionService.RevokeUserRefreshToken(r.Context(), target.ID, query.Get("id"))
+		} else {
+			err = h.tokenService.RevokeUserTokens(r.Context(), target.ID)
+		}
+		if err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleKeys processes the /admin/api/keys endpoint
+// API OUTPUT: Which keys and secrets are configured and how; key material is never returned
+func (h *AdminHandler) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.authorize(w, r); !ok {
+		return
+	}
+
+	response := keyStatusResponse{Warnings: []string{}}
+	jwk := h.signingKey.PublicJWK()
+	response.SigningKey.KeyID = jwk.KeyID
+	response.SigningKey.Algorithm = jwk.Algorithm
+	response.SigningKey.Ephemeral = h.signingKey.Ephemeral
+	response.SigningKey.LoadedAt = h.signingKey.LoadedAt.Unix()
+	response.SigningKey.JWKSURI = "/.well-known/jwks.json"
+	if h.signingKey.Previous != nil {
+		response.SigningKey.PreviousKeyID = h.signingKey.Previous.ID
+	}
+	response.Issuer = h.config.Issuer
+	response.JWTSecretDefault = h.config.JWTSecret == config.DefaultJWTSecret
+	response.SessionSecretFromJWTSecret = h.config.SessionSecret == h.config.JWTSecret
+	response.PairwiseSaltFromJWTSecret = h.config.PairwiseSalt == h.config.JWTSecret
+
+	if response.SigningKey.Ephemeral {
+		response.Warnings = append(response.Warnings, "SIGNING_KEY_FILE is not set; issued tokens stop verifying after a restart")
+	}
+	if response.JWTSecretDefault && response.SessionSecretFromJWTSecret {
+		response.Warnings = append(response.Warnings, "SESSION_SECRET falls back to the built-in JWT_SECRET; anyone can forge session cookies")
+	}
+	if response.PairwiseSaltFromJWTSecret {
+		response.Warnings = append(response.Warnings, "PAIRWISE_SALT is not set; rotating JWT_SECRET would change every pairwise subject")
+	}
+
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// authorize requires an access token with the admin scope and returns the calling administrator
+func (h *AdminHandler) authorize(w http.ResponseWriter, r *http.Request) (*storage.User, bool) {
+	caller, _, authErr := authenticateAdmin(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return nil, false
+	}
+	return caller, true
+}
+
+// signOutEverywhere ends a user's sessions (notifying their clients) and revokes all their tokens
+func (h *AdminHandler) signOutEverywhere(ctx context.Context, userID string) error {
+	if err := h.sessionService.LogoutUser(ctx, userID, true); err != nil {
+		return err
+	}
+	return h.tokenService.RevokeUserTokens(ctx, userID)
+}
+
+// paging parses the limit and offset query params
+func (h *AdminHandler) paging(w http.ResponseWriter, rawLimit, rawOffset string) (int, int, bool) {
+	limit, offset := defaultUserPageSize, 0
+	var err error
+	if rawLimit != "" {
+		if limit, err = strconv.Atoi(rawLimit); err != nil || limit <= 0 || limit > maxUserPageSize {
+			h.writeError(w, "invalid_request", "limit must be between 1 and "+strconv.Itoa(maxUserPageSize), http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	if rawOffset != "" {
+		if offset, err = strconv.Atoi(rawOffset); err != nil || offset < 0 {
+			h.writeError(w, "invalid_request", "offset must not be negative", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+// decode reads a JSON request body, writing the error if it is malformed
+func (h *AdminHandler) decode(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		h.writeError(w, "invalid_request", "Request body must be JSON", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// loadClient retrieves a registered client, writing the error if it does not exist
+func (h *AdminHandler) loadClient(ctx context.Context, w http.ResponseWriter, clientID string) (*storage.OAuthClient, bool) {
+	client, err := h.clientRegistry.FindClient(ctx, clientID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to retrieve client", http.StatusInternalServerError)
+		return nil, false
+	}
+	if client == nil {
+		h.writeError(w, "not_found", "Client not found", http.StatusNotFound)
+		return nil, false
+	}
+	return client, true
+}
+
+// loadUser retrieves a user by ID, writing the error if it does not exist
+func (h *AdminHandler) loadUser(ctx context.Context, w http.ResponseWriter, userID string) (*storage.User, bool) {
+	target, err := h.userAuth.GetUser(ctx, userID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to retrieve user", http.StatusInternalServerError)
+		return nil, false
+	}
+	if target == nil {
+		h.writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return target, true
+}
+
+// writeClientError maps client registry errors to responses
+func (h *AdminHandler) writeClientError(w http.ResponseWriter, err error) {
+	if errors.Is(err, oauth.ErrInvalidClientMetadata) {
+		h.writeError(w, "invalid_client_metadata", err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeError(w, "server_error", "Failed to save client", http.StatusInternalServerError)
+}
+
+// toClient converts the admin API view to a client; the secret and timestamps are not taken over
+func (c *adminClient) toClient() *storage.OAuthClient {
+	return &storage.OAuthClient{
+		ClientID:                          c.ClientID,
+		ClientName:                        c.ClientName,
+		ClientType:                        c.ClientType,
+		RedirectURIs:                      pq.StringArray(c.RedirectURIs),
+		PostLogoutRedirectURIs:            pq.StringArray(c.PostLogoutRedirectURIs),
+		GrantTypes:                        pq.StringArray(c.GrantTypes),
+		Scope:                             c.Scope,
+		RequireMFA:                        c.RequireMFA,
+		FirstParty:                        c.FirstParty,
+		SubjectType:                       c.SubjectType,
+		SectorIdentifierURI:               c.SectorIdentifierURI,
+		BackchannelLogoutURI:              c.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  c.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             c.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: c.FrontchannelLogoutSessionRequired,
+		AccessTokenLifetime:               c.AccessTokenLifetime,
+		RefreshTokenLifetime:              c.RefreshTokenLifetime,
+		RefreshTokenIdleLifetime:          c.RefreshTokenIdleLifetime,
+		IDTokenLifetime:                   c.IDTokenLifetime,
+		AuthCodeLifetime:                  c.AuthCodeLifetime,
+		AccessTokenFormat:                 c.AccessTokenFormat,
+		ResourceServer:                    c.ResourceServer,
+		Audiences:                         pq.StringArray(c.Audiences),
+		IntrospectionEncryptionKey:        c.IntrospectionEncryptionKey,
+		AuthorizationDetailsTypes:         pq.StringArray(c.AuthorizationDetailsTypes),
+	}
+}
+
+// toAdminClient converts a client to its admin API view without the secret
+func toAdminClient(client *storage.OAuthClient) adminClient {
+	redirectURIs := []string(client.RedirectURIs)
+	if redirectURIs == nil {
+		redirectURIs = []string{}
+	}
+	grantTypes := []string(client.GrantTypes)
+	if grantTypes == nil {
+		grantTypes = []string{}
+	}
+
+	return adminClient{
+		ClientID:                          client.ClientID,
+		ClientName:                        client.ClientName,
+		ClientType:                        client.ClientType,
+		RedirectURIs:                      redirectURIs,
+		PostLogoutRedirectURIs:            client.PostLogoutRedirectURIs,
+		GrantTypes:                        grantTypes,
+		Scope:                             client.Scope,
+		RequireMFA:                        client.RequireMFA,
+		FirstParty:                        client.FirstParty,
+		SubjectType:                       client.SubjectType,
+		SectorIdentifierURI:               client.SectorIdentifierURI,
+		BackchannelLogoutURI:              client.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  client.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             client.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: client.FrontchannelLogoutSessionRequired,
+		AccessTokenLifetime:               client.AccessTokenLifetime,
+		RefreshTokenLifetime:              client.RefreshTokenLifetime,
+		RefreshTokenIdleLifetime:          client.RefreshTokenIdleLifetime,
+		IDTokenLifetime:                   client.IDTokenLifetime,
+		AuthCodeLifetime:                  client.AuthCodeLifetime,
+		AccessTokenFormat:                 client.AccessTokenFormat,
+		ResourceServer:                    client.ResourceServer,
+		Audiences:                         client.Audiences,
+		IntrospectionEncryptionKey:        client.IntrospectionEncryptionKey,
+		AuthorizationDetailsTypes:         client.AuthorizationDetailsTypes,
+		CreatedAt:                         client.CreatedAt.Unix(),
+		UpdatedAt:                         client.UpdatedAt.Unix(),
+	}
+}
+
+// toAdminUser converts a user to its admin API view
+func toAdminUser(u *storage.User) adminUser {
+	return adminUser{
+		ID:            u.ID,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Name:          u.Name,
+		Picture:       u.Picture,
+		Disabled:      u.Disabled,
+		CreatedAt:     u.CreatedAt.Unix(),
+		UpdatedAt:     u.UpdatedAt.Unix(),
+	}
+}
+
+// writeJSON writes a JSON response that must not be cached
+func (h *AdminHandler) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error response
+func (h *AdminHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
@@ -1,18 +1,25 @@
 package handlers
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"oauth-golang/internal/config"
 	"oauth-golang/internal/models"
 	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/user"
 	"oauth-golang/pkg/utils"
 )
 
@@ -21,27 +28,69 @@ import (
 type AuthorizeHandler struct {
 	config          *config.Config
 	clientRegistry  *oauth.ClientRegistry
+	scopeRegistry   *oauth.ScopeRegistry
+	resources       *oauth.ResourceRegistry
+	detailsRegistry *oauth.AuthorizationDetailsRegistry
 	authCodeService *oauth.AuthCodeService
 	pkceValidator   *oauth.PKCEValidator
+	userAuth        *user.AuthService
+	mfaService      *user.MFAService
+	webauthnService *user.WebAuthnService
+	consentService  *oauth.ConsentService
+	sessionService  *oauth.SessionService
 }
 
 func NewAuthorizeHandler(
 	cfg *config.Config,
 	clientRegistry *oauth.ClientRegistry,
+	scopeRegistry *oauth.ScopeRegistry,
+	resources *oauth.ResourceRegistry,
+	detailsRegistry *oauth.AuthorizationDetailsRegistry,
 	authCodeService *oauth.AuthCodeService,
 	pkceValidator *oauth.PKCEValidator,
+	userAuth *user.AuthService,
+	mfaService *user.MFAService,
+	webauthnService *user.WebAuthnService,
+	consentService *oauth.ConsentService,
+	sessionService *oauth.SessionService,
 ) *AuthorizeHandler {
 	return &AuthorizeHandler{
 		config:          cfg,
 		clientRegistry:  clientRegistry,
+		scopeRegistry:   scopeRegistry,
+		resources:       resources,
+		detailsRegistry: detailsRegistry,
 		authCodeService: authCodeService,
 		pkceValidator:   pkceValidator,
+		userAuth:        userAuth,
+		mfaService:      mfaService,
+		webauthnService: webauthnService,
+		consentService:  consentService,
+		sessionService:  sessionService,
 	}
 }
 
+// authorizationRequest is a validated authorization request, sent to /authorize or pushed to /par
+type authorizationRequest struct {
+	session   *oauth.AuthSession
+	maxAge    int // -1 when unset
+	loginHint string
+}
+
+// authorizationError is why an authorization request was refused
+// Errors found before the redirect URI is validated must not be sent to it (redirect is false)
+type authorizationError struct {
+	code        string
+	description string
+	redirect    bool
+	status      int // used when the error is not redirected
+}
+
 // Handle processes the /authorize endpoint
-// API INPUT: Query params (client_id, redirect_uri, response_type, state, code_challenge, code_challenge_method)
-// OUTPUT: Redirects user to Google OAuth provider
+// API INPUT: Query params (client_id, redirect_uri, response_type, state, code_challenge, code_challenge_method,
+// scope, prompt, max_age, login_hint, nonce, resource, authorization_details), or client_id and the
+// request_uri of a request pushed to /par (RFC 9126)
+// OUTPUT: Reuses the SSO session when possible, otherwise redirects user to Google OAuth provider
 func (h *AuthorizeHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -49,38 +98,103 @@ func (h *AuthorizeHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse query parameters (API INPUT)
-	clientID := r.URL.Query().Get("client_id")
-	redirectURI := r.URL.Query().Get("redirect_uri")
-	responseType := r.URL.Query().Get("response_type")
-	state := r.URL.Query().Get("state")
-	codeChallenge := r.URL.Query().Get("code_challenge")
-	codeChallengeMethod := r.URL.Query().Get("code_challenge_method")
-	scope := r.URL.Query().Get("scope")
+	params := r.URL.Query()
+
+	// A pushed request replaces the query parameters; it can be used once, by the client that pushed it
+	if requestURI := params.Get("request_uri"); requestURI != "" {
+		pushed := h.authCodeService.TakePushedRequest(requestURI, params.Get("client_id"))
+		if pushed == nil {
+			http.Error(w, "Invalid or expired request_uri", http.StatusBadRequest)
+			return
+		}
+		params = pushed.Params
+	}
+
+	request, authErr := h.parseAuthorizationRequest(r.Context(), params)
+	if authErr != nil {
+		if authErr.redirect {
+			http.Redirect(w, r, authErrorRedirectURL(params.Get("redirect_uri"), request.session.State, authErr.code, authErr.description), http.StatusFound)
+			return
+		}
+		http.Error(w, authErr.description, authErr.status)
+		return
+	}
+	authSession := request.session
+
+	// Single sign-on: reuse our own login session when it satisfies the request (DB interaction via sessionService)
+	loginSession, err := h.reusableSession(r, authSession.Prompt, request.maxAge, request.loginHint)
+	if err != nil {
+		http.Error(w, "Failed to load session", http.StatusInternalServerError)
+		return
+	}
+	if loginSession != nil {
+		h.resumeSession(w, r, authSession, loginSession)
+		return
+	}
+
+	// Silent authentication failed: the user has to interact
+	if oauth.HasPrompt(authSession.Prompt, "none") {
+		http.Redirect(w, r, authErrorRedirectURL(authSession.RedirectURI, authSession.State, "login_required", "The user is not signed in"), http.StatusFound)
+		return
+	}
+
+	// Store PKCE challenge and redirect info temporarily
+	// In production, use Redis or database with TTL
+	sessionID := utils.GenerateRandomString(32)
+	h.authCodeService.StoreSession(sessionID, authSession)
+
+	// Build Google OAuth URL (INTERACTION WITH GOOGLE OAUTH PROVIDER)
+	// Google is only asked for the identity scopes; the granted scope stays on our session.
+	// prompt=login and max_age both demand a fresh sign-in, so Google must not reuse its own session
+	reauth := oauth.HasPrompt(authSession.Prompt, "login") || request.maxAge >= 0
+	googleAuthURL := buildGoogleAuthURL(h.config, sessionID, reauth, request.loginHint)
+
+	// Offer passwordless sign-in with a passkey, keeping Google as a fallback
+	if r.URL.Query().Get("idp") == "passkey" {
+		renderPasskeyLogin(w, passkeyLoginView{SessionID: sessionID, GoogleURL: googleAuthURL})
+		return
+	}
+
+	// Redirect user to Google login
+	http.Redirect(w, r, googleAuthURL, http.StatusFound)
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization request
+// On errors that can be redirected, the returned request still carries the session's state
+// DB INTERACTION: Loads the client, scopes and protected resources via the registries
+func (h *AuthorizeHandler) parseAuthorizationRequest(ctx context.Context, params url.Values) (*authorizationRequest, *authorizationError) {
+	clientID := params.Get("client_id")
+	redirectURI := params.Get("redirect_uri")
+	responseType := params.Get("response_type")
+	state := params.Get("state")
+	codeChallenge := params.Get("code_challenge")
+	codeChallengeMethod := params.Get("code_challenge_method")
+	scope := params.Get("scope")
+	prompt := params.Get("prompt")
+	maxAgeParam := params.Get("max_age")
+	requestedResources := params["resource"]
+	authorizationDetails := params.Get("authorization_details")
 
 	// Validate request parameters
 	if clientID == "" || redirectURI == "" || responseType != "code" {
-		http.Error(w, "Invalid request parameters", http.StatusBadRequest)
-		return
+		return nil, &authorizationError{code: "invalid_request", description: "Invalid request parameters", status: http.StatusBadRequest}
 	}
 
 	// Validate client (DB interaction via clientRegistry)
-	client, err := h.clientRegistry.GetClient(clientID)
+	client, err := h.clientRegistry.GetClient(ctx, clientID)
 	if err != nil || client == nil {
-		http.Error(w, "Invalid client_id", http.StatusBadRequest)
-		return
+		return nil, &authorizationError{code: "invalid_request", description: "Invalid client_id", status: http.StatusBadRequest}
 	}
 
 	// Validate redirect URI
 	if !client.ValidateRedirectURI(redirectURI) {
-		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
-		return
+		return nil, &authorizationError{code: "invalid_request", description: "Invalid redirect_uri", status: http.StatusBadRequest}
 	}
 
 	// Validate PKCE parameters
 	if codeChallenge != "" {
 		if !h.pkceValidator.ValidateCodeChallenge(codeChallenge, codeChallengeMethod) {
-			http.Error(w, "Invalid PKCE parameters", http.StatusBadRequest)
-			return
+			return nil, &authorizationError{code: "invalid_request", description: "Invalid PKCE parameters", status: http.StatusBadRequest}
 		}
 	}
 
@@ -89,24 +203,59 @@ func (h *AuthorizeHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		state = utils.GenerateRandomString(32)
 	}
 
-	// Store PKCE challenge and redirect info temporarily
-	// In production, use Redis or database with TTL
-	sessionID := utils.GenerateRandomString(32)
-	h.authCodeService.StoreSession(sessionID, &oauth.AuthSession{
-		ClientID:            clientID,
-		RedirectURI:         redirectURI,
-		State:               state,
-		CodeChallenge:       codeChallenge,
-		CodeChallengeMethod: codeChallengeMethod,
-		Scope:               scope,
-		CreatedAt:           time.Now(),
-	})
+	request := &authorizationRequest{
+		session: &oauth.AuthSession{
+			ClientID:            clientID,
+			RedirectURI:         redirectURI,
+			State:               state,
+			CodeChallenge:       codeChallenge,
+			CodeChallengeMethod: codeChallengeMethod,
+			Prompt:              prompt,
+			Nonce:               params.Get("nonce"),
+			CreatedAt:           time.Now(),
+		},
+		maxAge:    -1,
+		loginHint: params.Get("login_hint"),
+	}
 
-	// Build Google OAuth URL (INTERACTION WITH GOOGLE OAUTH PROVIDER)
-	googleAuthURL := h.buildGoogleAuthURL(sessionID, scope)
+	// Only scopes registered and allowed for this client are granted (DB interaction via scopeRegistry)
+	request.session.Scope, err = h.scopeRegistry.ResolveScope(ctx, client, scope)
+	if errors.Is(err, oauth.ErrInvalidScope) {
+		return request, &authorizationError{code: "invalid_scope", description: err.Error(), redirect: true}
+	}
+	if err != nil {
+		return request, &authorizationError{code: "server_error", description: "Failed to resolve scope", status: http.StatusInternalServerError}
+	}
 
-	// Redirect user to Google login
-	http.Redirect(w, r, googleAuthURL, http.StatusFound)
+	// Resource indicators must name registered protected resources (DB interaction via resources)
+	request.session.Resources, err = h.resources.ResolveResources(ctx, requestedResources)
+	if errors.Is(err, oauth.ErrInvalidTarget) {
+		return request, &authorizationError{code: "invalid_target", description: err.Error(), redirect: true}
+	}
+	if err != nil {
+		return request, &authorizationError{code: "server_error", description: "Failed to resolve resource", status: http.StatusInternalServerError}
+	}
+
+	// Authorization details must be of types registered and allowed for this client (RFC 9396 §5)
+	request.session.AuthorizationDetails, err = h.detailsRegistry.Parse(client, authorizationDetails)
+	if err != nil {
+		return request, &authorizationError{code: "invalid_authorization_details", description: err.Error(), redirect: true}
+	}
+
+	// prompt=none cannot be combined with other values (OIDC Core §3.1.2.1)
+	if oauth.HasPrompt(prompt, "none") && len(strings.Fields(prompt)) > 1 {
+		return request, &authorizationError{code: "invalid_request", description: "prompt=none cannot be combined with other values", redirect: true}
+	}
+
+	// max_age is the allowable elapsed time in seconds since the user last authenticated
+	if maxAgeParam != "" {
+		request.maxAge, err = strconv.Atoi(maxAgeParam)
+		if err != nil || request.maxAge < 0 {
+			return request, &authorizationError{code: "invalid_request", description: "max_age must be a non-negative integer", redirect: true}
+		}
+	}
+
+	return request, nil
 }
 
 // HandleCallback processes the callback from Google OAuth
@@ -140,61 +289,270 @@ func (h *AuthorizeHandler) HandleCallback(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// A link started elsewhere must not attach this browser's Google account to another user
+	if session.LinkUserID != "" && !h.linkStartedHere(r, session) {
+		h.authCodeService.DeleteSession(stateParam)
+		http.Error(w, "The identity link was started in another browser session", http.StatusForbidden)
+		return
+	}
+
 	// Exchange code for access token with Google (GOOGLE OAUTH PROVIDER INTERACTION)
-	googleToken, err := h.exchangeGoogleCode(code)
+	googleToken, err := h.exchangeGoogleCode(r.Context(), code)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to exchange code: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Get user info from Google (GOOGLE OAUTH PROVIDER INTERACTION)
-	userInfo, err := h.getGoogleUserInfo(googleToken.AccessToken)
+	userInfo, err := h.getGoogleUserInfo(r.Context(), googleToken.AccessToken)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get user info: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Generate authorization code for client
-	authCode := utils.GenerateRandomString(32)
-
-	// Store authorization code with user info (OUTPUT TO DB via authCodeService)
-	h.authCodeService.StoreAuthCode(authCode, &oauth.AuthCode{
-		Code:                authCode,
-		ClientID:            session.ClientID,
-		RedirectURI:         session.RedirectURI,
-		UserID:              userInfo.Email, // Using email as user ID
-		CodeChallenge:       session.CodeChallenge,
-		CodeChallengeMethod: session.CodeChallengeMethod,
-		Scope:               session.Scope,
-		ExpiresAt:           time.Now().Add(10 * time.Minute),
-		UserInfo:            userInfo,
+	// Get the user's Workspace groups (GOOGLE OAUTH PROVIDER INTERACTION)
+	// On failure the groups stay nil, which leaves the user's mirrored memberships unchanged
+	if h.config.GoogleWorkspaceGroups {
+		groups, err := h.getGoogleGroups(r.Context(), googleToken.AccessToken, userInfo.Email)
+		if err != nil {
+			log.Printf("Warning: failed to get Workspace groups for %s: %v", userInfo.Email, err)
+		} else {
+			userInfo.Groups = groups
+		}
+	}
+
+	// The upstream login is done; the session cannot be replayed
+	h.authCodeService.DeleteSession(stateParam)
+
+	// Account linking: attach this identity to the signed-in user instead of logging in
+	if session.LinkUserID != "" {
+		h.completeLink(r.Context(), w, session.LinkUserID, userInfo)
+		return
+	}
+
+	// Create or update user in database (OUTPUT TO DB via userAuth)
+	localUser, err := h.userAuth.CreateOrUpdateUser(r.Context(), userInfo)
+	if errors.Is(err, user.ErrEmailConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, user.ErrUserDisabled) || errors.Is(err, user.ErrIdentityUnlinked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	// Decide whether a second factor is required before issuing a code
+	mfaRequired, err := h.requiresMFA(r.Context(), session.ClientID, localUser.ID)
+	if err != nil {
+		http.Error(w, "Failed to check MFA policy", http.StatusInternalServerError)
+		return
+	}
+
+	if mfaRequired {
+		challengeID := utils.GenerateRandomString(32)
+		h.authCodeService.StoreMFAChallenge(challengeID, &oauth.MFAChallenge{
+			Session:   session,
+			UserID:    localUser.ID,
+			UserInfo:  userInfo,
+			CreatedAt: time.Now(),
+		})
+		http.Redirect(w, r, "/mfa/challenge?challenge="+url.QueryEscape(challengeID), http.StatusFound)
+		return
+	}
+
+	amr := []string{"fed"}
+
+	// Establish the SSO session so later /authorize calls skip the upstream login
+	loginSession, err := h.sessionService.Start(w, r, localUser.ID, amr, oauth.ACRSingleFactor)
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+
+	// Ask for consent if needed, then redirect back to client application with a code
+	redirectURL, err := completeAuthorization(r.Context(), h.authCodeService, h.consentService, h.scopeRegistry, &oauth.PendingConsent{
+		Session:   session,
+		UserID:    localUser.ID,
+		UserInfo:  userInfo,
+		AMR:       amr,
+		ACR:       oauth.ACRSingleFactor,
+		SessionID: loginSession.ID,
+		AuthTime:  loginSession.AuthTime,
 	})
+	if err != nil {
+		http.Error(w, "Failed to complete authorization", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// reusableSession returns the SSO session if it can satisfy this request without user interaction
+// prompt=login, an authentication older than max_age, or a login_hint naming someone else all rule it out
+func (h *AuthorizeHandler) reusableSession(r *http.Request, prompt string, maxAge int, loginHint string) (*storage.LoginSession, error) {
+	if oauth.HasPrompt(prompt, "login") {
+		return nil, nil
+	}
+
+	loginSession, err := h.sessionService.Current(r)
+	if err != nil || loginSession == nil {
+		return nil, err
+	}
+
+	if maxAge >= 0 && time.Since(loginSession.AuthTime) > time.Duration(maxAge)*time.Second {
+		return nil, nil
+	}
+
+	if loginHint != "" {
+		localUser, err := h.userAuth.GetUser(r.Context(), loginSession.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if localUser == nil || !strings.EqualFold(localUser.Email, loginHint) {
+			return nil, nil
+		}
+	}
+
+	return loginSession, nil
+}
+
+// resumeSession continues an authorization request for a user who is already signed in
+// The session's second factor is reused; a client needing MFA the session lacks gets a step-up challenge
+func (h *AuthorizeHandler) resumeSession(w http.ResponseWriter, r *http.Request, session *oauth.AuthSession, loginSession *storage.LoginSession) {
+	mfaRequired, err := h.requiresMFA(r.Context(), session.ClientID, loginSession.UserID)
+	if err != nil {
+		http.Error(w, "Failed to check MFA policy", http.StatusInternalServerError)
+		return
+	}
+
+	if mfaRequired && loginSession.ACR != oauth.ACRMultiFactor {
+		if oauth.HasPrompt(session.Prompt, "none") {
+			http.Redirect(w, r, authErrorRedirectURL(session.RedirectURI, session.State, "interaction_required", "A second factor is required"), http.StatusFound)
+			return
+		}
+
+		challengeID := utils.GenerateRandomString(32)
+		h.authCodeService.StoreMFAChallenge(challengeID, &oauth.MFAChallenge{
+			Session:   session,
+			UserID:    loginSession.UserID,
+			CreatedAt: time.Now(),
+		})
+		http.Redirect(w, r, "/mfa/challenge?challenge="+url.QueryEscape(challengeID), http.StatusFound)
+		return
+	}
+
+	redirectURL, err := completeAuthorization(r.Context(), h.authCodeService, h.consentService, h.scopeRegistry, &oauth.PendingConsent{
+		Session:   session,
+		UserID:    loginSession.UserID,
+		AMR:       loginSession.AMR,
+		ACR:       loginSession.ACR,
+		SessionID: loginSession.ID,
+		AuthTime:  loginSession.AuthTime,
+	})
+	if err != nil {
+		http.Error(w, "Failed to complete authorization", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// requiresMFA reports whether the client policy or the user's own authenticators demand a second factor
+func (h *AuthorizeHandler) requiresMFA(ctx context.Context, clientID, userID string) (bool, error) {
+	client, err := h.clientRegistry.GetClient(ctx, clientID)
+	if err != nil {
+		return false, err
+	}
+	if client != nil && client.RequireMFA {
+		return true, nil
+	}
+
+	enrolled, err := h.mfaService.IsEnrolled(ctx, userID)
+	if err != nil || enrolled {
+		return enrolled, err
+	}
+	return h.webauthnService.HasCredentials(ctx, userID)
+}
 
-	// Build redirect URL with authorization code
+// redirectWithAuthCode sends the user back to the client with the authorization code and state
+func redirectWithAuthCode(w http.ResponseWriter, r *http.Request, session *oauth.AuthSession, code string) {
+	http.Redirect(w, r, authCodeRedirectURL(session, code), http.StatusFound)
+}
+
+// authCodeRedirectURL builds the client redirect URI carrying the authorization code and state
+func authCodeRedirectURL(session *oauth.AuthSession, code string) string {
 	redirectURL, _ := url.Parse(session.RedirectURI)
 	q := redirectURL.Query()
-	q.Set("code", authCode)
+	q.Set("code", code)
 	q.Set("state", session.State)
 	redirectURL.RawQuery = q.Encode()
+	return redirectURL.String()
+}
 
-	// Redirect back to client application
-	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+// authErrorRedirectURL builds the client redirect URI carrying an OAuth error and state
+func authErrorRedirectURL(redirectURI, state, errorCode, description string) string {
+	redirectURL, _ := url.Parse(redirectURI)
+	q := redirectURL.Query()
+	q.Set("error", errorCode)
+	q.Set("error_description", description)
+	q.Set("state", state)
+	redirectURL.RawQuery = q.Encode()
+	return redirectURL.String()
 }
 
-// buildGoogleAuthURL constructs the Google OAuth authorization URL
-func (h *AuthorizeHandler) buildGoogleAuthURL(state, scope string) string {
-	if scope == "" {
-		scope = "openid email profile"
+// linkStartedHere reports whether the request comes from a browser signed in to the SSO session
+// that started the link flow, as the user it is linking for
+// INPUT FROM DB: Loads the SSO session via sessionService
+func (h *AuthorizeHandler) linkStartedHere(r *http.Request, session *oauth.AuthSession) bool {
+	loginSession, err := h.sessionService.Current(r)
+	if err != nil || loginSession == nil {
+		return false
+	}
+	return loginSession.ID == session.LinkSessionID && loginSession.UserID == session.LinkUserID
+}
+
+// completeLink links the upstream identity to the user who started the link flow
+// OUTPUT TO DB: Inserts identity via userAuth
+func (h *AuthorizeHandler) completeLink(ctx context.Context, w http.ResponseWriter, userID string, userInfo *models.GoogleUserInfo) {
+	identity, err := h.userAuth.LinkIdentity(ctx, userID, userInfo)
+	if errors.Is(err, user.ErrIdentityLinked) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to link identity", http.StatusInternalServerError)
+		return
 	}
 
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	identityLinkedPage.Execute(w, identity)
+}
+
+// buildGoogleAuthURL constructs the Google OAuth authorization URL
+// reauth forces Google to ask the user to sign in again rather than reuse their session;
+// loginHint pre-selects the account when set
+func buildGoogleAuthURL(cfg *config.Config, state string, reauth bool, loginHint string) string {
 	params := url.Values{}
-	params.Set("client_id", h.config.GoogleClientID)
-	params.Set("redirect_uri", h.config.GoogleRedirectURL)
+	params.Set("client_id", cfg.GoogleClientID)
+	params.Set("redirect_uri", cfg.GoogleRedirectURL)
 	params.Set("response_type", "code")
+	scope := oauth.UpstreamScopes
+	if cfg.GoogleWorkspaceGroups {
+		scope += " " + oauth.WorkspaceGroupsScope
+	}
 	params.Set("scope", scope)
 	params.Set("state", state)
-	params.Set("access_type", "offline")
-	params.Set("prompt", "consent")
+	if loginHint != "" {
+		params.Set("login_hint", loginHint)
+	}
+	if reauth {
+		params.Set("prompt", "select_account consent")
+		params.Set("max_age", "0")
+	}
 
 	return "https://accounts.google.com/o/oauth2/v2/auth?" + params.Encode()
 }
@@ -208,8 +566,14 @@ type GoogleTokenResponse struct {
 	IDToken      string `json:"id_token"`
 }
 
+// googleRequestTimeout bounds each call to Google, so a slow upstream fails the login instead of hanging it
+const googleRequestTimeout = 10 * time.Second
+
 // exchangeGoogleCode exchanges authorization code for access token with Google
-func (h *AuthorizeHandler) exchangeGoogleCode(code string) (*GoogleTokenResponse, error) {
+func (h *AuthorizeHandler) exchangeGoogleCode(ctx context.Context, code string) (*GoogleTokenResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+	defer cancel()
+
 	data := url.Values{}
 	data.Set("code", code)
 	data.Set("client_id", h.config.GoogleClientID)
@@ -217,7 +581,13 @@ func (h *AuthorizeHandler) exchangeGoogleCode(code string) (*GoogleTokenResponse
 	data.Set("redirect_uri", h.config.GoogleRedirectURL)
 	data.Set("grant_type", "authorization_code")
 
-	resp, err := http.PostForm("https://oauth2.googleapis.com/token", data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://oauth2.googleapis.com/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -237,8 +607,11 @@ func (h *AuthorizeHandler) exchangeGoogleCode(code string) (*GoogleTokenResponse
 }
 
 // getGoogleUserInfo retrieves user information from Google
-func (h *AuthorizeHandler) getGoogleUserInfo(accessToken string) (*models.GoogleUserInfo, error) {
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
+func (h *AuthorizeHandler) getGoogleUserInfo(ctx context.Context, accessToken string) (*models.GoogleUserInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -264,6 +637,65 @@ func (h *AuthorizeHandler) getGoogleUserInfo(accessToken string) (*models.Google
 	return &userInfo, nil
 }
 
+// googleGroupsResponse is a page of Cloud Identity searchDirectGroups results
+type googleGroupsResponse struct {
+	Memberships []struct {
+		GroupKey struct {
+			ID string `json:"id"`
+		} `json:"groupKey"`
+	} `json:"memberships"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// getGoogleGroups retrieves the emails of the Workspace groups a user is a direct member of
+// The timeout covers all pages together
+func (h *AuthorizeHandler) getGoogleGroups(ctx context.Context, accessToken, email string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+	defer cancel()
+
+	groups := []string{}
+	pageToken := ""
+	for {
+		params := url.Values{}
+		params.Set("query", fmt.Sprintf("member_key_id == '%s'", email))
+		if pageToken != "" {
+			params.Set("pageToken", pageToken)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", "https://cloudidentity.googleapis.com/v1/groups/-/memberships:searchDirectGroups?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("Failed to get groups: %s", string(body))
+		}
+
+		var page googleGroupsResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, membership := range page.Memberships {
+			groups = append(groups, membership.GroupKey.ID)
+		}
+		if page.NextPageToken == "" {
+			return groups, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
 // Helper function to verify code_verifier against code_challenge (for PKCE)
 func verifyCodeChallenge(codeVerifier, codeChallenge, method string) bool {
 	if method == "" || method == "plain" {
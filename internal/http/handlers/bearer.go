@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/user"
+)
+
+// reauthWindow is how recently the access token must have been issued for sensitive account changes
+const reauthWindow = 5 * time.Minute
+
+// bearerError describes why a request's Bearer token could not be resolved to a user
+type bearerError struct {
+	code        string
+	description string
+	status      int
+}
+
+// authenticateBearer resolves the signed-in user from the request's Bearer access token
+// Both JWT and opaque access tokens are accepted, but only when audienced to this service
+// and only while the user is enabled
+// DB INTERACTION: Resolves opaque tokens via tokenService; loads the token subject via userAuth
+func authenticateBearer(r *http.Request, tokenService *oauth.TokenService, userAuth *user.AuthService) (*storage.User, *security.TokenClaims, *bearerError) {
+	accessToken, err := security.ExtractToken(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, nil, &bearerError{"invalid_request", "Missing or invalid Authorization header", http.StatusUnauthorized}
+	}
+
+	claims, err := tokenService.VerifyAccessToken(r.Context(), accessToken)
+	if err != nil {
+		return nil, nil, &bearerError{"invalid_token", "Invalid or expired token", http.StatusUnauthorized}
+	}
+	if !issuedForThisService(claims) {
+		return nil, nil, &bearerError{"invalid_token", "Token was issued for another resource", http.StatusUnauthorized}
+	}
+
+	localUser, err := userAuth.GetUser(r.Context(), claims.Subject)
+	if err != nil {
+		return nil, nil, &bearerError{"server_error", "Failed to retrieve user", http.StatusInternalServerError}
+	}
+	if localUser == nil {
+		return nil, nil, &bearerError{"invalid_token", "User not found", http.StatusUnauthorized}
+	}
+	if localUser.Disabled {
+		return nil, nil, &bearerError{"invalid_token", "User is disabled", http.StatusUnauthorized}
+	}
+
+	return localUser, claims, nil
+}
+
+// authenticateAdmin resolves the signed-in user like authenticateBearer and requires the admin scope
+// and the user's admin role
+// INPUT FROM DB: Checks the user's roles via userAuth
+func authenticateAdmin(r *http.Request, tokenService *oauth.TokenService, userAuth *user.AuthService) (*storage.User, *security.TokenClaims, *bearerError) {
+	localUser, claims, authErr := authenticateBearer(r, tokenService, userAuth)
+	if authErr != nil {
+		return nil, nil, authErr
+	}
+	if !hasScope(claims, oauth.AdminScope) {
+		return nil, nil, &bearerError{"insufficient_scope", "The admin scope is required", http.StatusForbidden}
+	}
+
+	// The scope only says the client may act as an administrator; the user must still be one,
+	// so taking the role away takes effect on tokens already issued
+	isAdmin, err := userAuth.IsAdmin(r.Context(), localUser.ID)
+	if err != nil {
+		return nil, nil, &bearerError{"server_error", "Failed to check roles", http.StatusInternalServerError}
+	}
+	if !isAdmin {
+		return nil, nil, &bearerError{"access_denied", "The admin role is required", http.StatusForbidden}
+	}
+	return localUser, claims, nil
+}
+
+// authenticateStepUp resolves the signed-in user like authenticateBearer for changes to the user's
+// authentication methods: the user must have signed in recently and, once they have a second
+// factor, must have used it for that sign-in
+// action completes the error descriptions, e.g. "register a passkey"
+// INPUT FROM DB: Checks enrolled factors via mfaService and webauthnService
+func authenticateStepUp(
+	r *http.Request,
+	tokenService *oauth.TokenService,
+	userAuth *user.AuthService,
+	mfaService *user.MFAService,
+	webauthnService *user.WebAuthnService,
+	action string,
+) (*storage.User, *security.TokenClaims, *bearerError) {
+	localUser, claims, authErr := authenticateBearer(r, tokenService, userAuth)
+	if authErr != nil {
+		return nil, nil, authErr
+	}
+	if !recentlyAuthenticated(claims) {
+		return nil, nil, &bearerError{"login_required", "Recent authentication is required to " + action, http.StatusForbidden}
+	}
+	if claims.ACR == oauth.ACRMultiFactor {
+		return localUser, claims, nil
+	}
+
+	enrolled, err := mfaService.IsEnrolled(r.Context(), localUser.ID)
+	if err == nil && !enrolled {
+		enrolled, err = webauthnService.HasCredentials(r.Context(), localUser.ID)
+	}
+	if err != nil {
+		return nil, nil, &bearerError{"server_error", "Failed to check second factors", http.StatusInternalServerError}
+	}
+	if enrolled {
+		// RFC 9470: the client must send the user through a multi-factor sign-in first
+		return nil, nil, &bearerError{"insufficient_user_authentication", "Sign in with your second factor to " + action, http.StatusUnauthorized}
+	}
+	return localUser, claims, nil
+}
+
+// issuedForThisService reports whether an access token is meant for our own APIs (RFC 9068 §4)
+// Tokens requested for another resource must not be accepted here
+func issuedForThisService(claims *security.TokenClaims) bool {
+	return claims.Audience == security.AccessTokenAudience
+}
+
+// recentlyAuthenticated reports whether the user signed in within the re-authentication window
+// auth_time is used rather than iat, since refreshing a token does not re-authenticate the user
+func recentlyAuthenticated(claims *security.TokenClaims) bool {
+	if claims.AuthTime.IsZero() {
+		return false
+	}
+	return time.Since(claims.AuthTime) <= reauthWindow
+}
+
+// hasScope reports whether the access token was granted the given scope
+func hasScope(claims *security.TokenClaims, scope string) bool {
+	for _, granted := range strings.Fields(claims.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
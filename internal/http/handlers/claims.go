@@ -0,0 +1,23 @@
+package handlers
+
+import "encoding/json"
+
+// marshalWithClaims encodes a response and adds custom claims from the claims pipeline
+// Members the response already has are never replaced
+func marshalWithClaims(response interface{}, extra map[string]interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(response)
+	if err != nil || len(extra) == 0 {
+		return encoded, err
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(encoded, &merged); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, exists := merged[name]; !exists {
+			merged[name] = value
+		}
+	}
+	return json.Marshal(merged)
+}
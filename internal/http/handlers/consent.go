@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/user"
+	"oauth-golang/pkg/utils"
+)
+
+// ConsentHandler handles the consent screen and the user's list of granted consents
+// API INPUT: Receives the user's allow/deny decision and account management requests
+type ConsentHandler struct {
+	authCodeService *oauth.AuthCodeService
+	consentService  *oauth.ConsentService
+	clientRegistry  *oauth.ClientRegistry
+	scopeRegistry   *oauth.ScopeRegistry
+	detailsRegistry *oauth.AuthorizationDetailsRegistry
+	userAuth        *user.AuthService
+	tokenService    *oauth.TokenService
+}
+
+func NewConsentHandler(
+	authCodeService *oauth.AuthCodeService,
+	consentService *oauth.ConsentService,
+	clientRegistry *oauth.ClientRegistry,
+	scopeRegistry *oauth.ScopeRegistry,
+	detailsRegistry *oauth.AuthorizationDetailsRegistry,
+	userAuth *user.AuthService,
+	tokenService *oauth.TokenService,
+) *ConsentHandler {
+	return &ConsentHandler{
+		authCodeService: authCodeService,
+		consentService:  consentService,
+		clientRegistry:  clientRegistry,
+		scopeRegistry:   scopeRegistry,
+		detailsRegistry: detailsRegistry,
+		userAuth:        userAuth,
+		tokenService:    tokenService,
+	}
+}
+
+// consentPage asks the user to approve the scopes a client requested
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Authorize {{.ClientName}}</title></head>
+<body>
+  <h1>{{.ClientName}} wants to access your account</h1>
+  {{if .Scopes}}
+  <p>This will allow {{.ClientName}} to:</p>
+  <ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+  {{end}}
+  {{if .Details}}
+  <p>{{.ClientName}} is also asking for permission to:</p>
+  <ul>{{range .Details}}<li>{{.}}</li>{{end}}</ul>
+  {{end}}
+  <form method="POST" action="/consent">
+    <input type="hidden" name="consent" value="{{.ConsentID}}">
+    <button type="submit" name="decision" value="allow">Allow</button>
+    <button type="submit" name="decision" value="deny">Deny</button>
+  </form>
+</body>
+</html>`))
+
+type consentView struct {
+	ConsentID  string
+	ClientName string
+	Scopes     []string
+	Details    []string // one line per authorization detail (RFC 9396)
+}
+
+// consentResponse is the public view of a consent grant
+type consentResponse struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name,omitempty"`
+	Scopes     []string `json:"scopes"`
+	GrantedAt  int64    `json:"granted_at"`
+	UpdatedAt  int64    `json:"updated_at"`
+}
+
+// completeAuthorization finishes a login once the user is fully authenticated
+// It returns the client redirect carrying a new authorization code, or the consent screen
+// URL when the user still has to approve the client
+// Scopes bound to a role the user does not hold are dropped first; if none remain the client gets access_denied
+func completeAuthorization(
+	ctx context.Context,
+	authCodeService *oauth.AuthCodeService,
+	consentService *oauth.ConsentService,
+	scopeRegistry *oauth.ScopeRegistry,
+	pending *oauth.PendingConsent,
+) (string, error) {
+	scope, err := scopeRegistry.RestrictToUser(ctx, pending.Session.Scope, pending.UserID)
+	if err != nil {
+		return "", err
+	}
+	if scope == "" {
+		return authErrorRedirectURL(pending.Session.RedirectURI, pending.Session.State, "access_denied", "The requested scopes require a role the user does not hold"), nil
+	}
+	pending.Session.Scope = scope
+
+	needsConsent, err := consentService.RequiresConsent(ctx, pending.Session, pending.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	// Silent authentication cannot show the consent screen (OIDC Core §3.1.2.6)
+	if needsConsent && oauth.HasPrompt(pending.Session.Prompt, "none") {
+		return authErrorRedirectURL(pending.Session.RedirectURI, pending.Session.State, "consent_required", "The user has not approved this client"), nil
+	}
+
+	if needsConsent {
+		consentID := utils.GenerateRandomString(32)
+		pending.CreatedAt = time.Now()
+		authCodeService.StorePendingConsent(consentID, pending)
+		return "/consent?consent=" + url.QueryEscape(consentID), nil
+	}
+
+	// Store authorization code with user info (OUTPUT TO DB via authCodeService)
+	code, err := authCodeService.IssueAuthCode(ctx, pending)
+	if err != nil {
+		return "", err
+	}
+	return authCodeRedirectURL(pending.Session, code), nil
+}
+
+// HandleConsent processes the /consent endpoint
+// API INPUT: GET renders the consent screen; POST form with consent ID and decision (allow/deny)
+// OUTPUT: Redirects back to the client with an authorization code or access_denied
+func (h *ConsentHandler) HandleConsent(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		consentID := r.URL.Query().Get("consent")
+		pending := h.authCodeService.GetPendingConsent(consentID)
+		if pending == nil {
+			http.Error(w, "Invalid or expired consent request", http.StatusBadRequest)
+			return
+		}
+
+		client, err := h.clientRegistry.GetClient(r.Context(), pending.Session.ClientID)
+		if err != nil || client == nil {
+			http.Error(w, "Invalid client_id", http.StatusBadRequest)
+			return
+		}
+
+		scopes, err := h.scopeRegistry.DescribeScope(r.Context(), pending.Session.Scope)
+		if err != nil {
+			http.Error(w, "Failed to load scopes", http.StatusInternalServerError)
+			return
+		}
+
+		view := consentView{
+			ConsentID:  consentID,
+			ClientName: client.ClientName,
+			Scopes:     scopes,
+			Details:    h.detailsRegistry.Describe(pending.Session.AuthorizationDetails),
+		}
+		if view.ClientName == "" {
+			view.ClientName = client.ClientID
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		// Clickjacking protection: the consent buttons must not be framed by another site
+		w.Header().Set("X-Frame-Options", "DENY")
+		consentPage.Execute(w, view)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		consentID := r.FormValue("consent")
+		pending := h.authCodeService.GetPendingConsent(consentID)
+		if pending == nil {
+			http.Error(w, "Invalid or expired consent request", http.StatusBadRequest)
+			return
+		}
+		h.authCodeService.DeletePendingConsent(consentID)
+
+		if r.FormValue("decision") != "allow" {
+			http.Redirect(w, r, authErrorRedirectURL(pending.Session.RedirectURI, pending.Session.State, "access_denied", "The user denied the request"), http.StatusFound)
+			return
+		}
+
+		// Remember the decision (OUTPUT TO DB via consentService)
+		if err := h.consentService.GrantConsent(r.Context(), pending.UserID, pending.Session.ClientID, pending.Session.Scope); err != nil {
+			http.Error(w, "Failed to save consent", http.StatusInternalServerError)
+			return
+		}
+
+		code, err := h.authCodeService.IssueAuthCode(r.Context(), pending)
+		if err != nil {
+			http.Error(w, "Failed to issue authorization code", http.StatusInternalServerError)
+			return
+		}
+		redirectWithAuthCode(w, r, pending.Session, code)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleConsents processes the /account/consents endpoint
+// API INPUT: Bearer access token; DELETE takes a client_id query param
+// API OUTPUT: The clients the user has granted access to
+func (h *ConsentHandler) HandleConsents(w http.ResponseWriter, r *http.Request) {
+	localUser, _, authErr := authenticateBearer(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		grants, err := h.consentService.ListGrants(r.Context(), localUser.ID)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list consents", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]consentResponse, 0, len(grants))
+		for _, grant := range grants {
+			item := consentResponse{
+				ClientID:  grant.ClientID,
+				Scopes:    grant.Scopes,
+				GrantedAt: grant.CreatedAt.Unix(),
+				UpdatedAt: grant.UpdatedAt.Unix(),
+			}
+			if client, err := h.clientRegistry.GetClient(r.Context(), grant.ClientID); err == nil && client != nil {
+				item.ClientName = client.ClientName
+			}
+			response = append(response, item)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	case http.MethodDelete:
+		// Revoking consent also revokes the refresh tokens the client holds for this user
+		if err := h.consentService.RevokeConsent(r.Context(), localUser.ID, r.URL.Query().Get("client_id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeError writes an error response
+func (h *ConsentHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
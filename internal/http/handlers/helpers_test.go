@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+	"oauth-golang/internal/user"
+)
+
+// testServices are the services NewRouter builds, over seeded in-memory repositories
+type testServices struct {
+	cfg            *config.Config
+	repos          *storage.Repositories
+	signingKey     *security.SigningKey
+	jwtService     *security.JWTService
+	clientRegistry *oauth.ClientRegistry
+	subjectService *oauth.SubjectService
+	claimsService  *oauth.ClaimsService
+	tokenService   *oauth.TokenService
+	scopeRegistry  *oauth.ScopeRegistry
+	authCodes      *oauth.AuthCodeService
+	details        *oauth.AuthorizationDetailsRegistry
+	sessionService *oauth.SessionService
+	consentService *oauth.ConsentService
+	userAuth       *user.AuthService
+	mfaService     *user.MFAService
+	webauthn       *user.WebAuthnService
+}
+
+// newTestServices builds the services with a user "user-1" and two confidential clients:
+// "public-app" (public subjects) and "pairwise-app" (pairwise subjects), both with secret "secret"
+func newTestServices(t *testing.T) *testServices {
+	t.Helper()
+
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	storage.Seed(ctx, repos)
+
+	if err := repos.Users.CreateUser(ctx, &storage.User{
+		ID: "user-1", Email: "user@example.com", EmailVerified: true, Name: "Test User",
+	}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, client := range []*storage.OAuthClient{
+		{ClientID: "public-app", ClientSecret: "secret", ClientType: "confidential", Scope: "openid profile email",
+			SubjectType: "public", RedirectURIs: pq.StringArray{"https://public.example.com/callback"},
+			PostLogoutRedirectURIs: pq.StringArray{"https://public.example.com/signed-out"}},
+		{ClientID: "pairwise-app", ClientSecret: "secret", ClientType: "confidential", Scope: "openid profile email",
+			SubjectType: "pairwise", RedirectURIs: pq.StringArray{"https://pairwise.example.com/callback"}},
+	} {
+		if err := repos.Clients.CreateClient(ctx, client); err != nil {
+			t.Fatalf("CreateClient: %v", err)
+		}
+	}
+
+	signingKey, err := security.LoadSigningKey("")
+	if err != nil {
+		t.Fatalf("LoadSigningKey: %v", err)
+	}
+	cfg := &config.Config{
+		Issuer:            "http://localhost:8080",
+		AccessTokenTTL:    time.Hour,
+		RefreshTokenTTL:   24 * time.Hour,
+		IDTokenTTL:        time.Hour,
+		AuthCodeTTL:       10 * time.Minute,
+		AccessTokenFormat: "jwt",
+		PairwiseSalt:      "handlers-test-salt",
+		SessionSecret:     "handlers-test-session",
+		SessionTTL:        time.Hour,
+		MFAIssuer:         "Handlers Test",
+		WebAuthnRPID:      "localhost",
+		WebAuthnRPOrigins: []string{"http://localhost:8080"},
+	}
+
+	s := &testServices{
+		cfg:            cfg,
+		repos:          repos,
+		signingKey:     signingKey,
+		jwtService:     security.NewJWTService(cfg.Issuer, signingKey),
+		clientRegistry: oauth.NewClientRegistry(repos.Clients),
+		subjectService: oauth.NewSubjectService(cfg.PairwiseSalt),
+		claimsService:  oauth.NewClaimsService(repos.ClaimRules),
+	}
+	policies := oauth.NewTokenPolicies(cfg, s.clientRegistry)
+	s.tokenService = oauth.NewTokenService(cfg, s.jwtService, repos.Tokens, repos.Sessions, repos.Users, s.subjectService,
+		policies, oauth.NewResourceRegistry(repos.Resources), s.claimsService)
+	s.scopeRegistry = oauth.NewScopeRegistry(repos.Scopes)
+	s.authCodes = oauth.NewAuthCodeService(policies)
+	s.details = oauth.NewAuthorizationDetailsRegistry()
+	s.details.Register(oauth.PaymentInitiationType{})
+
+	cookieCodec, err := security.NewCookieCodec(cfg.SessionSecret)
+	if err != nil {
+		t.Fatalf("NewCookieCodec: %v", err)
+	}
+	notifier := oauth.NewLogoutNotifier(t.Context(), s.jwtService, s.subjectService, s.clientRegistry)
+	s.sessionService = oauth.NewSessionService(repos.Sessions, repos.Tokens, notifier, cookieCodec, cfg.SessionTTL, false)
+	s.consentService = oauth.NewConsentService(repos.Consents, repos.Tokens, s.clientRegistry, s.scopeRegistry)
+
+	s.userAuth = user.NewAuthService(repos.Users, repos.Identities, repos.RBAC)
+	rbacService := user.NewRBACService(repos.RBAC)
+	s.claimsService.SetMembershipSource(rbacService)
+	s.scopeRegistry.SetRoleSource(rbacService)
+	s.mfaService = user.NewMFAService(repos.MFA, cfg.MFAIssuer)
+	s.webauthn, err = user.NewWebAuthnService(cfg.WebAuthnRPID, cfg.MFAIssuer, cfg.WebAuthnRPOrigins, repos.WebAuthn, repos.Users)
+	if err != nil {
+		t.Fatalf("NewWebAuthnService: %v", err)
+	}
+	return s
+}
+
+// client loads a registered client
+func (s *testServices) client(t *testing.T, clientID string) *storage.OAuthClient {
+	t.Helper()
+
+	client, err := s.clientRegistry.FindClient(context.Background(), clientID)
+	if err != nil || client == nil {
+		t.Fatalf("FindClient(%s): %+v, %v", clientID, client, err)
+	}
+	return client
+}
+
+// issueTokens issues tokens for user-1 to clientID for scope
+// authn describes the sign-in; nil for tokens not tied to one
+func (s *testServices) issueTokens(t *testing.T, clientID, scope string, authn *oauth.AuthenticationContext) *oauth.TokenPair {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := s.repos.Users.GetUserByID(ctx, "user-1")
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByID: %+v, %v", user, err)
+	}
+	tokens, err := s.tokenService.GenerateTokens(ctx, user, s.client(t, clientID), &oauth.Grant{Scope: scope}, nil, authn, nil)
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	return tokens
+}
+
+// signIn starts an SSO session for userID and returns the browser's session cookie
+func (s *testServices) signIn(t *testing.T, userID string) (*storage.LoginSession, *http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	session, err := s.sessionService.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil), userID, []string{"pwd"}, oauth.ACRSingleFactor)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want the session cookie", len(cookies))
+	}
+	return session, cookies[0]
+}
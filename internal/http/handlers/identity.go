@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/user"
+	"oauth-golang/pkg/utils"
+)
+
+// IdentityHandler handles listing, linking and unlinking upstream identities on an account
+// API INPUT: Receives account management requests authenticated with a Bearer token
+type IdentityHandler struct {
+	config          *config.Config
+	authCodeService *oauth.AuthCodeService
+	userAuth        *user.AuthService
+	tokenService    *oauth.TokenService
+}
+
+func NewIdentityHandler(
+	cfg *config.Config,
+	authCodeService *oauth.AuthCodeService,
+	userAuth *user.AuthService,
+	tokenService *oauth.TokenService,
+) *IdentityHandler {
+	return &IdentityHandler{
+		config:          cfg,
+		authCodeService: authCodeService,
+		userAuth:        userAuth,
+		tokenService:    tokenService,
+	}
+}
+
+// identityLinkedPage confirms a completed link flow in the browser
+var identityLinkedPage = template.Must(template.New("linked").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Account linked</title></head>
+<body>
+  <h1>Account linked</h1>
+  <p>{{.Email}} ({{.Provider}}) can now be used to sign in to your account. You can close this window.</p>
+</body>
+</html>`))
+
+// identityResponse is the public view of a linked identity
+type identityResponse struct {
+	ID            string `json:"id"`
+	Provider      string `json:"provider"`
+	Subject       string `json:"subject"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	LinkedAt      int64  `json:"linked_at"`
+}
+
+// HandleIdentities processes the /account/identities endpoint
+// API INPUT: Bearer access token; DELETE takes an id query param and requires recent authentication
+// API OUTPUT: The identities linked to the user's account
+func (h *IdentityHandler) HandleIdentities(w http.ResponseWriter, r *http.Request) {
+	localUser, claims, authErr := authenticateBearer(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		identities, err := h.userAuth.ListIdentities(r.Context(), localUser.ID)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list identities", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]identityResponse, 0, len(identities))
+		for _, identity := range identities {
+			response = append(response, identityResponse{
+				ID:            identity.ID,
+				Provider:      identity.Provider,
+				Subject:       identity.Subject,
+				Email:         identity.Email,
+				EmailVerified: identity.EmailVerified,
+				LinkedAt:      identity.CreatedAt.Unix(),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	case http.MethodDelete:
+		if !recentlyAuthenticated(claims) {
+			h.writeError(w, "login_required", "Recent authentication is required to unlink an identity", http.StatusForbidden)
+			return
+		}
+
+		if err := h.userAuth.UnlinkIdentity(r.Context(), localUser.ID, r.URL.Query().Get("id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleLink processes the /account/identities/link endpoint
+// API INPUT: Bearer access token issued within the re-authentication window
+// API OUTPUT: URL the browser must visit to sign in with the identity being linked
+func (h *IdentityHandler) HandleLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	localUser, claims, authErr := authenticateBearer(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	if !recentlyAuthenticated(claims) {
+		h.writeError(w, "login_required", "Recent authentication is required to link an identity", http.StatusForbidden)
+		return
+	}
+	// The link is bound to the SSO session the token was issued under, so only a browser
+	// signed in to that session can complete it
+	if claims.SessionID == "" {
+		h.writeError(w, "login_required", "Sign in through the browser to link an identity", http.StatusForbidden)
+		return
+	}
+
+	// The link completes in HandleCallback once the user proves control of the new identity
+	sessionID := utils.GenerateRandomString(32)
+	h.authCodeService.StoreSession(sessionID, &oauth.AuthSession{
+		LinkUserID:    localUser.ID,
+		LinkSessionID: claims.SessionID,
+		CreatedAt:     time.Now(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorization_url": buildGoogleAuthURL(h.config, sessionID, true, ""),
+	})
+}
+
+// writeError writes an error response
+func (h *IdentityHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
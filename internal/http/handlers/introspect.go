@@ -1,55 +1,98 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
 
+	"oauth-golang/internal/oauth"
 	"oauth-golang/internal/security"
 	"oauth-golang/internal/storage"
 )
 
 // IntrospectHandler handles the /introspect endpoint
-// API INPUT: Receives token introspection requests from other microservices
+// API INPUT: Receives token introspection requests from authenticated resource servers and clients
 type IntrospectHandler struct {
-	jwtService *security.JWTService
-	tokenRepo  *storage.TokenRepository
+	tokenService   *oauth.TokenService
+	tokenRepo      storage.TokenRepository
+	userRepo       storage.UserRepository
+	clientRegistry *oauth.ClientRegistry
+	subjectService *oauth.SubjectService
+	jwtService     *security.JWTService
+	claimsService  *oauth.ClaimsService
 }
 
-func NewIntrospectHandler(jwtService *security.JWTService, tokenRepo *storage.TokenRepository) *IntrospectHandler {
+func NewIntrospectHandler(
+	tokenService *oauth.TokenService,
+	tokenRepo storage.TokenRepository,
+	userRepo storage.UserRepository,
+	clientRegistry *oauth.ClientRegistry,
+	subjectService *oauth.SubjectService,
+	jwtService *security.JWTService,
+	claimsService *oauth.ClaimsService,
+) *IntrospectHandler {
 	return &IntrospectHandler{
-		jwtService: jwtService,
-		tokenRepo:  tokenRepo,
+		tokenService:   tokenService,
+		tokenRepo:      tokenRepo,
+		userRepo:       userRepo,
+		clientRegistry: clientRegistry,
+		subjectService: subjectService,
+		jwtService:     jwtService,
+		claimsService:  claimsService,
 	}
 }
 
+// introspectionJWTType is the media type (and JWT typ) of signed introspection responses (RFC 9701)
+const introspectionJWTType = "token-introspection+jwt"
+
 // IntrospectRequest represents the token introspection request
 // API INPUT: Request body from other microservices
 type IntrospectRequest struct {
 	Token         string `json:"token"`
 	TokenTypeHint string `json:"token_type_hint,omitempty"` // "access_token" or "refresh_token"
+	ClientID      string `json:"client_id,omitempty"`       // caller credentials when HTTP Basic is not used
+	ClientSecret  string `json:"client_secret,omitempty"`
 }
 
 // IntrospectResponse represents the token introspection response (RFC 7662)
 // API OUTPUT: Token validation result for other microservices
 type IntrospectResponse struct {
-	Active    bool   `json:"active"`
-	Scope     string `json:"scope,omitempty"`
-	ClientID  string `json:"client_id,omitempty"`
-	Username  string `json:"username,omitempty"`
-	TokenType string `json:"token_type,omitempty"`
-	Exp       int64  `json:"exp,omitempty"`
-	Iat       int64  `json:"iat,omitempty"`
-	Sub       string `json:"sub,omitempty"`
-	Aud       string `json:"aud,omitempty"`
-	Iss       string `json:"iss,omitempty"`
-	Jti       string `json:"jti,omitempty"`
+	Active    bool                   `json:"active"`
+	Scope     string                 `json:"scope,omitempty"`
+	ClientID  string                 `json:"client_id,omitempty"`
+	Username  string                 `json:"username,omitempty"`
+	TokenType string                 `json:"token_type,omitempty"`
+	Exp       int64                  `json:"exp,omitempty"`
+	Iat       int64                  `json:"iat,omitempty"`
+	Sub       string                 `json:"sub,omitempty"`
+	Aud       string                 `json:"aud,omitempty"`
+	Iss       string                 `json:"iss,omitempty"`
+	Jti       string                 `json:"jti,omitempty"`
+	AuthTime  int64                  `json:"auth_time,omitempty"`
+	Sid       string                 `json:"sid,omitempty"`
+	Cnf       map[string]interface{} `json:"cnf,omitempty"`
+	Act       map[string]interface{} `json:"act,omitempty"`
+	// AuthorizationDetails are the fine-grained permissions of the token (RFC 9396 §9.2)
+	AuthorizationDetails []oauth.AuthorizationDetail `json:"authorization_details,omitempty"`
+	// Extra holds custom claims from the claims pipeline
+	Extra map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON adds the custom claims to the standard members
+func (r IntrospectResponse) MarshalJSON() ([]byte, error) {
+	type standard IntrospectResponse
+	return marshalWithClaims(standard(r), r.Extra)
 }
 
 // Handle processes the /introspect endpoint
-// API INPUT: POST request with token to validate
-// DB INTERACTION: Checks if token is revoked via tokenRepo
-// API OUTPUT: Returns token validation status and metadata
+// API INPUT: POST request with token to validate, authenticated with the caller's client credentials
+// (HTTP Basic or client_id/client_secret parameters)
+// DB INTERACTION: Authenticates the caller via clientRegistry; resolves access and refresh tokens
+// API OUTPUT: Returns token validation status and metadata. A token the caller may not see is
+// reported as inactive (RFC 7662 §2.2). With "Accept: application/token-introspection+jwt" the
+// response is a signed (and, if the caller registered a key, encrypted) JWT instead of JSON
 func (h *IntrospectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -60,113 +103,220 @@ func (h *IntrospectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	var req IntrospectRequest
 	if r.Header.Get("Content-Type") == "application/json" {
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			h.writeInactiveResponse(w)
+			h.writeError(w, "invalid_request", "Invalid JSON body", http.StatusBadRequest)
 			return
 		}
 	} else {
 		if err := r.ParseForm(); err != nil {
-			h.writeInactiveResponse(w)
+			h.writeError(w, "invalid_request", "Invalid form data", http.StatusBadRequest)
 			return
 		}
 		req.Token = r.FormValue("token")
 		req.TokenTypeHint = r.FormValue("token_type_hint")
+		req.ClientID = r.FormValue("client_id")
+		req.ClientSecret = r.FormValue("client_secret")
 	}
 
+	// Only confidential clients can authenticate (DB INTERACTION via clientRegistry)
+	caller := h.authenticateCaller(r, &req)
+	if caller == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+		h.writeError(w, "invalid_client", "Client authentication failed", http.StatusUnauthorized)
+		return
+	}
+
+	// The hint only decides which kind of token is tried first
+	response := &IntrospectResponse{Active: false}
 	if req.Token == "" {
-		h.writeInactiveResponse(w)
+		h.writeResponse(w, r, caller, response)
 		return
 	}
+	if req.TokenTypeHint == "refresh_token" {
+		response = h.introspectRefreshToken(r.Context(), caller, req.Token)
+		if response == nil {
+			response = h.introspectAccessToken(r.Context(), caller, req.Token)
+		}
+	} else {
+		response = h.introspectAccessToken(r.Context(), caller, req.Token)
+		if response == nil {
+			response = h.introspectRefreshToken(r.Context(), caller, req.Token)
+		}
+	}
 
-	// Verify JWT token
-	claims, err := h.jwtService.VerifyAccessToken(req.Token)
-	if err != nil {
-		// Token is invalid or expired
-		h.writeInactiveResponse(w)
+	if response == nil {
+		response = &IntrospectResponse{Active: false}
+	}
+
+	h.writeResponse(w, r, caller, response)
+}
+
+// writeResponse writes the introspection response as JSON, or as a JWT when the caller asked for one
+func (h *IntrospectHandler) writeResponse(w http.ResponseWriter, r *http.Request, caller *storage.OAuthClient, response *IntrospectResponse) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/"+introspectionJWTType) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	// Check if token has been revoked (DB INTERACTION via tokenRepo)
-	isRevoked, err := h.tokenRepo.IsTokenRevoked(req.Token)
-	if err != nil || isRevoked {
-		h.writeInactiveResponse(w)
+	signed, err := h.jwtService.SignIntrospectionResponse(caller.ClientID, response)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to sign introspection response", http.StatusInternalServerError)
 		return
 	}
 
-	// Build active response (API OUTPUT)
-	response := IntrospectResponse{
-		Active:    true,
-		Scope:     claims.Scope,
-		ClientID:  claims.ClientID,
-		Username:  claims.Email,
-		TokenType: "Bearer",
-		Exp:       claims.ExpiresAt.Unix(),
-		Iat:       claims.IssuedAt.Unix(),
-		Sub:       claims.Subject,
-		Aud:       claims.Audience,
-		Iss:       claims.Issuer,
-		Jti:       claims.ID,
+	// Encrypt for callers that registered a key (RFC 9701 §5)
+	if caller.IntrospectionEncryptionKey != "" {
+		publicKey, err := security.ParseRSAPublicKey(caller.IntrospectionEncryptionKey)
+		if err != nil {
+			h.writeError(w, "server_error", "Invalid introspection encryption key", http.StatusInternalServerError)
+			return
+		}
+		signed, err = security.EncryptJWT(signed, publicKey, introspectionJWTType)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to encrypt introspection response", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Content-Type", "application/"+introspectionJWTType)
+	w.Write([]byte(signed))
 }
 
-// writeInactiveResponse writes an inactive token response
-func (h *IntrospectHandler) writeInactiveResponse(w http.ResponseWriter) {
-	response := IntrospectResponse{
-		Active: false,
+// authenticateCaller returns the confidential client making the request, or nil
+func (h *IntrospectHandler) authenticateCaller(r *http.Request, req *IntrospectRequest) *storage.OAuthClient {
+	clientID, clientSecret := req.ClientID, req.ClientSecret
+	if basicID, basicSecret, ok := r.BasicAuth(); ok {
+		// Basic credentials are form-urlencoded first (RFC 6749 §2.3.1)
+		clientID, _ = url.QueryUnescape(basicID)
+		clientSecret, _ = url.QueryUnescape(basicSecret)
+	}
+	if clientID == "" || clientSecret == "" {
+		return nil
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
 
-// Additional helper for token revocation endpoint (optional)
-type RevokeHandler struct {
-	jwtService *security.JWTService
-	tokenRepo  *storage.TokenRepository
+	client, err := h.clientRegistry.ValidateClient(r.Context(), clientID, clientSecret)
+	if err != nil || client == nil || !client.IsConfidential() {
+		return nil
+	}
+	return client
 }
 
-func NewRevokeHandler(jwtService *security.JWTService, tokenRepo *storage.TokenRepository) *RevokeHandler {
-	return &RevokeHandler{
-		jwtService: jwtService,
-		tokenRepo:  tokenRepo,
+// introspectAccessToken describes an active access token the caller may see, or returns nil
+// Resource servers see tokens audienced to them; any client sees the tokens issued to it
+// DB INTERACTION: Resolves the token and checks revocation via tokenService
+func (h *IntrospectHandler) introspectAccessToken(ctx context.Context, caller *storage.OAuthClient, token string) *IntrospectResponse {
+	claims, err := h.tokenService.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return nil
+	}
+
+	if claims.ClientID != caller.ClientID && !caller.AcceptsAudience(claims.Audience) {
+		return nil
+	}
+
+	// Tokens of pairwise clients are described with the pairwise subject, never the internal ID
+	// INPUT FROM DB: Loads the token's client via clientRegistry
+	tokenClient, err := h.clientRegistry.GetClient(ctx, claims.ClientID)
+	if err != nil {
+		return nil
+	}
+	subject, err := h.subjectService.SubjectFor(tokenClient, claims.Subject)
+	if err != nil {
+		return nil
+	}
+
+	response := &IntrospectResponse{
+		Active:               true,
+		Scope:                claims.Scope,
+		ClientID:             claims.ClientID,
+		Username:             claims.Email,
+		TokenType:            "Bearer",
+		Exp:                  claims.ExpiresAt.Unix(),
+		Iat:                  claims.IssuedAt.Unix(),
+		Sub:                  subject,
+		Aud:                  claims.Audience,
+		Iss:                  claims.Issuer,
+		Jti:                  claims.ID,
+		Sid:                  claims.SessionID,
+		Cnf:                  claims.Confirmation,
+		Act:                  claims.Actor,
+		AuthorizationDetails: claims.AuthorizationDetails,
+	}
+	if !claims.AuthTime.IsZero() {
+		response.AuthTime = claims.AuthTime.Unix()
+	}
+	if !h.addClaims(ctx, response, claims.Subject, claims.ClientID, claims.Scope) {
+		return nil
 	}
+	return response
 }
 
-// Handle processes token revocation requests
-// API INPUT: Token to revoke
-// OUTPUT TO DB: Marks token as revoked via tokenRepo
-func (rh *RevokeHandler) Handle(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// introspectRefreshToken describes an active refresh token, or returns nil
+// Refresh tokens are only ever shown to the client they were issued to, with the subject that client sees
+// INPUT FROM DB: Loads the refresh token via tokenService
+func (h *IntrospectHandler) introspectRefreshToken(ctx context.Context, caller *storage.OAuthClient, token string) *IntrospectResponse {
+	storedToken, err := h.tokenService.VerifyRefreshToken(ctx, token)
+	if err != nil || storedToken.ClientID != caller.ClientID {
+		return nil
+	}
+	subject, err := h.subjectService.SubjectFor(caller, storedToken.UserID)
+	if err != nil {
+		return nil
 	}
 
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
+	details, err := oauth.DecodeAuthorizationDetails(storedToken.AuthorizationDetails)
+	if err != nil {
+		return nil
 	}
 
-	token := r.FormValue("token")
-	if token == "" {
-		http.Error(w, "Missing token parameter", http.StatusBadRequest)
-		return
+	response := &IntrospectResponse{
+		Active:               true,
+		Scope:                storedToken.Scope,
+		ClientID:             storedToken.ClientID,
+		TokenType:            "refresh_token",
+		Exp:                  storedToken.ExpiresAt.Unix(),
+		Iat:                  storedToken.CreatedAt.Unix(),
+		Sub:                  subject,
+		Aud:                  security.AccessTokenAudience,
+		Jti:                  storedToken.ID,
+		Sid:                  storedToken.SessionID,
+		AuthorizationDetails: details,
+	}
+	if !h.addClaims(ctx, response, storedToken.UserID, storedToken.ClientID, storedToken.Scope) {
+		return nil
 	}
+	return response
+}
 
-	// Verify token format
-	claims, err := rh.jwtService.VerifyAccessToken(token)
+// addClaims adds the custom claims for the token's user, client and scope to a response
+// A token whose claims cannot be built, or whose user is disabled, is reported as inactive
+// DB INTERACTION: Loads the user via userRepo, the client via clientRegistry and rules via claimsService
+func (h *IntrospectHandler) addClaims(ctx context.Context, response *IntrospectResponse, userID, clientID, scope string) bool {
+	user, err := h.userRepo.GetUserByID(ctx, userID)
+	if err != nil || user == nil || user.Disabled {
+		return false
+	}
+	client, err := h.clientRegistry.GetClient(ctx, clientID)
 	if err != nil {
-		// Even if token is invalid, return success per RFC 7009
-		w.WriteHeader(http.StatusOK)
-		return
+		return false
 	}
 
-	// Revoke token (OUTPUT TO DB via tokenRepo)
-	expiresAt := time.Until(claims.ExpiresAt)
-	if err := rh.tokenRepo.RevokeToken(token, expiresAt); err != nil {
-		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
-		return
+	extra, err := h.claimsService.Build(ctx, &oauth.ClaimsRequest{Target: oauth.ClaimTargetIntrospection, User: user, Client: client, Scope: scope})
+	if err != nil {
+		return false
 	}
+	response.Extra = extra
+	return true
+}
 
-	w.WriteHeader(http.StatusOK)
+// writeError writes an error response
+func (h *IntrospectHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
 }
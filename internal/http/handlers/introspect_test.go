@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+)
+
+func introspect(t *testing.T, handler *IntrospectHandler, clientID, token, hint string) *IntrospectResponse {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(url.Values{
+		"token": {token}, "token_type_hint": {hint},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, "secret")
+	rec := httptest.NewRecorder()
+	handler.Handle(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	var response IntrospectResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decode introspection response: %v", err)
+	}
+	return &response
+}
+
+func newIntrospectHandler(s *testServices) *IntrospectHandler {
+	return NewIntrospectHandler(s.tokenService, s.repos.Tokens, s.repos.Users, s.clientRegistry, s.subjectService, s.jwtService, s.claimsService)
+}
+
+func TestIntrospectRefreshTokenSubject(t *testing.T) {
+	s := newTestServices(t)
+	handler := newIntrospectHandler(s)
+
+	for _, clientID := range []string{"public-app", "pairwise-app"} {
+		t.Run(clientID, func(t *testing.T) {
+			tokens := s.issueTokens(t, clientID, "openid", nil)
+			want, err := s.subjectService.SubjectFor(s.client(t, clientID), "user-1")
+			if err != nil {
+				t.Fatalf("SubjectFor: %v", err)
+			}
+
+			response := introspect(t, handler, clientID, tokens.RefreshToken, "refresh_token")
+			if !response.Active || response.TokenType != "refresh_token" {
+				t.Fatalf("got %+v, want an active refresh token", response)
+			}
+			if response.Sub != want {
+				t.Errorf("got sub %q, want %q", response.Sub, want)
+			}
+		})
+	}
+
+	// Refresh tokens are only visible to the client they were issued to
+	tokens := s.issueTokens(t, "pairwise-app", "openid", nil)
+	if response := introspect(t, handler, "public-app", tokens.RefreshToken, "refresh_token"); response.Active {
+		t.Errorf("another client saw the refresh token: %+v", response)
+	}
+}
+
+// introspectJWT asks for a JWT introspection response (RFC 9701) and returns its body
+func introspectJWT(t *testing.T, handler *IntrospectHandler, clientID, token string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/token-introspection+jwt")
+	req.SetBasicAuth(clientID, "secret")
+	rec := httptest.NewRecorder()
+	handler.Handle(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/token-introspection+jwt" {
+		t.Fatalf("got status %d, Content-Type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	return rec.Body.String()
+}
+
+// decryptJWE opens a compact RSA-OAEP-256 / A256GCM JWE as the holder of key would
+func decryptJWE(t *testing.T, compact string, key *rsa.PrivateKey) (map[string]string, string) {
+	t.Helper()
+
+	parts := strings.Split(compact, ".")
+	if len(parts) != 5 {
+		t.Fatalf("got %d JWE parts, want 5", len(parts))
+	}
+	decoded := make([][]byte, 5)
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			t.Fatalf("JWE part %d: %v", i, err)
+		}
+	}
+
+	var header map[string]string
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		t.Fatalf("JWE header: %v", err)
+	}
+	contentKey, err := rsa.DecryptOAEP(sha256.New(), nil, key, decoded[1], nil)
+	if err != nil {
+		t.Fatalf("DecryptOAEP: %v", err)
+	}
+	block, _ := aes.NewCipher(contentKey)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		t.Fatalf("JWE does not decrypt: %v", err)
+	}
+	return header, string(plaintext)
+}
+
+// verifyIntrospectionJWT checks the signed response against the published key and returns its response object
+func verifyIntrospectionJWT(t *testing.T, s *testServices, signed, audience string) map[string]interface{} {
+	t.Helper()
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (interface{}, error) {
+		return &s.signingKey.PrivateKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer(s.cfg.Issuer), jwt.WithAudience(audience))
+	if err != nil {
+		t.Fatalf("introspection response does not verify: %v", err)
+	}
+	if token.Header["typ"] != "token-introspection+jwt" || token.Header["kid"] != s.signingKey.ID {
+		t.Errorf("got header %v", token.Header)
+	}
+	response, _ := claims["token_introspection"].(map[string]interface{})
+	return response
+}
+
+func TestIntrospectJWTResponses(t *testing.T) {
+	s := newTestServices(t)
+	handler := newIntrospectHandler(s)
+	accessToken := s.issueTokens(t, "public-app", "openid", nil).AccessToken
+
+	response := verifyIntrospectionJWT(t, s, introspectJWT(t, handler, "public-app", accessToken), "public-app")
+	if response["active"] != true || response["sub"] != "user-1" || response["client_id"] != "public-app" {
+		t.Errorf("got token_introspection %v", response)
+	}
+
+	// A resource server with a registered key gets the signed response encrypted to it
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err := s.repos.Clients.CreateClient(context.Background(), &storage.OAuthClient{
+		ClientID: "api", ClientSecret: "secret", ClientType: "confidential", ResourceServer: true,
+		Audiences:                  []string{security.AccessTokenAudience},
+		IntrospectionEncryptionKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	encrypted := introspectJWT(t, handler, "api", accessToken)
+	header, signed := decryptJWE(t, encrypted, rsaKey)
+	if header["alg"] != security.JWEKeyAlgorithm || header["enc"] != security.JWEContentAlgorithm || header["cty"] != "JWT" {
+		t.Errorf("got JWE header %v", header)
+	}
+	response = verifyIntrospectionJWT(t, s, signed, "api")
+	if response["active"] != true || response["aud"] != security.AccessTokenAudience {
+		t.Errorf("got token_introspection %v", response)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"oauth-golang/internal/security"
+)
+
+// JWKSHandler publishes the server's public signing keys
+// API OUTPUT: JSON Web Key Set (RFC 7517)
+type JWKSHandler struct {
+	signingKey *security.SigningKey
+}
+
+func NewJWKSHandler(signingKey *security.SigningKey) *JWKSHandler {
+	return &JWKSHandler{
+		signingKey: signingKey,
+	}
+}
+
+// Handle processes the /.well-known/jwks.json endpoint
+// API OUTPUT: The public half of the signing key, and of the previous one after a rotation, for
+// verifying ID tokens, logout tokens and JWT introspection responses
+func (h *JWKSHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(map[string][]security.JWK{
+		"keys": h.signingKey.PublicJWKs(),
+	})
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+)
+
+// LogoutHandler handles OpenID Connect RP-Initiated Logout
+// API INPUT: Receives logout requests from relying parties via the user's browser
+type LogoutHandler struct {
+	config         *config.Config
+	clientRegistry *oauth.ClientRegistry
+	sessionService *oauth.SessionService
+	subjectService *oauth.SubjectService
+	jwtService     *security.JWTService
+}
+
+func NewLogoutHandler(
+	cfg *config.Config,
+	clientRegistry *oauth.ClientRegistry,
+	sessionService *oauth.SessionService,
+	subjectService *oauth.SubjectService,
+	jwtService *security.JWTService,
+) *LogoutHandler {
+	return &LogoutHandler{
+		config:         cfg,
+		clientRegistry: clientRegistry,
+		sessionService: sessionService,
+		subjectService: subjectService,
+		jwtService:     jwtService,
+	}
+}
+
+// logoutConfirmPage asks the user to confirm a logout that did not come with a valid id_token_hint
+// The confirmation is a POST carrying the session's CSRF token, so a third-party page cannot log the user out on its own
+var logoutConfirmPage = template.Must(template.New("logout-confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign out</title></head>
+<body>
+  <h1>Sign out?</h1>
+  <p>Do you want to sign out of your account?</p>
+  <form method="POST" action="/logout">
+    <input type="hidden" name="client_id" value="{{.ClientID}}">
+    <input type="hidden" name="post_logout_redirect_uri" value="{{.PostLogoutRedirectURI}}">
+    <input type="hidden" name="state" value="{{.State}}">
+    <input type="hidden" name="confirm" value="yes">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+    <button type="submit">Sign out</button>
+  </form>
+</body>
+</html>`))
+
+// loggedOutPage confirms the logout and loads each client's front-channel logout URI in a hidden iframe
+// When the relying party asked to be redirected back, the browser continues once the iframes have loaded
+var loggedOutPage = template.Must(template.New("logged-out").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Signed out</title></head>
+<body>
+  <h1>Signed out</h1>
+  <p>You have been signed out.{{if not .RedirectURL}} You can close this window.{{end}}</p>
+  {{range .FrontchannelURIs}}<iframe src="{{.}}" style="display:none" width="0" height="0"></iframe>{{end}}
+  {{if .RedirectURL}}
+  <p><a id="continue" href="{{.RedirectURL}}">Continue</a></p>
+  <script>
+    window.addEventListener('load', function () { window.location.assign(document.getElementById('continue').href); });
+  </script>
+  {{end}}
+</body>
+</html>`))
+
+type loggedOutView struct {
+	FrontchannelURIs []string
+	RedirectURL      string
+}
+
+type logoutView struct {
+	ClientID              string
+	PostLogoutRedirectURI string
+	State                 string
+	CSRFToken             string
+}
+
+// Handle processes the /logout endpoint (end_session_endpoint)
+// API INPUT: id_token_hint, client_id, post_logout_redirect_uri and state, as query params or form data
+// DB INTERACTION: Revokes the SSO session and, if configured, its refresh tokens
+// OUTPUT: Back-channel logout tokens to participating clients; front-channel iframes and a redirect
+// to the registered post_logout_redirect_uri, or a signed-out page
+func (h *LogoutHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	idTokenHint := r.FormValue("id_token_hint")
+	clientID := r.FormValue("client_id")
+	postLogoutRedirectURI := r.FormValue("post_logout_redirect_uri")
+	state := r.FormValue("state")
+
+	// The hint identifies the user, the session and (through its audience) the client
+	var hint *security.TokenClaims
+	if idTokenHint != "" {
+		claims, err := h.jwtService.VerifyIDTokenHint(idTokenHint)
+		if err != nil {
+			http.Error(w, "Invalid id_token_hint", http.StatusBadRequest)
+			return
+		}
+		// The hint's audience is the client it was issued to
+		hintClientID := claims.Audience
+		if clientID != "" && hintClientID != clientID {
+			http.Error(w, "client_id does not match id_token_hint", http.StatusBadRequest)
+			return
+		}
+		clientID = hintClientID
+		hint = claims
+	}
+
+	// A post-logout redirect is only honoured when registered for an identified client
+	if postLogoutRedirectURI != "" {
+		if clientID == "" {
+			http.Error(w, "post_logout_redirect_uri requires client_id or id_token_hint", http.StatusBadRequest)
+			return
+		}
+		client, err := h.clientRegistry.GetClient(r.Context(), clientID)
+		if err != nil || client == nil || !client.ValidatePostLogoutRedirectURI(postLogoutRedirectURI) {
+			http.Error(w, "Invalid post_logout_redirect_uri", http.StatusBadRequest)
+			return
+		}
+	}
+
+	current, err := h.sessionService.Current(r)
+	if err != nil {
+		http.Error(w, "Failed to load session", http.StatusInternalServerError)
+		return
+	}
+
+	// Without a hint for this session we cannot tell the RP asked on the user's behalf, so ask the user first
+	// The confirmation must come from our own form, which carries the session's CSRF token
+	confirmed := r.Method == http.MethodPost && r.PostFormValue("confirm") == "yes"
+	if confirmed && current != nil && !h.sessionService.VerifyCSRFToken(current, r.PostFormValue("csrf_token")) {
+		http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+		return
+	}
+	if current != nil && !confirmed && !h.hintCoversSession(r.Context(), hint, current) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Cache-Control", "no-store")
+		logoutConfirmPage.Execute(w, logoutView{
+			ClientID:              clientID,
+			PostLogoutRedirectURI: postLogoutRedirectURI,
+			State:                 state,
+			CSRFToken:             h.sessionService.CSRFToken(current),
+		})
+		return
+	}
+
+	// The sid in the hint lets us end the right session even when the cookie is not sent
+	var ended *storage.LoginSession
+	if target := sessionToEnd(hint, current); target != "" {
+		ended, err = h.sessionService.Logout(r.Context(), target, h.config.LogoutRevokesRefreshTokens)
+		if err != nil {
+			http.Error(w, "Failed to end session", http.StatusInternalServerError)
+			return
+		}
+	}
+	if current == nil || (ended != nil && current.ID == ended.ID) {
+		h.sessionService.ClearCookie(w)
+	}
+
+	var redirectURL string
+	if postLogoutRedirectURI != "" {
+		parsed, _ := url.Parse(postLogoutRedirectURI)
+		if state != "" {
+			q := parsed.Query()
+			q.Set("state", state)
+			parsed.RawQuery = q.Encode()
+		}
+		redirectURL = parsed.String()
+	}
+
+	// Front-channel logout needs the browser, so it is rendered before following the redirect
+	var frontchannelURIs []string
+	if ended != nil {
+		frontchannelURIs = h.sessionService.FrontchannelURIs(r.Context(), ended)
+	}
+
+	if redirectURL != "" && len(frontchannelURIs) == 0 {
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	loggedOutPage.Execute(w, loggedOutView{
+		FrontchannelURIs: frontchannelURIs,
+		RedirectURL:      redirectURL,
+	})
+}
+
+// hintCoversSession reports whether the id_token_hint vouches for ending a logout without confirmation
+// A hint naming a session (sid) is enough; one without sid must belong to the browser session's user
+// INPUT FROM DB: Loads the hint's client via clientRegistry
+func (h *LogoutHandler) hintCoversSession(ctx context.Context, hint *security.TokenClaims, current *storage.LoginSession) bool {
+	if hint == nil {
+		return false
+	}
+	if hint.SessionID != "" {
+		return true
+	}
+
+	// The hint carries the subject as its client sees it, which may be pairwise
+	client, err := h.clientRegistry.GetClient(ctx, hint.Audience)
+	if err != nil || client == nil {
+		return false
+	}
+	subject, err := h.subjectService.SubjectFor(client, current.UserID)
+	if err != nil {
+		return false
+	}
+	return subject == hint.Subject
+}
+
+// sessionToEnd picks the session a logout applies to: the one named in the hint, else the browser's
+func sessionToEnd(hint *security.TokenClaims, current *storage.LoginSession) string {
+	if hint != nil && hint.SessionID != "" {
+		return hint.SessionID
+	}
+	if current != nil {
+		return current.ID
+	}
+	return ""
+}
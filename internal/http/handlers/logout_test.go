@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+)
+
+var csrfTokenField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func newLogoutHandler(s *testServices) *LogoutHandler {
+	return NewLogoutHandler(s.cfg, s.clientRegistry, s.sessionService, s.subjectService, s.jwtService)
+}
+
+// logout sends a /logout request from a browser holding cookie; form is sent as POST data when method is POST
+func logout(handler *LogoutHandler, method string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	var req *http.Request
+	if method == http.MethodPost {
+		req = httptest.NewRequest(method, "/logout", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, "/logout?"+form.Encode(), nil)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler.Handle(rec, req)
+	return rec
+}
+
+func sessionRevoked(t *testing.T, s *testServices, sessionID string) bool {
+	t.Helper()
+
+	session, err := s.repos.Sessions.GetSession(context.Background(), sessionID)
+	if err != nil || session == nil {
+		t.Fatalf("GetSession: %+v, %v", session, err)
+	}
+	return session.Revoked
+}
+
+func TestLogoutConfirmationRequiresSessionCSRFToken(t *testing.T) {
+	s := newTestServices(t)
+	handler := newLogoutHandler(s)
+	session, cookie := s.signIn(t, "user-1")
+	otherSession, _ := s.signIn(t, "user-1")
+
+	// Without an id_token_hint the user is asked first
+	rec := logout(handler, http.MethodGet, url.Values{}, cookie)
+	match := csrfTokenField.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || match == nil {
+		t.Fatalf("got status %d without a CSRF token in the confirmation form: %s", rec.Code, rec.Body)
+	}
+	if sessionRevoked(t, s, session.ID) {
+		t.Fatal("session ended before the user confirmed")
+	}
+
+	// A cross-site form can post confirm=yes, but cannot know the token
+	for name, token := range map[string]string{
+		"missing":           "",
+		"forged":            "forged",
+		"another session's": s.sessionService.CSRFToken(otherSession),
+	} {
+		rec := logout(handler, http.MethodPost, url.Values{"confirm": {"yes"}, "csrf_token": {token}}, cookie)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s token: got status %d, want 403", name, rec.Code)
+		}
+	}
+
+	// The token only counts in the posted form, not in the URL a third party could build
+	req := httptest.NewRequest(http.MethodPost, "/logout?csrf_token="+url.QueryEscape(match[1]), strings.NewReader("confirm=yes"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	handler.Handle(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("query string token: got status %d, want 403", rec.Code)
+	}
+	if sessionRevoked(t, s, session.ID) {
+		t.Fatal("session ended without a valid CSRF token")
+	}
+
+	rec = logout(handler, http.MethodPost, url.Values{"confirm": {"yes"}, "csrf_token": {match[1]}}, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if !sessionRevoked(t, s, session.ID) {
+		t.Error("confirmed logout left the session live")
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("got cookies %v, want the session cookie cleared", cookies)
+	}
+}
+
+func TestLogoutWithSessionHintRedirects(t *testing.T) {
+	s := newTestServices(t)
+	s.cfg.LogoutRevokesRefreshTokens = true
+	handler := newLogoutHandler(s)
+	session, cookie := s.signIn(t, "user-1")
+	tokens := s.issueTokens(t, "public-app", "openid", &oauth.AuthenticationContext{SessionID: session.ID, AuthTime: time.Now()})
+
+	// An unregistered redirect is refused before anything happens
+	rec := logout(handler, http.MethodGet, url.Values{
+		"id_token_hint":            {tokens.IDToken},
+		"post_logout_redirect_uri": {"https://evil.example.com/"},
+	}, cookie)
+	if rec.Code != http.StatusBadRequest || sessionRevoked(t, s, session.ID) {
+		t.Fatalf("got status %d for an unregistered redirect", rec.Code)
+	}
+
+	// The sid in the hint ends the session even without the cookie, and without asking
+	rec = logout(handler, http.MethodGet, url.Values{
+		"id_token_hint":            {tokens.IDToken},
+		"post_logout_redirect_uri": {"https://public.example.com/signed-out"},
+		"state":                    {"abc"},
+	}, nil)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if location := rec.Header().Get("Location"); location != "https://public.example.com/signed-out?state=abc" {
+		t.Errorf("redirected to %q", location)
+	}
+	if !sessionRevoked(t, s, session.ID) {
+		t.Error("session named by the hint is still live")
+	}
+	if _, err := s.tokenService.VerifyRefreshToken(context.Background(), tokens.RefreshToken); err == nil {
+		t.Error("refresh token issued under the session still works")
+	}
+}
+
+func TestLogoutHintForAnotherUserAsksForConfirmation(t *testing.T) {
+	s := newTestServices(t)
+	handler := newLogoutHandler(s)
+	if err := s.repos.Users.CreateUser(context.Background(), &storage.User{ID: "user-2", Email: "other@example.com"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	session, cookie := s.signIn(t, "user-2")
+
+	// A hint without sid for user-1 says nothing about user-2's browser session
+	hint := s.issueTokens(t, "public-app", "openid", nil).IDToken
+	rec := logout(handler, http.MethodGet, url.Values{"id_token_hint": {hint}}, cookie)
+	if rec.Code != http.StatusOK || !csrfTokenField.MatchString(rec.Body.String()) {
+		t.Fatalf("got status %d without the confirmation form: %s", rec.Code, rec.Body)
+	}
+	if sessionRevoked(t, s, session.ID) {
+		t.Error("another user's hint ended the session")
+	}
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/user"
+)
+
+// maxMFAAttempts is the number of wrong codes allowed before a challenge is abandoned
+const maxMFAAttempts = 5
+
+// MFAHandler handles the TOTP challenge step and authenticator enrolment
+// API INPUT: Receives verification codes from the user's browser or account page
+type MFAHandler struct {
+	authCodeService *oauth.AuthCodeService
+	mfaService      *user.MFAService
+	webauthnService *user.WebAuthnService
+	consentService  *oauth.ConsentService
+	scopeRegistry   *oauth.ScopeRegistry
+	sessionService  *oauth.SessionService
+	userAuth        *user.AuthService
+	tokenService    *oauth.TokenService
+}
+
+func NewMFAHandler(
+	authCodeService *oauth.AuthCodeService,
+	mfaService *user.MFAService,
+	webauthnService *user.WebAuthnService,
+	consentService *oauth.ConsentService,
+	scopeRegistry *oauth.ScopeRegistry,
+	sessionService *oauth.SessionService,
+	userAuth *user.AuthService,
+	tokenService *oauth.TokenService,
+) *MFAHandler {
+	return &MFAHandler{
+		authCodeService: authCodeService,
+		mfaService:      mfaService,
+		webauthnService: webauthnService,
+		consentService:  consentService,
+		scopeRegistry:   scopeRegistry,
+		sessionService:  sessionService,
+		userAuth:        userAuth,
+		tokenService:    tokenService,
+	}
+}
+
+// mfaChallengePage is rendered between upstream login and auth code issuance
+var mfaChallengePage = template.Must(template.New("mfa").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Two-step verification</title></head>
+<body>
+  <h1>Two-step verification</h1>
+  {{if .Error}}<p style="color:#b00">{{.Error}}</p>{{end}}
+  {{if .Enrollment}}
+  <p>This application requires an authenticator app. Scan the QR code for the URI below or enter the secret manually.</p>
+  <p><code>{{.Enrollment.ProvisioningURI}}</code></p>
+  <p>Secret: <code>{{.Enrollment.Secret}}</code></p>
+  <p>Save these recovery codes somewhere safe. Each can be used once if you lose your device:</p>
+  <ul>{{range .Enrollment.RecoveryCodes}}<li><code>{{.}}</code></li>{{end}}</ul>
+  {{end}}
+  {{if .HasPasskeys}}
+  <p id="webauthn-error" style="color:#b00"></p>
+  <button onclick="runAssert('/webauthn/mfa/begin?challenge=' + encodeURIComponent({{.ChallengeID}}), '/webauthn/mfa/finish?challenge=' + encodeURIComponent({{.ChallengeID}}))">Use security key or passkey</button>
+  <script>` + webauthnAssertScript + `</script>
+  {{end}}
+  {{if .ShowCodeForm}}
+  <form method="POST" action="/mfa/challenge">
+    <input type="hidden" name="challenge" value="{{.ChallengeID}}">
+    <label>Verification code <input name="code" autocomplete="one-time-code" autofocus></label>
+    <button type="submit">Verify</button>
+  </form>
+  {{end}}
+</body>
+</html>`))
+
+type mfaChallengeView struct {
+	ChallengeID  string
+	Enrollment   *user.MFAEnrollmentResult
+	HasPasskeys  bool
+	ShowCodeForm bool
+	Error        string
+}
+
+// HandleChallenge processes the /mfa/challenge endpoint
+// API INPUT: GET renders the code form, POST submits a TOTP or recovery code
+// OUTPUT: Redirects to the client with an authorization code once verified
+func (h *MFAHandler) HandleChallenge(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.renderChallenge(r.Context(), w, r.URL.Query().Get("challenge"), "")
+	case http.MethodPost:
+		h.verifyChallenge(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderChallenge shows the second factor options, starting inline TOTP enrolment for users without any
+func (h *MFAHandler) renderChallenge(ctx context.Context, w http.ResponseWriter, challengeID, errorMessage string) {
+	challenge := h.authCodeService.GetMFAChallenge(challengeID)
+	if challenge == nil {
+		http.Error(w, "Invalid or expired MFA challenge", http.StatusBadRequest)
+		return
+	}
+
+	view := mfaChallengeView{ChallengeID: challengeID, Error: errorMessage}
+
+	enrolled, err := h.mfaService.IsEnrolled(ctx, challenge.UserID)
+	if err != nil {
+		http.Error(w, "Failed to load MFA enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	view.HasPasskeys, err = h.webauthnService.HasCredentials(ctx, challenge.UserID)
+	if err != nil {
+		http.Error(w, "Failed to load security keys", http.StatusInternalServerError)
+		return
+	}
+
+	// Users with a security key are not pushed into TOTP enrolment
+	view.ShowCodeForm = enrolled || !view.HasPasskeys
+
+	// Only start a fresh enrolment on first display, not after a wrong code
+	if !enrolled && !view.HasPasskeys && errorMessage == "" {
+		localUser, err := h.userAuth.GetUser(ctx, challenge.UserID)
+		if err != nil || localUser == nil {
+			http.Error(w, "Failed to load user", http.StatusInternalServerError)
+			return
+		}
+		view.Enrollment, err = h.mfaService.BeginEnrollment(ctx, localUser)
+		if err != nil {
+			http.Error(w, "Failed to start MFA enrollment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	mfaChallengePage.Execute(w, view)
+}
+
+// verifyChallenge checks the submitted code and completes the authorization
+func (h *MFAHandler) verifyChallenge(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	challengeID := r.FormValue("challenge")
+	code := r.FormValue("code")
+
+	challenge := h.authCodeService.GetMFAChallenge(challengeID)
+	if challenge == nil {
+		http.Error(w, "Invalid or expired MFA challenge", http.StatusBadRequest)
+		return
+	}
+
+	enrolled, err := h.mfaService.IsEnrolled(r.Context(), challenge.UserID)
+	if err != nil {
+		http.Error(w, "Failed to load MFA enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	// Users enrolling inline confirm with their first TOTP code
+	method := "otp"
+	if enrolled {
+		method, err = h.mfaService.Verify(r.Context(), challenge.UserID, code)
+	} else {
+		err = h.mfaService.ConfirmEnrollment(r.Context(), challenge.UserID, code)
+	}
+
+	if err != nil {
+		if h.authCodeService.RecordMFAFailure(challengeID) >= maxMFAAttempts {
+			h.authCodeService.DeleteMFAChallenge(challengeID)
+			http.Error(w, "Too many failed attempts", http.StatusForbidden)
+			return
+		}
+		h.renderChallenge(r.Context(), w, challengeID, "That code was not valid. Please try again.")
+		return
+	}
+
+	h.authCodeService.DeleteMFAChallenge(challengeID)
+
+	amr := []string{"fed", "mfa"}
+	if method == "otp" {
+		amr = append(amr, "otp")
+	}
+
+	// Establish (or upgrade) the SSO session with the second factor
+	loginSession, err := h.sessionService.Start(w, r, challenge.UserID, amr, oauth.ACRMultiFactor)
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+
+	redirectURL, err := completeAuthorization(r.Context(), h.authCodeService, h.consentService, h.scopeRegistry, &oauth.PendingConsent{
+		Session:   challenge.Session,
+		UserID:    challenge.UserID,
+		UserInfo:  challenge.UserInfo,
+		AMR:       amr,
+		ACR:       oauth.ACRMultiFactor,
+		SessionID: loginSession.ID,
+		AuthTime:  loginSession.AuthTime,
+	})
+	if err != nil {
+		http.Error(w, "Failed to complete authorization", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// HandleEnroll processes the /mfa/totp/enroll endpoint
+// API INPUT: Bearer access token from a recent sign-in, using the second factor when one is enrolled
+// API OUTPUT: TOTP secret, otpauth:// provisioning URI and one-time recovery codes
+func (h *MFAHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	localUser, _, authErr := authenticateStepUp(r, h.tokenService, h.userAuth, h.mfaService, h.webauthnService, "enrol an authenticator app")
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	result, err := h.mfaService.BeginEnrollment(r.Context(), localUser)
+	if err != nil {
+		h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleConfirm processes the /mfa/totp/confirm endpoint
+// API INPUT: Bearer access token and the first code from the authenticator
+// OUTPUT TO DB: Activates the enrolment via mfaService
+func (h *MFAHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	localUser, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.writeError(w, "invalid_request", "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaService.ConfirmEnrollment(r.Context(), localUser.ID, r.FormValue("code")); err != nil {
+		h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDisable processes the /mfa/totp/disable endpoint
+// API INPUT: Bearer access token and a current TOTP or recovery code
+// OUTPUT TO DB: Removes the enrolment via mfaService
+func (h *MFAHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	localUser, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.writeError(w, "invalid_request", "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// A stolen access token alone must not be enough to strip the second factor
+	if _, err := h.mfaService.Verify(r.Context(), localUser.ID, r.FormValue("code")); err != nil {
+		h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), localUser.ID); err != nil {
+		h.writeError(w, "server_error", "Failed to disable MFA", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate resolves the user from the Bearer access token, writing an error if it fails
+func (h *MFAHandler) authenticate(w http.ResponseWriter, r *http.Request) (*storage.User, bool) {
+	localUser, _, authErr := authenticateBearer(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return nil, false
+	}
+	return localUser, true
+}
+
+// writeError writes an error response
+func (h *MFAHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
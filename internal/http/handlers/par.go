@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+)
+
+// HandlePushedAuthorizationRequest processes the /par endpoint (RFC 9126)
+// The client sends the authorization request parameters directly to us, so they are authenticated and
+// cannot be altered in the browser; /authorize is then called with only client_id and the returned request_uri
+// API INPUT: Form data with the /authorize parameters (authorization_details included) and client credentials
+// API OUTPUT: request_uri and expires_in
+func (h *AuthorizeHandler) HandlePushedAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.writePARError(w, "invalid_request", "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// Clients authenticate as they do at the token endpoint (DB INTERACTION via clientRegistry)
+	client := h.authenticatePARClient(r)
+	if client == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="par"`)
+		h.writePARError(w, "invalid_client", "Client authentication failed", http.StatusUnauthorized)
+		return
+	}
+
+	// A pushed request cannot itself reference one (RFC 9126 §2.1)
+	if r.PostForm.Get("request_uri") != "" {
+		h.writePARError(w, "invalid_request", "request_uri is not allowed in a pushed request", http.StatusBadRequest)
+		return
+	}
+	if clientID := r.PostForm.Get("client_id"); clientID != "" && clientID != client.ClientID {
+		h.writePARError(w, "invalid_request", "client_id does not match the authenticated client", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	for name, values := range r.PostForm {
+		if name != "client_secret" {
+			params[name] = values
+		}
+	}
+	params.Set("client_id", client.ClientID)
+
+	// The request is validated now as /authorize would, so errors reach the client directly
+	if _, authErr := h.parseAuthorizationRequest(r.Context(), params); authErr != nil {
+		status := authErr.status
+		if authErr.redirect {
+			status = http.StatusBadRequest
+		}
+		h.writePARError(w, authErr.code, authErr.description, status)
+		return
+	}
+
+	requestURI := h.authCodeService.StorePushedRequest(&oauth.PushedRequest{
+		ClientID:  client.ClientID,
+		Params:    params,
+		ExpiresAt: time.Now().Add(oauth.PushedRequestTTL),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request_uri": requestURI,
+		"expires_in":  int(oauth.PushedRequestTTL.Seconds()),
+	})
+}
+
+// authenticatePARClient returns the client pushing the request, or nil
+// Confidential clients must present their secret; public clients only send client_id
+func (h *AuthorizeHandler) authenticatePARClient(r *http.Request) *storage.OAuthClient {
+	clientID, clientSecret := r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	if basicID, basicSecret, ok := r.BasicAuth(); ok {
+		// Basic credentials are form-urlencoded first (RFC 6749 §2.3.1)
+		clientID, _ = url.QueryUnescape(basicID)
+		clientSecret, _ = url.QueryUnescape(basicSecret)
+	}
+	if clientID == "" {
+		return nil
+	}
+
+	// Unknown clients fail rather than being registered on the fly
+	client, err := h.clientRegistry.FindClient(r.Context(), clientID)
+	if err != nil || client == nil {
+		return nil
+	}
+	if client.IsConfidential() && client.ClientSecret != clientSecret {
+		return nil
+	}
+	return client
+}
+
+// writePARError writes an OAuth error response for /par
+func (h *AuthorizeHandler) writePARError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
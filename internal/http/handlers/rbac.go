@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/user"
+)
+
+// RBACHandler lets administrators manage roles, groups, memberships and role assignments
+// API INPUT: Bearer access token with the admin scope; POST bodies are JSON
+type RBACHandler struct {
+	rbacService  *user.RBACService
+	userAuth     *user.AuthService
+	tokenService *oauth.TokenService
+}
+
+func NewRBACHandler(rbacService *user.RBACService, userAuth *user.AuthService, tokenService *oauth.TokenService) *RBACHandler {
+	return &RBACHandler{
+		rbacService:  rbacService,
+		userAuth:     userAuth,
+		tokenService: tokenService,
+	}
+}
+
+// roleResponse is the public view of a role
+type roleResponse struct {
+	ID          string `json:"id"`
+	ClientID    string `json:"client_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// groupResponse is the public view of a group
+type groupResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	ExternalID  string `json:"external_id,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// rbacRequest is the body of the POST endpoints; each endpoint reads the fields it needs
+type rbacRequest struct {
+	ClientID    string `json:"client_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ExternalID  string `json:"external_id"`
+	RoleID      string `json:"role_id"`
+	GroupID     string `json:"group_id"`
+	UserID      string `json:"user_id"`
+}
+
+// HandleRoles processes the /admin/api/roles endpoint
+// API INPUT: GET lists roles; POST creates one from client_id, name and description; DELETE takes the id query param
+// DB INTERACTION: Reads, inserts and deletes roles
+func (h *RBACHandler) HandleRoles(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		roles, err := h.rbacService.ListRoles(r.Context())
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list roles", http.StatusInternalServerError)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, map[string]interface{}{"roles": roleResponses(roles)})
+	case http.MethodPost:
+		var req rbacRequest
+		if !h.decode(w, r, &req) {
+			return
+		}
+		role, err := h.rbacService.CreateRole(r.Context(), req.ClientID, req.Name, req.Description)
+		if err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.writeJSON(w, http.StatusCreated, roleResponses([]*storage.Role{role})[0])
+	case http.MethodDelete:
+		if err := h.rbacService.DeleteRole(r.Context(), r.URL.Query().Get("id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleGroups processes the /admin/api/groups endpoint
+// API INPUT: GET lists groups; POST creates one from name, description and external_id (a Google
+// Workspace group email); DELETE takes the id query param
+// DB INTERACTION: Reads, inserts and deletes groups
+func (h *RBACHandler) HandleGroups(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		groups, err := h.rbacService.ListGroups(r.Context())
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list groups", http.StatusInternalServerError)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, map[string]interface{}{"groups": groupResponses(groups)})
+	case http.MethodPost:
+		var req rbacRequest
+		if !h.decode(w, r, &req) {
+			return
+		}
+		group, err := h.rbacService.CreateGroup(r.Context(), req.Name, req.Description, req.ExternalID)
+		if err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.writeJSON(w, http.StatusCreated, groupResponses([]*storage.Group{group})[0])
+	case http.MethodDelete:
+		if err := h.rbacService.DeleteGroup(r.Context(), r.URL.Query().Get("id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleGroupMembers processes the /admin/api/groups/members endpoint
+// API INPUT: GET takes the group_id query param; POST takes group_id and user_id;
+// DELETE takes the group_id and user_id query params
+// DB INTERACTION: Reads, inserts and deletes group memberships
+func (h *RBACHandler) HandleGroupMembers(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		group, ok := h.loadGroup(r.Context(), w, r.URL.Query().Get("group_id"))
+		if !ok {
+			return
+		}
+		members, err := h.rbacService.ListGroupMembers(r.Context(), group.ID)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list group members", http.StatusInternalServerError)
+			return
+		}
+		if members == nil {
+			members = []string{}
+		}
+		h.writeJSON(w, http.StatusOK, map[string]interface{}{"group_id": group.ID, "user_ids": members})
+	case http.MethodPost:
+		var req rbacRequest
+		if !h.decode(w, r, &req) {
+			return
+		}
+		group, ok := h.loadGroup(r.Context(), w, req.GroupID)
+		if !ok {
+			return
+		}
+		target, ok := h.loadUser(r.Context(), w, req.UserID)
+		if !ok {
+			return
+		}
+		if err := h.rbacService.AddGroupMember(r.Context(), group.ID, target.ID); err != nil {
+			h.writeError(w, "server_error", "Failed to add group member", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		query := r.URL.Query()
+		if err := h.rbacService.RemoveGroupMember(r.Context(), query.Get("group_id"), query.Get("user_id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRoleAssignments processes the /admin/api/role-assignments endpoint
+// API INPUT: POST takes role_id and one of user_id or group_id; DELETE takes the same as query params
+// DB INTERACTION: Inserts and deletes user and group role assignments
+func (h *RBACHandler) HandleRoleAssignments(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req rbacRequest
+		if !h.decode(w, r, &req) {
+			return
+		}
+		role, err := h.rbacService.GetRole(r.Context(), req.RoleID)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to retrieve role", http.StatusInternalServerError)
+			return
+		}
+		if role == nil {
+			h.writeError(w, "not_found", "Role not found", http.StatusNotFound)
+			return
+		}
+		if req.UserID != "" {
+			if _, ok := h.loadUser(r.Context(), w, req.UserID); !ok {
+				return
+			}
+		}
+		if req.GroupID != "" {
+			if _, ok := h.loadGroup(r.Context(), w, req.GroupID); !ok {
+				return
+			}
+		}
+		if err := h.rbacService.AssignRole(r.Context(), role.ID, req.UserID, req.GroupID); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		query := r.URL.Query()
+		if err := h.rbacService.UnassignRole(r.Context(), query.Get("role_id"), query.Get("user_id"), query.Get("group_id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleMemberships processes the /admin/api/memberships endpoint
+// API INPUT: GET with the user_id query param
+// API OUTPUT: The user's groups and the roles they hold, directly or through a group, for every client
+// INPUT FROM DB: Reads the user's roles and groups
+func (h *RBACHandler) HandleMemberships(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorize(w, r) {
+		return
+	}
+
+	target, ok := h.loadUser(r.Context(), w, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+	memberships, err := h.rbacService.GetMemberships(r.Context(), target.ID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to retrieve memberships", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": target.ID,
+		"roles":   roleResponses(memberships.Roles),
+		"groups":  groupResponses(memberships.Groups),
+	})
+}
+
+// authorize requires an access token with the admin scope, writing the error otherwise
+func (h *RBACHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	_, _, authErr := authenticateAdmin(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return false
+	}
+	return true
+}
+
+// decode reads a JSON request body, writing the error if it is malformed
+func (h *RBACHandler) decode(w http.ResponseWriter, r *http.Request, req *rbacRequest) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		h.writeError(w, "invalid_request", "Request body must be JSON", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// loadUser retrieves a user by ID, writing the error if it does not exist
+func (h *RBACHandler) loadUser(ctx context.Context, w http.ResponseWriter, userID string) (*storage.User, bool) {
+	target, err := h.userAuth.GetUser(ctx, userID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to retrieve user", http.StatusInternalServerError)
+		return nil, false
+	}
+	if target == nil {
+		h.writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return target, true
+}
+
+// loadGroup retrieves a group by ID, writing the error if it does not exist
+func (h *RBACHandler) loadGroup(ctx context.Context, w http.ResponseWriter, groupID string) (*storage.Group, bool) {
+	group, err := h.rbacService.GetGroup(ctx, groupID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to retrieve group", http.StatusInternalServerError)
+		return nil, false
+	}
+	if group == nil {
+		h.writeError(w, "not_found", "Group not found", http.StatusNotFound)
+		return nil, false
+	}
+	return group, true
+}
+
+// roleResponses converts roles to their public view
+func roleResponses(roles []*storage.Role) []roleResponse {
+	response := make([]roleResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, roleResponse{
+			ID:          role.ID,
+			ClientID:    role.ClientID,
+			Name:        role.Name,
+			Description: role.Description,
+			CreatedAt:   role.CreatedAt.Unix(),
+		})
+	}
+	return response
+}
+
+// groupResponses converts groups to their public view
+func groupResponses(groups []*storage.Group) []groupResponse {
+	response := make([]groupResponse, 0, len(groups))
+	for _, group := range groups {
+		response = append(response, groupResponse{
+			ID:          group.ID,
+			Name:        group.Name,
+			Description: group.Description,
+			ExternalID:  group.ExternalID,
+			CreatedAt:   group.CreatedAt.Unix(),
+		})
+	}
+	return response
+}
+
+// writeJSON writes a JSON response that must not be cached
+func (h *RBACHandler) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error response
+func (h *RBACHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+)
+
+// RevokeHandler handles token revocation (RFC 7009)
+type RevokeHandler struct {
+	tokenService   *oauth.TokenService
+	clientRegistry *oauth.ClientRegistry
+}
+
+func NewRevokeHandler(tokenService *oauth.TokenService, clientRegistry *oauth.ClientRegistry) *RevokeHandler {
+	return &RevokeHandler{
+		tokenService:   tokenService,
+		clientRegistry: clientRegistry,
+	}
+}
+
+// Handle processes token revocation requests
+// Clients may only revoke tokens issued to them. Unknown, expired and already revoked tokens
+// succeed without effect, so the response does not reveal whether a token existed (RFC 7009 §2.2)
+// API INPUT: Form data with token, token_type_hint and client credentials (form or Basic)
+// OUTPUT TO DB: Marks token as revoked via tokenService
+func (h *RevokeHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.writeError(w, "invalid_request", "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// Public clients identify themselves, confidential clients authenticate (DB INTERACTION via clientRegistry)
+	client := h.authenticateClient(r)
+	if client == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="revoke"`)
+		h.writeError(w, "invalid_client", "Client authentication failed", http.StatusUnauthorized)
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		h.writeError(w, "invalid_request", "Missing token parameter", http.StatusBadRequest)
+		return
+	}
+
+	// The hint only decides which kind of token is looked up first (INPUT FROM DB via tokenService)
+	issuedTo, found := "", false
+	if r.FormValue("token_type_hint") == "refresh_token" {
+		issuedTo, found = h.refreshTokenClient(r, token)
+		if !found {
+			issuedTo, found = h.accessTokenClient(r, token)
+		}
+	} else {
+		issuedTo, found = h.accessTokenClient(r, token)
+		if !found {
+			issuedTo, found = h.refreshTokenClient(r, token)
+		}
+	}
+	if !found {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if issuedTo != client.ClientID {
+		h.writeError(w, "unauthorized_client", "The token was not issued to this client", http.StatusBadRequest)
+		return
+	}
+
+	// Refresh tokens and opaque access tokens are revoked in place, JWTs also denylisted (OUTPUT TO DB via tokenService)
+	if err := h.tokenService.RevokeToken(r.Context(), token); err != nil {
+		h.writeError(w, "server_error", "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// accessTokenClient returns the client an active access token was issued to
+func (h *RevokeHandler) accessTokenClient(r *http.Request, token string) (string, bool) {
+	claims, err := h.tokenService.VerifyAccessToken(r.Context(), token)
+	if err != nil {
+		return "", false
+	}
+	return claims.ClientID, true
+}
+
+// refreshTokenClient returns the client an active refresh token was issued to
+func (h *RevokeHandler) refreshTokenClient(r *http.Request, token string) (string, bool) {
+	storedToken, err := h.tokenService.VerifyRefreshToken(r.Context(), token)
+	if err != nil {
+		return "", false
+	}
+	return storedToken.ClientID, true
+}
+
+// authenticateClient returns the client making the request, or nil
+// Confidential clients must present their secret; public clients only send client_id
+func (h *RevokeHandler) authenticateClient(r *http.Request) *storage.OAuthClient {
+	clientID, clientSecret := r.FormValue("client_id"), r.FormValue("client_secret")
+	if basicID, basicSecret, ok := r.BasicAuth(); ok {
+		// Basic credentials are form-urlencoded first (RFC 6749 §2.3.1)
+		clientID, _ = url.QueryUnescape(basicID)
+		clientSecret, _ = url.QueryUnescape(basicSecret)
+	}
+	if clientID == "" {
+		return nil
+	}
+
+	// Unknown clients fail rather than being registered on the fly
+	client, err := h.clientRegistry.FindClient(r.Context(), clientID)
+	if err != nil || client == nil {
+		return nil
+	}
+	if client.IsConfidential() && client.ClientSecret != clientSecret {
+		return nil
+	}
+	return client
+}
+
+// writeError writes an OAuth error response
+func (h *RevokeHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/user"
+)
+
+// SessionHandler lets users see and end their signed-in sessions, and administrators do so for any user
+// API INPUT: Bearer access token; the admin endpoints require the admin scope
+type SessionHandler struct {
+	sessionService *oauth.SessionService
+	clientRegistry *oauth.ClientRegistry
+	userAuth       *user.AuthService
+	tokenService   *oauth.TokenService
+}
+
+func NewSessionHandler(
+	sessionService *oauth.SessionService,
+	clientRegistry *oauth.ClientRegistry,
+	userAuth *user.AuthService,
+	tokenService *oauth.TokenService,
+) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+		clientRegistry: clientRegistry,
+		userAuth:       userAuth,
+		tokenService:   tokenService,
+	}
+}
+
+// refreshTokenResponse is the public view of a refresh token; the token value is never returned
+type refreshTokenResponse struct {
+	ID         string `json:"id"`
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name,omitempty"`
+	Scope      string `json:"scope"`
+	IPAddress  string `json:"ip_address,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at,omitempty"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+// sessionResponse is the public view of an SSO session ("signed-in device")
+type sessionResponse struct {
+	ID            string                 `json:"id"`
+	Current       bool                   `json:"current"`
+	IPAddress     string                 `json:"ip_address,omitempty"`
+	UserAgent     string                 `json:"user_agent,omitempty"`
+	AMR           []string               `json:"amr,omitempty"`
+	AuthTime      int64                  `json:"auth_time"`
+	CreatedAt     int64                  `json:"created_at"`
+	LastSeenAt    int64                  `json:"last_seen_at"`
+	ExpiresAt     int64                  `json:"expires_at"`
+	Clients       []string               `json:"clients"`
+	RefreshTokens []refreshTokenResponse `json:"refresh_tokens"`
+}
+
+type sessionsResponse struct {
+	Sessions      []sessionResponse      `json:"sessions"`
+	RefreshTokens []refreshTokenResponse `json:"refresh_tokens"` // tokens not tied to a live session
+}
+
+// HandleSessions processes the /account/sessions endpoint
+// API INPUT: Bearer access token; DELETE takes the session id query param
+// API OUTPUT: The user's live sessions with their clients and refresh tokens
+// DB INTERACTION: DELETE revokes the session and its refresh tokens
+func (h *SessionHandler) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	localUser, claims, authErr := authenticateBearer(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.writeSessions(r.Context(), w, localUser.ID, claims.SessionID)
+	case http.MethodDelete:
+		if err := h.sessionService.RevokeUserSession(r.Context(), localUser.ID, r.URL.Query().Get("id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleTokens processes the /account/tokens endpoint
+// API INPUT: Bearer access token; DELETE takes the refresh token id query param
+// OUTPUT TO DB: Revokes one of the user's refresh tokens
+func (h *SessionHandler) HandleTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	localUser, _, authErr := authenticateBearer(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	if err := h.sessionService.RevokeUserRefreshToken(r.Context(), localUser.ID, r.URL.Query().Get("id")); err != nil {
+		h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAdminSessions processes the /admin/api/sessions endpoint
+// API INPUT: Bearer access token with the admin scope and a user_id query param
+// GET lists the user's sessions; DELETE ends the session named by id, revokes the refresh token
+// named by token_id, or, with neither, signs the user out everywhere
+// DB INTERACTION: Reads and revokes sessions and refresh tokens
+func (h *SessionHandler) HandleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	_, _, authErr := authenticateAdmin(r, h.tokenService, h.userAuth)
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	query := r.URL.Query()
+	target, err := h.userAuth.GetUser(r.Context(), query.Get("user_id"))
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		h.writeError(w, "not_found", "User not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.writeSessions(r.Context(), w, target.ID, "")
+	case http.MethodDelete:
+		switch {
+		case query.Get("id") != "":
+			err = h.sessionService.RevokeUserSession(r.Context(), target.ID, query.Get("id"))
+		case query.Get("token_id") != "":
+			err = h.sessionService.RevokeUserRefreshToken(r.Context(), target.ID, query.Get("token_id"))
+		default:
+			err = h.sessionService.LogoutUser(r.Context(), target.ID, true)
+		}
+		if err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeSessions lists a user's sessions; currentSessionID marks the session the caller is using
+func (h *SessionHandler) writeSessions(ctx context.Context, w http.ResponseWriter, userID, currentSessionID string) {
+	summaries, unbound, err := h.sessionService.ListUserSessions(ctx, userID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	response := sessionsResponse{
+		Sessions:      make([]sessionResponse, 0, len(summaries)),
+		RefreshTokens: refreshTokenResponses(ctx, h.clientRegistry, unbound),
+	}
+	for _, summary := range summaries {
+		session := summary.Session
+		clients := []string(session.ClientIDs)
+		if clients == nil {
+			clients = []string{}
+		}
+		response.Sessions = append(response.Sessions, sessionResponse{
+			ID:            session.ID,
+			Current:       currentSessionID != "" && session.ID == currentSessionID,
+			IPAddress:     session.IPAddress,
+			UserAgent:     session.UserAgent,
+			AMR:           session.AMR,
+			AuthTime:      session.AuthTime.Unix(),
+			CreatedAt:     session.CreatedAt.Unix(),
+			LastSeenAt:    session.LastSeenAt.Unix(),
+			ExpiresAt:     session.ExpiresAt.Unix(),
+			Clients:       clients,
+			RefreshTokens: refreshTokenResponses(ctx, h.clientRegistry, summary.RefreshTokens),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// refreshTokenResponses converts refresh tokens to their public view
+func refreshTokenResponses(ctx context.Context, clientRegistry *oauth.ClientRegistry, tokens []*storage.RefreshToken) []refreshTokenResponse {
+	response := make([]refreshTokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		item := refreshTokenResponse{
+			ID:        token.ID,
+			ClientID:  token.ClientID,
+			Scope:     token.Scope,
+			IPAddress: token.IPAddress,
+			UserAgent: token.UserAgent,
+			CreatedAt: token.CreatedAt.Unix(),
+			ExpiresAt: token.ExpiresAt.Unix(),
+		}
+		if token.LastUsedAt != nil {
+			item.LastUsedAt = token.LastUsedAt.Unix()
+		}
+		if client, err := clientRegistry.FindClient(ctx, token.ClientID); err == nil && client != nil {
+			item.ClientName = client.ClientName
+		}
+		response = append(response, item)
+	}
+	return response
+}
+
+// writeError writes an error response
+func (h *SessionHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -19,6 +20,7 @@ type TokenHandler struct {
 	clientRegistry  *oauth.ClientRegistry
 	pkceValidator   *oauth.PKCEValidator
 	userAuth        *user.AuthService
+	detailsRegistry *oauth.AuthorizationDetailsRegistry
 }
 
 func NewTokenHandler(
@@ -28,6 +30,7 @@ func NewTokenHandler(
 	clientRegistry *oauth.ClientRegistry,
 	pkceValidator *oauth.PKCEValidator,
 	userAuth *user.AuthService,
+	detailsRegistry *oauth.AuthorizationDetailsRegistry,
 ) *TokenHandler {
 	return &TokenHandler{
 		config:          cfg,
@@ -36,6 +39,7 @@ func NewTokenHandler(
 		clientRegistry:  clientRegistry,
 		pkceValidator:   pkceValidator,
 		userAuth:        userAuth,
+		detailsRegistry: detailsRegistry,
 	}
 }
 
@@ -49,6 +53,11 @@ type TokenRequest struct {
 	ClientSecret string `json:"client_secret"`
 	CodeVerifier string `json:"code_verifier"`
 	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	// Resources are the RFC 8707 resource parameters; a JSON body sends them as an array
+	Resources []string `json:"resource"`
+	// AuthorizationDetails narrows the authorized details (RFC 9396 §6.1); a JSON array
+	AuthorizationDetails json.RawMessage `json:"authorization_details,omitempty"`
 }
 
 // TokenResponse represents the token exchange response
@@ -59,10 +68,14 @@ type TokenResponse struct {
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// AuthorizationDetails echoes the details the access token carries (RFC 9396 §7)
+	AuthorizationDetails []oauth.AuthorizationDetail `json:"authorization_details,omitempty"`
 }
 
 // Handle processes the /token endpoint
-// API INPUT: Form data or JSON body with grant_type, code, client credentials
+// API INPUT: Form data or JSON body with grant_type, code, client credentials, scope, resource
+// and authorization_details
 // OUTPUT TO DB: Stores access token and refresh token via tokenService
 func (h *TokenHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -90,6 +103,9 @@ func (h *TokenHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		req.ClientSecret = r.FormValue("client_secret")
 		req.CodeVerifier = r.FormValue("code_verifier")
 		req.RefreshToken = r.FormValue("refresh_token")
+		req.Scope = r.FormValue("scope")
+		req.Resources = r.Form["resource"]
+		req.AuthorizationDetails = json.RawMessage(r.FormValue("authorization_details"))
 	}
 
 	// Validate grant type
@@ -112,7 +128,7 @@ func (h *TokenHandler) handleAuthorizationCodeGrant(w http.ResponseWriter, r *ht
 	}
 
 	// Validate client credentials (DB interaction via clientRegistry)
-	client, err := h.clientRegistry.GetClient(req.ClientID)
+	client, err := h.clientRegistry.GetClient(r.Context(), req.ClientID)
 	if err != nil || client == nil {
 		h.writeError(w, "invalid_client", "Invalid client credentials", http.StatusUnauthorized)
 		return
@@ -162,15 +178,55 @@ func (h *TokenHandler) handleAuthorizationCodeGrant(w http.ResponseWriter, r *ht
 		}
 	}
 
-	// Create or update user in database (OUTPUT TO DB via userAuth)
-	user, err := h.userAuth.CreateOrUpdateUser(authCode.UserID, authCode.UserInfo)
+	// Requested authorization details may only narrow those the user approved (RFC 9396 §6.1)
+	details, err := h.detailsRegistry.Parse(client, string(req.AuthorizationDetails))
 	if err != nil {
-		h.writeError(w, "server_error", "Failed to create user", http.StatusInternalServerError)
+		h.writeError(w, "invalid_authorization_details", err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Generate tokens (OUTPUT TO DB via tokenService)
-	tokens, err := h.tokenService.GenerateTokens(user, authCode.Scope)
+	// Load the user created at login (INPUT FROM DB via userAuth)
+	user, err := h.userAuth.GetUser(r.Context(), authCode.UserID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		h.writeError(w, "invalid_grant", "User no longer exists", http.StatusBadRequest)
+		return
+	}
+	if user.Disabled {
+		h.writeError(w, "invalid_grant", "User is disabled", http.StatusBadRequest)
+		return
+	}
+
+	// Generate tokens, audienced to the requested resource (OUTPUT TO DB via tokenService)
+	grant := &oauth.Grant{
+		Scope:                authCode.Scope,
+		Resources:            authCode.Resources,
+		AuthorizationDetails: authCode.AuthorizationDetails,
+	}
+	access := &oauth.AccessRequest{Resources: req.Resources, AuthorizationDetails: details}
+	tokens, err := h.tokenService.GenerateTokens(r.Context(), user, client, grant, access, &oauth.AuthenticationContext{
+		AMR:       authCode.AMR,
+		ACR:       authCode.ACR,
+		SessionID: authCode.SessionID,
+		AuthTime:  authCode.AuthTime,
+		Nonce:     authCode.Nonce,
+		Code:      req.Code,
+	}, oauth.RequesterFromRequest(r))
+	if errors.Is(err, oauth.ErrInvalidTarget) {
+		h.writeError(w, "invalid_target", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, oauth.ErrInvalidScope) {
+		h.writeError(w, "invalid_scope", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, oauth.ErrInvalidAuthorizationDetails) {
+		h.writeError(w, "invalid_authorization_details", err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		h.writeError(w, "server_error", "Failed to generate tokens", http.StatusInternalServerError)
 		return
@@ -192,7 +248,7 @@ func (h *TokenHandler) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Re
 	}
 
 	// Validate client credentials (DB interaction via clientRegistry)
-	client, err := h.clientRegistry.GetClient(req.ClientID)
+	client, err := h.clientRegistry.GetClient(r.Context(), req.ClientID)
 	if err != nil || client == nil {
 		h.writeError(w, "invalid_client", "Invalid client credentials", http.StatusUnauthorized)
 		return
@@ -204,8 +260,27 @@ func (h *TokenHandler) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Refresh tokens (DB interaction via tokenService)
-	tokens, err := h.tokenService.RefreshTokens(req.RefreshToken, req.ClientID)
+	details, err := h.detailsRegistry.Parse(client, string(req.AuthorizationDetails))
+	if err != nil {
+		h.writeError(w, "invalid_authorization_details", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Refresh tokens, optionally narrowing the grant or picking a resource (DB interaction via tokenService)
+	access := &oauth.AccessRequest{Scope: req.Scope, Resources: req.Resources, AuthorizationDetails: details}
+	tokens, err := h.tokenService.RefreshTokens(r.Context(), req.RefreshToken, client, access, oauth.RequesterFromRequest(r))
+	if errors.Is(err, oauth.ErrInvalidTarget) {
+		h.writeError(w, "invalid_target", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, oauth.ErrInvalidScope) {
+		h.writeError(w, "invalid_scope", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, oauth.ErrInvalidAuthorizationDetails) {
+		h.writeError(w, "invalid_authorization_details", err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		h.writeError(w, "invalid_grant", err.Error(), http.StatusBadRequest)
 		return
@@ -218,11 +293,13 @@ func (h *TokenHandler) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Re
 // writeTokenResponse writes the token response to the client
 func (h *TokenHandler) writeTokenResponse(w http.ResponseWriter, tokens *oauth.TokenPair) {
 	response := TokenResponse{
-		AccessToken:  tokens.AccessToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
-		RefreshToken: tokens.RefreshToken,
-		IDToken:      tokens.IDToken,
+		AccessToken:          tokens.AccessToken,
+		TokenType:            "Bearer",
+		ExpiresIn:            int(tokens.ExpiresIn.Seconds()),
+		RefreshToken:         tokens.RefreshToken,
+		IDToken:              tokens.IDToken,
+		Scope:                tokens.Scope,
+		AuthorizationDetails: tokens.AuthorizationDetails,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
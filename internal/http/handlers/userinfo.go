@@ -5,21 +5,33 @@ import (
 	"net/http"
 	"strings"
 
-	"oauth-golang/internal/security"
+	"oauth-golang/internal/oauth"
 	"oauth-golang/internal/storage"
 )
 
 // UserInfoHandler handles the /userinfo endpoint
 // API INPUT: Receives access token from Authorization header
 type UserInfoHandler struct {
-	jwtService *security.JWTService
-	userRepo   *storage.UserRepository
+	tokenService   *oauth.TokenService
+	userRepo       storage.UserRepository
+	clientRegistry *oauth.ClientRegistry
+	subjectService *oauth.SubjectService
+	claimsService  *oauth.ClaimsService
 }
 
-func NewUserInfoHandler(jwtService *security.JWTService, userRepo *storage.UserRepository) *UserInfoHandler {
+func NewUserInfoHandler(
+	tokenService *oauth.TokenService,
+	userRepo storage.UserRepository,
+	clientRegistry *oauth.ClientRegistry,
+	subjectService *oauth.SubjectService,
+	claimsService *oauth.ClaimsService,
+) *UserInfoHandler {
 	return &UserInfoHandler{
-		jwtService: jwtService,
-		userRepo:   userRepo,
+		tokenService:   tokenService,
+		userRepo:       userRepo,
+		clientRegistry: clientRegistry,
+		subjectService: subjectService,
+		claimsService:  claimsService,
 	}
 }
 
@@ -33,6 +45,14 @@ type UserInfoResponse struct {
 	GivenName     string `json:"given_name,omitempty"`
 	FamilyName    string `json:"family_name,omitempty"`
 	Picture       string `json:"picture,omitempty"`
+	// Extra holds custom claims from the claims pipeline
+	Extra map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON adds the custom claims to the standard ones
+func (r UserInfoResponse) MarshalJSON() ([]byte, error) {
+	type standard UserInfoResponse
+	return marshalWithClaims(standard(r), r.Extra)
 }
 
 // Handle processes the /userinfo endpoint
@@ -61,15 +81,19 @@ func (h *UserInfoHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 	accessToken := parts[1]
 
-	// Verify and decode JWT token
-	claims, err := h.jwtService.VerifyAccessToken(accessToken)
+	// Verify the access token (JWT or opaque)
+	claims, err := h.tokenService.VerifyAccessToken(r.Context(), accessToken)
 	if err != nil {
 		h.writeError(w, "invalid_token", "Invalid or expired token", http.StatusUnauthorized)
 		return
 	}
+	if !issuedForThisService(claims) {
+		h.writeError(w, "invalid_token", "Token was issued for another resource", http.StatusUnauthorized)
+		return
+	}
 
 	// Retrieve user information from database (DB INTERACTION via userRepo)
-	user, err := h.userRepo.GetUserByID(claims.Subject)
+	user, err := h.userRepo.GetUserByID(r.Context(), claims.Subject)
 	if err != nil {
 		h.writeError(w, "server_error", "Failed to retrieve user information", http.StatusInternalServerError)
 		return
@@ -79,16 +103,36 @@ func (h *UserInfoHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, "invalid_token", "User not found", http.StatusUnauthorized)
 		return
 	}
+	if user.Disabled {
+		h.writeError(w, "invalid_token", "User is disabled", http.StatusUnauthorized)
+		return
+	}
+
+	// The sub must match the one in the client's ID token (OIDC Core §5.3.2)
+	client, _ := h.clientRegistry.GetClient(r.Context(), claims.ClientID)
+	subject, err := h.subjectService.SubjectFor(client, user.ID)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to derive subject", http.StatusInternalServerError)
+		return
+	}
+
+	// Custom claims for this client and scope (DB INTERACTION via claimsService)
+	extra, err := h.claimsService.Build(r.Context(), &oauth.ClaimsRequest{Target: oauth.ClaimTargetUserInfo, User: user, Client: client, Scope: claims.Scope})
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to build claims", http.StatusInternalServerError)
+		return
+	}
 
 	// Build user info response (API OUTPUT)
 	response := UserInfoResponse{
-		Sub:           user.ID,
+		Sub:           subject,
 		Email:         user.Email,
 		EmailVerified: user.EmailVerified,
 		Name:          user.Name,
 		GivenName:     user.GivenName,
 		FamilyName:    user.FamilyName,
 		Picture:       user.Picture,
+		Extra:         extra,
 	}
 
 	// Return user info as JSON
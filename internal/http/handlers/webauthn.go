@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/user"
+)
+
+// WebAuthnHandler handles passkey registration, passwordless login and security-key second factor
+// API INPUT: Receives WebAuthn ceremony responses from the browser
+type WebAuthnHandler struct {
+	authCodeService *oauth.AuthCodeService
+	webauthnService *user.WebAuthnService
+	mfaService      *user.MFAService
+	consentService  *oauth.ConsentService
+	scopeRegistry   *oauth.ScopeRegistry
+	sessionService  *oauth.SessionService
+	userAuth        *user.AuthService
+	tokenService    *oauth.TokenService
+}
+
+func NewWebAuthnHandler(
+	authCodeService *oauth.AuthCodeService,
+	webauthnService *user.WebAuthnService,
+	mfaService *user.MFAService,
+	consentService *oauth.ConsentService,
+	scopeRegistry *oauth.ScopeRegistry,
+	sessionService *oauth.SessionService,
+	userAuth *user.AuthService,
+	tokenService *oauth.TokenService,
+) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		authCodeService: authCodeService,
+		webauthnService: webauthnService,
+		mfaService:      mfaService,
+		consentService:  consentService,
+		scopeRegistry:   scopeRegistry,
+		sessionService:  sessionService,
+		userAuth:        userAuth,
+		tokenService:    tokenService,
+	}
+}
+
+// webauthnAssertScript runs an assertion ceremony against a begin/finish endpoint pair
+// and follows the redirect_uri returned on success
+const webauthnAssertScript = `
+function b64urlToBuf(s) {
+  s = s.replace(/-/g, '+').replace(/_/g, '/');
+  while (s.length % 4) s += '=';
+  return Uint8Array.from(atob(s), c => c.charCodeAt(0)).buffer;
+}
+function bufToB64url(b) {
+  return btoa(String.fromCharCode(...new Uint8Array(b))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+async function webauthnAssert(beginURL, finishURL) {
+  const begin = await fetch(beginURL, {method: 'POST'});
+  if (!begin.ok) throw new Error(await begin.text());
+  const {ceremony_id, options} = await begin.json();
+  const pk = options.publicKey;
+  pk.challenge = b64urlToBuf(pk.challenge);
+  (pk.allowCredentials || []).forEach(c => c.id = b64urlToBuf(c.id));
+  const cred = await navigator.credentials.get({publicKey: pk});
+  const body = {
+    id: cred.id, rawId: bufToB64url(cred.rawId), type: cred.type,
+    response: {
+      clientDataJSON: bufToB64url(cred.response.clientDataJSON),
+      authenticatorData: bufToB64url(cred.response.authenticatorData),
+      signature: bufToB64url(cred.response.signature),
+      userHandle: cred.response.userHandle ? bufToB64url(cred.response.userHandle) : null
+    }
+  };
+  const finish = await fetch(finishURL + '&ceremony_id=' + encodeURIComponent(ceremony_id), {
+    method: 'POST', headers: {'Content-Type': 'application/json'}, body: JSON.stringify(body)
+  });
+  if (!finish.ok) throw new Error(await finish.text());
+  window.location = (await finish.json()).redirect_uri;
+}
+function runAssert(beginURL, finishURL) {
+  webauthnAssert(beginURL, finishURL).catch(e => { document.getElementById('webauthn-error').textContent = e.message; });
+}
+`
+
+// passkeyLoginPage offers passwordless sign-in as an alternative to Google
+var passkeyLoginPage = template.Must(template.New("passkey").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in with a passkey</title></head>
+<body>
+  <h1>Sign in with a passkey</h1>
+  <p id="webauthn-error" style="color:#b00"></p>
+  <button onclick="runAssert('/webauthn/login/begin?session=' + encodeURIComponent({{.SessionID}}), '/webauthn/login/finish?session=' + encodeURIComponent({{.SessionID}}))">Use passkey</button>
+  <p><a href="{{.GoogleURL}}">Sign in with Google instead</a></p>
+  <script>` + webauthnAssertScript + `</script>
+</body>
+</html>`))
+
+type passkeyLoginView struct {
+	SessionID string
+	GoogleURL string
+}
+
+// renderPasskeyLogin writes the passwordless sign-in page for a pending /authorize session
+func renderPasskeyLogin(w http.ResponseWriter, view passkeyLoginView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	passkeyLoginPage.Execute(w, view)
+}
+
+// HandleLoginBegin processes the /webauthn/login/begin endpoint
+// API OUTPUT: Assertion options for a discoverable credential
+func (h *WebAuthnHandler) HandleLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.authCodeService.GetSession(r.URL.Query().Get("session")) == nil {
+		h.writeError(w, "invalid_request", "Invalid or expired session", http.StatusBadRequest)
+		return
+	}
+
+	ceremonyID, options, err := h.webauthnService.BeginLogin()
+	if err != nil {
+		h.writeError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeCeremony(w, ceremonyID, options)
+}
+
+// HandleLoginFinish processes the /webauthn/login/finish endpoint
+// API INPUT: Assertion response from navigator.credentials.get()
+// OUTPUT: Authorization code issued for the pending /authorize session
+func (h *WebAuthnHandler) HandleLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := r.URL.Query().Get("session")
+	session := h.authCodeService.GetSession(sessionID)
+	if session == nil {
+		h.writeError(w, "invalid_request", "Invalid or expired session", http.StatusBadRequest)
+		return
+	}
+
+	localUser, err := h.webauthnService.FinishLogin(r.URL.Query().Get("ceremony_id"), r)
+	if err != nil {
+		h.writeError(w, "access_denied", err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	h.authCodeService.DeleteSession(sessionID)
+
+	// User verification is required for passkey login, so it satisfies MFA on its own
+	h.writeRedirect(w, r, &oauth.PendingConsent{
+		Session: session,
+		UserID:  localUser.ID,
+		AMR:     []string{"hwk", "user", "mfa"},
+		ACR:     oauth.ACRMultiFactor,
+	})
+}
+
+// HandleMFABegin processes the /webauthn/mfa/begin endpoint
+// API OUTPUT: Assertion options restricted to the challenged user's credentials
+func (h *WebAuthnHandler) HandleMFABegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challenge := h.authCodeService.GetMFAChallenge(r.URL.Query().Get("challenge"))
+	if challenge == nil {
+		h.writeError(w, "invalid_request", "Invalid or expired MFA challenge", http.StatusBadRequest)
+		return
+	}
+
+	localUser, err := h.userAuth.GetUser(r.Context(), challenge.UserID)
+	if err != nil || localUser == nil {
+		h.writeError(w, "server_error", "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	ceremonyID, options, err := h.webauthnService.BeginSecondFactor(r.Context(), localUser)
+	if err != nil {
+		h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeCeremony(w, ceremonyID, options)
+}
+
+// HandleMFAFinish processes the /webauthn/mfa/finish endpoint
+// API INPUT: Assertion response from navigator.credentials.get()
+// OUTPUT: Authorization code issued for the pending MFA challenge
+func (h *WebAuthnHandler) HandleMFAFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challengeID := r.URL.Query().Get("challenge")
+	challenge := h.authCodeService.GetMFAChallenge(challengeID)
+	if challenge == nil {
+		h.writeError(w, "invalid_request", "Invalid or expired MFA challenge", http.StatusBadRequest)
+		return
+	}
+
+	localUser, err := h.userAuth.GetUser(r.Context(), challenge.UserID)
+	if err != nil || localUser == nil {
+		h.writeError(w, "server_error", "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.webauthnService.FinishSecondFactor(localUser, r.URL.Query().Get("ceremony_id"), r); err != nil {
+		if h.authCodeService.RecordMFAFailure(challengeID) >= maxMFAAttempts {
+			h.authCodeService.DeleteMFAChallenge(challengeID)
+		}
+		h.writeError(w, "access_denied", err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	h.authCodeService.DeleteMFAChallenge(challengeID)
+
+	h.writeRedirect(w, r, &oauth.PendingConsent{
+		Session:  challenge.Session,
+		UserID:   challenge.UserID,
+		UserInfo: challenge.UserInfo,
+		AMR:      []string{"fed", "hwk", "mfa"},
+		ACR:      oauth.ACRMultiFactor,
+	})
+}
+
+// HandleRegisterBegin processes the /webauthn/register/begin endpoint
+// API INPUT: Bearer access token from a recent sign-in, using the second factor when one is enrolled
+// API OUTPUT: Options for navigator.credentials.create()
+func (h *WebAuthnHandler) HandleRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	localUser, _, authErr := authenticateStepUp(r, h.tokenService, h.userAuth, h.mfaService, h.webauthnService, "register a passkey")
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	ceremonyID, options, err := h.webauthnService.BeginRegistration(r.Context(), localUser)
+	if err != nil {
+		h.writeError(w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeCeremony(w, ceremonyID, options)
+}
+
+// HandleRegisterFinish processes the /webauthn/register/finish endpoint
+// API INPUT: Step-up Bearer access token as for begin, ceremony_id and name query params, attestation response body
+// OUTPUT TO DB: Stores the new credential via webauthnService
+func (h *WebAuthnHandler) HandleRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	localUser, _, authErr := authenticateStepUp(r, h.tokenService, h.userAuth, h.mfaService, h.webauthnService, "register a passkey")
+	if authErr != nil {
+		h.writeError(w, authErr.code, authErr.description, authErr.status)
+		return
+	}
+
+	credential, err := h.webauthnService.FinishRegistration(
+		localUser,
+		r.URL.Query().Get("ceremony_id"),
+		r.URL.Query().Get("name"),
+		r,
+	)
+	if err != nil {
+		h.writeError(w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(credentialResponse{
+		ID:         credential.ID,
+		Name:       credential.Name,
+		CreatedAt:  credential.CreatedAt.Unix(),
+		LastUsedAt: credential.LastUsedAt.Unix(),
+	})
+}
+
+// credentialResponse is the public view of a registered credential
+type credentialResponse struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	CreatedAt    int64  `json:"created_at"`
+	LastUsedAt   int64  `json:"last_used_at"`
+	CloneWarning bool   `json:"clone_warning,omitempty"`
+}
+
+// HandleCredentials processes the /webauthn/credentials endpoint
+// API INPUT: Bearer access token; DELETE takes an id query param and needs a step-up token
+// API OUTPUT: The user's registered credentials
+func (h *WebAuthnHandler) HandleCredentials(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		localUser, _, authErr := authenticateBearer(r, h.tokenService, h.userAuth)
+		if authErr != nil {
+			h.writeError(w, authErr.code, authErr.description, authErr.status)
+			return
+		}
+
+		credentials, err := h.webauthnService.ListCredentials(r.Context(), localUser.ID)
+		if err != nil {
+			h.writeError(w, "server_error", "Failed to list credentials", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]credentialResponse, 0, len(credentials))
+		for _, credential := range credentials {
+			response = append(response, credentialResponse{
+				ID:           credential.ID,
+				Name:         credential.Name,
+				CreatedAt:    credential.CreatedAt.Unix(),
+				LastUsedAt:   credential.LastUsedAt.Unix(),
+				CloneWarning: credential.CloneWarning,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	case http.MethodDelete:
+		// Removing a passkey can remove the user's second factor, so it needs the same step-up as adding one
+		localUser, _, authErr := authenticateStepUp(r, h.tokenService, h.userAuth, h.mfaService, h.webauthnService, "remove a passkey")
+		if authErr != nil {
+			h.writeError(w, authErr.code, authErr.description, authErr.status)
+			return
+		}
+
+		if err := h.webauthnService.DeleteCredential(r.Context(), localUser.ID, r.URL.Query().Get("id")); err != nil {
+			h.writeError(w, "invalid_request", err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeCeremony writes ceremony options along with the ID needed to finish it
+func (h *WebAuthnHandler) writeCeremony(w http.ResponseWriter, ceremonyID string, options interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ceremony_id": ceremonyID,
+		"options":     options,
+	})
+}
+
+// writeRedirect establishes the SSO session for the completed login and tells the browser
+// script where to send the user next: the consent screen or the client with a new authorization code
+func (h *WebAuthnHandler) writeRedirect(w http.ResponseWriter, r *http.Request, pending *oauth.PendingConsent) {
+	loginSession, err := h.sessionService.Start(w, r, pending.UserID, pending.AMR, pending.ACR)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	pending.SessionID = loginSession.ID
+	pending.AuthTime = loginSession.AuthTime
+
+	redirectURL, err := completeAuthorization(r.Context(), h.authCodeService, h.consentService, h.scopeRegistry, pending)
+	if err != nil {
+		h.writeError(w, "server_error", "Failed to complete authorization", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{
+		"redirect_uri": redirectURL,
+	})
+}
+
+// writeError writes an error response
+func (h *WebAuthnHandler) writeError(w http.ResponseWriter, errorCode, description string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             errorCode,
+		"error_description": description,
+	})
+}
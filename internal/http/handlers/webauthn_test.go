@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+)
+
+func newWebAuthnHandler(s *testServices) *WebAuthnHandler {
+	return NewWebAuthnHandler(s.authCodes, s.webauthn, s.mfaService, s.consentService, s.scopeRegistry, s.sessionService, s.userAuth, s.tokenService)
+}
+
+func TestHandleCredentialsDeleteRequiresStepUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		authn      *oauth.AuthenticationContext
+		wantCode   string
+		wantStatus int
+	}{
+		{"no sign-in time", nil, "login_required", http.StatusForbidden},
+		{"stale sign-in", &oauth.AuthenticationContext{AuthTime: time.Now().Add(-time.Hour), ACR: oauth.ACRMultiFactor}, "login_required", http.StatusForbidden},
+		{"single factor", &oauth.AuthenticationContext{AuthTime: time.Now(), ACR: oauth.ACRSingleFactor}, "insufficient_user_authentication", http.StatusUnauthorized},
+		{"recent multi-factor", &oauth.AuthenticationContext{AuthTime: time.Now(), ACR: oauth.ACRMultiFactor}, "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t)
+			handler := newWebAuthnHandler(s)
+			if err := s.repos.WebAuthn.CreateCredential(ctx, &storage.WebAuthnCredential{
+				ID: "cred-1", UserID: "user-1", Name: "Laptop", PublicKey: []byte("key"), CreatedAt: time.Now(), LastUsedAt: time.Now(),
+			}); err != nil {
+				t.Fatalf("CreateCredential: %v", err)
+			}
+			accessToken := s.issueTokens(t, "public-app", "openid", tt.authn).AccessToken
+
+			// Listing passkeys only needs a valid token
+			req := httptest.NewRequest(http.MethodGet, "/webauthn/credentials", nil)
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			rec := httptest.NewRecorder()
+			handler.HandleCredentials(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got GET status %d: %s", rec.Code, rec.Body)
+			}
+
+			req = httptest.NewRequest(http.MethodDelete, "/webauthn/credentials?id=cred-1", nil)
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			rec = httptest.NewRecorder()
+			handler.HandleCredentials(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got DELETE status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantCode != "" {
+				var body map[string]string
+				json.NewDecoder(rec.Body).Decode(&body)
+				if body["error"] != tt.wantCode {
+					t.Errorf("got error %q, want %q", body["error"], tt.wantCode)
+				}
+			}
+
+			credentials, err := s.repos.WebAuthn.ListByUser(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("ListByUser: %v", err)
+			}
+			if removed := len(credentials) == 0; removed != (tt.wantStatus == http.StatusNoContent) {
+				t.Errorf("got %d credentials left", len(credentials))
+			}
+		})
+	}
+}
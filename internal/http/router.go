@@ -1,6 +1,8 @@
 package http
 
 import (
+	"context"
+	"log"
 	"net/http"
 
 	"oauth-golang/internal/config"
@@ -13,32 +15,62 @@ import (
 
 // NewRouter creates and configures the HTTP router with all endpoints
 // This is the main API input layer - handles all HTTP requests
-func NewRouter(
-	cfg *config.Config,
-	userRepo *storage.UserRepository,
-	storageService *storage.Storage,
-	tokenRepo *storage.TokenRepository,
-) http.Handler {
+// ctx is the server's lifetime; background work such as back-channel logout retries stops when it ends
+func NewRouter(ctx context.Context, cfg *config.Config, repos *storage.Repositories) http.Handler {
 	mux := http.NewServeMux()
 
 	// Initialize security components
-	jwtService := security.NewJWTService(cfg.JWTSecret)
+	signingKey, err := security.LoadSigningKey(cfg.SigningKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load signing key: %v", err)
+	}
+	jwtService := security.NewJWTService(cfg.Issuer, signingKey)
 
 	// Initialize OAuth components (handles Google OAuth provider interaction)
-	authCodeService := oauth.NewAuthCodeService()
-	tokenService := oauth.NewTokenService(cfg, jwtService, tokenRepo)
-	clientRegistry := oauth.NewClientRegistry(storageService)
+	clientRegistry := oauth.NewClientRegistry(repos.Clients)
+	tokenPolicies := oauth.NewTokenPolicies(cfg, clientRegistry)
+	authCodeService := oauth.NewAuthCodeService(tokenPolicies)
+	subjectService := oauth.NewSubjectService(cfg.PairwiseSalt)
+	resourceRegistry := oauth.NewResourceRegistry(repos.Resources)
+	detailsRegistry := oauth.NewAuthorizationDetailsRegistry()
+	detailsRegistry.Register(oauth.PaymentInitiationType{})
+	claimsService := oauth.NewClaimsService(repos.ClaimRules)
+	tokenService := oauth.NewTokenService(cfg, jwtService, repos.Tokens, repos.Sessions, repos.Users, subjectService, tokenPolicies, resourceRegistry, claimsService)
+	scopeRegistry := oauth.NewScopeRegistry(repos.Scopes)
 	pkceValidator := oauth.NewPKCEValidator()
-
-	// Initialize user authentication service
-	userAuth := user.NewAuthService(userRepo)
+	logoutNotifier := oauth.NewLogoutNotifier(ctx, jwtService, subjectService, clientRegistry)
+	cookieCodec, err := security.NewCookieCodec(cfg.SessionSecret)
+	if err != nil {
+		log.Fatalf("Failed to initialize session cookies: %v", err)
+	}
+	sessionService := oauth.NewSessionService(repos.Sessions, repos.Tokens, logoutNotifier, cookieCodec, cfg.SessionTTL, cfg.SessionCookieSecure)
+	consentService := oauth.NewConsentService(repos.Consents, repos.Tokens, clientRegistry, scopeRegistry)
+
+	// Initialize user authentication services
+	userAuth := user.NewAuthService(repos.Users, repos.Identities, repos.RBAC)
+	rbacService := user.NewRBACService(repos.RBAC)
+	claimsService.SetMembershipSource(rbacService)
+	scopeRegistry.SetRoleSource(rbacService)
+	mfaService := user.NewMFAService(repos.MFA, cfg.MFAIssuer)
+	webauthnService, err := user.NewWebAuthnService(cfg.WebAuthnRPID, cfg.MFAIssuer, cfg.WebAuthnRPOrigins, repos.WebAuthn, repos.Users)
+	if err != nil {
+		log.Fatalf("Failed to initialize WebAuthn: %v", err)
+	}
 
 	// Initialize handlers (API input/output layer)
 	authorizeHandler := handlers.NewAuthorizeHandler(
 		cfg,
 		clientRegistry,
+		scopeRegistry,
+		resourceRegistry,
+		detailsRegistry,
 		authCodeService,
 		pkceValidator,
+		userAuth,
+		mfaService,
+		webauthnService,
+		consentService,
+		sessionService,
 	)
 	tokenHandler := handlers.NewTokenHandler(
 		cfg,
@@ -47,17 +79,84 @@ func NewRouter(
 		clientRegistry,
 		pkceValidator,
 		userAuth,
+		detailsRegistry,
 	)
-	userinfoHandler := handlers.NewUserInfoHandler(jwtService, userRepo)
-	introspectHandler := handlers.NewIntrospectHandler(jwtService, tokenRepo)
+	userinfoHandler := handlers.NewUserInfoHandler(tokenService, repos.Users, clientRegistry, subjectService, claimsService)
+	introspectHandler := handlers.NewIntrospectHandler(tokenService, repos.Tokens, repos.Users, clientRegistry, subjectService, jwtService, claimsService)
+	mfaHandler := handlers.NewMFAHandler(authCodeService, mfaService, webauthnService, consentService, scopeRegistry, sessionService, userAuth, tokenService)
+	webauthnHandler := handlers.NewWebAuthnHandler(authCodeService, webauthnService, mfaService, consentService, scopeRegistry, sessionService, userAuth, tokenService)
+	identityHandler := handlers.NewIdentityHandler(cfg, authCodeService, userAuth, tokenService)
+	logoutHandler := handlers.NewLogoutHandler(cfg, clientRegistry, sessionService, subjectService, jwtService)
+	consentHandler := handlers.NewConsentHandler(authCodeService, consentService, clientRegistry, scopeRegistry, detailsRegistry, userAuth, tokenService)
+	revokeHandler := handlers.NewRevokeHandler(tokenService, clientRegistry)
+	jwksHandler := handlers.NewJWKSHandler(signingKey)
+	sessionHandler := handlers.NewSessionHandler(sessionService, clientRegistry, userAuth, tokenService)
+	rbacHandler := handlers.NewRBACHandler(rbacService, userAuth, tokenService)
+	adminHandler := handlers.NewAdminHandler(cfg, clientRegistry, userAuth, tokenService, sessionService, signingKey)
 
 	// OAuth 2.0 endpoints - API input layer
 	// /authorize - Initiates OAuth flow, redirects to Google
 	mux.HandleFunc("/authorize", authorizeHandler.Handle)
 
+	// /par - Pushed authorization requests (RFC 9126); /authorize then takes the returned request_uri
+	mux.HandleFunc("/par", authorizeHandler.HandlePushedAuthorizationRequest)
+
 	// /callback - Receives authorization code from Google (Google OAuth provider interaction)
 	mux.HandleFunc("/callback", authorizeHandler.HandleCallback)
 
+	// /logout - OIDC RP-Initiated Logout (end_session_endpoint); ends the SSO session
+	mux.HandleFunc("/logout", logoutHandler.Handle)
+
+	// /mfa/challenge - Second factor step between Google login and auth code issuance
+	mux.HandleFunc("/mfa/challenge", mfaHandler.HandleChallenge)
+
+	// /consent - Asks the user to approve the client before a code is issued
+	mux.HandleFunc("/consent", consentHandler.HandleConsent)
+
+	// /mfa/totp/* - Authenticated TOTP enrolment management
+	mux.HandleFunc("/mfa/totp/enroll", mfaHandler.HandleEnroll)
+	mux.HandleFunc("/mfa/totp/confirm", mfaHandler.HandleConfirm)
+	mux.HandleFunc("/mfa/totp/disable", mfaHandler.HandleDisable)
+
+	// /webauthn/* - Passkey login (via /authorize?idp=passkey), security-key second factor and registration
+	mux.HandleFunc("/webauthn/login/begin", webauthnHandler.HandleLoginBegin)
+	mux.HandleFunc("/webauthn/login/finish", webauthnHandler.HandleLoginFinish)
+	mux.HandleFunc("/webauthn/mfa/begin", webauthnHandler.HandleMFABegin)
+	mux.HandleFunc("/webauthn/mfa/finish", webauthnHandler.HandleMFAFinish)
+	mux.HandleFunc("/webauthn/register/begin", webauthnHandler.HandleRegisterBegin)
+	mux.HandleFunc("/webauthn/register/finish", webauthnHandler.HandleRegisterFinish)
+	mux.HandleFunc("/webauthn/credentials", webauthnHandler.HandleCredentials)
+
+	// /account/identities - List, link and unlink upstream identities on the signed-in account
+	mux.HandleFunc("/account/identities", identityHandler.HandleIdentities)
+	mux.HandleFunc("/account/identities/link", identityHandler.HandleLink)
+
+	// /account/consents - Review and revoke the access granted to clients
+	mux.HandleFunc("/account/consents", consentHandler.HandleConsents)
+
+	// /account/sessions, /account/tokens - Signed-in devices: list sessions, sign out, revoke refresh tokens
+	mux.HandleFunc("/account/sessions", sessionHandler.HandleSessions)
+	mux.HandleFunc("/account/tokens", sessionHandler.HandleTokens)
+
+	// /admin/api/sessions - Same as above for any user; requires the admin scope
+	mux.HandleFunc("/admin/api/sessions", sessionHandler.HandleAdminSessions)
+
+	// /admin/api/clients, /users, /tokens, /keys - Administration API; requires the admin scope
+	mux.HandleFunc("/admin/api/clients", adminHandler.HandleClients)
+	mux.HandleFunc("/admin/api/clients/secret", adminHandler.HandleClientSecret)
+	mux.HandleFunc("/admin/api/users", adminHandler.HandleUsers)
+	mux.HandleFunc("/admin/api/users/disable", adminHandler.HandleDisableUser)
+	mux.HandleFunc("/admin/api/users/enable", adminHandler.HandleEnableUser)
+	mux.HandleFunc("/admin/api/tokens", adminHandler.HandleTokens)
+	mux.HandleFunc("/admin/api/keys", adminHandler.HandleKeys)
+
+	// /admin/api/roles, /groups, ... - Roles, groups, memberships and role assignments; requires the admin scope
+	mux.HandleFunc("/admin/api/roles", rbacHandler.HandleRoles)
+	mux.HandleFunc("/admin/api/groups", rbacHandler.HandleGroups)
+	mux.HandleFunc("/admin/api/groups/members", rbacHandler.HandleGroupMembers)
+	mux.HandleFunc("/admin/api/role-assignments", rbacHandler.HandleRoleAssignments)
+	mux.HandleFunc("/admin/api/memberships", rbacHandler.HandleMemberships)
+
 	// /token - Exchanges authorization code for JWT tokens (output to DB via tokenRepo)
 	mux.HandleFunc("/token", tokenHandler.Handle)
 
@@ -67,6 +166,12 @@ func NewRouter(
 	// /introspect - Validates tokens for other microservices
 	mux.HandleFunc("/introspect", introspectHandler.Handle)
 
+	// /revoke - Revokes refresh and access tokens for the client they were issued to (RFC 7009)
+	mux.HandleFunc("/revoke", revokeHandler.Handle)
+
+	// /.well-known/jwks.json - Public keys for verifying signed responses (e.g. JWT introspection)
+	mux.HandleFunc("/.well-known/jwks.json", jwksHandler.Handle)
+
 	// Health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -89,7 +194,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
@@ -0,0 +1,613 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/oauth"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/user"
+)
+
+const (
+	testClientID    = "integration-app"
+	testRedirectURI = "http://localhost:3000/callback"
+	testGoogleID    = "google-user-1"
+)
+
+// fakeGoogle answers the Google token and userinfo endpoints the callback calls
+// The code "second-google-code" signs in as a second Google account, any other code as testGoogleID
+// It replaces http.DefaultClient's transport, so requests to the test server use server.Client()
+type fakeGoogle struct{}
+
+func (fakeGoogle) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body string
+	switch r.URL.Host + r.URL.Path {
+	case "oauth2.googleapis.com/token":
+		r.ParseForm()
+		body = `{"access_token":"` + r.PostForm.Get("code") + `","token_type":"Bearer","expires_in":3600}`
+	case "www.googleapis.com/oauth2/v2/userinfo":
+		if r.Header.Get("Authorization") == "Bearer second-google-code" {
+			body = `{"id":"google-user-2","email":"second@example.com","verified_email":true,"name":"Second Account"}`
+			break
+		}
+		body = `{"id":"` + testGoogleID + `","email":"user@example.com","verified_email":true,"name":"Test User"}`
+	default:
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+// newTestServer migrates and seeds a temporary SQLite database and serves the router over it
+func newTestServer(t *testing.T) (*httptest.Server, *storage.Repositories) {
+	t.Helper()
+
+	ctx := context.Background()
+	db, err := storage.Open(storage.DriverSQLite, filepath.Join(t.TempDir(), "oauth.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	applied, err := storage.MigrateUp(ctx, db)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(applied) == 0 {
+		t.Fatal("no migrations applied to a new database")
+	}
+	if err := storage.CheckSchema(ctx, db); err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+
+	repos := storage.NewRepositories(db)
+	storage.Seed(ctx, repos)
+
+	if err := repos.Clients.CreateClient(ctx, &storage.OAuthClient{
+		ClientID:     testClientID,
+		ClientName:   "Integration Test App",
+		ClientType:   "public",
+		RedirectURIs: pq.StringArray{testRedirectURI},
+		GrantTypes:   pq.StringArray{"authorization_code", "refresh_token"},
+		Scope:        "openid profile email admin",
+		FirstParty:   true,
+		SubjectType:  "public",
+		// For pushed authorization requests carrying authorization details
+		AuthorizationDetailsTypes: pq.StringArray{"payment_initiation"},
+	}); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = fakeGoogle{}
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+
+	cfg := &config.Config{
+		GoogleClientID:             "google-client",
+		GoogleClientSecret:         "google-secret",
+		GoogleRedirectURL:          "http://localhost:8080/callback",
+		Issuer:                     "http://localhost:8080",
+		AccessTokenTTL:             time.Hour,
+		RefreshTokenTTL:            24 * time.Hour,
+		IDTokenTTL:                 time.Hour,
+		AuthCodeTTL:                10 * time.Minute,
+		AccessTokenFormat:          "jwt",
+		PairwiseSalt:               "integration-test-salt",
+		SessionSecret:              "integration-test-session",
+		SessionTTL:                 time.Hour,
+		MFAIssuer:                  "Integration Test",
+		WebAuthnRPID:               "localhost",
+		WebAuthnRPOrigins:          []string{"http://localhost:8080"},
+		LogoutRevokesRefreshTokens: true,
+	}
+
+	server := httptest.NewServer(NewRouter(t.Context(), cfg, repos))
+	t.Cleanup(server.Close)
+	return server, repos
+}
+
+// noRedirects returns a client that stops at the first redirect so its Location can be read
+func noRedirects() *http.Client {
+	return &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+}
+
+func redirectLocation(t *testing.T, resp *http.Response) *url.URL {
+	t.Helper()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("got status %d, want 302: %s", resp.StatusCode, body)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid Location: %v", err)
+	}
+	return location
+}
+
+func postToken(t *testing.T, server *httptest.Server, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+
+	resp, err := server.Client().PostForm(server.URL+"/token", form)
+	if err != nil {
+		t.Fatalf("POST /token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode token response: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func getUserInfo(t *testing.T, server *httptest.Server, accessToken string) int {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /userinfo: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAuthorizationCodeFlowOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	server, repos := newTestServer(t)
+	client := noRedirects()
+
+	verifier := "integration-test-code-verifier-0123456789-abcdefghij"
+	digest := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	// /authorize sends the user to Google, carrying our session in state
+	params := url.Values{
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid profile email admin"},
+		"state":                 {"client-state"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	resp, err := client.Get(server.URL + "/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("GET /authorize: %v", err)
+	}
+	google := redirectLocation(t, resp)
+	if google.Host != "accounts.google.com" {
+		t.Fatalf("got redirect to %s, want Google", google)
+	}
+
+	// Google redirects back; the callback signs the user in and returns a code to the client
+	resp, err = client.Get(server.URL + "/callback?" + url.Values{
+		"code":  {"google-code"},
+		"state": {google.Query().Get("state")},
+	}.Encode())
+	if err != nil {
+		t.Fatalf("GET /callback: %v", err)
+	}
+	callback := redirectLocation(t, resp)
+	if !strings.HasPrefix(callback.String(), testRedirectURI) || callback.Query().Get("state") != "client-state" {
+		t.Fatalf("unexpected client redirect: %s", callback)
+	}
+	code := callback.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in client redirect: %s", callback)
+	}
+
+	status, tokens := postToken(t, server, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {testClientID},
+		"code_verifier": {verifier},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("got token status %d: %v", status, tokens)
+	}
+	accessToken, _ := tokens["access_token"].(string)
+	refreshToken, _ := tokens["refresh_token"].(string)
+	if !oauth.IsJWT(accessToken) || refreshToken == "" || tokens["id_token"] == nil {
+		t.Fatalf("unexpected token response: %v", tokens)
+	}
+	// The admin scope is bound to the admin role, which nobody holds yet
+	if tokens["scope"] != "openid profile email" {
+		t.Errorf("got scope %v, want admin dropped", tokens["scope"])
+	}
+
+	// Codes are single use
+	if status, _ := postToken(t, server, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {testClientID},
+		"code_verifier": {verifier},
+	}); status != http.StatusBadRequest {
+		t.Errorf("got status %d replaying the code, want 400", status)
+	}
+
+	if status := getUserInfo(t, server, accessToken); status != http.StatusOK {
+		t.Fatalf("got userinfo status %d, want 200", status)
+	}
+
+	status, refreshed := postToken(t, server, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {testClientID},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("got refresh status %d: %v", status, refreshed)
+	}
+	refreshedToken, _ := refreshed["access_token"].(string)
+
+	// The login left its rows behind in every repository it touched
+	localUser, err := repos.Users.GetUserByGoogleID(ctx, testGoogleID)
+	if err != nil || localUser == nil {
+		t.Fatalf("GetUserByGoogleID: %+v, %v", localUser, err)
+	}
+	identity, err := repos.Identities.GetIdentity(ctx, user.ProviderGoogle, testGoogleID)
+	if err != nil || identity == nil || identity.UserID != localUser.ID {
+		t.Fatalf("GetIdentity: %+v, %v", identity, err)
+	}
+	sessions, err := repos.Sessions.ListActiveByUser(ctx, localUser.ID)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("ListActiveByUser sessions: %d, %v", len(sessions), err)
+	}
+	grants, err := repos.Tokens.ListActiveByUser(ctx, localUser.ID)
+	if err != nil || len(grants) == 0 {
+		t.Fatalf("ListActiveByUser refresh tokens: %d, %v", len(grants), err)
+	}
+	stored, err := repos.Tokens.GetAccessToken(ctx, accessToken)
+	if err != nil || stored == nil || stored.UserID != localUser.ID || stored.ClientID != testClientID {
+		t.Fatalf("GetAccessToken: %+v, %v", stored, err)
+	}
+
+	// Revoking the client's access tokens in the database invalidates the self-contained JWTs too
+	if err := repos.Tokens.RevokeClientAccessTokens(ctx, localUser.ID, testClientID); err != nil {
+		t.Fatalf("RevokeClientAccessTokens: %v", err)
+	}
+	for _, token := range []string{accessToken, refreshedToken} {
+		if status := getUserInfo(t, server, token); status != http.StatusUnauthorized {
+			t.Errorf("got userinfo status %d after revocation, want 401", status)
+		}
+	}
+}
+
+// browser returns a client that keeps cookies, like a browser, and stops at redirects
+func browser() *http.Client {
+	client := noRedirects()
+	client.Jar, _ = cookiejar.New(nil)
+	return client
+}
+
+// signIn runs the authorization code flow for the test client in client and returns the token response
+func signIn(t *testing.T, server *httptest.Server, client *http.Client, scope string) map[string]interface{} {
+	t.Helper()
+
+	verifier := "integration-test-code-verifier-0123456789-abcdefghij"
+	digest := sha256.Sum256([]byte(verifier))
+	resp, err := client.Get(server.URL + "/authorize?" + url.Values{
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(digest[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode())
+	if err != nil {
+		t.Fatalf("GET /authorize: %v", err)
+	}
+	google := redirectLocation(t, resp)
+
+	resp, err = client.Get(server.URL + "/callback?" + url.Values{
+		"code":  {"google-code"},
+		"state": {google.Query().Get("state")},
+	}.Encode())
+	if err != nil {
+		t.Fatalf("GET /callback: %v", err)
+	}
+	callback := redirectLocation(t, resp)
+
+	status, tokens := postToken(t, server, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {callback.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {testClientID},
+		"code_verifier": {verifier},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("got token status %d: %v", status, tokens)
+	}
+	return tokens
+}
+
+func postRevoke(t *testing.T, server *httptest.Server, form url.Values) int {
+	t.Helper()
+
+	resp, err := server.Client().PostForm(server.URL+"/revoke", form)
+	if err != nil {
+		t.Fatalf("POST /revoke: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRevokeEndpoint(t *testing.T) {
+	ctx := context.Background()
+	server, repos := newTestServer(t)
+	tokens := signIn(t, server, browser(), "openid profile email")
+	accessToken, _ := tokens["access_token"].(string)
+	refreshToken, _ := tokens["refresh_token"].(string)
+
+	if err := repos.Clients.CreateClient(ctx, &storage.OAuthClient{
+		ClientID:     "other-app",
+		ClientType:   "public",
+		RedirectURIs: pq.StringArray{testRedirectURI},
+		GrantTypes:   pq.StringArray{"authorization_code", "refresh_token"},
+		Scope:        "openid",
+		SubjectType:  "public",
+	}); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		form url.Values
+		want int
+	}{
+		{"no client", url.Values{"token": {refreshToken}}, http.StatusUnauthorized},
+		{"unknown client", url.Values{"client_id": {"nobody"}, "token": {refreshToken}}, http.StatusUnauthorized},
+		{"missing token", url.Values{"client_id": {testClientID}}, http.StatusBadRequest},
+		{"another client's token", url.Values{"client_id": {"other-app"}, "token": {refreshToken}}, http.StatusBadRequest},
+		{"unknown token", url.Values{"client_id": {testClientID}, "token": {"not-a-token"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := postRevoke(t, server, tt.form); status != tt.want {
+				t.Errorf("got status %d, want %d", status, tt.want)
+			}
+		})
+	}
+
+	// Nothing above revoked the tokens
+	if status := getUserInfo(t, server, accessToken); status != http.StatusOK {
+		t.Fatalf("got userinfo status %d, want 200", status)
+	}
+
+	// Revoking the refresh token marks its row revoked rather than denylisting the token
+	if status := postRevoke(t, server, url.Values{
+		"client_id": {testClientID}, "token": {refreshToken}, "token_type_hint": {"refresh_token"},
+	}); status != http.StatusOK {
+		t.Fatalf("got revoke status %d, want 200", status)
+	}
+	stored, err := repos.Tokens.GetRefreshToken(ctx, refreshToken)
+	if err != nil || stored == nil || !stored.Revoked {
+		t.Fatalf("refresh token not revoked: %+v, %v", stored, err)
+	}
+	if revoked, err := repos.Tokens.IsTokenRevoked(ctx, refreshToken); err != nil || revoked {
+		t.Errorf("refresh token denylisted: %v, %v", revoked, err)
+	}
+	if status, body := postToken(t, server, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {testClientID},
+	}); status != http.StatusBadRequest {
+		t.Errorf("got refresh status %d after revocation, want 400: %v", status, body)
+	}
+
+	// Revoking again is not an error
+	if status := postRevoke(t, server, url.Values{"client_id": {testClientID}, "token": {refreshToken}}); status != http.StatusOK {
+		t.Errorf("got status %d revoking twice, want 200", status)
+	}
+
+	if status := postRevoke(t, server, url.Values{"client_id": {testClientID}, "token": {accessToken}}); status != http.StatusOK {
+		t.Fatalf("got revoke status %d, want 200", status)
+	}
+	if status := getUserInfo(t, server, accessToken); status != http.StatusUnauthorized {
+		t.Errorf("got userinfo status %d after revocation, want 401", status)
+	}
+}
+
+// startLink starts linking an identity to the signed-in user and returns the state of the Google sign-in
+func startLink(t *testing.T, server *httptest.Server, accessToken string) string {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/account/identities/link", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("POST /account/identities/link: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got link status %d: %v", resp.StatusCode, body)
+	}
+	authorizationURL, err := url.Parse(body["authorization_url"])
+	if err != nil {
+		t.Fatalf("invalid authorization_url: %v", err)
+	}
+	return authorizationURL.Query().Get("state")
+}
+
+func TestIdentityLinkIsBoundToBrowser(t *testing.T) {
+	ctx := context.Background()
+	server, repos := newTestServer(t)
+	userBrowser := browser()
+	accessToken, _ := signIn(t, server, userBrowser, "openid profile email")["access_token"].(string)
+
+	completeLink := func(client *http.Client, state string) int {
+		t.Helper()
+		resp, err := client.Get(server.URL + "/callback?" + url.Values{"code": {"second-google-code"}, "state": {state}}.Encode())
+		if err != nil {
+			t.Fatalf("GET /callback: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// A link URL opened in another browser, e.g. one sent to someone else, is refused
+	state := startLink(t, server, accessToken)
+	if status := completeLink(browser(), state); status != http.StatusForbidden {
+		t.Errorf("got status %d completing the link in another browser, want 403", status)
+	}
+	if identity, _ := repos.Identities.GetIdentity(ctx, user.ProviderGoogle, "google-user-2"); identity != nil {
+		t.Fatalf("identity linked from another browser: %+v", identity)
+	}
+	// The refused attempt used up the link
+	if status := completeLink(userBrowser, state); status != http.StatusBadRequest {
+		t.Errorf("got status %d reusing a refused link, want 400", status)
+	}
+
+	// The browser that started the link completes it
+	if status := completeLink(userBrowser, startLink(t, server, accessToken)); status != http.StatusOK {
+		t.Fatalf("got status %d completing the link, want 200", status)
+	}
+	owner, err := repos.Users.GetUserByGoogleID(ctx, testGoogleID)
+	if err != nil || owner == nil {
+		t.Fatalf("GetUserByGoogleID: %+v, %v", owner, err)
+	}
+	identity, err := repos.Identities.GetIdentity(ctx, user.ProviderGoogle, "google-user-2")
+	if err != nil || identity == nil || identity.UserID != owner.ID {
+		t.Fatalf("identity not linked to the signed-in user: %+v, %v", identity, err)
+	}
+}
+
+func postPAR(t *testing.T, server *httptest.Server, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+
+	resp, err := server.Client().PostForm(server.URL+"/par", form)
+	if err != nil {
+		t.Fatalf("POST /par: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode PAR response: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestPushedAuthorizationRequest(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := noRedirects()
+
+	verifier := "pushed-request-code-verifier-0123456789-abcdefghijkl"
+	digest := sha256.Sum256([]byte(verifier))
+	pushed := url.Values{
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid profile"},
+		"state":                 {"pushed-state"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(digest[:])},
+		"code_challenge_method": {"S256"},
+	}
+	with := func(name, value string) url.Values {
+		form := url.Values{}
+		for k, v := range pushed {
+			form[k] = v
+		}
+		form.Set(name, value)
+		return form
+	}
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{"unknown client", with("client_id", "nobody"), http.StatusUnauthorized, "invalid_client"},
+		{"nested request_uri", with("request_uri", oauth.RequestURIPrefix+"x"), http.StatusBadRequest, "invalid_request"},
+		{"unregistered redirect_uri", with("redirect_uri", "https://attacker.example.com/callback"), http.StatusBadRequest, "invalid_request"},
+		{"unknown scope", with("scope", "openid unknown"), http.StatusBadRequest, "invalid_scope"},
+		{"invalid authorization details", with("authorization_details", `[{"type":"payment_initiation"}]`), http.StatusBadRequest, "invalid_authorization_details"},
+		{"authorization details", with("authorization_details", `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":"10.00"}}]`), http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := postPAR(t, server, tt.form)
+			if status != tt.wantStatus || (tt.wantError != "" && body["error"] != tt.wantError) {
+				t.Errorf("got %d %v, want %d %s", status, body, tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+
+	status, body := postPAR(t, server, pushed)
+	requestURI, _ := body["request_uri"].(string)
+	if status != http.StatusCreated || !strings.HasPrefix(requestURI, oauth.RequestURIPrefix) || body["expires_in"] != float64(90) {
+		t.Fatalf("got %d %v, want a request_uri", status, body)
+	}
+
+	authorize := func(clientID string) *http.Response {
+		t.Helper()
+		resp, err := client.Get(server.URL + "/authorize?" + url.Values{"client_id": {clientID}, "request_uri": {requestURI}}.Encode())
+		if err != nil {
+			t.Fatalf("GET /authorize: %v", err)
+		}
+		return resp
+	}
+
+	// Another client cannot use the request_uri, and does not use it up
+	resp := authorize("demo-frontend")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d using another client's request_uri, want 400", resp.StatusCode)
+	}
+
+	// The pushed parameters drive the flow: the code goes to the pushed redirect_uri with the pushed state
+	// and is bound to the pushed PKCE challenge
+	google := redirectLocation(t, authorize(testClientID))
+	resp, err := client.Get(server.URL + "/callback?" + url.Values{"code": {"google-code"}, "state": {google.Query().Get("state")}}.Encode())
+	if err != nil {
+		t.Fatalf("GET /callback: %v", err)
+	}
+	callback := redirectLocation(t, resp)
+	if !strings.HasPrefix(callback.String(), testRedirectURI) || callback.Query().Get("state") != "pushed-state" {
+		t.Fatalf("unexpected client redirect: %s", callback)
+	}
+	if status, tokens := postToken(t, server, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {callback.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {testClientID},
+		"code_verifier": {verifier},
+	}); status != http.StatusOK || tokens["scope"] != "openid profile" {
+		t.Fatalf("got token status %d: %v", status, tokens)
+	}
+
+	// A request_uri works once
+	resp = authorize(testClientID)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d reusing the request_uri, want 400", resp.StatusCode)
+	}
+}
@@ -9,4 +9,7 @@ type GoogleUserInfo struct {
 	GivenName     string `json:"given_name"`
 	FamilyName    string `json:"family_name"`
 	Picture       string `json:"picture"`
+
+	// Groups are the user's Google Workspace group emails; nil when they were not fetched
+	Groups []string `json:"-"`
 }
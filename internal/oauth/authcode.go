@@ -1,10 +1,19 @@
 package oauth
 
 import (
+	"context"
+	"net/url"
 	"sync"
 	"time"
 
 	"oauth-golang/internal/models"
+	"oauth-golang/pkg/utils"
+)
+
+// Authentication context class references recorded in the ID token "acr" claim
+const (
+	ACRSingleFactor = "urn:oauth-golang:acr:sfa"
+	ACRMultiFactor  = "urn:oauth-golang:acr:mfa"
 )
 
 // AuthSession represents a temporary OAuth session during authorization
@@ -15,7 +24,15 @@ type AuthSession struct {
 	CodeChallenge       string
 	CodeChallengeMethod string
 	Scope               string
-	CreatedAt           time.Time
+	Prompt              string   // OIDC prompt parameter, e.g. "consent"
+	Nonce               string   // OIDC nonce, echoed in the ID token
+	Resources           []string // RFC 8707 resource indicators the client asked for
+	// AuthorizationDetails are the fine-grained permissions the client asked for (RFC 9396)
+	AuthorizationDetails []AuthorizationDetail
+	CreatedAt            time.Time
+	LinkUserID           string // set when the upstream login links an identity to this user instead of signing in
+	// LinkSessionID is the SSO session the link was started under; the callback must come from a browser signed in to it
+	LinkSessionID string
 }
 
 // AuthCode represents an authorization code
@@ -29,20 +46,70 @@ type AuthCode struct {
 	Scope               string
 	ExpiresAt           time.Time
 	UserInfo            *models.GoogleUserInfo
+	AMR                 []string // authentication methods references (RFC 8176)
+	ACR                 string
+	SessionID           string // SSO session the user authenticated under
+	AuthTime            time.Time
+	Nonce               string
+	Resources           []string // resources the access tokens may be audienced to
+	// AuthorizationDetails are the details the user approved on the consent screen
+	AuthorizationDetails []AuthorizationDetail
+}
+
+// MFAChallenge represents a user who has logged in upstream but still owes a second factor
+type MFAChallenge struct {
+	Session   *AuthSession
+	UserID    string
+	UserInfo  *models.GoogleUserInfo
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// PendingConsent represents a fully authenticated user who has yet to approve the client
+type PendingConsent struct {
+	Session   *AuthSession
+	UserID    string
+	UserInfo  *models.GoogleUserInfo
+	AMR       []string
+	ACR       string
+	SessionID string
+	AuthTime  time.Time // when the user last actively authenticated
+	CreatedAt time.Time
+}
+
+// PushedRequestTTL is how long a request_uri returned by /par can be used (RFC 9126 §2.2)
+const PushedRequestTTL = 90 * time.Second
+
+// RequestURIPrefix starts every request_uri returned by /par (RFC 9126 §2.2)
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PushedRequest is an authorization request a client pushed to /par, referenced by a request_uri (RFC 9126)
+type PushedRequest struct {
+	ClientID  string
+	Params    url.Values // the authorization request parameters, already validated
+	ExpiresAt time.Time
 }
 
 // AuthCodeService manages authorization codes and sessions
 // In production, use Redis or database with TTL instead of in-memory storage
 type AuthCodeService struct {
-	sessions  map[string]*AuthSession
-	authCodes map[string]*AuthCode
-	mu        sync.RWMutex
+	sessions      map[string]*AuthSession
+	authCodes     map[string]*AuthCode
+	mfaChallenges map[string]*MFAChallenge
+	consents      map[string]*PendingConsent
+	pushed        map[string]*PushedRequest
+	policies      *TokenPolicies
+	mu            sync.RWMutex
 }
 
-func NewAuthCodeService() *AuthCodeService {
+func NewAuthCodeService(policies *TokenPolicies) *AuthCodeService {
 	service := &AuthCodeService{
-		sessions:  make(map[string]*AuthSession),
-		authCodes: make(map[string]*AuthCode),
+		policies:      policies,
+		sessions:      make(map[string]*AuthSession),
+		authCodes:     make(map[string]*AuthCode),
+		mfaChallenges: make(map[string]*MFAChallenge),
+		consents:      make(map[string]*PendingConsent),
+		pushed:        make(map[string]*PushedRequest),
 	}
 
 	// Start cleanup goroutine for expired codes
@@ -93,6 +160,118 @@ func (s *AuthCodeService) DeleteAuthCode(code string) {
 	delete(s.authCodes, code)
 }
 
+// IssueAuthCode creates and stores a one-time authorization code for a completed login
+// The code lives for the client's auth code lifetime
+// DB INTERACTION: Loads the client's token policy via policies
+func (s *AuthCodeService) IssueAuthCode(ctx context.Context, login *PendingConsent) (string, error) {
+	policy, err := s.policies.For(ctx, login.Session.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	code := utils.GenerateRandomString(32)
+
+	s.StoreAuthCode(code, &AuthCode{
+		Code:                 code,
+		ClientID:             login.Session.ClientID,
+		RedirectURI:          login.Session.RedirectURI,
+		UserID:               login.UserID,
+		CodeChallenge:        login.Session.CodeChallenge,
+		CodeChallengeMethod:  login.Session.CodeChallengeMethod,
+		Scope:                login.Session.Scope,
+		ExpiresAt:            time.Now().Add(policy.AuthCodeTTL),
+		UserInfo:             login.UserInfo,
+		AMR:                  login.AMR,
+		ACR:                  login.ACR,
+		SessionID:            login.SessionID,
+		AuthTime:             login.AuthTime,
+		Nonce:                login.Session.Nonce,
+		Resources:            login.Session.Resources,
+		AuthorizationDetails: login.Session.AuthorizationDetails,
+	})
+
+	return code, nil
+}
+
+// StoreMFAChallenge stores a pending MFA challenge
+func (s *AuthCodeService) StoreMFAChallenge(challengeID string, challenge *MFAChallenge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mfaChallenges[challengeID] = challenge
+}
+
+// GetMFAChallenge retrieves a pending MFA challenge
+func (s *AuthCodeService) GetMFAChallenge(challengeID string) *MFAChallenge {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.mfaChallenges[challengeID]
+}
+
+// RecordMFAFailure increments the failed attempt counter and returns the new count
+func (s *AuthCodeService) RecordMFAFailure(challengeID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	challenge, ok := s.mfaChallenges[challengeID]
+	if !ok {
+		return 0
+	}
+	challenge.Attempts++
+	return challenge.Attempts
+}
+
+// DeleteMFAChallenge removes a pending MFA challenge
+func (s *AuthCodeService) DeleteMFAChallenge(challengeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.mfaChallenges, challengeID)
+}
+
+// StorePendingConsent stores a login waiting on the consent screen
+func (s *AuthCodeService) StorePendingConsent(consentID string, pending *PendingConsent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consents[consentID] = pending
+}
+
+// GetPendingConsent retrieves a login waiting on the consent screen
+func (s *AuthCodeService) GetPendingConsent(consentID string) *PendingConsent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.consents[consentID]
+}
+
+// DeletePendingConsent removes a login waiting on the consent screen
+func (s *AuthCodeService) DeletePendingConsent(consentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.consents, consentID)
+}
+
+// StorePushedRequest stores a pushed authorization request and returns its request_uri
+func (s *AuthCodeService) StorePushedRequest(request *PushedRequest) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requestURI := RequestURIPrefix + utils.GenerateRandomString(32)
+	s.pushed[requestURI] = request
+	return requestURI
+}
+
+// TakePushedRequest retrieves and removes a pushed authorization request, so a request_uri is used once
+// Returns nil for unknown and expired request_uris, and for those pushed by another client
+func (s *AuthCodeService) TakePushedRequest(requestURI, clientID string) *PushedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, ok := s.pushed[requestURI]
+	if !ok || request.ClientID != clientID {
+		return nil
+	}
+	delete(s.pushed, requestURI)
+	if time.Now().After(request.ExpiresAt) {
+		return nil
+	}
+	return request
+}
+
 // cleanupExpired removes expired authorization codes and sessions
 func (s *AuthCodeService) cleanupExpired() {
 	ticker := time.NewTicker(1 * time.Minute)
@@ -116,6 +295,27 @@ func (s *AuthCodeService) cleanupExpired() {
 			}
 		}
 
+		// Clean up abandoned MFA challenges (older than 10 minutes)
+		for challengeID, challenge := range s.mfaChallenges {
+			if now.Sub(challenge.CreatedAt) > 10*time.Minute {
+				delete(s.mfaChallenges, challengeID)
+			}
+		}
+
+		// Clean up consent screens left unanswered (older than 10 minutes)
+		for consentID, pending := range s.consents {
+			if now.Sub(pending.CreatedAt) > 10*time.Minute {
+				delete(s.consents, consentID)
+			}
+		}
+
+		// Clean up pushed authorization requests that were never used
+		for requestURI, request := range s.pushed {
+			if now.After(request.ExpiresAt) {
+				delete(s.pushed, requestURI)
+			}
+		}
+
 		s.mu.Unlock()
 	}
 }
@@ -0,0 +1,168 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"oauth-golang/internal/storage"
+)
+
+// ErrInvalidAuthorizationDetails is returned when authorization_details is malformed, of an
+// unknown type, not allowed for the client, or rejected by its type's validator (RFC 9396 §5)
+var ErrInvalidAuthorizationDetails = errors.New("invalid_authorization_details")
+
+// AuthorizationDetail is one object of the authorization_details parameter (RFC 9396 §2)
+// Every object has a "type"; the other members depend on it
+type AuthorizationDetail = map[string]interface{}
+
+// AuthorizationDetailType validates and describes the authorization details of one type
+// Register an implementation with AuthorizationDetailsRegistry.Register to accept a new type
+type AuthorizationDetailType interface {
+	// Name is the value of the "type" member this implementation handles
+	Name() string
+	// Validate rejects details the client may not request or that are malformed
+	Validate(client *storage.OAuthClient, detail AuthorizationDetail) error
+	// Describe returns the line shown to the user on the consent screen
+	Describe(detail AuthorizationDetail) string
+}
+
+// AuthorizationDetailsRegistry holds the authorization detail types the server understands
+type AuthorizationDetailsRegistry struct {
+	types map[string]AuthorizationDetailType
+	mu    sync.RWMutex
+}
+
+func NewAuthorizationDetailsRegistry() *AuthorizationDetailsRegistry {
+	return &AuthorizationDetailsRegistry{
+		types: make(map[string]AuthorizationDetailType),
+	}
+}
+
+// Register adds a type; a later registration for the same name replaces the earlier one
+func (r *AuthorizationDetailsRegistry) Register(detailType AuthorizationDetailType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[detailType.Name()] = detailType
+}
+
+// Types returns the names of the registered types
+func (r *AuthorizationDetailsRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Parse decodes and validates an authorization_details parameter for a client
+// An empty (or JSON null) parameter yields no details. Each object must name a registered type
+// the client is allowed to request (authorization_details_types) and pass that type's validation
+func (r *AuthorizationDetailsRegistry) Parse(client *storage.OAuthClient, raw string) ([]AuthorizationDetail, error) {
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+
+	var details []AuthorizationDetail
+	if err := json.Unmarshal([]byte(raw), &details); err != nil {
+		return nil, fmt.Errorf("%w: authorization_details must be a JSON array of objects", ErrInvalidAuthorizationDetails)
+	}
+	if len(details) == 0 {
+		return nil, fmt.Errorf("%w: authorization_details must not be empty", ErrInvalidAuthorizationDetails)
+	}
+
+	for _, detail := range details {
+		detailType, err := r.typeOf(detail)
+		if err != nil {
+			return nil, err
+		}
+		if !client.AllowsAuthorizationDetailsType(detailType.Name()) {
+			return nil, fmt.Errorf("%w: type %q is not allowed for this client", ErrInvalidAuthorizationDetails, detailType.Name())
+		}
+		if err := detailType.Validate(client, detail); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAuthorizationDetails, err)
+		}
+	}
+
+	return details, nil
+}
+
+// Describe returns a consent screen line for each detail
+func (r *AuthorizationDetailsRegistry) Describe(details []AuthorizationDetail) []string {
+	var descriptions []string
+	for _, detail := range details {
+		detailType, err := r.typeOf(detail)
+		if err != nil {
+			continue
+		}
+		descriptions = append(descriptions, detailType.Describe(detail))
+	}
+	return descriptions
+}
+
+// typeOf returns the registered type of a detail
+func (r *AuthorizationDetailsRegistry) typeOf(detail AuthorizationDetail) (AuthorizationDetailType, error) {
+	name, _ := detail["type"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: every authorization detail needs a type", ErrInvalidAuthorizationDetails)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	detailType, ok := r.types[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidAuthorizationDetails, name)
+	}
+	return detailType, nil
+}
+
+// NarrowAuthorizationDetails checks that requested details are a subset of the granted ones
+// Each requested object must equal a granted one; an empty request keeps the grant (RFC 9396 §6.1)
+func NarrowAuthorizationDetails(granted, requested []AuthorizationDetail) ([]AuthorizationDetail, error) {
+	if requested == nil {
+		return granted, nil
+	}
+
+	for _, detail := range requested {
+		found := false
+		for _, candidate := range granted {
+			if reflect.DeepEqual(detail, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: authorization details exceed the original grant", ErrInvalidAuthorizationDetails)
+		}
+	}
+
+	return requested, nil
+}
+
+// DecodeAuthorizationDetails decodes authorization details stored as JSON; empty means none
+func DecodeAuthorizationDetails(raw string) ([]AuthorizationDetail, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var details []AuthorizationDetail
+	if err := json.Unmarshal([]byte(raw), &details); err != nil {
+		return nil, fmt.Errorf("failed to decode authorization details: %w", err)
+	}
+	return details, nil
+}
+
+// EncodeAuthorizationDetails encodes authorization details for storage; none encodes as empty
+func EncodeAuthorizationDetails(details []AuthorizationDetail) (string, error) {
+	if len(details) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode authorization details: %w", err)
+	}
+	return string(encoded), nil
+}
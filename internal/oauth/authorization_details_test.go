@@ -0,0 +1,109 @@
+package oauth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/storage"
+)
+
+const validPayment = `{"type":"payment_initiation","actions":["initiate"],
+	"instructedAmount":{"currency":"EUR","amount":"123.50"},
+	"debtorAccount":{"iban":"DE02100100109307118603"},"creditorName":"Merchant A"}`
+
+func newDetailsRegistry() *AuthorizationDetailsRegistry {
+	registry := NewAuthorizationDetailsRegistry()
+	registry.Register(PaymentInitiationType{})
+	return registry
+}
+
+func TestParseAuthorizationDetails(t *testing.T) {
+	registry := newDetailsRegistry()
+	client := &storage.OAuthClient{ClientID: "app", AuthorizationDetailsTypes: pq.StringArray{"payment_initiation"}}
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    int
+		wantErr bool
+	}{
+		{"absent", "", 0, false},
+		{"null", "null", 0, false},
+		{"valid payment", "[" + validPayment + "]", 1, false},
+		{"not an array", validPayment, 0, true},
+		{"empty array", "[]", 0, true},
+		{"missing type", `[{"actions":["initiate"]}]`, 0, true},
+		{"unknown type", `[{"type":"account_information"}]`, 0, true},
+		{"unsupported action", `[{"type":"payment_initiation","actions":["refund"],"instructedAmount":{"currency":"EUR","amount":"1"}}]`, 0, true},
+		{"missing amount", `[{"type":"payment_initiation"}]`, 0, true},
+		{"lowercase currency", `[{"type":"payment_initiation","instructedAmount":{"currency":"eur","amount":"1"}}]`, 0, true},
+		{"numeric amount", `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":1}}]`, 0, true},
+		{"zero amount", `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":"0.00"}}]`, 0, true},
+		{"bad IBAN", `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":"1"},"creditorAccount":{"iban":"12345"}}]`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, err := registry.Parse(client, tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAuthorizationDetails) {
+					t.Fatalf("err = %v, want ErrInvalidAuthorizationDetails", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(details) != tt.want {
+				t.Errorf("got %d details, want %d", len(details), tt.want)
+			}
+		})
+	}
+
+	// Clients only request the types they are registered for
+	other := &storage.OAuthClient{ClientID: "other"}
+	if _, err := registry.Parse(other, "["+validPayment+"]"); !errors.Is(err, ErrInvalidAuthorizationDetails) {
+		t.Errorf("client without payment_initiation: err = %v", err)
+	}
+}
+
+func TestDescribeAuthorizationDetails(t *testing.T) {
+	registry := newDetailsRegistry()
+	client := &storage.OAuthClient{AuthorizationDetailsTypes: pq.StringArray{"payment_initiation"}}
+	details, err := registry.Parse(client, "["+validPayment+"]")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := "Pay up to 123.50 EUR to Merchant A from account DE02…8603"
+	if got := registry.Describe(details); len(got) != 1 || got[0] != want {
+		t.Errorf("got %q, want [%q]", got, want)
+	}
+}
+
+func TestNarrowAuthorizationDetails(t *testing.T) {
+	registry := newDetailsRegistry()
+	client := &storage.OAuthClient{AuthorizationDetailsTypes: pq.StringArray{"payment_initiation"}}
+	granted, err := registry.Parse(client, "["+validPayment+"]")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if got, err := NarrowAuthorizationDetails(granted, nil); err != nil || len(got) != 1 {
+		t.Errorf("empty request: got %v, %v; want the grant", got, err)
+	}
+	same, _ := registry.Parse(client, "["+validPayment+"]")
+	if _, err := NarrowAuthorizationDetails(granted, same); err != nil {
+		t.Errorf("identical request rejected: %v", err)
+	}
+
+	// A larger amount than was consented to is not a subset of the grant
+	larger, _ := registry.Parse(client, `[{"type":"payment_initiation","actions":["initiate"],
+		"instructedAmount":{"currency":"EUR","amount":"999.00"},
+		"debtorAccount":{"iban":"DE02100100109307118603"},"creditorName":"Merchant A"}]`)
+	if _, err := NarrowAuthorizationDetails(granted, larger); !errors.Is(err, ErrInvalidAuthorizationDetails) {
+		t.Errorf("larger request: err = %v, want ErrInvalidAuthorizationDetails", err)
+	}
+}
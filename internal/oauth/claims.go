@@ -0,0 +1,225 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"oauth-golang/internal/storage"
+)
+
+// Claim targets: where a custom claim is delivered
+const (
+	ClaimTargetAccessToken   = "access_token"
+	ClaimTargetIDToken       = "id_token"
+	ClaimTargetUserInfo      = "userinfo"
+	ClaimTargetIntrospection = "introspection"
+)
+
+// reservedClaims are set by the server itself; rules and hooks cannot add or replace them
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"type": true, "client_id": true, "scope": true, "azp": true, "nonce": true, "auth_time": true,
+	"at_hash": true, "c_hash": true, "sid": true, "acr": true, "amr": true, "cnf": true, "act": true,
+	"authorization_details": true, "active": true, "token_type": true, "username": true,
+}
+
+// ClaimsRequest describes the token or response custom claims are being built for
+type ClaimsRequest struct {
+	Target string
+	User   *storage.User
+	Client *storage.OAuthClient // nil when the client is unknown
+	Scope  string               // scope granted to the token
+}
+
+// ClaimsHook adds claims computed by other services, e.g. a customer number from the billing system
+// Register implementations with ClaimsService.AddHook; hooks run after the claim rules and may
+// replace claims the rules set
+type ClaimsHook interface {
+	Claims(ctx context.Context, request *ClaimsRequest) (map[string]interface{}, error)
+}
+
+// MembershipSource supplies the values of "roles" and "groups" claim rules
+type MembershipSource interface {
+	Roles(ctx context.Context, userID, clientID string) ([]string, error)
+	Groups(ctx context.Context, userID string) ([]string, error)
+}
+
+// ClaimsService builds the custom claims added to access tokens, ID tokens, userinfo and
+// introspection responses, so every target sees the same mapping
+// DB INTERACTION: Retrieves claim rules from database
+type ClaimsService struct {
+	ruleRepo   storage.ClaimRuleRepository
+	membership MembershipSource
+	hooks      []ClaimsHook
+	mu         sync.RWMutex
+}
+
+func NewClaimsService(ruleRepo storage.ClaimRuleRepository) *ClaimsService {
+	return &ClaimsService{
+		ruleRepo: ruleRepo,
+	}
+}
+
+// AddHook registers a hook; hooks run in registration order
+func (s *ClaimsService) AddHook(hook ClaimsHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// SetMembershipSource sets where "roles" and "groups" rules read from
+// Without one those rules add nothing
+func (s *ClaimsService) SetMembershipSource(source MembershipSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.membership = source
+}
+
+// Build returns the custom claims for a request
+// DB INTERACTION: Loads the client's claim rules via ruleRepo
+func (s *ClaimsService) Build(ctx context.Context, request *ClaimsRequest) (map[string]interface{}, error) {
+	if request.User == nil {
+		return nil, nil
+	}
+
+	var clientID string
+	if request.Client != nil {
+		clientID = request.Client.ClientID
+	}
+
+	rules, err := s.ruleRepo.ListClaimRules(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load claim rules: %w", err)
+	}
+
+	s.mu.RLock()
+	membership := s.membership
+	hooks := s.hooks
+	s.mu.RUnlock()
+
+	granted := make(map[string]bool)
+	for _, name := range strings.Fields(request.Scope) {
+		granted[name] = true
+	}
+
+	claims := make(map[string]interface{})
+	for _, rule := range rules {
+		if reservedClaims[rule.ClaimName] || !appliesTo(rule, request.Target) {
+			continue
+		}
+		if rule.Scope != "" && !granted[rule.Scope] {
+			continue
+		}
+
+		value, err := s.evaluate(ctx, rule, request, clientID, membership)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			claims[rule.ClaimName] = value
+		}
+	}
+
+	for _, hook := range hooks {
+		added, err := hook.Claims(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("claims hook failed: %w", err)
+		}
+		for name, value := range added {
+			if reservedClaims[name] {
+				log.Printf("Warning: claims hook tried to set reserved claim %q", name)
+				continue
+			}
+			claims[name] = value
+		}
+	}
+
+	return claims, nil
+}
+
+// evaluate computes the value of one rule; nil means the claim is left out
+func (s *ClaimsService) evaluate(ctx context.Context, rule *storage.ClaimRule, request *ClaimsRequest, clientID string, membership MembershipSource) (interface{}, error) {
+	switch rule.Source {
+	case storage.ClaimSourceStatic:
+		var value interface{}
+		if err := json.Unmarshal([]byte(rule.Value), &value); err != nil {
+			return rule.Value, nil
+		}
+		return value, nil
+	case storage.ClaimSourceUser:
+		return userAttribute(request.User, rule.Value), nil
+	case storage.ClaimSourceRoles:
+		if membership == nil {
+			return nil, nil
+		}
+		roles, err := membership.Roles(ctx, request.User.ID, clientID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load roles: %w", err)
+		}
+		return nonEmpty(roles), nil
+	case storage.ClaimSourceGroups:
+		if membership == nil {
+			return nil, nil
+		}
+		groups, err := membership.Groups(ctx, request.User.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load groups: %w", err)
+		}
+		return nonEmpty(groups), nil
+	default:
+		log.Printf("Warning: claim rule %d has unknown source %q", rule.ID, rule.Source)
+		return nil, nil
+	}
+}
+
+// appliesTo reports whether a rule delivers its claim to the target
+func appliesTo(rule *storage.ClaimRule, target string) bool {
+	if len(rule.Targets) == 0 {
+		return true
+	}
+	for _, t := range rule.Targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// userAttribute returns a user attribute by its claim-style name, or nil if unknown or empty
+func userAttribute(user *storage.User, attribute string) interface{} {
+	var value string
+	switch attribute {
+	case "id":
+		value = user.ID
+	case "email":
+		value = user.Email
+	case "email_verified":
+		return user.EmailVerified
+	case "name":
+		value = user.Name
+	case "given_name":
+		value = user.GivenName
+	case "family_name":
+		value = user.FamilyName
+	case "picture":
+		value = user.Picture
+	case "google_id":
+		value = user.GoogleID
+	}
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// nonEmpty returns nil for an empty list so the claim is left out rather than sent as []
+func nonEmpty(values []string) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
@@ -0,0 +1,198 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+	"oauth-golang/internal/user"
+)
+
+// claimsHookFunc adapts a function to ClaimsHook
+type claimsHookFunc func(ctx context.Context, request *ClaimsRequest) (map[string]interface{}, error)
+
+func (f claimsHookFunc) Claims(ctx context.Context, request *ClaimsRequest) (map[string]interface{}, error) {
+	return f(ctx, request)
+}
+
+// newClaimsService returns a claims service over in-memory repositories holding rules
+func newClaimsService(t *testing.T, rules ...*storage.ClaimRule) *ClaimsService {
+	t.Helper()
+
+	repos := memory.NewRepositories()
+	for _, rule := range rules {
+		if err := repos.ClaimRules.CreateClaimRule(context.Background(), rule); err != nil {
+			t.Fatalf("CreateClaimRule: %v", err)
+		}
+	}
+	return NewClaimsService(repos.ClaimRules)
+}
+
+var claimsUser = &storage.User{ID: "user-1", Email: "user@example.com", EmailVerified: true, GivenName: "Test"}
+
+func TestClaimsPipelineRules(t *testing.T) {
+	service := newClaimsService(t,
+		&storage.ClaimRule{ClaimName: "tenant", Source: storage.ClaimSourceStatic, Value: "acme"},
+		&storage.ClaimRule{ClaimName: "limits", Source: storage.ClaimSourceStatic, Value: `{"max": 3}`},
+		&storage.ClaimRule{ClaimName: "first_name", Source: storage.ClaimSourceUser, Value: "given_name"},
+		&storage.ClaimRule{ClaimName: "nickname", Source: storage.ClaimSourceUser, Value: "family_name"},
+		&storage.ClaimRule{ClaimName: "mail", Source: storage.ClaimSourceUser, Value: "email", Scope: "email"},
+		&storage.ClaimRule{ClaimName: "id_only", Source: storage.ClaimSourceStatic, Value: "yes",
+			Targets: pq.StringArray{ClaimTargetIDToken}},
+		&storage.ClaimRule{ClaimName: "sub", Source: storage.ClaimSourceStatic, Value: "forged"},
+		&storage.ClaimRule{ClientID: "app", ClaimName: "tenant", Source: storage.ClaimSourceStatic, Value: "app-tenant"},
+		&storage.ClaimRule{ClientID: "other", ClaimName: "other_only", Source: storage.ClaimSourceStatic, Value: "x"},
+	)
+
+	claims, err := service.Build(context.Background(), &ClaimsRequest{
+		Target: ClaimTargetAccessToken,
+		User:   claimsUser,
+		Client: &storage.OAuthClient{ClientID: "app"},
+		Scope:  "openid",
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	// The client's rule overrides the global one; empty attributes, ungranted scopes, other targets,
+	// other clients and reserved claims add nothing
+	want := map[string]interface{}{
+		"tenant":     "app-tenant",
+		"limits":     map[string]interface{}{"max": float64(3)},
+		"first_name": "Test",
+	}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("got %v, want %v", claims, want)
+	}
+
+	claims, err = service.Build(context.Background(), &ClaimsRequest{
+		Target: ClaimTargetIDToken,
+		User:   claimsUser,
+		Scope:  "openid email",
+	})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if claims["tenant"] != "acme" || claims["mail"] != "user@example.com" || claims["id_only"] != "yes" {
+		t.Errorf("got %v for the ID token of an unknown client with the email scope", claims)
+	}
+}
+
+func TestClaimsPipelineHooks(t *testing.T) {
+	service := newClaimsService(t, &storage.ClaimRule{ClaimName: "tenant", Source: storage.ClaimSourceStatic, Value: "acme"})
+	service.AddHook(claimsHookFunc(func(ctx context.Context, request *ClaimsRequest) (map[string]interface{}, error) {
+		return map[string]interface{}{"tenant": "from-hook", "customer": request.User.ID, "iss": "forged"}, nil
+	}))
+
+	claims, err := service.Build(context.Background(), &ClaimsRequest{Target: ClaimTargetUserInfo, User: claimsUser})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	want := map[string]interface{}{"tenant": "from-hook", "customer": "user-1"}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("got %v, want %v", claims, want)
+	}
+
+	// A failing hook fails the whole request rather than issuing a token without its claims
+	failure := errors.New("billing unavailable")
+	service.AddHook(claimsHookFunc(func(context.Context, *ClaimsRequest) (map[string]interface{}, error) {
+		return nil, failure
+	}))
+	if _, err := service.Build(context.Background(), &ClaimsRequest{Target: ClaimTargetUserInfo, User: claimsUser}); !errors.Is(err, failure) {
+		t.Errorf("err = %v, want the hook's error", err)
+	}
+}
+
+func TestCustomClaimsReachIssuedTokens(t *testing.T) {
+	service, jwtService, repos := newTokenService(t)
+	for _, rule := range []*storage.ClaimRule{
+		{ClaimName: "tenant", Source: storage.ClaimSourceStatic, Value: "acme", Targets: pq.StringArray{ClaimTargetAccessToken}},
+		{ClaimName: "first_name", Source: storage.ClaimSourceUser, Value: "given_name", Targets: pq.StringArray{ClaimTargetIDToken}},
+	} {
+		if err := repos.ClaimRules.CreateClaimRule(context.Background(), rule); err != nil {
+			t.Fatalf("CreateClaimRule: %v", err)
+		}
+	}
+	tokens := generateTokens(t, service, repos, "public-app", "openid")
+
+	accessClaims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, accessClaims); err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if accessClaims["tenant"] != "acme" || accessClaims["first_name"] != nil {
+		t.Errorf("access token claims %v, want tenant only", accessClaims)
+	}
+
+	idClaims, err := jwtService.VerifyIDTokenHint(tokens.IDToken)
+	if err != nil {
+		t.Fatalf("VerifyIDTokenHint: %v", err)
+	}
+	idToken := jwt.MapClaims{}
+	jwt.NewParser().ParseUnverified(tokens.IDToken, idToken)
+	if idToken["first_name"] != "Test" || idToken["tenant"] != nil || idClaims.Subject != "user-1" {
+		t.Errorf("ID token claims %v, want first_name only", idToken)
+	}
+}
+
+func TestRolesAndGroupsClaims(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	storage.SeedDefaultClaimRules(ctx, repos.ClaimRules)
+	if err := repos.Users.CreateUser(ctx, claimsUser); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	rbac := user.NewRBACService(repos.RBAC)
+	editor, err := rbac.CreateRole(ctx, "app", "editor", "")
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	deployer, err := rbac.CreateRole(ctx, "other", "deployer", "")
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	group, err := rbac.CreateGroup(ctx, "ops", "", "")
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	for _, step := range []error{
+		rbac.AddGroupMember(ctx, group.ID, claimsUser.ID),
+		rbac.AssignRole(ctx, editor.ID, "", group.ID),
+		rbac.AssignRole(ctx, deployer.ID, claimsUser.ID, ""),
+	} {
+		if step != nil {
+			t.Fatalf("setup: %v", step)
+		}
+	}
+
+	service := NewClaimsService(repos.ClaimRules)
+	service.SetMembershipSource(rbac)
+	build := func(scope string) map[string]interface{} {
+		t.Helper()
+		claims, err := service.Build(ctx, &ClaimsRequest{
+			Target: ClaimTargetAccessToken,
+			User:   claimsUser,
+			Client: &storage.OAuthClient{ClientID: "app"},
+			Scope:  scope,
+		})
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		return claims
+	}
+
+	// The claims follow their scopes, and roles for other clients stay out
+	if claims := build("openid"); len(claims) != 0 {
+		t.Errorf("got %v without the roles and groups scopes", claims)
+	}
+	want := map[string]interface{}{"roles": []string{"editor"}, "groups": []string{"ops"}}
+	if claims := build("openid roles groups"); !reflect.DeepEqual(claims, want) {
+		t.Errorf("got %v, want %v", claims, want)
+	}
+}
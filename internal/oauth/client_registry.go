@@ -1,31 +1,44 @@
 package oauth
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"oauth-golang/internal/security"
 	"oauth-golang/internal/storage"
+	"oauth-golang/pkg/utils"
 )
 
+// ErrInvalidClientMetadata is returned when a client registration is incomplete or inconsistent
+var ErrInvalidClientMetadata = errors.New("invalid_client_metadata")
+
+// supportedGrantTypes are the grant types a client may be registered for
+var supportedGrantTypes = map[string]bool{"authorization_code": true, "refresh_token": true}
+
 // ClientRegistry manages OAuth clients
 // DB INTERACTION: Retrieves client information from database
 type ClientRegistry struct {
-	storage *storage.Storage
+	clientRepo storage.ClientRepository
 }
 
-func NewClientRegistry(storage *storage.Storage) *ClientRegistry {
+func NewClientRegistry(clientRepo storage.ClientRepository) *ClientRegistry {
 	return &ClientRegistry{
-		storage: storage,
+		clientRepo: clientRepo,
 	}
 }
 
 // GetClient retrieves a client by client ID
-// DB INTERACTION: Queries database via storage
-func (r *ClientRegistry) GetClient(clientID string) (*storage.OAuthClient, error) {
-	return r.storage.GetClientByID(clientID)
+// DB INTERACTION: Queries database via clientRepo
+func (r *ClientRegistry) GetClient(ctx context.Context, clientID string) (*storage.OAuthClient, error) {
+	return r.clientRepo.GetClientByID(ctx, clientID)
 }
 
 // ValidateClient validates client credentials
 // DB INTERACTION: Queries database and validates credentials
-func (r *ClientRegistry) ValidateClient(clientID, clientSecret string) (*storage.OAuthClient, error) {
-	client, err := r.storage.GetClientByID(clientID)
+func (r *ClientRegistry) ValidateClient(ctx context.Context, clientID, clientSecret string) (*storage.OAuthClient, error) {
+	client, err := r.clientRepo.GetClientByID(ctx, clientID)
 	if err != nil {
 		return nil, err
 	}
@@ -41,3 +54,151 @@ func (r *ClientRegistry) ValidateClient(clientID, clientSecret string) (*storage
 
 	return client, nil
 }
+
+// FindClient retrieves a registered client, returning nil instead of creating unknown clients
+// DB INTERACTION: Queries database via clientRepo
+func (r *ClientRegistry) FindClient(ctx context.Context, clientID string) (*storage.OAuthClient, error) {
+	return r.clientRepo.FindClientByID(ctx, clientID)
+}
+
+// ListClients retrieves all registered clients
+// DB INTERACTION: Queries database via clientRepo
+func (r *ClientRegistry) ListClients(ctx context.Context) ([]*storage.OAuthClient, error) {
+	return r.clientRepo.ListClients(ctx)
+}
+
+// CreateClient validates and registers a client; confidential clients get a generated secret
+// An empty client ID is replaced by a random one
+// DB INTERACTION: Inserts client via clientRepo
+func (r *ClientRegistry) CreateClient(ctx context.Context, client *storage.OAuthClient) error {
+	if client.ClientID == "" {
+		client.ClientID = utils.GenerateRandomString(24)
+	}
+	if err := validateClientMetadata(client); err != nil {
+		return err
+	}
+
+	existing, err := r.clientRepo.FindClientByID(ctx, client.ClientID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("%w: client_id is already registered", ErrInvalidClientMetadata)
+	}
+
+	client.ClientSecret = ""
+	if client.IsConfidential() {
+		client.ClientSecret = utils.GenerateSecureToken(48)
+	}
+	return r.clientRepo.CreateClient(ctx, client)
+}
+
+// UpdateClient validates and replaces a registered client's metadata; the secret is kept
+// DB INTERACTION: Updates client via clientRepo
+func (r *ClientRegistry) UpdateClient(ctx context.Context, client *storage.OAuthClient) error {
+	existing, err := r.clientRepo.FindClientByID(ctx, client.ClientID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return fmt.Errorf("client not found")
+	}
+	if err := validateClientMetadata(client); err != nil {
+		return err
+	}
+
+	client.ClientSecret = existing.ClientSecret
+	if client.IsConfidential() && client.ClientSecret == "" {
+		client.ClientSecret = utils.GenerateSecureToken(48)
+	}
+	client.CreatedAt = existing.CreatedAt
+	return r.clientRepo.SaveClient(ctx, client)
+}
+
+// RotateSecret replaces a confidential client's secret and returns the new one
+// The old secret stops working immediately
+// DB INTERACTION: Updates client via clientRepo
+func (r *ClientRegistry) RotateSecret(ctx context.Context, clientID string) (string, error) {
+	client, err := r.clientRepo.FindClientByID(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	if client == nil {
+		return "", fmt.Errorf("client not found")
+	}
+	if !client.IsConfidential() {
+		return "", fmt.Errorf("public clients have no secret")
+	}
+
+	client.ClientSecret = utils.GenerateSecureToken(48)
+	if err := r.clientRepo.SaveClient(ctx, client); err != nil {
+		return "", err
+	}
+	return client.ClientSecret, nil
+}
+
+// DeleteClient removes a registered client
+// DB INTERACTION: Deletes client via clientRepo
+func (r *ClientRegistry) DeleteClient(ctx context.Context, clientID string) error {
+	if err := r.clientRepo.DeleteClient(ctx, clientID); err != nil {
+		return fmt.Errorf("failed to delete client: %w", err)
+	}
+	return nil
+}
+
+// validateClientMetadata checks the fields a registration must get right
+func validateClientMetadata(client *storage.OAuthClient) error {
+	if client.ClientName == "" {
+		return fmt.Errorf("%w: client_name is required", ErrInvalidClientMetadata)
+	}
+	if client.ClientType != "public" && client.ClientType != "confidential" {
+		return fmt.Errorf("%w: client_type must be public or confidential", ErrInvalidClientMetadata)
+	}
+	if client.SubjectType == "" {
+		client.SubjectType = "public"
+	}
+	if client.SubjectType != "public" && client.SubjectType != "pairwise" {
+		return fmt.Errorf("%w: subject_type must be public or pairwise", ErrInvalidClientMetadata)
+	}
+	if client.AccessTokenFormat != "" && client.AccessTokenFormat != AccessTokenFormatJWT && client.AccessTokenFormat != AccessTokenFormatOpaque {
+		return fmt.Errorf("%w: access_token_format must be jwt or opaque", ErrInvalidClientMetadata)
+	}
+	if client.SubjectType == "pairwise" && client.AccessTokenFormat == AccessTokenFormatJWT {
+		return fmt.Errorf("%w: pairwise clients must use opaque access tokens", ErrInvalidClientMetadata)
+	}
+	if len(client.GrantTypes) == 0 {
+		return fmt.Errorf("%w: grant_types is required", ErrInvalidClientMetadata)
+	}
+	for _, grantType := range client.GrantTypes {
+		if !supportedGrantTypes[grantType] {
+			return fmt.Errorf("%w: unsupported grant type %q", ErrInvalidClientMetadata, grantType)
+		}
+	}
+
+	uris := append(append([]string{}, client.RedirectURIs...), client.PostLogoutRedirectURIs...)
+	for _, candidate := range []string{client.SectorIdentifierURI, client.BackchannelLogoutURI, client.FrontchannelLogoutURI} {
+		if candidate != "" {
+			uris = append(uris, candidate)
+		}
+	}
+	for _, uri := range uris {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return fmt.Errorf("%w: %q must be an absolute URI without a fragment", ErrInvalidClientMetadata, uri)
+		}
+	}
+
+	for _, lifetime := range []int{client.AccessTokenLifetime, client.RefreshTokenLifetime, client.RefreshTokenIdleLifetime, client.IDTokenLifetime, client.AuthCodeLifetime} {
+		if lifetime < 0 {
+			return fmt.Errorf("%w: token lifetimes must not be negative", ErrInvalidClientMetadata)
+		}
+	}
+
+	if client.IntrospectionEncryptionKey != "" {
+		if _, err := security.ParseRSAPublicKey(client.IntrospectionEncryptionKey); err != nil {
+			return fmt.Errorf("%w: introspection_encryption_key: %v", ErrInvalidClientMetadata, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"oauth-golang/internal/storage"
+)
+
+// ConsentService decides when a user must approve a client and remembers what they approved
+type ConsentService struct {
+	consentRepo    storage.ConsentRepository
+	tokenRepo      storage.TokenRepository
+	clientRegistry *ClientRegistry
+	scopeRegistry  *ScopeRegistry
+}
+
+func NewConsentService(
+	consentRepo storage.ConsentRepository,
+	tokenRepo storage.TokenRepository,
+	clientRegistry *ClientRegistry,
+	scopeRegistry *ScopeRegistry,
+) *ConsentService {
+	return &ConsentService{
+		consentRepo:    consentRepo,
+		tokenRepo:      tokenRepo,
+		clientRegistry: clientRegistry,
+		scopeRegistry:  scopeRegistry,
+	}
+}
+
+// RequiresConsent reports whether the consent screen must be shown before a code is issued
+// Authorization details describe a single transaction, so the user always approves them.
+// Otherwise first-party clients never ask, and the user is asked when prompt=consent was requested
+// or when the request includes consent-required scopes they have not yet granted to the client
+func (s *ConsentService) RequiresConsent(ctx context.Context, session *AuthSession, userID string) (bool, error) {
+	client, err := s.clientRegistry.GetClient(ctx, session.ClientID)
+	if err != nil {
+		return false, err
+	}
+	if client == nil {
+		return false, fmt.Errorf("client not found")
+	}
+
+	if len(session.AuthorizationDetails) > 0 {
+		return true, nil
+	}
+	if client.FirstParty {
+		return false, nil
+	}
+	if HasPrompt(session.Prompt, "consent") {
+		return true, nil
+	}
+
+	grant, err := s.consentRepo.GetGrant(ctx, userID, session.ClientID)
+	if err != nil {
+		return false, err
+	}
+	if grant == nil {
+		return true, nil
+	}
+
+	granted := make(map[string]bool, len(grant.Scopes))
+	for _, scope := range grant.Scopes {
+		granted[scope] = true
+	}
+	for _, name := range strings.Fields(session.Scope) {
+		if granted[name] {
+			continue
+		}
+		scope, err := s.scopeRegistry.GetScope(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		if scope == nil || scope.ConsentRequired {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GrantConsent remembers that the user approved the given scopes for a client
+// Previously granted scopes are kept so narrower requests do not prompt again
+// OUTPUT TO DB: Upserts consent grant via consentRepo
+func (s *ConsentService) GrantConsent(ctx context.Context, userID, clientID, scope string) error {
+	grant, err := s.consentRepo.GetGrant(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	scopes := make(map[string]bool)
+	if grant != nil {
+		for _, existing := range grant.Scopes {
+			scopes[existing] = true
+		}
+	}
+	for _, requested := range strings.Fields(scope) {
+		scopes[requested] = true
+	}
+
+	merged := make([]string, 0, len(scopes))
+	for name := range scopes {
+		merged = append(merged, name)
+	}
+	sort.Strings(merged)
+
+	return s.consentRepo.SaveGrant(ctx, &storage.ConsentGrant{
+		UserID:   userID,
+		ClientID: clientID,
+		Scopes:   merged,
+	})
+}
+
+// ListGrants returns every client the user has granted access to
+func (s *ConsentService) ListGrants(ctx context.Context, userID string) ([]*storage.ConsentGrant, error) {
+	return s.consentRepo.ListByUser(ctx, userID)
+}
+
+// RevokeConsent withdraws a client's access: the grant is deleted and its refresh and
+// access tokens revoked
+// OUTPUT TO DB: Deletes consent grant and revokes tokens
+func (s *ConsentService) RevokeConsent(ctx context.Context, userID, clientID string) error {
+	if err := s.consentRepo.DeleteGrant(ctx, userID, clientID); err != nil {
+		return err
+	}
+	if err := s.tokenRepo.RevokeClientRefreshTokens(ctx, userID, clientID); err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeClientAccessTokens(ctx, userID, clientID)
+}
+
+// HasPrompt reports whether a space-delimited OIDC prompt parameter contains value
+func HasPrompt(prompt, value string) bool {
+	for _, p := range strings.Fields(prompt) {
+		if p == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+)
+
+// newConsentService returns a consent service over seeded in-memory repositories
+// with a third-party client "third-party" and a first-party client "first-party"
+func newConsentService(t *testing.T) (*ConsentService, *storage.Repositories) {
+	t.Helper()
+
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	storage.Seed(ctx, repos)
+
+	for _, client := range []*storage.OAuthClient{
+		{ClientID: "third-party", ClientType: "public", Scope: "openid profile email"},
+		{ClientID: "first-party", ClientType: "public", Scope: "openid profile email", FirstParty: true},
+	} {
+		if err := repos.Clients.CreateClient(ctx, client); err != nil {
+			t.Fatalf("CreateClient: %v", err)
+		}
+	}
+
+	service := NewConsentService(repos.Consents, repos.Tokens, NewClientRegistry(repos.Clients), NewScopeRegistry(repos.Scopes))
+	return service, repos
+}
+
+func TestRequiresConsent(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted string // scope granted before the request; empty for no grant
+		session AuthSession
+		want    bool
+	}{
+		{"no grant", "", AuthSession{ClientID: "third-party", Scope: "openid profile"}, true},
+		{"first-party client", "", AuthSession{ClientID: "first-party", Scope: "openid profile"}, false},
+		{"granted scopes", "openid profile", AuthSession{ClientID: "third-party", Scope: "openid profile"}, false},
+		{"narrower request", "openid profile email", AuthSession{ClientID: "third-party", Scope: "openid email"}, false},
+		{"new consent-required scope", "openid profile", AuthSession{ClientID: "third-party", Scope: "openid profile email"}, true},
+		{"new scope without consent", "profile", AuthSession{ClientID: "third-party", Scope: "openid profile"}, false},
+		{"unknown scope", "openid", AuthSession{ClientID: "third-party", Scope: "openid unknown"}, true},
+		{"prompt=consent", "openid profile", AuthSession{ClientID: "third-party", Scope: "openid profile", Prompt: "login consent"}, true},
+		{"authorization details", "openid", AuthSession{ClientID: "first-party", Scope: "openid", AuthorizationDetails: []AuthorizationDetail{{"type": "payment_initiation"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			service, _ := newConsentService(t)
+
+			if tt.granted != "" {
+				if err := service.GrantConsent(ctx, "user-1", tt.session.ClientID, tt.granted); err != nil {
+					t.Fatalf("GrantConsent: %v", err)
+				}
+			}
+
+			got, err := service.RequiresConsent(ctx, &tt.session, "user-1")
+			if err != nil {
+				t.Fatalf("RequiresConsent: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrantConsentMergesScopes(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newConsentService(t)
+
+	if err := service.GrantConsent(ctx, "user-1", "third-party", "openid profile"); err != nil {
+		t.Fatalf("GrantConsent: %v", err)
+	}
+	if err := service.GrantConsent(ctx, "user-1", "third-party", "email openid"); err != nil {
+		t.Fatalf("GrantConsent: %v", err)
+	}
+
+	grants, err := service.ListGrants(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("ListGrants: %v", err)
+	}
+	if len(grants) != 1 {
+		t.Fatalf("got %d grants, want 1", len(grants))
+	}
+	want := []string{"email", "openid", "profile"}
+	if len(grants[0].Scopes) != len(want) {
+		t.Fatalf("got scopes %v, want %v", grants[0].Scopes, want)
+	}
+	for i := range want {
+		if grants[0].Scopes[i] != want[i] {
+			t.Fatalf("got scopes %v, want %v", grants[0].Scopes, want)
+		}
+	}
+}
+
+func TestRevokeConsentRevokesClientTokens(t *testing.T) {
+	ctx := context.Background()
+	service, repos := newConsentService(t)
+
+	if err := service.GrantConsent(ctx, "user-1", "third-party", "openid profile"); err != nil {
+		t.Fatalf("GrantConsent: %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	tokens := []struct{ token, clientID string }{
+		{"third-party-token", "third-party"},
+		{"first-party-token", "first-party"},
+	}
+	for _, tok := range tokens {
+		if err := repos.Tokens.StoreRefreshToken(ctx, &storage.RefreshToken{
+			Token: "refresh-" + tok.token, ID: "id-" + tok.token, UserID: "user-1", ClientID: tok.clientID, Scope: "openid", ExpiresAt: expires,
+		}); err != nil {
+			t.Fatalf("StoreRefreshToken: %v", err)
+		}
+		if err := repos.Tokens.StoreAccessToken(ctx, "access-"+tok.token, &storage.AccessToken{
+			UserID: "user-1", ClientID: tok.clientID, Scope: "openid", ExpiresAt: expires,
+		}); err != nil {
+			t.Fatalf("StoreAccessToken: %v", err)
+		}
+	}
+
+	if err := service.RevokeConsent(ctx, "user-1", "third-party"); err != nil {
+		t.Fatalf("RevokeConsent: %v", err)
+	}
+
+	if grants, _ := service.ListGrants(ctx, "user-1"); len(grants) != 0 {
+		t.Fatalf("got %d grants after revoke, want 0", len(grants))
+	}
+	required, err := service.RequiresConsent(ctx, &AuthSession{ClientID: "third-party", Scope: "openid profile"}, "user-1")
+	if err != nil || !required {
+		t.Fatalf("got consent required %v (%v) after revoke, want true", required, err)
+	}
+
+	for _, tok := range tokens {
+		wantRevoked := tok.clientID == "third-party"
+
+		rt, err := repos.Tokens.GetRefreshToken(ctx, "refresh-"+tok.token)
+		if err != nil || rt == nil {
+			t.Fatalf("GetRefreshToken: %+v, %v", rt, err)
+		}
+		if rt.Revoked != wantRevoked {
+			t.Errorf("%s refresh token revoked=%v, want %v", tok.clientID, rt.Revoked, wantRevoked)
+		}
+
+		at, err := repos.Tokens.GetAccessToken(ctx, "access-"+tok.token)
+		if err != nil || at == nil {
+			t.Fatalf("GetAccessToken: %+v, %v", at, err)
+		}
+		if at.Revoked != wantRevoked {
+			t.Errorf("%s access token revoked=%v, want %v", tok.clientID, at.Revoked, wantRevoked)
+		}
+	}
+}
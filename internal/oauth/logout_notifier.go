@@ -0,0 +1,161 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+)
+
+// Back-channel delivery policy: attempts are spaced 1s, 2s, 4s, ... apart and each is bounded by backchannelTimeout
+const (
+	backchannelMaxAttempts  = 5
+	backchannelInitialDelay = 1 * time.Second
+	backchannelTimeout      = 10 * time.Second
+)
+
+// LogoutNotifier tells the clients that took part in a session that it has ended
+// Back-channel notifications are POSTed server-to-server; front-channel ones are iframe URLs
+// the logout page renders in the user's browser
+type LogoutNotifier struct {
+	lifetime       context.Context
+	jwtService     *security.JWTService
+	subjectService *SubjectService
+	clientRegistry *ClientRegistry
+	httpClient     *http.Client
+	retryDelay     time.Duration
+}
+
+// NewLogoutNotifier creates a notifier whose background deliveries are bound to lifetime,
+// the server's context: cancelling it at shutdown abandons pending retries
+func NewLogoutNotifier(
+	lifetime context.Context,
+	jwtService *security.JWTService,
+	subjectService *SubjectService,
+	clientRegistry *ClientRegistry,
+) *LogoutNotifier {
+	return &LogoutNotifier{
+		lifetime:       lifetime,
+		jwtService:     jwtService,
+		subjectService: subjectService,
+		clientRegistry: clientRegistry,
+		httpClient:     &http.Client{},
+		retryDelay:     backchannelInitialDelay,
+	}
+}
+
+// NotifyBackchannel sends a logout token to every client in the session with a back-channel URI
+// Delivery happens in the background and is retried with exponential backoff; it is bound to the
+// server's lifetime rather than ctx, since the request that ended the session usually completes first
+func (n *LogoutNotifier) NotifyBackchannel(ctx context.Context, session *storage.LoginSession) {
+	for _, clientID := range session.ClientIDs {
+		client, err := n.clientRegistry.GetClient(ctx, clientID)
+		if err != nil || client == nil || client.BackchannelLogoutURI == "" {
+			continue
+		}
+
+		subject, err := n.subjectService.SubjectFor(client, session.UserID)
+		if err != nil {
+			log.Printf("Back-channel logout: cannot derive subject for client %s: %v", clientID, err)
+			continue
+		}
+
+		sessionID := ""
+		if client.BackchannelLogoutSessionRequired {
+			sessionID = session.ID
+		}
+
+		logoutToken, err := n.jwtService.GenerateLogoutToken(subject, client.ClientID, sessionID)
+		if err != nil {
+			log.Printf("Back-channel logout: cannot sign logout token for client %s: %v", clientID, err)
+			continue
+		}
+
+		go n.deliver(n.lifetime, client.ClientID, client.BackchannelLogoutURI, logoutToken)
+	}
+}
+
+// deliver POSTs a logout token, retrying until the client acknowledges it, attempts run out or ctx ends
+func (n *LogoutNotifier) deliver(ctx context.Context, clientID, logoutURI, logoutToken string) {
+	delay := n.retryDelay
+	for attempt := 1; attempt <= backchannelMaxAttempts; attempt++ {
+		err := n.post(ctx, logoutURI, logoutToken)
+		if err == nil {
+			return
+		}
+
+		if attempt == backchannelMaxAttempts {
+			log.Printf("Back-channel logout to client %s failed after %d attempts: %v", clientID, attempt, err)
+			return
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Printf("Back-channel logout to client %s abandoned at shutdown after %d attempts: %v", clientID, attempt, err)
+			return
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// post sends one logout request; any 2xx response counts as delivered
+func (n *LogoutNotifier) post(ctx context.Context, logoutURI, logoutToken string) error {
+	ctx, cancel := context.WithTimeout(ctx, backchannelTimeout)
+	defer cancel()
+
+	form := url.Values{}
+	form.Set("logout_token", logoutToken)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, logoutURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cache-Control", "no-store")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// FrontchannelURIs returns the iframe URLs the logout page must load for a session
+func (n *LogoutNotifier) FrontchannelURIs(ctx context.Context, session *storage.LoginSession) []string {
+	var uris []string
+	for _, clientID := range session.ClientIDs {
+		client, err := n.clientRegistry.GetClient(ctx, clientID)
+		if err != nil || client == nil || client.FrontchannelLogoutURI == "" {
+			continue
+		}
+
+		frontchannelURL, err := url.Parse(client.FrontchannelLogoutURI)
+		if err != nil {
+			continue
+		}
+		if client.FrontchannelLogoutSessionRequired {
+			q := frontchannelURL.Query()
+			q.Set("iss", n.jwtService.Issuer())
+			q.Set("sid", session.ID)
+			frontchannelURL.RawQuery = q.Encode()
+		}
+
+		uris = append(uris, frontchannelURL.String())
+	}
+	return uris
+}
@@ -0,0 +1,120 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+)
+
+// newLogoutNotifier returns a notifier over ctx with a client "rp" whose back-channel logout URI is logoutURI
+func newLogoutNotifier(t *testing.T, ctx context.Context, logoutURI string) (*LogoutNotifier, *security.SigningKey) {
+	t.Helper()
+
+	repos := memory.NewRepositories()
+	if err := repos.Clients.CreateClient(context.Background(), &storage.OAuthClient{
+		ClientID: "rp", ClientType: "confidential", SubjectType: "pairwise",
+		RedirectURIs:                     pq.StringArray{"https://rp.example.com/callback"},
+		BackchannelLogoutURI:             logoutURI,
+		BackchannelLogoutSessionRequired: true,
+	}); err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	key, err := security.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	notifier := NewLogoutNotifier(ctx, security.NewJWTService("https://auth.example.com", key),
+		NewSubjectService("salt"), NewClientRegistry(repos.Clients))
+	notifier.retryDelay = 10 * time.Millisecond
+	return notifier, key
+}
+
+func TestBackchannelLogoutRetriesUntilAcknowledged(t *testing.T) {
+	var attempts atomic.Int32
+	tokens := make(chan string, 1)
+	rp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		tokens <- r.PostFormValue("logout_token")
+	}))
+	defer rp.Close()
+
+	notifier, key := newLogoutNotifier(t, t.Context(), rp.URL)
+	notifier.NotifyBackchannel(context.Background(), &storage.LoginSession{ID: "session-1", UserID: "user-1", ClientIDs: pq.StringArray{"rp"}})
+
+	var logoutToken string
+	select {
+	case logoutToken = <-tokens:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("logout token not delivered after %d attempts", attempts.Load())
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("delivered on attempt %d, want 3", attempts.Load())
+	}
+
+	// The relying party verifies the token with the published key
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(logoutToken, claims, func(*jwt.Token) (interface{}, error) {
+		return &key.PrivateKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer("https://auth.example.com"), jwt.WithAudience("rp")); err != nil {
+		t.Fatalf("logout token does not verify: %v", err)
+	}
+	subject, _ := NewSubjectService("salt").SubjectFor(&storage.OAuthClient{SubjectType: "pairwise",
+		RedirectURIs: pq.StringArray{"https://rp.example.com/callback"}}, "user-1")
+	if claims["sub"] != subject || claims["sid"] != "session-1" || claims["nonce"] != nil {
+		t.Errorf("got sub %v, sid %v, nonce %v; want the pairwise subject and session-1 without a nonce", claims["sub"], claims["sid"], claims["nonce"])
+	}
+	if events, _ := claims["events"].(map[string]interface{}); events[security.BackchannelLogoutEvent] == nil {
+		t.Errorf("events = %v, want the back-channel logout event", claims["events"])
+	}
+}
+
+func TestBackchannelLogoutStopsRetryingAtShutdown(t *testing.T) {
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+
+	var attempts atomic.Int32
+	rp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer rp.Close()
+
+	notifier, _ := newLogoutNotifier(t, ctx, rp.URL)
+	notifier.retryDelay = time.Hour
+
+	done := make(chan struct{})
+	go func() {
+		notifier.deliver(ctx, "rp", rp.URL, "logout-token")
+		close(done)
+	}()
+
+	// The first attempt fails and the next one is an hour away; shutting down ends the wait
+	deadline := time.Now().Add(5 * time.Second)
+	for attempts.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	shutdown()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery kept waiting to retry after shutdown")
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("got %d attempts, want 1", attempts.Load())
+	}
+}
@@ -0,0 +1,108 @@
+package oauth
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"oauth-golang/internal/storage"
+)
+
+// PaymentInitiationType handles "payment_initiation" authorization details: permission to
+// transfer a bounded amount, optionally from and to given accounts (RFC 9396 §2, example type)
+//
+//	{"type": "payment_initiation", "actions": ["initiate"],
+//	 "instructedAmount": {"currency": "EUR", "amount": "123.50"},
+//	 "debtorAccount": {"iban": "DE02100100109307118603"},
+//	 "creditorName": "Merchant A", "creditorAccount": {"iban": "DE02120300000000202051"}}
+type PaymentInitiationType struct{}
+
+// paymentActions are the actions a payment_initiation detail may list
+var paymentActions = map[string]bool{"initiate": true, "status": true, "cancel": true}
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	amountPattern   = regexp.MustCompile(`^[0-9]+(\.[0-9]{1,2})?$`)
+	ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+)
+
+func (PaymentInitiationType) Name() string {
+	return "payment_initiation"
+}
+
+// Validate requires a positive instructedAmount and well-formed actions and accounts
+func (PaymentInitiationType) Validate(client *storage.OAuthClient, detail AuthorizationDetail) error {
+	if actions, ok := detail["actions"]; ok {
+		list, ok := actions.([]interface{})
+		if !ok {
+			return fmt.Errorf("payment_initiation actions must be an array")
+		}
+		for _, action := range list {
+			name, _ := action.(string)
+			if !paymentActions[name] {
+				return fmt.Errorf("unsupported payment_initiation action %v", action)
+			}
+		}
+	}
+
+	amount, ok := detail["instructedAmount"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("payment_initiation requires instructedAmount")
+	}
+	currency, _ := amount["currency"].(string)
+	if !currencyPattern.MatchString(currency) {
+		return fmt.Errorf("instructedAmount.currency must be an ISO 4217 code")
+	}
+	value, _ := amount["amount"].(string)
+	if !amountPattern.MatchString(value) {
+		return fmt.Errorf("instructedAmount.amount must be a decimal string")
+	}
+	if parsed, _ := strconv.ParseFloat(value, 64); parsed <= 0 {
+		return fmt.Errorf("instructedAmount.amount must be positive")
+	}
+
+	for _, member := range []string{"debtorAccount", "creditorAccount"} {
+		raw, ok := detail[member]
+		if !ok {
+			continue
+		}
+		account, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", member)
+		}
+		iban, _ := account["iban"].(string)
+		if !ibanPattern.MatchString(strings.ReplaceAll(iban, " ", "")) {
+			return fmt.Errorf("%s.iban is not a valid IBAN", member)
+		}
+	}
+
+	return nil
+}
+
+// Describe renders e.g. "Pay up to 123.50 EUR to Merchant A from account DE02…8603"
+func (PaymentInitiationType) Describe(detail AuthorizationDetail) string {
+	amount, _ := detail["instructedAmount"].(map[string]interface{})
+	value, _ := amount["amount"].(string)
+	currency, _ := amount["currency"].(string)
+
+	description := fmt.Sprintf("Pay up to %s %s", value, currency)
+	if creditor, _ := detail["creditorName"].(string); creditor != "" {
+		description += " to " + creditor
+	}
+	if account, ok := detail["debtorAccount"].(map[string]interface{}); ok {
+		if iban, _ := account["iban"].(string); iban != "" {
+			description += " from account " + maskIBAN(iban)
+		}
+	}
+	return description
+}
+
+// maskIBAN keeps the country code, check digits and last four characters of an IBAN
+func maskIBAN(iban string) string {
+	iban = strings.ReplaceAll(iban, " ", "")
+	if len(iban) <= 8 {
+		return iban
+	}
+	return iban[:4] + "…" + iban[len(iban)-4:]
+}
@@ -0,0 +1,129 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"oauth-golang/internal/storage"
+)
+
+// ErrInvalidTarget is returned when a resource parameter names an unknown or unauthorized resource (RFC 8707 §2)
+var ErrInvalidTarget = errors.New("invalid_target")
+
+// ResourceRegistry manages the protected resources clients may request access tokens for
+// DB INTERACTION: Retrieves protected resource definitions from database
+type ResourceRegistry struct {
+	resourceRepo storage.ResourceRepository
+}
+
+func NewResourceRegistry(resourceRepo storage.ResourceRepository) *ResourceRegistry {
+	return &ResourceRegistry{
+		resourceRepo: resourceRepo,
+	}
+}
+
+// GetResource retrieves a protected resource by identifier
+// DB INTERACTION: Queries database via resourceRepo
+func (r *ResourceRegistry) GetResource(ctx context.Context, identifier string) (*storage.ProtectedResource, error) {
+	return r.resourceRepo.GetProtectedResource(ctx, identifier)
+}
+
+// ResolveResources validates the resource parameters of a request and returns them without duplicates
+// Each must be an absolute URI without a fragment and registered in the database
+func (r *ResourceRegistry) ResolveResources(ctx context.Context, requested []string) ([]string, error) {
+	var resources []string
+	seen := make(map[string]bool)
+	for _, identifier := range requested {
+		if seen[identifier] {
+			continue
+		}
+		seen[identifier] = true
+
+		parsed, err := url.Parse(identifier)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || strings.Contains(identifier, "#") {
+			return nil, fmt.Errorf("%w: resource %q must be an absolute URI without a fragment", ErrInvalidTarget, identifier)
+		}
+
+		resource, err := r.GetResource(ctx, identifier)
+		if err != nil {
+			return nil, err
+		}
+		if resource == nil {
+			return nil, fmt.Errorf("%w: unknown resource %q", ErrInvalidTarget, identifier)
+		}
+		resources = append(resources, identifier)
+	}
+
+	return resources, nil
+}
+
+// SelectResource picks the resource a single access token is issued for
+// granted are the resources authorized for the grant, requested the resource parameters of the
+// token request. An access token has one audience; a client authorized for several resources
+// names one per token request. Returns nil when neither restricts the token
+// DB INTERACTION: Queries database via resourceRepo
+func (r *ResourceRegistry) SelectResource(ctx context.Context, granted, requested []string) (*storage.ProtectedResource, error) {
+	requested, err := r.ResolveResources(ctx, requested)
+	if err != nil {
+		return nil, err
+	}
+
+	var identifier string
+	switch {
+	case len(requested) > 1:
+		return nil, fmt.Errorf("%w: an access token is issued for one resource at a time", ErrInvalidTarget)
+	case len(requested) == 1:
+		identifier = requested[0]
+		if len(granted) > 0 && !containsString(granted, identifier) {
+			return nil, fmt.Errorf("%w: resource %q was not authorized", ErrInvalidTarget, identifier)
+		}
+	case len(granted) == 1:
+		identifier = granted[0]
+	case len(granted) > 1:
+		return nil, fmt.Errorf("%w: resource is required when more than one resource was authorized", ErrInvalidTarget)
+	default:
+		return nil, nil
+	}
+
+	resource, err := r.GetResource(ctx, identifier)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("%w: unknown resource %q", ErrInvalidTarget, identifier)
+	}
+	return resource, nil
+}
+
+// ResourceScope narrows a scope to the scopes a resource accepts
+// A token left with no scope the resource understands is rejected
+func ResourceScope(resource *storage.ProtectedResource, scope string) (string, error) {
+	if resource == nil {
+		return scope, nil
+	}
+
+	var kept []string
+	for _, name := range strings.Fields(scope) {
+		if resource.AllowsScope(name) {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) == 0 {
+		return "", fmt.Errorf("%w: none of the granted scopes apply to resource %q", ErrInvalidScope, resource.Identifier)
+	}
+
+	return strings.Join(kept, " "), nil
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
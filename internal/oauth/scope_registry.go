@@ -0,0 +1,175 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"oauth-golang/internal/storage"
+)
+
+// ErrInvalidScope is returned when a request asks for a scope that is unknown or not allowed
+var ErrInvalidScope = errors.New("invalid_scope")
+
+// UpstreamScopes are the Google scopes we request to identify the user
+// They are independent of the scopes clients request from us
+const UpstreamScopes = "openid email profile"
+
+// WorkspaceGroupsScope is added to UpstreamScopes when Google Workspace groups are mirrored at login
+const WorkspaceGroupsScope = "https://www.googleapis.com/auth/cloud-identity.groups.readonly"
+
+// AdminScope grants access to the administrative endpoints
+// Only clients registered with it may request it, and only users holding storage.AdminRole are granted it
+const AdminScope = "admin"
+
+// RoleSource reports whether a user holds a global role
+type RoleSource interface {
+	HasGlobalRole(ctx context.Context, userID, role string) (bool, error)
+}
+
+// ScopeRegistry manages the scopes clients may request
+// DB INTERACTION: Retrieves scope definitions from database
+type ScopeRegistry struct {
+	scopeRepo storage.ScopeRepository
+	roles     RoleSource
+}
+
+func NewScopeRegistry(scopeRepo storage.ScopeRepository) *ScopeRegistry {
+	return &ScopeRegistry{
+		scopeRepo: scopeRepo,
+	}
+}
+
+// SetRoleSource supplies the roles checked for scopes with a required role
+// Without one, such scopes are never granted
+func (r *ScopeRegistry) SetRoleSource(roles RoleSource) {
+	r.roles = roles
+}
+
+// GetScope retrieves a scope definition by name
+// DB INTERACTION: Queries database via scopeRepo
+func (r *ScopeRegistry) GetScope(ctx context.Context, name string) (*storage.Scope, error) {
+	return r.scopeRepo.GetScope(ctx, name)
+}
+
+// ListScopes retrieves all registered scopes
+// DB INTERACTION: Queries database via scopeRepo
+func (r *ScopeRegistry) ListScopes(ctx context.Context) ([]*storage.Scope, error) {
+	return r.scopeRepo.ListScopes(ctx)
+}
+
+// DescribeScope returns a human-readable line for each scope in a scope string
+// Scopes without a description are listed by name
+func (r *ScopeRegistry) DescribeScope(ctx context.Context, scope string) ([]string, error) {
+	var descriptions []string
+	for _, name := range strings.Fields(scope) {
+		definition, err := r.GetScope(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if definition != nil && definition.Description != "" {
+			descriptions = append(descriptions, definition.Description)
+		} else {
+			descriptions = append(descriptions, name)
+		}
+	}
+	return descriptions, nil
+}
+
+// ResolveScope validates a requested scope string for a client and returns the scope to grant
+// An empty request gets the registry defaults. Unknown scopes are rejected; known scopes the
+// client is not allowed are dropped, and a request left with nothing is rejected
+func (r *ScopeRegistry) ResolveScope(ctx context.Context, client *storage.OAuthClient, requested string) (string, error) {
+	names := strings.Fields(requested)
+	if len(names) == 0 {
+		scopes, err := r.ListScopes(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, scope := range scopes {
+			if scope.Default {
+				names = append(names, scope.Name)
+			}
+		}
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range strings.Fields(client.Scope) {
+		allowed[name] = true
+	}
+
+	var granted []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		scope, err := r.GetScope(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if scope == nil {
+			return "", fmt.Errorf("%w: unknown scope %q", ErrInvalidScope, name)
+		}
+		if allowed[name] {
+			granted = append(granted, name)
+		}
+	}
+
+	if len(granted) == 0 {
+		return "", fmt.Errorf("%w: none of the requested scopes are allowed for this client", ErrInvalidScope)
+	}
+
+	return strings.Join(granted, " "), nil
+}
+
+// RestrictToUser drops the scopes bound to a role the user does not hold
+// It runs once the user is known, before consent; the result may be empty
+// DB INTERACTION: Queries scope definitions via scopeRepo and roles via the role source
+func (r *ScopeRegistry) RestrictToUser(ctx context.Context, scope, userID string) (string, error) {
+	var granted []string
+	for _, name := range strings.Fields(scope) {
+		definition, err := r.GetScope(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if definition != nil && definition.RequiredRole != "" {
+			if r.roles == nil {
+				continue
+			}
+			held, err := r.roles.HasGlobalRole(ctx, userID, definition.RequiredRole)
+			if err != nil {
+				return "", err
+			}
+			if !held {
+				continue
+			}
+		}
+		granted = append(granted, name)
+	}
+	return strings.Join(granted, " "), nil
+}
+
+// NarrowScope checks that a requested scope is a subset of an already granted scope
+// An empty request keeps the granted scope (RFC 6749 §6)
+func NarrowScope(granted, requested string) (string, error) {
+	if requested == "" {
+		return granted, nil
+	}
+
+	grantedSet := make(map[string]bool)
+	for _, name := range strings.Fields(granted) {
+		grantedSet[name] = true
+	}
+
+	for _, name := range strings.Fields(requested) {
+		if !grantedSet[name] {
+			return "", fmt.Errorf("%w: scope %q exceeds the original grant", ErrInvalidScope, name)
+		}
+	}
+
+	return strings.Join(strings.Fields(requested), " "), nil
+}
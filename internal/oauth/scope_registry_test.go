@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+	"oauth-golang/internal/user"
+)
+
+func TestResolveScope(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	storage.Seed(ctx, repos)
+
+	registry := NewScopeRegistry(repos.Scopes)
+	client := &storage.OAuthClient{ClientID: "app", Scope: "openid email"}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"allowed scopes", "openid email", "openid email", false},
+		{"duplicates collapse", "openid openid email", "openid email", false},
+		{"disallowed scopes dropped", "openid profile", "openid", false},
+		{"defaults intersected with the client", "", "email openid", false}, // registry order
+		{"unknown scope", "openid calendar", "", true},
+		{"nothing allowed", "profile", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registry.ResolveScope(ctx, client, tt.requested)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidScope) {
+					t.Fatalf("err = %v, want ErrInvalidScope", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveScope: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNarrowScope(t *testing.T) {
+	tests := []struct {
+		requested string
+		want      string
+		wantErr   bool
+	}{
+		{"", "openid profile email", false},
+		{"openid  email", "openid email", false},
+		{"openid admin", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NarrowScope("openid profile email", tt.requested)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidScope) {
+				t.Errorf("NarrowScope(%q) err = %v, want ErrInvalidScope", tt.requested, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NarrowScope(%q) = %q, %v; want %q", tt.requested, got, err, tt.want)
+		}
+	}
+}
+
+func TestRestrictToUserDropsAdminScopeWithoutRole(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	storage.Seed(ctx, repos)
+
+	registry := NewScopeRegistry(repos.Scopes)
+
+	// Without a role source role-bound scopes are never granted
+	got, err := registry.RestrictToUser(ctx, "openid admin", "admin-user")
+	if err != nil {
+		t.Fatalf("RestrictToUser: %v", err)
+	}
+	if got != "openid" {
+		t.Fatalf("got %q without a role source, want %q", got, "openid")
+	}
+
+	registry.SetRoleSource(user.NewRBACService(repos.RBAC))
+
+	for _, id := range []string{"admin-user", "other-user"} {
+		if err := repos.Users.CreateUser(ctx, &storage.User{ID: id, Email: id + "@example.com"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	roles, err := repos.RBAC.ListRoles(ctx)
+	if err != nil {
+		t.Fatalf("ListRoles: %v", err)
+	}
+	for _, role := range roles {
+		if role.ClientID == "" && role.Name == storage.AdminRole {
+			if err := repos.RBAC.AssignUserRole(ctx, "admin-user", role.ID); err != nil {
+				t.Fatalf("AssignUserRole: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		userID string
+		scope  string
+		want   string
+	}{
+		{"admin keeps admin scope", "admin-user", "openid admin", "openid admin"},
+		{"other user loses admin scope", "other-user", "openid admin", "openid"},
+		{"only admin scope requested", "other-user", "admin", ""},
+		{"unrestricted scopes untouched", "other-user", "openid profile email", "openid profile email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registry.RestrictToUser(ctx, tt.scope, tt.userID)
+			if err != nil {
+				t.Fatalf("RestrictToUser: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+)
+
+// SessionCookieName is the cookie carrying the single sign-on session
+const SessionCookieName = "oauth_session"
+
+// sessionCookie is the sealed content of the SSO cookie
+// Only a reference is kept client-side so sessions can be revoked server-side
+type sessionCookie struct {
+	SessionID string    `json:"sid"`
+	UserID    string    `json:"uid"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// SessionService manages the authorization server's own login session
+// DB INTERACTION: Persists sessions via sessionRepo
+type SessionService struct {
+	sessionRepo  storage.SessionRepository
+	tokenRepo    storage.TokenRepository
+	notifier     *LogoutNotifier
+	codec        *security.CookieCodec
+	ttl          time.Duration
+	secureCookie bool
+}
+
+func NewSessionService(
+	sessionRepo storage.SessionRepository,
+	tokenRepo storage.TokenRepository,
+	notifier *LogoutNotifier,
+	codec *security.CookieCodec,
+	ttl time.Duration,
+	secureCookie bool,
+) *SessionService {
+	return &SessionService{
+		sessionRepo:  sessionRepo,
+		tokenRepo:    tokenRepo,
+		notifier:     notifier,
+		codec:        codec,
+		ttl:          ttl,
+		secureCookie: secureCookie,
+	}
+}
+
+// Start records a completed authentication and sets the SSO cookie
+// Any session already in the browser is revoked so a login never inherits a previous session ID
+// OUTPUT TO DB: Inserts session via sessionRepo
+func (s *SessionService) Start(w http.ResponseWriter, r *http.Request, userID string, amr []string, acr string) (*storage.LoginSession, error) {
+	ctx := r.Context()
+	if previous, _ := s.Current(r); previous != nil {
+		s.sessionRepo.RevokeSession(ctx, previous.ID)
+	}
+
+	now := time.Now()
+	session := &storage.LoginSession{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		AuthTime:  now,
+		AMR:       amr,
+		ACR:       acr,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: now.Add(s.ttl),
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	value, err := s.codec.Encode(SessionCookieName, &sessionCookie{
+		SessionID: session.ID,
+		UserID:    userID,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   s.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return session, nil
+}
+
+// Current returns the live session referenced by the request's SSO cookie, or nil
+// INPUT FROM DB: Loads session via sessionRepo
+func (s *SessionService) Current(r *http.Request) (*storage.LoginSession, error) {
+	ctx := r.Context()
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return nil, nil
+	}
+
+	var content sessionCookie
+	if err := s.codec.Decode(SessionCookieName, cookie.Value, &content); err != nil {
+		return nil, nil
+	}
+	if time.Now().After(content.ExpiresAt) {
+		return nil, nil
+	}
+
+	session, err := s.sessionRepo.GetSession(ctx, content.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.Revoked || session.UserID != content.UserID || time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	s.sessionRepo.TouchSession(ctx, session.ID)
+
+	return session, nil
+}
+
+// Logout ends a session server-side, optionally revoking the refresh and access tokens issued under it,
+// and sends back-channel logout notifications to the clients that took part in it
+// Returns the ended session (nil if it did not exist) so callers can render front-channel logout
+// OUTPUT TO DB: Revokes session via sessionRepo and refresh tokens via tokenRepo
+func (s *SessionService) Logout(ctx context.Context, sessionID string, revokeRefreshTokens bool) (*storage.LoginSession, error) {
+	session, err := s.sessionRepo.GetSession(ctx, sessionID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.RevokeSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	if revokeRefreshTokens {
+		if err := s.tokenRepo.RevokeSessionRefreshTokens(ctx, sessionID); err != nil {
+			return nil, err
+		}
+		// Opaque access tokens can be cut off immediately, unlike self-contained JWTs
+		if err := s.tokenRepo.RevokeSessionAccessTokens(ctx, sessionID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only notify for sessions that were still live; repeated logouts stay silent
+	if !session.Revoked {
+		s.notifier.NotifyBackchannel(ctx, session)
+	}
+
+	return session, nil
+}
+
+// LogoutUser ends every live session of a user, e.g. when an administrator disables the account
+// OUTPUT TO DB: Revokes sessions and refresh tokens
+func (s *SessionService) LogoutUser(ctx context.Context, userID string, revokeRefreshTokens bool) error {
+	sessions, err := s.sessionRepo.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if _, err := s.Logout(ctx, session.ID, revokeRefreshTokens); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SessionSummary is a live session together with the refresh tokens issued under it
+type SessionSummary struct {
+	Session       *storage.LoginSession
+	RefreshTokens []*storage.RefreshToken
+}
+
+// ListUserSessions returns a user's live sessions with their refresh tokens, plus the active
+// refresh tokens that are not tied to a live session (e.g. issued before SSO sessions existed)
+// INPUT FROM DB: Loads sessions via sessionRepo and refresh tokens via tokenRepo
+func (s *SessionService) ListUserSessions(ctx context.Context, userID string) ([]*SessionSummary, []*storage.RefreshToken, error) {
+	sessions, err := s.sessionRepo.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.tokenRepo.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summaries := make([]*SessionSummary, 0, len(sessions))
+	bySession := make(map[string]*SessionSummary, len(sessions))
+	for _, session := range sessions {
+		summary := &SessionSummary{Session: session}
+		summaries = append(summaries, summary)
+		bySession[session.ID] = summary
+	}
+
+	var unbound []*storage.RefreshToken
+	for _, token := range tokens {
+		if summary, ok := bySession[token.SessionID]; ok {
+			summary.RefreshTokens = append(summary.RefreshTokens, token)
+			continue
+		}
+		unbound = append(unbound, token)
+	}
+
+	return summaries, unbound, nil
+}
+
+// RevokeUserSession signs a user out of one of their sessions and revokes its refresh tokens
+// The session must belong to userID, so users cannot end each other's sessions
+// OUTPUT TO DB: Revokes session and refresh tokens
+func (s *SessionService) RevokeUserSession(ctx context.Context, userID, sessionID string) error {
+	session, err := s.sessionRepo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID {
+		return fmt.Errorf("session not found")
+	}
+
+	_, err = s.Logout(ctx, sessionID, true)
+	return err
+}
+
+// RevokeUserRefreshToken revokes one of a user's refresh tokens by its public ID
+// OUTPUT TO DB: Revokes refresh token via tokenRepo
+func (s *SessionService) RevokeUserRefreshToken(ctx context.Context, userID, tokenID string) error {
+	return s.tokenRepo.RevokeRefreshTokenByID(ctx, userID, tokenID)
+}
+
+// CSRFToken returns the token forms posted by the browser of a session must carry
+func (s *SessionService) CSRFToken(session *storage.LoginSession) string {
+	return s.codec.Token("csrf", session.ID)
+}
+
+// VerifyCSRFToken reports whether token is the CSRF token of the session
+func (s *SessionService) VerifyCSRFToken(session *storage.LoginSession, token string) bool {
+	return s.codec.VerifyToken("csrf", session.ID, token)
+}
+
+// FrontchannelURIs returns the front-channel logout iframe URLs for an ended session
+func (s *SessionService) FrontchannelURIs(ctx context.Context, session *storage.LoginSession) []string {
+	return s.notifier.FrontchannelURIs(ctx, session)
+}
+
+// ClearCookie removes the SSO cookie from the browser
+func (s *SessionService) ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clientIP returns the remote address of the request without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,70 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	"oauth-golang/internal/storage"
+)
+
+// SubjectService derives the "sub" value a client sees for a user
+// Public clients see the user's immutable ID; pairwise clients see a per-sector
+// identifier so that clients in different sectors cannot correlate users (OIDC Core §8)
+type SubjectService struct {
+	salt string
+}
+
+func NewSubjectService(salt string) *SubjectService {
+	return &SubjectService{
+		salt: salt,
+	}
+}
+
+// SubjectFor returns the subject identifier for a user as seen by the given client
+func (s *SubjectService) SubjectFor(client *storage.OAuthClient, userID string) (string, error) {
+	if client == nil || !client.UsesPairwiseSubject() {
+		return userID, nil
+	}
+
+	sector, err := SectorIdentifier(client)
+	if err != nil {
+		return "", err
+	}
+
+	// sub = SHA-256(sector_identifier || local_account_id || salt), as suggested in OIDC Core §8.1
+	hash := sha256.Sum256([]byte(sector + userID + s.salt))
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+// SectorIdentifier returns the host used to group a client's pairwise subjects
+// It is the host of sector_identifier_uri when registered, otherwise the host of the redirect URIs
+func SectorIdentifier(client *storage.OAuthClient) (string, error) {
+	if client.SectorIdentifierURI != "" {
+		u, err := url.Parse(client.SectorIdentifierURI)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return "", fmt.Errorf("invalid sector_identifier_uri for client %s", client.ClientID)
+		}
+		return u.Host, nil
+	}
+
+	// Without a sector_identifier_uri all redirect URIs must share one host
+	var sector string
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid redirect_uri for client %s", client.ClientID)
+		}
+		if sector != "" && u.Host != sector {
+			return "", fmt.Errorf("client %s has redirect URIs on multiple hosts and needs a sector_identifier_uri", client.ClientID)
+		}
+		sector = u.Host
+	}
+
+	if sector == "" {
+		return "", fmt.Errorf("client %s has no redirect URIs to derive a sector from", client.ClientID)
+	}
+
+	return sector, nil
+}
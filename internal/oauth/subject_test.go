@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"testing"
+
+	"oauth-golang/internal/storage"
+)
+
+func pairwiseClient(id, sectorURI string, redirectURIs ...string) *storage.OAuthClient {
+	return &storage.OAuthClient{ClientID: id, SubjectType: "pairwise", SectorIdentifierURI: sectorURI, RedirectURIs: redirectURIs}
+}
+
+func TestSubjectForPairwiseClients(t *testing.T) {
+	service := NewSubjectService("salt")
+
+	subject := func(client *storage.OAuthClient, userID string) string {
+		t.Helper()
+		sub, err := service.SubjectFor(client, userID)
+		if err != nil {
+			t.Fatalf("SubjectFor(%s): %v", client.ClientID, err)
+		}
+		return sub
+	}
+
+	web := pairwiseClient("web", "", "https://app.example.com/callback")
+	mobile := pairwiseClient("mobile", "", "https://app.example.com/mobile")
+	other := pairwiseClient("other", "", "https://other.example.org/callback")
+	grouped := pairwiseClient("grouped", "https://app.example.com/sector.json", "https://login.example.net/callback")
+
+	if got := subject(&storage.OAuthClient{ClientID: "public"}, "user-1"); got != "user-1" {
+		t.Errorf("public client got %q, want the user ID", got)
+	}
+	if got := subject(web, "user-1"); got == "user-1" || got != subject(web, "user-1") {
+		t.Errorf("pairwise subject %q is not a stable derived value", got)
+	}
+	if subject(web, "user-1") != subject(mobile, "user-1") {
+		t.Error("clients in the same sector see different subjects")
+	}
+	if subject(web, "user-1") != subject(grouped, "user-1") {
+		t.Error("sector_identifier_uri does not place the client in its sector")
+	}
+	if subject(web, "user-1") == subject(other, "user-1") {
+		t.Error("clients in different sectors see the same subject")
+	}
+	if subject(web, "user-1") == subject(web, "user-2") {
+		t.Error("different users share a pairwise subject")
+	}
+
+	resalted, err := NewSubjectService("other-salt").SubjectFor(web, "user-1")
+	if err != nil || resalted == subject(web, "user-1") {
+		t.Errorf("changing the salt kept subject %q (err %v)", resalted, err)
+	}
+}
+
+func TestSectorIdentifierRejectsAmbiguousClients(t *testing.T) {
+	for _, client := range []*storage.OAuthClient{
+		pairwiseClient("multi-host", "", "https://a.example.com/cb", "https://b.example.com/cb"),
+		pairwiseClient("http-sector", "http://app.example.com/sector.json", "https://app.example.com/cb"),
+		pairwiseClient("no-redirects", ""),
+	} {
+		if sector, err := SectorIdentifier(client); err == nil {
+			t.Errorf("%s: got sector %q, want an error", client.ClientID, sector)
+		}
+	}
+}
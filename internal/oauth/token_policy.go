@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/storage"
+)
+
+// Access token formats
+const (
+	AccessTokenFormatJWT    = "jwt"    // self-contained signed JWT
+	AccessTokenFormatOpaque = "opaque" // random reference resolved server-side; clients cannot read it
+)
+
+// TokenPolicy is the effective token configuration for one client
+type TokenPolicy struct {
+	AccessTokenTTL      time.Duration
+	RefreshTokenTTL     time.Duration // absolute lifetime of a grant's refresh tokens
+	RefreshTokenIdleTTL time.Duration // 0 means refresh tokens never expire from inactivity
+	IDTokenTTL          time.Duration
+	AuthCodeTTL         time.Duration
+	AccessTokenFormat   string
+}
+
+// TokenPolicies resolves token policies from the global defaults and per-client overrides
+// DB INTERACTION: Loads clients via clientRegistry
+type TokenPolicies struct {
+	defaults       TokenPolicy
+	clientRegistry *ClientRegistry
+}
+
+func NewTokenPolicies(cfg *config.Config, clientRegistry *ClientRegistry) *TokenPolicies {
+	return &TokenPolicies{
+		defaults: TokenPolicy{
+			AccessTokenTTL:      cfg.AccessTokenTTL,
+			RefreshTokenTTL:     cfg.RefreshTokenTTL,
+			RefreshTokenIdleTTL: cfg.RefreshTokenIdleTTL,
+			IDTokenTTL:          cfg.IDTokenTTL,
+			AuthCodeTTL:         cfg.AuthCodeTTL,
+			AccessTokenFormat:   cfg.AccessTokenFormat,
+		},
+		clientRegistry: clientRegistry,
+	}
+}
+
+// ForClient returns the policy for a client: each lifetime set on the client replaces the default
+func (p *TokenPolicies) ForClient(client *storage.OAuthClient) *TokenPolicy {
+	policy := p.defaults
+	if client == nil {
+		return &policy
+	}
+
+	overrides := []struct {
+		seconds int
+		target  *time.Duration
+	}{
+		{client.AccessTokenLifetime, &policy.AccessTokenTTL},
+		{client.RefreshTokenLifetime, &policy.RefreshTokenTTL},
+		{client.RefreshTokenIdleLifetime, &policy.RefreshTokenIdleTTL},
+		{client.IDTokenLifetime, &policy.IDTokenTTL},
+		{client.AuthCodeLifetime, &policy.AuthCodeTTL},
+	}
+	for _, o := range overrides {
+		if o.seconds > 0 {
+			*o.target = time.Duration(o.seconds) * time.Second
+		}
+	}
+
+	if client.AccessTokenFormat == AccessTokenFormatJWT || client.AccessTokenFormat == AccessTokenFormatOpaque {
+		policy.AccessTokenFormat = client.AccessTokenFormat
+	}
+	// A JWT would hand a pairwise client the internal user ID it must not be able to correlate
+	if client.UsesPairwiseSubject() {
+		policy.AccessTokenFormat = AccessTokenFormatOpaque
+	}
+
+	return &policy
+}
+
+// For returns the policy for a client ID
+// DB INTERACTION: Queries database via clientRegistry
+func (p *TokenPolicies) For(ctx context.Context, clientID string) (*TokenPolicy, error) {
+	client, err := p.clientRegistry.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client: %w", err)
+	}
+	return p.ForClient(client), nil
+}
+
+// RefreshTokenIdleExpired reports whether a refresh token has been unused for longer than the idle limit
+func (p *TokenPolicy) RefreshTokenIdleExpired(token *storage.RefreshToken) bool {
+	if p.RefreshTokenIdleTTL <= 0 {
+		return false
+	}
+	lastActivity := token.CreatedAt
+	if token.LastUsedAt != nil {
+		lastActivity = *token.LastUsedAt
+	}
+	return time.Since(lastActivity) > p.RefreshTokenIdleTTL
+}
@@ -1,12 +1,19 @@
 package oauth
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"oauth-golang/internal/config"
 	"oauth-golang/internal/security"
 	"oauth-golang/internal/storage"
+	"oauth-golang/pkg/utils"
 )
 
 // TokenPair represents an access token and refresh token pair
@@ -15,134 +22,548 @@ type TokenPair struct {
 	RefreshToken string
 	IDToken      string
 	ExpiresIn    time.Duration
+	Scope        string // scope of the access token
+	// AuthorizationDetails are the details the access token carries, echoed in the token response
+	AuthorizationDetails []AuthorizationDetail
+}
+
+// AuthenticationContext describes how the user authenticated for this grant
+// Carried into the ID token as the "amr", "acr", "auth_time" and "nonce" claims
+type AuthenticationContext struct {
+	AMR       []string
+	ACR       string
+	SessionID string // SSO session, carried as "sid" and recorded on the refresh token
+	AuthTime  time.Time
+	Nonce     string // only set when redeeming the authorization code
+	Code      string // authorization code being redeemed, hashed into "c_hash"
+}
+
+// Requester records where a token request came from, for the user's list of signed-in devices
+// For confidential clients this is the client's backend; for public clients it is the user's device
+type Requester struct {
+	IPAddress string
+	UserAgent string
+}
+
+// RequesterFromRequest extracts the requester of a token endpoint call
+func RequesterFromRequest(r *http.Request) *Requester {
+	return &Requester{IPAddress: clientIP(r), UserAgent: r.UserAgent()}
 }
 
 // TokenService handles token generation and refresh
 // OUTPUT TO DB: Stores refresh tokens in database via tokenRepo
 type TokenService struct {
-	config     *config.Config
-	jwtService *security.JWTService
-	tokenRepo  *storage.TokenRepository
+	config         *config.Config
+	jwtService     *security.JWTService
+	tokenRepo      storage.TokenRepository
+	sessionRepo    storage.SessionRepository
+	userRepo       storage.UserRepository
+	subjectService *SubjectService
+	policies       *TokenPolicies
+	resources      *ResourceRegistry
+	claims         *ClaimsService
 }
 
 func NewTokenService(
 	cfg *config.Config,
 	jwtService *security.JWTService,
-	tokenRepo *storage.TokenRepository,
+	tokenRepo storage.TokenRepository,
+	sessionRepo storage.SessionRepository,
+	userRepo storage.UserRepository,
+	subjectService *SubjectService,
+	policies *TokenPolicies,
+	resources *ResourceRegistry,
+	claims *ClaimsService,
 ) *TokenService {
 	return &TokenService{
-		config:     cfg,
-		jwtService: jwtService,
-		tokenRepo:  tokenRepo,
+		config:         cfg,
+		jwtService:     jwtService,
+		tokenRepo:      tokenRepo,
+		sessionRepo:    sessionRepo,
+		userRepo:       userRepo,
+		subjectService: subjectService,
+		policies:       policies,
+		resources:      resources,
+		claims:         claims,
 	}
 }
 
-// GenerateTokens creates a new access token and refresh token pair
+// Grant is what the user authorized: scope, resources (RFC 8707) and authorization details (RFC 9396)
+// It is kept on the refresh token so later access tokens can be derived from it
+type Grant struct {
+	Scope                string
+	Resources            []string
+	AuthorizationDetails []AuthorizationDetail
+}
+
+// AccessRequest narrows a grant for one access token; empty fields keep the grant
+type AccessRequest struct {
+	Scope                string                // must not exceed the granted scope
+	Resources            []string              // picks the access token audience among the granted resources
+	AuthorizationDetails []AuthorizationDetail // must be a subset of the granted details
+}
+
+// accessGrant is the part of a grant one access token carries
+type accessGrant struct {
+	scope                string
+	resource             *storage.ProtectedResource // nil for this service's own APIs
+	authorizationDetails []AuthorizationDetail
+}
+
+// GenerateTokens creates a new access token and refresh token pair for a grant
+// request may narrow the access token; it may be nil
 // OUTPUT TO DB: Stores refresh token in database
-func (s *TokenService) GenerateTokens(user *storage.User, scope string) (*TokenPair, error) {
-	// Generate access token (short-lived, 1 hour)
-	accessToken, err := s.jwtService.GenerateAccessToken(&security.TokenClaims{
-		Subject:  user.ID,
-		Email:    user.Email,
-		Name:     user.Name,
-		Scope:    scope,
-		ClientID: "oauth-service",
-	})
+// authn may be nil when the grant is not tied to an interactive login
+func (s *TokenService) GenerateTokens(
+	ctx context.Context,
+	user *storage.User,
+	client *storage.OAuthClient,
+	grant *Grant,
+	request *AccessRequest,
+	authn *AuthenticationContext,
+	requester *Requester,
+) (*TokenPair, error) {
+	policy := s.policies.ForClient(client)
+	return s.issueTokens(ctx, user, client, policy, grant, request, time.Now().Add(policy.RefreshTokenTTL), authn, requester)
+}
+
+// narrowGrant derives what one access token carries from the grant and the token request
+// DB INTERACTION: Loads the requested protected resource via resources
+func (s *TokenService) narrowGrant(ctx context.Context, grant *Grant, request *AccessRequest) (*accessGrant, error) {
+	if request == nil {
+		request = &AccessRequest{}
+	}
+
+	scope, err := NarrowScope(grant.Scope, request.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := s.resources.SelectResource(ctx, grant.Resources, request.Resources)
+	if err != nil {
+		return nil, err
+	}
+	scope, err = ResourceScope(resource, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := NarrowAuthorizationDetails(grant.AuthorizationDetails, request.AuthorizationDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accessGrant{scope: scope, resource: resource, authorizationDetails: details}, nil
+}
+
+// issueTokens creates the token pair; the refresh token keeps the whole grant while the access
+// token may carry a narrower part of it (RFC 6749 §6)
+// The access token is audienced to the selected resource, or to this service when there is none
+// refreshExpiresAt is the absolute expiry of the grant, carried over from token to token on refresh
+func (s *TokenService) issueTokens(
+	ctx context.Context,
+	user *storage.User,
+	client *storage.OAuthClient,
+	policy *TokenPolicy,
+	grant *Grant,
+	request *AccessRequest,
+	refreshExpiresAt time.Time,
+	authn *AuthenticationContext,
+	requester *Requester,
+) (*TokenPair, error) {
+	access, err := s.narrowGrant(ctx, grant, request)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedDetails, err := EncodeAuthorizationDetails(grant.AuthorizationDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionID, acr string
+	var authTime time.Time
+	var amr []string
+	if authn != nil {
+		sessionID = authn.SessionID
+		authTime = authn.AuthTime
+		amr = authn.AMR
+		acr = authn.ACR
+	}
+
+	audience := security.AccessTokenAudience
+	if access.resource != nil {
+		audience = access.resource.Identifier
+	}
+
+	// Custom claims from the claims pipeline (INPUT FROM DB via claims)
+	accessExtra, err := s.claims.Build(ctx, &ClaimsRequest{Target: ClaimTargetAccessToken, User: user, Client: client, Scope: access.scope})
+	if err != nil {
+		return nil, err
+	}
+	idExtra, err := s.claims.Build(ctx, &ClaimsRequest{Target: ClaimTargetIDToken, User: user, Client: client, Scope: grant.Scope})
+	if err != nil {
+		return nil, err
+	}
+
+	// Access tokens keep the internal user ID: they are meant for our own resource servers
+	// Pairwise clients always get opaque tokens (see TokenPolicies.ForClient), so they never see it
+	// Email and name are only included when the matching scope was granted
+	accessClaims := &security.TokenClaims{
+		Subject:              user.ID,
+		Scope:                access.scope,
+		ClientID:             client.ClientID,
+		Audience:             audience,
+		SessionID:            sessionID,
+		AuthTime:             authTime,
+		AMR:                  amr,
+		ACR:                  acr,
+		AuthorizationDetails: access.authorizationDetails,
+		Extra:                accessExtra,
+	}
+	if scopeGranted(access.scope, "email") {
+		accessClaims.Email = user.Email
+	}
+	if scopeGranted(access.scope, "profile") {
+		accessClaims.Name = user.Name
+	}
+	accessToken, err := s.issueAccessToken(ctx, accessClaims, policy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	// Generate refresh token (long-lived, 30 days)
-	refreshToken, err := s.jwtService.GenerateRefreshToken(user.ID)
+	// Refresh tokens are opaque references to their stored row, so they reveal nothing about the user
+	refreshToken := utils.GenerateRandomString(32)
+
+	// The ID token carries the subject as this client is allowed to see it (public or pairwise)
+	subject, err := s.subjectService.SubjectFor(client, user.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, fmt.Errorf("failed to derive subject: %w", err)
 	}
 
 	// Generate ID token (contains user identity information)
-	idToken, err := s.jwtService.GenerateIDToken(&security.TokenClaims{
-		Subject:       user.ID,
-		Email:         user.Email,
-		Name:          user.Name,
-		EmailVerified: user.EmailVerified,
-		Picture:       user.Picture,
-		GivenName:     user.GivenName,
-		FamilyName:    user.FamilyName,
-	})
+	// Email and profile claims are only included when the matching scope was granted (OIDC Core §5.4)
+	idClaims := &security.TokenClaims{
+		Subject:         subject,
+		Audience:        client.ClientID,
+		AccessTokenHash: s.jwtService.TokenHash(accessToken),
+		Extra:           idExtra,
+	}
+	if scopeGranted(grant.Scope, "email") {
+		idClaims.Email = user.Email
+		idClaims.EmailVerified = user.EmailVerified
+	}
+	if scopeGranted(grant.Scope, "profile") {
+		idClaims.Name = user.Name
+		idClaims.Picture = user.Picture
+		idClaims.GivenName = user.GivenName
+		idClaims.FamilyName = user.FamilyName
+	}
+	if authn != nil {
+		idClaims.AMR = authn.AMR
+		idClaims.ACR = authn.ACR
+		idClaims.SessionID = authn.SessionID
+		idClaims.AuthTime = authn.AuthTime
+		idClaims.Nonce = authn.Nonce
+		if authn.Code != "" {
+			idClaims.CodeHash = s.jwtService.TokenHash(authn.Code)
+		}
+	}
+	idToken, err := s.jwtService.GenerateIDToken(idClaims, policy.IDTokenTTL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ID token: %w", err)
 	}
 
+	// Remember the client took part in the SSO session so logout can notify it (OUTPUT TO DB)
+	if sessionID != "" {
+		if err := s.sessionRepo.AddClient(ctx, sessionID, client.ClientID); err != nil {
+			return nil, fmt.Errorf("failed to record session client: %w", err)
+		}
+	}
+
 	// Store refresh token in database (OUTPUT TO DB)
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
-	if err := s.tokenRepo.StoreRefreshToken(refreshToken, user.ID, expiresAt); err != nil {
+	stored := &storage.RefreshToken{
+		Token:                refreshToken,
+		ID:                   uuid.NewString(),
+		UserID:               user.ID,
+		ClientID:             client.ClientID,
+		Scope:                grant.Scope,
+		Resources:            grant.Resources,
+		AuthorizationDetails: encodedDetails,
+		SessionID:            sessionID,
+		ExpiresAt:            refreshExpiresAt,
+	}
+	if requester != nil {
+		stored.IPAddress = requester.IPAddress
+		stored.UserAgent = requester.UserAgent
+	}
+	if err := s.tokenRepo.StoreRefreshToken(ctx, stored); err != nil {
 		return nil, fmt.Errorf("failed to store refresh token: %w", err)
 	}
 
 	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		IDToken:      idToken,
-		ExpiresIn:    1 * time.Hour,
+		AccessToken:          accessToken,
+		RefreshToken:         refreshToken,
+		IDToken:              idToken,
+		ExpiresIn:            policy.AccessTokenTTL,
+		Scope:                access.scope,
+		AuthorizationDetails: access.authorizationDetails,
 	}, nil
 }
 
-// RefreshTokens generates new tokens using a refresh token
-// DB INTERACTION: Validates refresh token from database, stores new refresh token
-func (s *TokenService) RefreshTokens(refreshToken, clientID string) (*TokenPair, error) {
-	// Verify refresh token
-	claims, err := s.jwtService.VerifyRefreshToken(refreshToken)
+// issueAccessToken signs a JWT access token or, for clients using opaque tokens, stores the
+// claims under a random reference that only this server can resolve
+// JWTs are recorded too, under the hash of the whole token, so they can be revoked like opaque ones
+// OUTPUT TO DB: Stores access tokens via tokenRepo
+func (s *TokenService) issueAccessToken(ctx context.Context, claims *security.TokenClaims, policy *TokenPolicy) (string, error) {
+	now := time.Now()
+	claims.Issuer = s.jwtService.Issuer()
+	if claims.Audience == "" {
+		claims.Audience = security.AccessTokenAudience
+	}
+	claims.IssuedAt = now
+	claims.ExpiresAt = now.Add(policy.AccessTokenTTL)
+	claims.ID = uuid.NewString()
+
+	encoded, err := json.Marshal(claims)
 	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token")
+		return "", err
 	}
 
+	var token string
+	if policy.AccessTokenFormat == AccessTokenFormatOpaque {
+		token = utils.GenerateRandomString(32)
+	} else {
+		token, err = s.jwtService.GenerateAccessToken(claims, policy.AccessTokenTTL)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.tokenRepo.StoreAccessToken(ctx, token, &storage.AccessToken{
+		UserID:    claims.Subject,
+		ClientID:  claims.ClientID,
+		Scope:     claims.Scope,
+		SessionID: claims.SessionID,
+		Claims:    string(encoded),
+		ExpiresAt: claims.ExpiresAt,
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// RefreshTokens generates new tokens using a refresh token
+// request may narrow the access token; it must not exceed the original grant
+// DB INTERACTION: Validates refresh token from database, stores new refresh token
+func (s *TokenService) RefreshTokens(ctx context.Context, refreshToken string, client *storage.OAuthClient, request *AccessRequest, requester *Requester) (*TokenPair, error) {
 	// Check if refresh token exists and is valid in database (DB INTERACTION)
-	storedToken, err := s.tokenRepo.GetRefreshToken(refreshToken)
+	storedToken, err := s.tokenRepo.GetRefreshToken(ctx, refreshToken)
 	if err != nil || storedToken == nil {
 		return nil, fmt.Errorf("refresh token not found or expired")
 	}
 
-	// Check if token is revoked
-	if storedToken.Revoked {
-		return nil, fmt.Errorf("refresh token has been revoked")
+	// Refresh tokens are bound to the client they were issued to
+	if storedToken.ClientID != client.ClientID {
+		return nil, fmt.Errorf("refresh token was not issued to this client")
 	}
 
-	// Check if token has expired
-	if time.Now().After(storedToken.ExpiresAt) {
-		return nil, fmt.Errorf("refresh token has expired")
+	policy := s.policies.ForClient(client)
+	if err := checkRefreshToken(storedToken, policy); err != nil {
+		return nil, err
 	}
 
-	// Get user information
-	user, err := s.tokenRepo.GetUserByID(storedToken.UserID)
+	details, err := DecodeAuthorizationDetails(storedToken.AuthorizationDetails)
 	if err != nil {
+		return nil, err
+	}
+	grant := &Grant{Scope: storedToken.Scope, Resources: storedToken.Resources, AuthorizationDetails: details}
+
+	// Record the use for the user's device list (OUTPUT TO DB)
+	if requester != nil {
+		if err := s.tokenRepo.TouchRefreshToken(ctx, refreshToken, requester.IPAddress, requester.UserAgent); err != nil {
+			return nil, err
+		}
+	}
+
+	// Get user information
+	user, err := s.userRepo.GetUserByID(ctx, storedToken.UserID)
+	if err != nil || user == nil {
 		return nil, fmt.Errorf("user not found")
 	}
+	if user.Disabled {
+		return nil, fmt.Errorf("user is disabled")
+	}
+
+	// Generate new tokens; the new refresh token keeps the original grant
+	// No fresh authentication took place: the ID token describes the original login of the
+	// SSO session and carries no nonce (OIDC Core §12.2)
+	authn := &AuthenticationContext{SessionID: storedToken.SessionID}
+	if storedToken.SessionID != "" {
+		loginSession, err := s.sessionRepo.GetSession(ctx, storedToken.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if loginSession != nil {
+			authn.AMR = loginSession.AMR
+			authn.ACR = loginSession.ACR
+			authn.AuthTime = loginSession.AuthTime
+		}
+	}
 
-	// Generate new tokens
-	tokens, err := s.GenerateTokens(user, claims.Scope)
+	tokens, err := s.issueTokens(ctx, user, client, policy, grant, request, storedToken.ExpiresAt, authn, requester)
 	if err != nil {
 		return nil, err
 	}
 
 	// Optionally: Revoke old refresh token (refresh token rotation)
-	// s.tokenRepo.RevokeRefreshToken(refreshToken)
+	// s.tokenRepo.RevokeRefreshToken(ctx, refreshToken)
 
 	return tokens, nil
 }
 
-// RevokeToken revokes an access or refresh token
-// OUTPUT TO DB: Marks token as revoked
-func (s *TokenService) RevokeToken(token string) error {
-	// Verify token to get expiration time
-	claims, err := s.jwtService.VerifyAccessToken(token)
+// VerifyRefreshToken validates a refresh token and returns its stored record
+// INPUT FROM DB: Loads the token via tokenRepo and its client's policy via policies
+func (s *TokenService) VerifyRefreshToken(ctx context.Context, refreshToken string) (*storage.RefreshToken, error) {
+	storedToken, err := s.tokenRepo.GetRefreshToken(ctx, refreshToken)
+	if err != nil || storedToken == nil {
+		return nil, fmt.Errorf("refresh token not found or expired")
+	}
+
+	policy, err := s.policies.For(ctx, storedToken.ClientID)
 	if err != nil {
-		// Try as refresh token
-		claims, err = s.jwtService.VerifyRefreshToken(token)
+		return nil, err
+	}
+	if err := checkRefreshToken(storedToken, policy); err != nil {
+		return nil, err
+	}
+
+	return storedToken, nil
+}
+
+// checkRefreshToken rejects stored refresh tokens that are revoked or expired, absolutely or from inactivity
+func checkRefreshToken(storedToken *storage.RefreshToken, policy *TokenPolicy) error {
+	if storedToken.Revoked {
+		return fmt.Errorf("refresh token has been revoked")
+	}
+	if time.Now().After(storedToken.ExpiresAt) || policy.RefreshTokenIdleExpired(storedToken) {
+		return fmt.Errorf("refresh token has expired")
+	}
+	return nil
+}
+
+// VerifyAccessToken validates an access token of either format and returns its claims
+// Both formats must be on record and neither revoked nor expired; JWTs must also carry a valid
+// signature and a jti that is not on the denylist
+// INPUT FROM DB: Looks up the token and the jti denylist via tokenRepo
+func (s *TokenService) VerifyAccessToken(ctx context.Context, token string) (*security.TokenClaims, error) {
+	var verified *security.TokenClaims
+	if IsJWT(token) {
+		claims, err := s.jwtService.VerifyAccessToken(token)
 		if err != nil {
-			return fmt.Errorf("invalid token")
+			return nil, err
+		}
+		revoked, err := s.tokenRepo.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, fmt.Errorf("access token has been revoked")
+		}
+		verified = claims
+	}
+
+	// A JWT is looked up by the whole token, so a jti presented as an opaque token never matches
+	stored, err := s.tokenRepo.GetAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("unknown access token")
+	}
+	if stored.Revoked {
+		return nil, fmt.Errorf("access token has been revoked")
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, fmt.Errorf("access token has expired")
+	}
+	if verified != nil {
+		return verified, nil
+	}
+
+	var claims security.TokenClaims
+	if err := json.Unmarshal([]byte(stored.Claims), &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode access token claims: %w", err)
+	}
+
+	return &claims, nil
+}
+
+// RevokeToken revokes an access or refresh token
+// Refresh tokens and access tokens are revoked by updating their row, which takes effect immediately;
+// the jti of a JWT access token is also denylisted until it expires
+// OUTPUT TO DB: Marks token as revoked via tokenRepo
+func (s *TokenService) RevokeToken(ctx context.Context, token string) error {
+	if IsJWT(token) {
+		if claims, err := s.jwtService.VerifyAccessToken(token); err == nil {
+			if err := s.tokenRepo.RevokeAccessToken(ctx, token); err != nil {
+				return err
+			}
+			// Store the revoked jti until the token expires (OUTPUT TO DB)
+			return s.tokenRepo.RevokeToken(ctx, claims.ID, time.Until(claims.ExpiresAt))
 		}
 	}
 
-	// Store revoked token until it expires (OUTPUT TO DB)
-	expiresAt := time.Until(claims.ExpiresAt)
-	return s.tokenRepo.RevokeToken(token, expiresAt)
+	storedToken, err := s.tokenRepo.GetRefreshToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if storedToken != nil {
+		return s.tokenRepo.RevokeRefreshToken(ctx, token)
+	}
+	if IsJWT(token) {
+		return fmt.Errorf("invalid token")
+	}
+	return s.tokenRepo.RevokeAccessToken(ctx, token)
+}
+
+// ListUserRefreshTokens returns a user's refresh tokens that are neither revoked nor expired
+// INPUT FROM DB: Queries refresh tokens via tokenRepo
+func (s *TokenService) ListUserRefreshTokens(ctx context.Context, userID string) ([]*storage.RefreshToken, error) {
+	return s.tokenRepo.ListActiveByUser(ctx, userID)
+}
+
+// RevokeUserTokens revokes every refresh token and access token of a user
+// Resource servers that only check JWT signatures keep accepting JWT access tokens until they expire
+// OUTPUT TO DB: Marks tokens as revoked via tokenRepo
+func (s *TokenService) RevokeUserTokens(ctx context.Context, userID string) error {
+	if err := s.tokenRepo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeUserAccessTokens(ctx, userID)
+}
+
+// RevokeClientTokens revokes every refresh token and access token issued to a client
+// OUTPUT TO DB: Marks tokens as revoked via tokenRepo
+func (s *TokenService) RevokeClientTokens(ctx context.Context, clientID string) error {
+	if err := s.tokenRepo.RevokeAllClientRefreshTokens(ctx, clientID); err != nil {
+		return err
+	}
+	return s.tokenRepo.RevokeAllClientAccessTokens(ctx, clientID)
+}
+
+// IsJWT reports whether a token is a JWT (three dot-separated segments) rather than an opaque reference
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// scopeGranted reports whether a space-separated scope string includes the given scope
+func scopeGranted(scope, name string) bool {
+	for _, granted := range strings.Fields(scope) {
+		if granted == name {
+			return true
+		}
+	}
+	return false
 }
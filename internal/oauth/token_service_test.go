@@ -0,0 +1,216 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/config"
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+)
+
+// newTokenService returns a token service over seeded in-memory repositories with a user "user-1",
+// a public-subject client "public-app" and a pairwise-subject client "pairwise-app"
+func newTokenService(t *testing.T) (*TokenService, *security.JWTService, *storage.Repositories) {
+	t.Helper()
+
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	storage.Seed(ctx, repos)
+
+	if err := repos.Users.CreateUser(ctx, &storage.User{
+		ID: "user-1", Email: "user@example.com", EmailVerified: true,
+		Name: "Test User", GivenName: "Test", FamilyName: "User", Picture: "https://example.com/user.png",
+	}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, client := range []*storage.OAuthClient{
+		{ClientID: "public-app", ClientType: "public", Scope: "openid profile email", SubjectType: "public",
+			RedirectURIs: pq.StringArray{"https://public.example.com/callback"}},
+		{ClientID: "pairwise-app", ClientType: "public", Scope: "openid profile email", SubjectType: "pairwise",
+			RedirectURIs: pq.StringArray{"https://pairwise.example.com/callback"}},
+	} {
+		if err := repos.Clients.CreateClient(ctx, client); err != nil {
+			t.Fatalf("CreateClient: %v", err)
+		}
+	}
+
+	signingKey, err := security.LoadSigningKey("")
+	if err != nil {
+		t.Fatalf("LoadSigningKey: %v", err)
+	}
+	cfg := &config.Config{
+		Issuer:            "https://auth.example.com",
+		AccessTokenTTL:    time.Hour,
+		RefreshTokenTTL:   24 * time.Hour,
+		IDTokenTTL:        time.Hour,
+		AccessTokenFormat: "jwt",
+		PairwiseSalt:      "token-service-test-salt",
+	}
+	jwtService := security.NewJWTService(cfg.Issuer, signingKey)
+	clientRegistry := NewClientRegistry(repos.Clients)
+	service := NewTokenService(cfg, jwtService, repos.Tokens, repos.Sessions, repos.Users,
+		NewSubjectService(cfg.PairwiseSalt), NewTokenPolicies(cfg, clientRegistry),
+		NewResourceRegistry(repos.Resources), NewClaimsService(repos.ClaimRules))
+	return service, jwtService, repos
+}
+
+// generateTokens issues tokens for user-1 to clientID for scope
+func generateTokens(t *testing.T, service *TokenService, repos *storage.Repositories, clientID, scope string) *TokenPair {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := repos.Users.GetUserByID(ctx, "user-1")
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByID: %+v, %v", user, err)
+	}
+	client, err := repos.Clients.GetClientByID(ctx, clientID)
+	if err != nil {
+		t.Fatalf("GetClientByID: %v", err)
+	}
+
+	tokens, err := service.GenerateTokens(ctx, user, client, &Grant{Scope: scope}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	return tokens
+}
+
+func TestRefreshTokensAreOpaque(t *testing.T) {
+	ctx := context.Background()
+	service, _, repos := newTokenService(t)
+	tokens := generateTokens(t, service, repos, "public-app", "openid")
+
+	if IsJWT(tokens.RefreshToken) || len(tokens.RefreshToken) < 32 {
+		t.Fatalf("refresh token %q is not an opaque random string", tokens.RefreshToken)
+	}
+
+	stored, err := service.VerifyRefreshToken(ctx, tokens.RefreshToken)
+	if err != nil || stored.UserID != "user-1" || stored.ClientID != "public-app" {
+		t.Fatalf("VerifyRefreshToken: %+v, %v", stored, err)
+	}
+	if _, err := service.VerifyRefreshToken(ctx, tokens.RefreshToken+"x"); err == nil {
+		t.Error("VerifyRefreshToken accepted an unknown token")
+	}
+
+	client, _ := repos.Clients.GetClientByID(ctx, "public-app")
+	refreshed, err := service.RefreshTokens(ctx, tokens.RefreshToken, client, nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if IsJWT(refreshed.RefreshToken) || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Errorf("got refreshed token %q, want a new opaque token", refreshed.RefreshToken)
+	}
+
+	// Revoking marks the row, so the token stops working
+	if err := service.RevokeToken(ctx, refreshed.RefreshToken); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, err := service.VerifyRefreshToken(ctx, refreshed.RefreshToken); err == nil {
+		t.Error("VerifyRefreshToken accepted a revoked token")
+	}
+	if _, err := service.RefreshTokens(ctx, refreshed.RefreshToken, client, nil, nil); err == nil {
+		t.Error("RefreshTokens accepted a revoked token")
+	}
+}
+
+func TestIDTokenClaimsFollowScope(t *testing.T) {
+	tests := []struct {
+		scope       string
+		wantEmail   bool
+		wantProfile bool
+	}{
+		{"openid", false, false},
+		{"openid email", true, false},
+		{"openid profile", false, true},
+		{"openid profile email", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			service, jwtService, repos := newTokenService(t)
+			tokens := generateTokens(t, service, repos, "public-app", tt.scope)
+
+			claims, err := jwtService.VerifyIDTokenHint(tokens.IDToken)
+			if err != nil {
+				t.Fatalf("VerifyIDTokenHint: %v", err)
+			}
+			if claims.Subject != "user-1" {
+				t.Errorf("got sub %q, want user-1", claims.Subject)
+			}
+			if gotEmail := claims.Email != "" || claims.EmailVerified; gotEmail != tt.wantEmail {
+				t.Errorf("got email %q (verified %v), want email claims %v", claims.Email, claims.EmailVerified, tt.wantEmail)
+			}
+			gotProfile := claims.Name != "" || claims.GivenName != "" || claims.FamilyName != "" || claims.Picture != ""
+			if gotProfile != tt.wantProfile {
+				t.Errorf("got profile claims %+v, want profile claims %v", claims, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func TestPairwiseClientsGetPairwiseSubjects(t *testing.T) {
+	service, jwtService, repos := newTokenService(t)
+
+	subjects := map[string]string{}
+	for _, clientID := range []string{"public-app", "pairwise-app"} {
+		tokens := generateTokens(t, service, repos, clientID, "openid")
+		claims, err := jwtService.VerifyIDTokenHint(tokens.IDToken)
+		if err != nil {
+			t.Fatalf("VerifyIDTokenHint: %v", err)
+		}
+		subjects[clientID] = claims.Subject
+	}
+
+	if subjects["public-app"] != "user-1" {
+		t.Errorf("got public subject %q, want user-1", subjects["public-app"])
+	}
+	if subjects["pairwise-app"] == "" || subjects["pairwise-app"] == "user-1" {
+		t.Errorf("got pairwise subject %q, want one derived from the sector", subjects["pairwise-app"])
+	}
+}
+
+func TestIDTokenBindsCodeAndAccessToken(t *testing.T) {
+	ctx := context.Background()
+	service, jwtService, repos := newTokenService(t)
+	user, _ := repos.Users.GetUserByID(ctx, "user-1")
+	client, _ := repos.Clients.GetClientByID(ctx, "public-app")
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	authn := &AuthenticationContext{AMR: []string{"pwd"}, AuthTime: authTime, Nonce: "nonce-1", Code: "code-1"}
+	tokens, err := service.GenerateTokens(ctx, user, client, &Grant{Scope: "openid"}, nil, authn, nil)
+	if err != nil {
+		t.Fatalf("GenerateTokens: %v", err)
+	}
+	claims, err := jwtService.VerifyIDTokenHint(tokens.IDToken)
+	if err != nil {
+		t.Fatalf("VerifyIDTokenHint: %v", err)
+	}
+
+	if claims.AccessTokenHash != jwtService.TokenHash(tokens.AccessToken) {
+		t.Errorf("at_hash %q does not match the access token", claims.AccessTokenHash)
+	}
+	if claims.CodeHash != jwtService.TokenHash("code-1") {
+		t.Errorf("c_hash %q does not match the code", claims.CodeHash)
+	}
+	if claims.Nonce != "nonce-1" || claims.AuthorizedParty != "public-app" || !claims.AuthTime.Equal(authTime) {
+		t.Errorf("got nonce %q, azp %q, auth_time %v", claims.Nonce, claims.AuthorizedParty, claims.AuthTime)
+	}
+
+	// A refreshed ID token binds the new access token; there is no code or nonce to echo
+	refreshed, err := service.RefreshTokens(ctx, tokens.RefreshToken, client, nil, nil)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	claims, err = jwtService.VerifyIDTokenHint(refreshed.IDToken)
+	if err != nil {
+		t.Fatalf("VerifyIDTokenHint: %v", err)
+	}
+	if claims.AccessTokenHash != jwtService.TokenHash(refreshed.AccessToken) || claims.CodeHash != "" || claims.Nonce != "" {
+		t.Errorf("refreshed ID token has at_hash %q, c_hash %q, nonce %q", claims.AccessTokenHash, claims.CodeHash, claims.Nonce)
+	}
+}
@@ -0,0 +1,96 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// JWE algorithms supported for encrypted responses
+const (
+	JWEKeyAlgorithm     = "RSA-OAEP-256"
+	JWEContentAlgorithm = "A256GCM"
+)
+
+// ParseRSAPublicKey parses a PEM-encoded RSA public key (PKIX "PUBLIC KEY" or PKCS #1 "RSA PUBLIC KEY")
+func ParseRSAPublicKey(publicKeyPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key must be an RSA key")
+		}
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// EncryptJWT wraps a signed JWT in a compact JWE (RFC 7516) for the holder of publicKey
+// The content key is encrypted with RSA-OAEP-256 and the JWT with AES-256-GCM; cty "JWT"
+// marks the payload as a nested JWT (RFC 7519 §5.2)
+func EncryptJWT(signedJWT string, publicKey *rsa.PublicKey, typ string) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": JWEKeyAlgorithm,
+		"enc": JWEContentAlgorithm,
+		"typ": typ,
+		"cty": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+
+	contentKey := make([]byte, 32)
+	if _, err := rand.Read(contentKey); err != nil {
+		return "", err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, contentKey, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt content key: %w", err)
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	// The protected header is the additional authenticated data; GCM appends the tag to the ciphertext
+	sealed := gcm.Seal(nil, iv, []byte(signedJWT), []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
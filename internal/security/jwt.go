@@ -1,6 +1,8 @@
 package security
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"time"
 
@@ -9,98 +11,155 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenAudience is the audience of access tokens issued for this service's own APIs
+// (no resource requested); introspection reports it for refresh tokens too
+const AccessTokenAudience = "oauth-service"
+
 // TokenClaims represents JWT token claims
 type TokenClaims struct {
-	Subject       string    `json:"sub"`
-	Email         string    `json:"email"`
-	Name          string    `json:"name"`
-	GivenName     string    `json:"given_name,omitempty"`
-	FamilyName    string    `json:"family_name,omitempty"`
-	Picture       string    `json:"picture,omitempty"`
-	EmailVerified bool      `json:"email_verified,omitempty"`
-	Scope         string    `json:"scope,omitempty"`
-	ClientID      string    `json:"client_id,omitempty"`
-	Issuer        string    `json:"iss,omitempty"`
-	Audience      string    `json:"aud,omitempty"`
-	ExpiresAt     time.Time `json:"exp"`
-	IssuedAt      time.Time `json:"iat"`
-	ID            string    `json:"jti,omitempty"`
+	Subject         string    `json:"sub"`
+	Email           string    `json:"email"`
+	Name            string    `json:"name"`
+	GivenName       string    `json:"given_name,omitempty"`
+	FamilyName      string    `json:"family_name,omitempty"`
+	Picture         string    `json:"picture,omitempty"`
+	EmailVerified   bool      `json:"email_verified,omitempty"`
+	Scope           string    `json:"scope,omitempty"`
+	ClientID        string    `json:"client_id,omitempty"`
+	Issuer          string    `json:"iss,omitempty"`
+	Audience        string    `json:"aud,omitempty"`
+	ExpiresAt       time.Time `json:"exp"`
+	IssuedAt        time.Time `json:"iat"`
+	ID              string    `json:"jti,omitempty"`
+	AMR             []string  `json:"amr,omitempty"`
+	ACR             string    `json:"acr,omitempty"`
+	SessionID       string    `json:"sid,omitempty"` // SSO session the token was issued under
+	Nonce           string    `json:"nonce,omitempty"`
+	AuthTime        time.Time `json:"auth_time,omitempty"`
+	AuthorizedParty string    `json:"azp,omitempty"`
+	AccessTokenHash string    `json:"at_hash,omitempty"`
+	CodeHash        string    `json:"c_hash,omitempty"`
+	// Confirmation binds the token to a key (RFC 7800); Actor names the party acting for the subject (RFC 8693)
+	Confirmation map[string]interface{} `json:"cnf,omitempty"`
+	Actor        map[string]interface{} `json:"act,omitempty"`
+	// AuthorizationDetails are the fine-grained permissions the access token carries (RFC 9396 §9)
+	AuthorizationDetails []map[string]interface{} `json:"authorization_details,omitempty"`
+	// Extra holds custom claims from the claims pipeline; they never replace the claims above
+	Extra map[string]interface{} `json:"extra,omitempty"`
 }
 
 // JWTService handles JWT token generation and verification
+// Every token and signed response is signed with signingKey, whose public half is published as a
+// JWKS, so resource servers and clients can verify them without sharing a secret
 type JWTService struct {
-	secret string
-	issuer string
+	issuer     string
+	signingKey *SigningKey
 }
 
-// NewJWTService creates a new JWT service
-func NewJWTService(secret string) *JWTService {
+// NewJWTService creates a new JWT service; issuer is the URL placed in the iss claim
+func NewJWTService(issuer string, signingKey *SigningKey) *JWTService {
 	return &JWTService{
-		secret: secret,
-		issuer: "oauth-service",
+		issuer:     issuer,
+		signingKey: signingKey,
 	}
 }
 
-// GenerateAccessToken generates a new access token (short-lived)
-func (s *JWTService) GenerateAccessToken(claims *TokenClaims) (string, error) {
+// AccessTokenType is the JWT "typ" header of access tokens (RFC 9068 §2.1)
+const AccessTokenType = "at+jwt"
+
+// GenerateAccessToken generates a new access token (short-lived) following the JWT access token
+// profile (RFC 9068); claims.Audience is the resource it is meant for, this service when empty
+// claims.ID becomes the jti when set, so the caller can record the token
+func (s *JWTService) GenerateAccessToken(claims *TokenClaims, ttl time.Duration) (string, error) {
 	now := time.Now()
-	expiresAt := now.Add(1 * time.Hour) // Access tokens expire in 1 hour
+	expiresAt := now.Add(ttl)
+
+	audience := claims.Audience
+	if audience == "" {
+		audience = AccessTokenAudience
+	}
+	jti := claims.ID
+	if jti == "" {
+		jti = utils.GenerateRandomString(16)
+	}
 
 	jwtClaims := jwt.MapClaims{
 		"sub":       claims.Subject,
-		"email":     claims.Email,
-		"name":      claims.Name,
 		"scope":     claims.Scope,
 		"client_id": claims.ClientID,
 		"iss":       s.issuer,
-		"aud":       "oauth-service",
+		"aud":       audience,
 		"exp":       expiresAt.Unix(),
 		"iat":       now.Unix(),
-		"jti":       utils.GenerateRandomString(16),
+		"jti":       jti,
 		"type":      "access",
 	}
+	if claims.Email != "" {
+		jwtClaims["email"] = claims.Email
+	}
+	if claims.Name != "" {
+		jwtClaims["name"] = claims.Name
+	}
+	if claims.SessionID != "" {
+		jwtClaims["sid"] = claims.SessionID
+	}
+	if !claims.AuthTime.IsZero() {
+		jwtClaims["auth_time"] = claims.AuthTime.Unix()
+	}
+	if len(claims.AMR) > 0 {
+		jwtClaims["amr"] = claims.AMR
+	}
+	if claims.ACR != "" {
+		jwtClaims["acr"] = claims.ACR
+	}
+	if len(claims.Confirmation) > 0 {
+		jwtClaims["cnf"] = claims.Confirmation
+	}
+	if len(claims.Actor) > 0 {
+		jwtClaims["act"] = claims.Actor
+	}
+	if len(claims.AuthorizationDetails) > 0 {
+		jwtClaims["authorization_details"] = claims.AuthorizationDetails
+	}
+	addExtraClaims(jwtClaims, claims.Extra)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims)
-	return token.SignedString([]byte(s.secret))
+	return s.signPublic(jwtClaims, AccessTokenType)
 }
 
-// GenerateRefreshToken generates a new refresh token (long-lived)
-func (s *JWTService) GenerateRefreshToken(userID string) (string, error) {
+// GenerateIDToken generates an OpenID Connect ID token
+// claims.Audience must be the client the token is issued to (OIDC Core §2)
+func (s *JWTService) GenerateIDToken(claims *TokenClaims, ttl time.Duration) (string, error) {
+	if claims.Audience == "" {
+		return "", fmt.Errorf("ID token audience is required")
+	}
+
 	now := time.Now()
-	expiresAt := now.Add(30 * 24 * time.Hour) // Refresh tokens expire in 30 days
+	expiresAt := now.Add(ttl)
+
+	// With a single audience azp equals it; it is still sent because some libraries expect it
+	authorizedParty := claims.AuthorizedParty
+	if authorizedParty == "" {
+		authorizedParty = claims.Audience
+	}
 
 	jwtClaims := jwt.MapClaims{
-		"sub":  userID,
+		"sub":  claims.Subject,
 		"iss":  s.issuer,
-		"aud":  "oauth-service",
+		"aud":  claims.Audience,
+		"azp":  authorizedParty,
 		"exp":  expiresAt.Unix(),
 		"iat":  now.Unix(),
-		"jti":  utils.GenerateRandomString(16),
-		"type": "refresh",
+		"type": "id",
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims)
-	return token.SignedString([]byte(s.secret))
-}
-
-// GenerateIDToken generates an OpenID Connect ID token
-func (s *JWTService) GenerateIDToken(claims *TokenClaims) (string, error) {
-	now := time.Now()
-	expiresAt := now.Add(1 * time.Hour)
-
-	jwtClaims := jwt.MapClaims{
-		"sub":            claims.Subject,
-		"email":          claims.Email,
-		"email_verified": claims.EmailVerified,
-		"name":           claims.Name,
-		"iss":            s.issuer,
-		"aud":            "oauth-service",
-		"exp":            expiresAt.Unix(),
-		"iat":            now.Unix(),
-		"type":           "id",
-	}
-
-	// Add optional claims
+	// Add optional claims; email_verified only describes an email that is present
+	if claims.Email != "" {
+		jwtClaims["email"] = claims.Email
+		jwtClaims["email_verified"] = claims.EmailVerified
+	}
+	if claims.Name != "" {
+		jwtClaims["name"] = claims.Name
+	}
 	if claims.GivenName != "" {
 		jwtClaims["given_name"] = claims.GivenName
 	}
@@ -110,19 +169,112 @@ func (s *JWTService) GenerateIDToken(claims *TokenClaims) (string, error) {
 	if claims.Picture != "" {
 		jwtClaims["picture"] = claims.Picture
 	}
+	if len(claims.AMR) > 0 {
+		jwtClaims["amr"] = claims.AMR
+	}
+	if claims.ACR != "" {
+		jwtClaims["acr"] = claims.ACR
+	}
+	if claims.SessionID != "" {
+		jwtClaims["sid"] = claims.SessionID
+	}
+	if claims.Nonce != "" {
+		jwtClaims["nonce"] = claims.Nonce
+	}
+	if !claims.AuthTime.IsZero() {
+		jwtClaims["auth_time"] = claims.AuthTime.Unix()
+	}
+	if claims.AccessTokenHash != "" {
+		jwtClaims["at_hash"] = claims.AccessTokenHash
+	}
+	if claims.CodeHash != "" {
+		jwtClaims["c_hash"] = claims.CodeHash
+	}
+	addExtraClaims(jwtClaims, claims.Extra)
+
+	// Relying parties verify ID tokens themselves, so they are signed with the published key
+	return s.signPublic(jwtClaims, "JWT")
+}
+
+// addExtraClaims copies custom claims into a token without replacing any claim already set
+func addExtraClaims(jwtClaims jwt.MapClaims, extra map[string]interface{}) {
+	for name, value := range extra {
+		if _, exists := jwtClaims[name]; !exists {
+			jwtClaims[name] = value
+		}
+	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims)
-	return token.SignedString([]byte(s.secret))
+// TokenHash computes the at_hash / c_hash value of an access token or authorization code:
+// the base64url-encoded left half of its hash under the ID token signing algorithm (OIDC Core §3.1.3.6)
+// ID tokens are signed with ES256, so the hash is SHA-256
+func (s *JWTService) TokenHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// SignIntrospectionResponse wraps an introspection response in a signed JWT (RFC 9701)
+// audience is the client that asked; the response is carried in the token_introspection claim
+func (s *JWTService) SignIntrospectionResponse(audience string, response interface{}) (string, error) {
+	jwtClaims := jwt.MapClaims{
+		"iss":                 s.issuer,
+		"aud":                 audience,
+		"iat":                 time.Now().Unix(),
+		"token_introspection": response,
+	}
+
+	return s.signPublic(jwtClaims, "token-introspection+jwt")
+}
+
+// signPublic signs claims with ES256 under the published signing key, so third parties can
+// verify the token against the JWKS; typ is the JWT "typ" header
+func (s *JWTService) signPublic(jwtClaims jwt.MapClaims, typ string) (string, error) {
+	if s.signingKey == nil {
+		return "", fmt.Errorf("no signing key configured")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwtClaims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = s.signingKey.ID
+	return token.SignedString(s.signingKey.PrivateKey)
+}
+
+// BackchannelLogoutEvent is the event type identifying a logout token
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// GenerateLogoutToken generates an OIDC Back-Channel Logout token for one client
+// sessionID may be empty when the client does not require it; a logout token never carries a nonce
+func (s *JWTService) GenerateLogoutToken(subject, audience, sessionID string) (string, error) {
+	now := time.Now()
+
+	jwtClaims := jwt.MapClaims{
+		"sub": subject,
+		"iss": s.issuer,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(2 * time.Minute).Unix(),
+		"jti": utils.GenerateRandomString(16),
+		"events": map[string]interface{}{
+			BackchannelLogoutEvent: map[string]interface{}{},
+		},
+	}
+	if sessionID != "" {
+		jwtClaims["sid"] = sessionID
+	}
+
+	// Relying parties verify logout tokens themselves, so they are signed with the published key
+	return s.signPublic(jwtClaims, "logout+jwt")
+}
+
+// Issuer returns the issuer identifier placed in every token
+func (s *JWTService) Issuer() string {
+	return s.issuer
 }
 
 // VerifyAccessToken verifies and decodes an access token
+// Only ES256 tokens from this issuer verify; HS256 tokens issued before the switch are rejected
 func (s *JWTService) VerifyAccessToken(tokenString string) (*TokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.secret), nil
-	})
+	token, err := jwt.Parse(tokenString, s.publicVerificationKey, jwt.WithIssuer(s.issuer))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -145,36 +297,46 @@ func (s *JWTService) VerifyAccessToken(tokenString string) (*TokenClaims, error)
 	return s.mapClaimsToTokenClaims(claims), nil
 }
 
-// VerifyRefreshToken verifies and decodes a refresh token
-func (s *JWTService) VerifyRefreshToken(tokenString string) (*TokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.secret), nil
-	})
+// VerifyIDTokenHint verifies an ID token presented back to us, e.g. as id_token_hint at logout
+// The signature, issuer and type are checked but expiry is not: RPs commonly log out with an expired ID token
+func (s *JWTService) VerifyIDTokenHint(tokenString string) (*TokenClaims, error) {
+	token, err := jwt.Parse(tokenString, s.publicVerificationKey, jwt.WithoutClaimsValidation(), jwt.WithIssuer(s.issuer))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
 		return nil, fmt.Errorf("invalid token claims")
 	}
 
 	// Verify token type
-	if tokenType, ok := claims["type"].(string); !ok || tokenType != "refresh" {
-		return nil, fmt.Errorf("not a refresh token")
+	if tokenType, ok := claims["type"].(string); !ok || tokenType != "id" {
+		return nil, fmt.Errorf("not an ID token")
 	}
 
 	return s.mapClaimsToTokenClaims(claims), nil
 }
 
+// publicVerificationKey is the jwt.Keyfunc for tokens signed by signPublic
+// The kid header must name a published key: the current one or the one retired by the last rotation
+func (s *JWTService) publicVerificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	if s.signingKey == nil {
+		return nil, fmt.Errorf("no signing key configured")
+	}
+	kid, _ := token.Header["kid"].(string)
+	for key := s.signingKey; key != nil; key = key.Previous {
+		if key.ID == kid {
+			return &key.PrivateKey.PublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
 // mapClaimsToTokenClaims converts JWT claims to TokenClaims struct
 func (s *JWTService) mapClaimsToTokenClaims(claims jwt.MapClaims) *TokenClaims {
 	tokenClaims := &TokenClaims{}
@@ -215,6 +377,44 @@ func (s *JWTService) mapClaimsToTokenClaims(claims jwt.MapClaims) *TokenClaims {
 	if jti, ok := claims["jti"].(string); ok {
 		tokenClaims.ID = jti
 	}
+	if amr, ok := claims["amr"].([]interface{}); ok {
+		for _, method := range amr {
+			if m, ok := method.(string); ok {
+				tokenClaims.AMR = append(tokenClaims.AMR, m)
+			}
+		}
+	}
+	if acr, ok := claims["acr"].(string); ok {
+		tokenClaims.ACR = acr
+	}
+	if sid, ok := claims["sid"].(string); ok {
+		tokenClaims.SessionID = sid
+	}
+	if nonce, ok := claims["nonce"].(string); ok {
+		tokenClaims.Nonce = nonce
+	}
+	if azp, ok := claims["azp"].(string); ok {
+		tokenClaims.AuthorizedParty = azp
+	}
+	if atHash, ok := claims["at_hash"].(string); ok {
+		tokenClaims.AccessTokenHash = atHash
+	}
+	if cHash, ok := claims["c_hash"].(string); ok {
+		tokenClaims.CodeHash = cHash
+	}
+	if cnf, ok := claims["cnf"].(map[string]interface{}); ok {
+		tokenClaims.Confirmation = cnf
+	}
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		tokenClaims.Actor = act
+	}
+	if details, ok := claims["authorization_details"].([]interface{}); ok {
+		for _, detail := range details {
+			if d, ok := detail.(map[string]interface{}); ok {
+				tokenClaims.AuthorizationDetails = append(tokenClaims.AuthorizationDetails, d)
+			}
+		}
+	}
 
 	// Parse time fields
 	if exp, ok := claims["exp"].(float64); ok {
@@ -223,6 +423,9 @@ func (s *JWTService) mapClaimsToTokenClaims(claims jwt.MapClaims) *TokenClaims {
 	if iat, ok := claims["iat"].(float64); ok {
 		tokenClaims.IssuedAt = time.Unix(int64(iat), 0)
 	}
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		tokenClaims.AuthTime = time.Unix(int64(authTime), 0)
+	}
 
 	return tokenClaims
 }
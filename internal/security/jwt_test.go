@@ -0,0 +1,92 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://auth.example.com"
+
+func newTestJWTService(t *testing.T) (*JWTService, *SigningKey) {
+	t.Helper()
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	return NewJWTService(testIssuer, key), key
+}
+
+func TestAccessTokenSignedWithPublishedKey(t *testing.T) {
+	service, key := newTestJWTService(t)
+
+	token, err := service.GenerateAccessToken(&TokenClaims{Subject: "user-1", ClientID: "app", Scope: "openid"}, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+
+	// A resource server verifies it with nothing but the public key from the JWKS
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return &key.PrivateKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer(testIssuer))
+	if err != nil {
+		t.Fatalf("token does not verify with the published key: %v", err)
+	}
+	if parsed.Header["kid"] != key.ID || parsed.Header["typ"] != AccessTokenType {
+		t.Errorf("header = %v, want kid %s and typ %s", parsed.Header, key.ID, AccessTokenType)
+	}
+
+	claims, err := service.VerifyAccessToken(token)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Issuer != testIssuer {
+		t.Errorf("claims = %+v, want sub user-1 and iss %s", claims, testIssuer)
+	}
+}
+
+func TestVerifyAccessTokenRejectsHMACAndForeignIssuers(t *testing.T) {
+	service, key := newTestJWTService(t)
+	claims := jwt.MapClaims{
+		"sub":  "user-1",
+		"iss":  testIssuer,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"type": "access",
+	}
+
+	// Tokens signed with JWT_SECRET before the switch to the published key
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("default-jwt-secret-change-in-production"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if _, err := service.VerifyAccessToken(legacy); err == nil {
+		t.Error("HS256 access token verified")
+	}
+
+	other := NewJWTService("https://other.example.com", key)
+	foreign, err := other.GenerateAccessToken(&TokenClaims{Subject: "user-1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if _, err := service.VerifyAccessToken(foreign); err == nil {
+		t.Error("access token from another issuer verified")
+	}
+
+	// ID tokens share the key, so the type claim keeps them from being used as access tokens
+	idToken, err := service.GenerateIDToken(&TokenClaims{Subject: "user-1", Audience: "app"}, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateIDToken: %v", err)
+	}
+	if _, err := service.VerifyAccessToken(idToken); err == nil {
+		t.Error("ID token verified as an access token")
+	}
+}
+
+// The access token and at_hash from the OIDC Core §A.3 example, which also hashes with SHA-256
+func TestTokenHashMatchesOIDCExample(t *testing.T) {
+	service, _ := newTestJWTService(t)
+	if got := service.TokenHash("jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"); got != "77QmUPtjPfzWtF2AnpK9RQ" {
+		t.Errorf("TokenHash = %q, want 77QmUPtjPfzWtF2AnpK9RQ", got)
+	}
+}
@@ -0,0 +1,178 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// SigningKey is the server's asymmetric key for tokens and responses third parties must be able to
+// verify without sharing a secret (ID tokens, logout tokens, JWT introspection responses).
+// Its public half is published as a JWKS.
+type SigningKey struct {
+	ID         string // RFC 7638 thumbprint, used as the JWS "kid"
+	PrivateKey *ecdsa.PrivateKey
+	Ephemeral  bool        // generated at startup because SIGNING_KEY_FILE was not set
+	LoadedAt   time.Time   // when this process loaded or generated the key
+	Previous   *SigningKey // key retired by the last rotation (<file>.prev); still published and verified, never used to sign
+}
+
+// JWK is the JSON Web Key (RFC 7517) form of a public key
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+}
+
+// LoadSigningKey reads a PEM-encoded P-256 private key (SEC 1 or PKCS #8) from path, and the
+// previous key from path + ".prev" when that file exists
+// Without a path an ephemeral key is generated; signatures then stop verifying after a restart
+func LoadSigningKey(path string) (*SigningKey, error) {
+	if path == "" {
+		log.Println("Warning: SIGNING_KEY_FILE not set, generating an ephemeral signing key")
+		key, err := GenerateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		key.Ephemeral = true
+		return key, nil
+	}
+
+	key, err := readSigningKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens signed before the last rotation must keep verifying until they expire
+	previousPath := path + ".prev"
+	if _, err := os.Stat(previousPath); err == nil {
+		key.Previous, err = readSigningKey(previousPath)
+		if err != nil {
+			return nil, fmt.Errorf("previous key: %w", err)
+		}
+	}
+
+	return key, nil
+}
+
+// readSigningKey parses one PEM key file
+func readSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key is not PEM encoded")
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed interface{}
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if privateKey, ok = parsed.(*ecdsa.PrivateKey); !ok {
+				err = fmt.Errorf("signing key must be an ECDSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	if privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("signing key must use the P-256 curve")
+	}
+
+	return newSigningKey(privateKey), nil
+}
+
+// GenerateSigningKey creates a new random P-256 signing key
+func GenerateSigningKey() (*SigningKey, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return newSigningKey(privateKey), nil
+}
+
+// EncodePEM returns the private key as a PKCS #8 PEM block, the format LoadSigningKey reads
+func (k *SigningKey) EncodePEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func newSigningKey(privateKey *ecdsa.PrivateKey) *SigningKey {
+	key := &SigningKey{PrivateKey: privateKey, LoadedAt: time.Now()}
+	key.ID = key.thumbprint()
+	return key
+}
+
+// PublicJWKs returns the JWKS entries: the current key, then the previous one if there is one
+func (k *SigningKey) PublicJWKs() []JWK {
+	keys := []JWK{k.PublicJWK()}
+	if k.Previous != nil {
+		keys = append(keys, k.Previous.PublicJWK())
+	}
+	return keys
+}
+
+// PublicJWK returns the public key as a JWK for the JWKS endpoint
+func (k *SigningKey) PublicJWK() JWK {
+	jwk := k.thumbprintJWK()
+	jwk.KeyID = k.ID
+	jwk.Use = "sig"
+	jwk.Algorithm = "ES256"
+	return jwk
+}
+
+// thumbprintJWK returns only the members that take part in the RFC 7638 thumbprint
+func (k *SigningKey) thumbprintJWK() JWK {
+	byteLen := (k.PrivateKey.Curve.Params().BitSize + 7) / 8
+	x := make([]byte, byteLen)
+	y := make([]byte, byteLen)
+	k.PrivateKey.X.FillBytes(x)
+	k.PrivateKey.Y.FillBytes(y)
+
+	return JWK{
+		KeyType: "EC",
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(x),
+		Y:       base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint: SHA-256 over the required members in lexical order
+func (k *SigningKey) thumbprint() string {
+	jwk := k.thumbprintJWK()
+	// encoding/json writes struct fields in declaration order, so spell the members out explicitly
+	canonical, _ := json.Marshal(struct {
+		Crv string `json:"crv"`
+		Kty string `json:"kty"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
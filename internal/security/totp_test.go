@@ -0,0 +1,99 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the RFC 6238 Appendix B SHA-1 seed "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC vectors are 8 digits; a 6-digit code is the same value truncated to its last 6 digits
+func TestGenerateTOTPCodeRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := GenerateTOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("T=%d: unexpected error: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("T=%d: got %s, want %s", tt.unix, got, tt.want)
+		}
+
+		step, ok := ValidateTOTPCode(rfc6238Secret, tt.want, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("T=%d: vector code rejected", tt.unix)
+		}
+		if want := tt.unix / int64(TOTPPeriod.Seconds()); step != want {
+			t.Errorf("T=%d: got step %d, want %d", tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPCodeSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / int64(TOTPPeriod.Seconds())
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -1, true},
+		{"one step ahead", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := GenerateTOTPCode(rfc6238Secret, now.Add(time.Duration(tt.offset)*TOTPPeriod))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			step, ok := ValidateTOTPCode(rfc6238Secret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("got ok=%v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("got step %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPCodeRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{"wrong code", rfc6238Secret, "000000"},
+		{"too short", rfc6238Secret, "28708"},
+		{"full 8-digit vector", rfc6238Secret, "94287082"},
+		{"invalid secret", "not-base32!", "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTPCode(tt.secret, tt.code, now); ok {
+				t.Errorf("code %q accepted", tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Claim rule sources
+const (
+	ClaimSourceStatic = "static" // Value is the claim value as JSON (a bare string is taken literally)
+	ClaimSourceUser   = "user"   // Value names a user attribute, e.g. "email" or "given_name"
+	ClaimSourceRoles  = "roles"  // the user's roles for the client
+	ClaimSourceGroups = "groups" // the user's groups
+)
+
+// ClaimRule adds one claim to the tokens and responses issued for a client
+type ClaimRule struct {
+	ID        uint
+	ClientID  string // empty applies to every client; client rules override global ones
+	Scope     string // the rule only applies when this scope was granted; empty means always
+	ClaimName string
+	Source    string // "static", "user", "roles" or "groups"
+	Value     string
+	// Targets are where the claim appears: "access_token", "id_token", "userinfo", "introspection"
+	// Empty means everywhere
+	Targets   pq.StringArray
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ClaimRuleRepository stores claim rules
+type ClaimRuleRepository interface {
+	ListClaimRules(ctx context.Context, clientID string) ([]*ClaimRule, error)
+	CreateClaimRule(ctx context.Context, rule *ClaimRule) error
+}
+
+// claimRuleRepository implements ClaimRuleRepository with database/sql
+// DB INTERACTION: All methods interact with the claim_rules table
+type claimRuleRepository struct {
+	db *sql.DB
+}
+
+// NewClaimRuleRepository creates a new claim rule repository
+func NewClaimRuleRepository(db *sql.DB) ClaimRuleRepository {
+	return &claimRuleRepository{db: db}
+}
+
+// ListClaimRules retrieves the global rules and the client's own rules
+// Global rules come first so a client rule for the same claim takes precedence
+// INPUT FROM DB: Queries claim_rules table by client ID
+func (r *claimRuleRepository) ListClaimRules(ctx context.Context, clientID string) ([]*ClaimRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, COALESCE(client_id, ''), COALESCE(scope, ''), claim_name, source, COALESCE(value, ''), targets, created_at, updated_at
+		FROM claim_rules
+		WHERE client_id = $1 OR COALESCE(client_id, '') = ''
+		ORDER BY COALESCE(client_id, ''), id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list claim rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*ClaimRule
+	for rows.Next() {
+		rule := &ClaimRule{}
+		err := rows.Scan(
+			&rule.ID,
+			&rule.ClientID,
+			&rule.Scope,
+			&rule.ClaimName,
+			&rule.Source,
+			&rule.Value,
+			&rule.Targets,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan claim rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// CreateClaimRule inserts a claim rule and sets its ID
+// OUTPUT TO DB: Inserts rule into claim_rules table
+func (r *claimRuleRepository) CreateClaimRule(ctx context.Context, rule *ClaimRule) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO claim_rules (client_id, scope, claim_name, source, value, targets, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING id
+	`
+
+	now := time.Now()
+	err := r.db.QueryRowContext(ctx, query, rule.ClientID, rule.Scope, rule.ClaimName, rule.Source, rule.Value, rule.Targets, now).Scan(&rule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create claim rule: %w", err)
+	}
+
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	return nil
+}
@@ -1,24 +1,54 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/lib/pq"
-	"gorm.io/gorm"
+
 	"oauth-golang/pkg/utils"
 )
 
 // OAuthClient represents an OAuth client application
 type OAuthClient struct {
-	ClientID     string         `gorm:"primaryKey"`
+	ClientID     string
 	ClientSecret string
 	ClientName   string
-	ClientType   string         // "public" or "confidential"
-	RedirectURIs pq.StringArray `gorm:"type:text[]"`
-	GrantTypes   pq.StringArray `gorm:"type:text[]"`
-	Scope        string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ClientType   string // "public" or "confidential"
+	RedirectURIs pq.StringArray
+	// PostLogoutRedirectURIs are the registered targets for RP-initiated logout
+	PostLogoutRedirectURIs pq.StringArray
+	GrantTypes             pq.StringArray
+	Scope                  string
+	RequireMFA             bool   // users must pass a second factor before a code is issued
+	FirstParty             bool   // operated by us; users are not asked for consent
+	SubjectType            string // "public" or "pairwise" (OIDC Core §8)
+	// SectorIdentifierURI groups pairwise subjects across clients; defaults to the redirect URI host
+	SectorIdentifierURI string
+	// Logout notification endpoints (OIDC Back-Channel and Front-Channel Logout)
+	BackchannelLogoutURI              string
+	BackchannelLogoutSessionRequired  bool // include sid in logout tokens
+	FrontchannelLogoutURI             string
+	FrontchannelLogoutSessionRequired bool // append iss and sid to the front-channel URI
+	// Token lifetimes in seconds; 0 uses the global default
+	AccessTokenLifetime      int
+	RefreshTokenLifetime     int // absolute, counted from the original grant
+	RefreshTokenIdleLifetime int
+	IDTokenLifetime          int
+	AuthCodeLifetime         int
+	AccessTokenFormat        string // "jwt" or "opaque"; empty uses the global default
+	// ResourceServer clients may call /introspect for access tokens audienced to one of Audiences
+	ResourceServer bool
+	Audiences      pq.StringArray
+	// IntrospectionEncryptionKey is a PEM RSA public key; when set, JWT introspection responses
+	// to this client are encrypted with RSA-OAEP-256 / A256GCM (RFC 9701 §5)
+	IntrospectionEncryptionKey string
+	// AuthorizationDetailsTypes lists the authorization_details types the client may request (RFC 9396 §10)
+	AuthorizationDetailsTypes pq.StringArray
+	CreatedAt                 time.Time
+	UpdatedAt                 time.Time
 }
 
 // IsConfidential returns true if the client is a confidential client
@@ -26,6 +56,34 @@ func (c *OAuthClient) IsConfidential() bool {
 	return c.ClientType == "confidential"
 }
 
+// UsesPairwiseSubject returns true if the client receives pairwise subject identifiers
+func (c *OAuthClient) UsesPairwiseSubject() bool {
+	return c.SubjectType == "pairwise"
+}
+
+// AcceptsAudience reports whether a resource server client may see tokens for the given audience
+func (c *OAuthClient) AcceptsAudience(audience string) bool {
+	if !c.ResourceServer {
+		return false
+	}
+	for _, accepted := range c.Audiences {
+		if accepted == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAuthorizationDetailsType reports whether the client may request authorization details of a type
+func (c *OAuthClient) AllowsAuthorizationDetailsType(detailType string) bool {
+	for _, allowed := range c.AuthorizationDetailsTypes {
+		if allowed == detailType {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateRedirectURI checks if a redirect URI is registered for this client
 func (c *OAuthClient) ValidateRedirectURI(uri string) bool {
 	for _, registeredURI := range c.RedirectURIs {
@@ -36,50 +94,287 @@ func (c *OAuthClient) ValidateRedirectURI(uri string) bool {
 	return false
 }
 
-// GetClientByID retrieves a client by client ID using GORM
-// If the client does not exist, it automatically creates a new one with default values
-func (s *Storage) GetClientByID(id string) (*OAuthClient, error) {
-	var client OAuthClient
-	err := s.DB.Where("client_id = ?", id).First(&client).Error
-	
-	// If client not found, create a new one with default values
-	if err == gorm.ErrRecordNotFound {
-		// Generate secure random client secret (48 bytes = 64 chars in base64)
-		clientSecret := utils.GenerateSecureToken(48)
-		
-		// Create new client with default values
-		newClient := OAuthClient{
-			ClientID:     id,
-			ClientSecret: clientSecret,
-			ClientName:   "Auto-generated Client",
-			ClientType:   "public",
-			RedirectURIs: pq.StringArray{"http://localhost:3000/auth/callback"},
-			GrantTypes:   pq.StringArray{"authorization_code", "refresh_token"},
-			Scope:        "openid profile email",
+// ValidatePostLogoutRedirectURI checks if a post-logout redirect URI is registered for this client
+func (c *OAuthClient) ValidatePostLogoutRedirectURI(uri string) bool {
+	for _, registeredURI := range c.PostLogoutRedirectURIs {
+		if registeredURI == uri {
+			return true
 		}
-		
-		// Insert the new client into the database
-		if err := s.DB.Create(&newClient).Error; err != nil {
+	}
+	return false
+}
+
+// ClientRepository stores OAuth clients
+type ClientRepository interface {
+	GetClientByID(ctx context.Context, id string) (*OAuthClient, error)
+	FindClientByID(ctx context.Context, id string) (*OAuthClient, error)
+	ListClients(ctx context.Context) ([]*OAuthClient, error)
+	CreateClient(ctx context.Context, client *OAuthClient) error
+	SaveClient(ctx context.Context, client *OAuthClient) error
+	DeleteClient(ctx context.Context, id string) error
+}
+
+// clientRepository implements ClientRepository with database/sql
+// DB INTERACTION: All methods interact with the o_auth_clients table
+type clientRepository struct {
+	db *sql.DB
+}
+
+// NewClientRepository creates a new client repository
+func NewClientRepository(db *sql.DB) ClientRepository {
+	return &clientRepository{db: db}
+}
+
+// clientColumns lists the o_auth_clients columns in scanClient order
+// Columns added after a client was registered by hand may be NULL, hence the COALESCEs
+const clientColumns = `client_id, COALESCE(client_secret, ''), COALESCE(client_name, ''), COALESCE(client_type, ''),
+		redirect_uris, post_logout_redirect_uris, grant_types, COALESCE(scope, ''),
+		COALESCE(require_mfa, false), COALESCE(first_party, false), COALESCE(subject_type, 'public'), COALESCE(sector_identifier_uri, ''),
+		COALESCE(backchannel_logout_uri, ''), COALESCE(backchannel_logout_session_required, false),
+		COALESCE(frontchannel_logout_uri, ''), COALESCE(frontchannel_logout_session_required, false),
+		COALESCE(access_token_lifetime, 0), COALESCE(refresh_token_lifetime, 0), COALESCE(refresh_token_idle_lifetime, 0),
+		COALESCE(id_token_lifetime, 0), COALESCE(auth_code_lifetime, 0), COALESCE(access_token_format, ''),
+		COALESCE(resource_server, false), audiences, COALESCE(introspection_encryption_key, ''), authorization_details_types,
+		created_at, updated_at`
+
+// GetClientByID retrieves a client by client ID
+// If the client does not exist, it automatically creates a new one with default values
+// INPUT FROM DB: Queries o_auth_clients table by client ID
+// OUTPUT TO DB: Inserts the client into o_auth_clients table when missing
+func (r *clientRepository) GetClientByID(ctx context.Context, id string) (*OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	client, err := r.FindClientByID(ctx, id)
+	if err != nil || client != nil {
+		return client, err
+	}
+
+	// Create new client with default values and a secure random secret (48 bytes = 64 chars in base64)
+	client = &OAuthClient{
+		ClientID:     id,
+		ClientSecret: utils.GenerateSecureToken(48),
+		ClientName:   "Auto-generated Client",
+		ClientType:   "public",
+		RedirectURIs: pq.StringArray{"http://localhost:3000/auth/callback"},
+		GrantTypes:   pq.StringArray{"authorization_code", "refresh_token"},
+		Scope:        "openid profile email",
+		SubjectType:  "public",
+	}
+	if err := r.CreateClient(ctx, client); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// FindClientByID retrieves a client by client ID, returning nil if it does not exist
+// Unlike GetClientByID it never creates the client
+// INPUT FROM DB: Queries o_auth_clients table by client ID
+func (r *clientRepository) FindClientByID(ctx context.Context, id string) (*OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + clientColumns + `
+		FROM o_auth_clients
+		WHERE client_id = $1
+	`
+
+	return scanClient(r.db.QueryRowContext(ctx, query, id))
+}
+
+// ListClients retrieves all registered clients
+// INPUT FROM DB: Queries o_auth_clients table
+func (r *clientRepository) ListClients(ctx context.Context) ([]*OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + clientColumns + `
+		FROM o_auth_clients
+		ORDER BY client_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []*OAuthClient
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
 			return nil, err
 		}
-		
-		return &newClient, nil
+		clients = append(clients, client)
 	}
-	
-	// If any other error occurred, return it
+
+	return clients, rows.Err()
+}
+
+// CreateClient inserts a new client
+// OUTPUT TO DB: Inserts client into o_auth_clients table
+func (r *clientRepository) CreateClient(ctx context.Context, client *OAuthClient) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO o_auth_clients (client_id, client_secret, client_name, client_type, redirect_uris, post_logout_redirect_uris,
+			grant_types, scope, require_mfa, first_party, subject_type, sector_identifier_uri,
+			backchannel_logout_uri, backchannel_logout_session_required, frontchannel_logout_uri, frontchannel_logout_session_required,
+			access_token_lifetime, refresh_token_lifetime, refresh_token_idle_lifetime, id_token_lifetime, auth_code_lifetime,
+			access_token_format, resource_server, audiences, introspection_encryption_key, authorization_details_types,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+			$21, $22, $23, $24, $25, $26, $27, $27)
+	`
+
+	if client.SubjectType == "" {
+		client.SubjectType = "public"
+	}
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, append(clientValues(client), now)...)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to create client: %w", err)
 	}
-	
-	return &client, nil
+
+	client.CreatedAt = now
+	client.UpdatedAt = now
+
+	return nil
 }
 
-// ValidateRedirectURI checks if a redirect URI is registered for this client
-func (s *Storage) ValidateRedirectURI(client *OAuthClient, redirect string) bool {
-	for _, uri := range client.RedirectURIs {
-		if uri == redirect {
-			return true
-		}
+// SaveClient updates every column of an existing client
+// OUTPUT TO DB: Updates client in o_auth_clients table
+func (r *clientRepository) SaveClient(ctx context.Context, client *OAuthClient) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE o_auth_clients
+		SET client_secret = $2, client_name = $3, client_type = $4, redirect_uris = $5, post_logout_redirect_uris = $6,
+			grant_types = $7, scope = $8, require_mfa = $9, first_party = $10, subject_type = $11, sector_identifier_uri = $12,
+			backchannel_logout_uri = $13, backchannel_logout_session_required = $14,
+			frontchannel_logout_uri = $15, frontchannel_logout_session_required = $16,
+			access_token_lifetime = $17, refresh_token_lifetime = $18, refresh_token_idle_lifetime = $19,
+			id_token_lifetime = $20, auth_code_lifetime = $21, access_token_format = $22, resource_server = $23,
+			audiences = $24, introspection_encryption_key = $25, authorization_details_types = $26, updated_at = $27
+		WHERE client_id = $1
+	`
+
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, query, append(clientValues(client), now)...)
+	if err != nil {
+		return fmt.Errorf("failed to update client: %w", err)
 	}
-	return false
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("client not found")
+	}
+
+	client.UpdatedAt = now
+
+	return nil
+}
+
+// DeleteClient removes a client
+// OUTPUT TO DB: Deletes client from o_auth_clients table
+func (r *clientRepository) DeleteClient(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM o_auth_clients WHERE client_id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete client: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("client not found")
+	}
+
+	return nil
+}
+
+// clientValues returns the client's columns in the order of the INSERT and UPDATE parameters $1-$26
+func clientValues(client *OAuthClient) []interface{} {
+	return []interface{}{
+		client.ClientID,
+		client.ClientSecret,
+		client.ClientName,
+		client.ClientType,
+		client.RedirectURIs,
+		client.PostLogoutRedirectURIs,
+		client.GrantTypes,
+		client.Scope,
+		client.RequireMFA,
+		client.FirstParty,
+		client.SubjectType,
+		client.SectorIdentifierURI,
+		client.BackchannelLogoutURI,
+		client.BackchannelLogoutSessionRequired,
+		client.FrontchannelLogoutURI,
+		client.FrontchannelLogoutSessionRequired,
+		client.AccessTokenLifetime,
+		client.RefreshTokenLifetime,
+		client.RefreshTokenIdleLifetime,
+		client.IDTokenLifetime,
+		client.AuthCodeLifetime,
+		client.AccessTokenFormat,
+		client.ResourceServer,
+		client.Audiences,
+		client.IntrospectionEncryptionKey,
+		client.AuthorizationDetailsTypes,
+	}
+}
+
+// scanClient scans a row selected with clientColumns; it returns nil when there is no row
+func scanClient(row rowScanner) (*OAuthClient, error) {
+	client := &OAuthClient{}
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(
+		&client.ClientID,
+		&client.ClientSecret,
+		&client.ClientName,
+		&client.ClientType,
+		&client.RedirectURIs,
+		&client.PostLogoutRedirectURIs,
+		&client.GrantTypes,
+		&client.Scope,
+		&client.RequireMFA,
+		&client.FirstParty,
+		&client.SubjectType,
+		&client.SectorIdentifierURI,
+		&client.BackchannelLogoutURI,
+		&client.BackchannelLogoutSessionRequired,
+		&client.FrontchannelLogoutURI,
+		&client.FrontchannelLogoutSessionRequired,
+		&client.AccessTokenLifetime,
+		&client.RefreshTokenLifetime,
+		&client.RefreshTokenIdleLifetime,
+		&client.IDTokenLifetime,
+		&client.AuthCodeLifetime,
+		&client.AccessTokenFormat,
+		&client.ResourceServer,
+		&client.Audiences,
+		&client.IntrospectionEncryptionKey,
+		&client.AuthorizationDetailsTypes,
+		&createdAt,
+		&updatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan client: %w", err)
+	}
+
+	client.CreatedAt = createdAt.Time
+	client.UpdatedAt = updatedAt.Time
+
+	return client, nil
 }
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ConsentGrant records the scopes a user has agreed to share with a client
+type ConsentGrant struct {
+	UserID    string
+	ClientID  string
+	Scopes    pq.StringArray
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ConsentRepository stores consent grants
+type ConsentRepository interface {
+	GetGrant(ctx context.Context, userID, clientID string) (*ConsentGrant, error)
+	ListByUser(ctx context.Context, userID string) ([]*ConsentGrant, error)
+	SaveGrant(ctx context.Context, grant *ConsentGrant) error
+	DeleteGrant(ctx context.Context, userID, clientID string) error
+}
+
+// consentRepository implements ConsentRepository with database/sql
+// DB INTERACTION: All methods interact with the consent_grants table
+type consentRepository struct {
+	db *sql.DB
+}
+
+// NewConsentRepository creates a new consent repository
+func NewConsentRepository(db *sql.DB) ConsentRepository {
+	return &consentRepository{db: db}
+}
+
+// GetGrant retrieves the consent a user has given a client
+// INPUT FROM DB: Queries consent_grants table by user and client ID
+func (r *consentRepository) GetGrant(ctx context.Context, userID, clientID string) (*ConsentGrant, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT user_id, client_id, scopes, created_at, updated_at
+		FROM consent_grants
+		WHERE user_id = $1 AND client_id = $2
+	`
+
+	grant := &ConsentGrant{}
+	err := r.db.QueryRowContext(ctx, query, userID, clientID).Scan(
+		&grant.UserID,
+		&grant.ClientID,
+		&grant.Scopes,
+		&grant.CreatedAt,
+		&grant.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consent grant: %w", err)
+	}
+
+	return grant, nil
+}
+
+// ListByUser retrieves all consent grants a user has given
+// INPUT FROM DB: Queries consent_grants table by user ID
+func (r *consentRepository) ListByUser(ctx context.Context, userID string) ([]*ConsentGrant, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT user_id, client_id, scopes, created_at, updated_at
+		FROM consent_grants
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consent grants: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []*ConsentGrant
+	for rows.Next() {
+		grant := &ConsentGrant{}
+		err := rows.Scan(
+			&grant.UserID,
+			&grant.ClientID,
+			&grant.Scopes,
+			&grant.CreatedAt,
+			&grant.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan consent grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, nil
+}
+
+// SaveGrant creates or replaces the consent a user has given a client
+// OUTPUT TO DB: Upserts row in consent_grants table
+func (r *consentRepository) SaveGrant(ctx context.Context, grant *ConsentGrant) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO consent_grants (user_id, client_id, scopes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = EXCLUDED.scopes,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, grant.UserID, grant.ClientID, grant.Scopes, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save consent grant: %w", err)
+	}
+
+	grant.UpdatedAt = now
+
+	return nil
+}
+
+// DeleteGrant removes the consent a user has given a client
+// OUTPUT TO DB: Deletes row from consent_grants table
+func (r *consentRepository) DeleteGrant(ctx context.Context, userID, clientID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM consent_grants WHERE user_id = $1 AND client_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, userID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete consent grant: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("consent grant not found")
+	}
+
+	return nil
+}
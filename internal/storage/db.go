@@ -1,42 +1,181 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log"
+	"time"
 
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
 	"github.com/lib/pq"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// queryTimeout bounds every repository call, on top of any deadline the caller's context carries,
+// so a stalled database fails the request instead of holding it open
+const queryTimeout = 5 * time.Second
 
-// Storage provides database operations using GORM
-type Storage struct {
-	DB *gorm.DB
+// Repositories bundles the repositories the service is built from
+// NewRepositories backs them with a database; tests can fill it with in-memory implementations
+type Repositories struct {
+	Users      UserRepository
+	Clients    ClientRepository
+	Scopes     ScopeRepository
+	Resources  ResourceRepository
+	ClaimRules ClaimRuleRepository
+	Tokens     TokenRepository
+	MFA        MFARepository
+	WebAuthn   WebAuthnRepository
+	Identities IdentityRepository
+	Consents   ConsentRepository
+	Sessions   SessionRepository
+	RBAC       RBACRepository
 }
 
-func InitDB(dsn string) {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// NewRepositories creates every repository on db
+func NewRepositories(db *sql.DB) *Repositories {
+	return &Repositories{
+		Users:      NewUserRepository(db),
+		Clients:    NewClientRepository(db),
+		Scopes:     NewScopeRepository(db),
+		Resources:  NewResourceRepository(db),
+		ClaimRules: NewClaimRuleRepository(db),
+		Tokens:     NewTokenRepository(db),
+		MFA:        NewMFARepository(db),
+		WebAuthn:   NewWebAuthnRepository(db),
+		Identities: NewIdentityRepository(db),
+		Consents:   NewConsentRepository(db),
+		Sessions:   NewSessionRepository(db),
+		RBAC:       NewRBACRepository(db),
+	}
+}
+
+// InitDB connects to the database and makes sure its schema is the one this build expects
+// With autoMigrate pending migrations are applied first; otherwise the service refuses to start
+// until they are applied with "oauthctl migrate". A schema newer than this build is always refused.
+func InitDB(driver, dsn string, autoMigrate bool) *sql.DB {
+	db, err := Open(driver, dsn)
 	if err != nil {
 		log.Fatal("failed to connect database:", err)
 	}
 
-	DB = db
+	ctx := context.Background()
+	if autoMigrate {
+		applied, err := MigrateUp(ctx, db)
+		if err != nil {
+			log.Fatal("failed to migrate database:", err)
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %s", migration)
+		}
+	}
+	if err := CheckSchema(ctx, db); err != nil {
+		log.Fatal("refusing to start: ", err)
+	}
+
+	Seed(ctx, NewRepositories(db))
+
+	log.Println("Database connected and schema is up to date")
+	return db
+}
+
+// Open connects to the database without touching the schema
+// driver is DriverPostgres or DriverSQLite; for SQLite dsn is a file path or ":memory:"
+func Open(driver, dsn string) (*sql.DB, error) {
+	db, err := openDriver(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to reach database: %w", err)
+	}
+	return db, nil
+}
+
+// Seed inserts the standard scopes, claim rules, admin role and development client if they are missing
+func Seed(ctx context.Context, repos *Repositories) {
+	SeedDefaultScopes(ctx, repos.Scopes)
+	SeedDefaultClaimRules(ctx, repos.ClaimRules)
+	SeedAdminRole(ctx, repos.RBAC)
+	SeedDevClient(ctx, repos.Clients)
+}
+
+// SeedDefaultScopes inserts the OpenID Connect scopes and the admin scope if they are not registered yet
+// Existing rows are left alone so operators can change descriptions and flags
+func SeedDefaultScopes(ctx context.Context, scopeRepo ScopeRepository) {
+	scopes := []Scope{
+		{Name: "openid", Description: "Sign you in", Type: ScopeTypeOIDC, Default: true},
+		{Name: "profile", Description: "View your name and profile picture", Type: ScopeTypeOIDC, Default: true, ConsentRequired: true},
+		{Name: "email", Description: "View your email address", Type: ScopeTypeOIDC, Default: true, ConsentRequired: true},
+		{Name: "roles", Description: "View your roles in this application", Type: ScopeTypeOIDC},
+		{Name: "groups", Description: "View the groups you belong to", Type: ScopeTypeOIDC, ConsentRequired: true},
+		{Name: "admin", Description: "Administer users, sessions and clients", Type: ScopeTypeAPI, ConsentRequired: true, RequiredRole: AdminRole},
+	}
+
+	for _, scope := range scopes {
+		existing, err := scopeRepo.GetScope(ctx, scope.Name)
+		if err == nil && existing == nil {
+			err = scopeRepo.CreateScope(ctx, &scope)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to seed scope %s: %v", scope.Name, err)
+		}
+	}
+}
+
+// SeedDefaultClaimRules inserts the global rules putting roles and groups into tokens when the
+// "roles" and "groups" scopes are granted, unless a global rule for those claims exists
+func SeedDefaultClaimRules(ctx context.Context, ruleRepo ClaimRuleRepository) {
+	rules := []ClaimRule{
+		{Scope: "roles", ClaimName: "roles", Source: ClaimSourceRoles},
+		{Scope: "groups", ClaimName: "groups", Source: ClaimSourceGroups},
+	}
 
-	// Auto-migrate the schemas
-	err = db.AutoMigrate(&User{}, &OAuthClient{}, &RefreshToken{})
+	// With an empty client ID only the global rules are returned
+	existing, err := ruleRepo.ListClaimRules(ctx, "")
 	if err != nil {
-		log.Fatal("failed to migrate database:", err)
+		log.Printf("Warning: failed to seed claim rules: %v", err)
+		return
+	}
+	seeded := make(map[string]bool)
+	for _, rule := range existing {
+		seeded[rule.ClaimName] = true
+	}
+
+	for _, rule := range rules {
+		if seeded[rule.ClaimName] {
+			continue
+		}
+		if err := ruleRepo.CreateClaimRule(ctx, &rule); err != nil {
+			log.Printf("Warning: failed to seed claim rule %s: %v", rule.ClaimName, err)
+		}
 	}
+}
 
-	log.Println("Database connected and tables migrated successfully")
+// SeedAdminRole inserts the global admin role if it does not exist yet
+// Nobody holds it until an operator assigns it (oauthctl admins grant)
+func SeedAdminRole(ctx context.Context, rbacRepo RBACRepository) {
+	roles, err := rbacRepo.ListRoles(ctx)
+	if err != nil {
+		log.Printf("Warning: failed to seed admin role: %v", err)
+		return
+	}
+	for _, role := range roles {
+		if role.ClientID == "" && role.Name == AdminRole {
+			return
+		}
+	}
 
-	// Seed development client
-	SeedDevClient(db)
+	role := Role{ID: uuid.NewString(), Name: AdminRole, Description: "Administer users, sessions and clients"}
+	if err := rbacRepo.CreateRole(ctx, &role); err != nil {
+		log.Printf("Warning: failed to seed admin role: %v", err)
+	}
 }
 
 // SeedDevClient inserts a development OAuth client for testing
-func SeedDevClient(db *gorm.DB) {
+func SeedDevClient(ctx context.Context, clientRepo ClientRepository) {
 	client := OAuthClient{
 		ClientID:     "demo-frontend",
 		ClientSecret: "dev-secret",
@@ -47,9 +186,12 @@ func SeedDevClient(db *gorm.DB) {
 		Scope:        "openid profile email",
 	}
 
-	result := db.Where(OAuthClient{ClientID: client.ClientID}).FirstOrCreate(&client)
-	if result.Error != nil {
-		log.Printf("Warning: failed to seed dev client: %v", result.Error)
+	existing, err := clientRepo.FindClientByID(ctx, client.ClientID)
+	if err == nil && existing == nil {
+		err = clientRepo.CreateClient(ctx, &client)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to seed dev client: %v", err)
 	} else {
 		log.Println("Development OAuth client seeded successfully")
 	}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Database drivers selectable with DATABASE_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" // pure Go, for development and tests; not meant for production
+)
+
+// dialect holds the SQL that differs between the supported databases
+// The repositories themselves only use SQL both databases accept
+type dialect struct {
+	driver string
+	// lock and unlock guard migrations; empty when the database needs no lock
+	lock, unlock          string
+	createMigrationsTable string
+	migrationsTableExists string
+}
+
+var postgresDialect = dialect{
+	driver: DriverPostgres,
+	lock:   `SELECT pg_advisory_lock($1)`,
+	unlock: `SELECT pg_advisory_unlock($1)`,
+	createMigrationsTable: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL
+		)
+	`,
+	migrationsTableExists: `
+		SELECT EXISTS(
+			SELECT 1 FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = 'schema_migrations'
+		)
+	`,
+}
+
+// SQLite allows one writer at a time and Open uses a single connection, so no lock is needed
+var sqliteDialect = dialect{
+	driver: DriverSQLite,
+	createMigrationsTable: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at datetime NOT NULL
+		)
+	`,
+	migrationsTableExists: `
+		SELECT EXISTS(
+			SELECT 1 FROM sqlite_master
+			WHERE type = 'table' AND name = 'schema_migrations'
+		)
+	`,
+}
+
+// dialectOf returns the dialect of a database opened with Open
+func dialectOf(db *sql.DB) dialect {
+	if _, ok := db.Driver().(sqliteDriver); ok {
+		return sqliteDialect
+	}
+	return postgresDialect
+}
+
+// openDriver opens a database with the given driver without connecting to it
+func openDriver(driver, dsn string) (*sql.DB, error) {
+	switch driver {
+	case DriverPostgres, "":
+		return sql.Open("pgx", dsn)
+	case DriverSQLite:
+		return openSQLite(dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserIdentity represents an upstream identity (e.g. a Google account) linked to a local user
+type UserIdentity struct {
+	ID            string
+	UserID        string
+	Provider      string // e.g. "google"
+	Subject       string // provider's stable user ID
+	Email         string
+	EmailVerified bool
+	RawProfile    string     // profile as returned by the provider
+	UnlinkedAt    *time.Time // set once the user removed the identity from their account
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// IdentityRepository stores linked identities
+type IdentityRepository interface {
+	GetIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	ListByUser(ctx context.Context, userID string) ([]*UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *UserIdentity) error
+	UpdateProfile(ctx context.Context, identity *UserIdentity) error
+	UnlinkIdentity(ctx context.Context, userID, id string) error
+	RelinkIdentity(ctx context.Context, id, userID string) error
+}
+
+// identityRepository implements IdentityRepository with database/sql
+// DB INTERACTION: All methods interact with the user_identities table
+type identityRepository struct {
+	db *sql.DB
+}
+
+// NewIdentityRepository creates a new identity repository
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+// GetIdentity retrieves an identity by provider and provider subject
+// INPUT FROM DB: Queries user_identities table
+func (r *identityRepository) GetIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, provider, subject, email, email_verified, raw_profile, unlinked_at, created_at, updated_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	identity, err := scanIdentity(r.db.QueryRowContext(ctx, query, provider, subject))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// ListByUser retrieves the identities currently linked to a user
+// INPUT FROM DB: Queries user_identities table by user ID
+func (r *identityRepository) ListByUser(ctx context.Context, userID string) ([]*UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, provider, subject, email, email_verified, raw_profile, unlinked_at, created_at, updated_at
+		FROM user_identities
+		WHERE user_id = $1 AND unlinked_at IS NULL
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []*UserIdentity
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, nil
+}
+
+// CreateIdentity links a new identity to a user
+// OUTPUT TO DB: Inserts identity into user_identities table
+func (r *identityRepository) CreateIdentity(ctx context.Context, identity *UserIdentity) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_identities (id, user_id, provider, subject, email, email_verified, raw_profile, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx,
+		query,
+		identity.ID,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+		identity.EmailVerified,
+		identity.RawProfile,
+		now,
+		now,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	identity.CreatedAt = now
+	identity.UpdatedAt = now
+
+	return nil
+}
+
+// UpdateProfile refreshes the provider profile stored for an identity
+// OUTPUT TO DB: Updates identity row in user_identities table
+func (r *identityRepository) UpdateProfile(ctx context.Context, identity *UserIdentity) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE user_identities
+		SET email = $2, email_verified = $3, raw_profile = $4, updated_at = $5
+		WHERE id = $1
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, identity.ID, identity.Email, identity.EmailVerified, identity.RawProfile, now)
+	if err != nil {
+		return fmt.Errorf("failed to update identity: %w", err)
+	}
+
+	identity.UpdatedAt = now
+
+	return nil
+}
+
+// UnlinkIdentity detaches an identity from a user
+// The row is kept with unlinked_at set so the login flow can recognise the removed account
+// OUTPUT TO DB: Updates identity row in user_identities table
+func (r *identityRepository) UnlinkIdentity(ctx context.Context, userID, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE user_identities
+		SET unlinked_at = $3, updated_at = $3
+		WHERE id = $1 AND user_id = $2 AND unlinked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("identity not found")
+	}
+
+	return nil
+}
+
+// RelinkIdentity attaches a previously unlinked identity to a user
+// OUTPUT TO DB: Updates identity row in user_identities table
+func (r *identityRepository) RelinkIdentity(ctx context.Context, id, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE user_identities
+		SET user_id = $2, unlinked_at = NULL, updated_at = $3
+		WHERE id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, id, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to relink identity: %w", err)
+	}
+
+	return nil
+}
+
+// scanIdentity reads one identity row; returns nil if there is no row
+func scanIdentity(row rowScanner) (*UserIdentity, error) {
+	identity := &UserIdentity{}
+	var unlinkedAt sql.NullTime
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.EmailVerified,
+		&identity.RawProfile,
+		&unlinkedAt,
+		&identity.CreatedAt,
+		&identity.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if unlinkedAt.Valid {
+		identity.UnlinkedAt = &unlinkedAt.Time
+	}
+
+	return identity, nil
+}
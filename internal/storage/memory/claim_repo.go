@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// claimRuleRepository implements storage.ClaimRuleRepository in memory
+type claimRuleRepository struct {
+	*store
+}
+
+// ListClaimRules returns the global rules followed by the client's, each in creation order
+func (r *claimRuleRepository) ListClaimRules(ctx context.Context, clientID string) ([]*storage.ClaimRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var global, client []*storage.ClaimRule
+	for _, rule := range r.claimRules {
+		rule.Targets = cloneStrings(rule.Targets)
+		switch rule.ClientID {
+		case "":
+			global = append(global, &rule)
+		case clientID:
+			client = append(client, &rule)
+		}
+	}
+	return append(global, client...), nil
+}
+
+func (r *claimRuleRepository) CreateClaimRule(ctx context.Context, rule *storage.ClaimRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextRuleID++
+	now := time.Now()
+	rule.ID = r.nextRuleID
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+
+	stored := *rule
+	stored.Targets = cloneStrings(rule.Targets)
+	r.claimRules = append(r.claimRules, stored)
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/storage"
+	"oauth-golang/pkg/utils"
+)
+
+// clientRepository implements storage.ClientRepository in memory
+type clientRepository struct {
+	*store
+}
+
+// GetClientByID retrieves a client, creating it with default values when missing like the database repository
+func (r *clientRepository) GetClientByID(ctx context.Context, id string) (*storage.OAuthClient, error) {
+	client, err := r.FindClientByID(ctx, id)
+	if err != nil || client != nil {
+		return client, err
+	}
+
+	client = &storage.OAuthClient{
+		ClientID:     id,
+		ClientSecret: utils.GenerateSecureToken(48),
+		ClientName:   "Auto-generated Client",
+		ClientType:   "public",
+		RedirectURIs: pq.StringArray{"http://localhost:3000/auth/callback"},
+		GrantTypes:   pq.StringArray{"authorization_code", "refresh_token"},
+		Scope:        "openid profile email",
+		SubjectType:  "public",
+	}
+	if err := r.CreateClient(ctx, client); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (r *clientRepository) FindClientByID(ctx context.Context, id string) (*storage.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, ok := r.clients[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyClient(client), nil
+}
+
+func (r *clientRepository) ListClients(ctx context.Context) ([]*storage.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clients := sortedValues(r.clients, func(a, b *storage.OAuthClient) bool { return a.ClientID < b.ClientID })
+	for i, client := range clients {
+		clients[i] = copyClient(*client)
+	}
+	return clients, nil
+}
+
+func (r *clientRepository) CreateClient(ctx context.Context, client *storage.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clients[client.ClientID]; ok {
+		return fmt.Errorf("failed to create client: client %s already exists", client.ClientID)
+	}
+
+	if client.SubjectType == "" {
+		client.SubjectType = "public"
+	}
+	now := time.Now()
+	client.CreatedAt = now
+	client.UpdatedAt = now
+	r.clients[client.ClientID] = *copyClient(*client)
+
+	return nil
+}
+
+func (r *clientRepository) SaveClient(ctx context.Context, client *storage.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.clients[client.ClientID]
+	if !ok {
+		return fmt.Errorf("client not found")
+	}
+
+	client.CreatedAt = stored.CreatedAt
+	client.UpdatedAt = time.Now()
+	r.clients[client.ClientID] = *copyClient(*client)
+
+	return nil
+}
+
+func (r *clientRepository) DeleteClient(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clients[id]; !ok {
+		return fmt.Errorf("client not found")
+	}
+	delete(r.clients, id)
+
+	return nil
+}
+
+// copyClient copies a client including its array fields
+func copyClient(client storage.OAuthClient) *storage.OAuthClient {
+	client.RedirectURIs = cloneStrings(client.RedirectURIs)
+	client.PostLogoutRedirectURIs = cloneStrings(client.PostLogoutRedirectURIs)
+	client.GrantTypes = cloneStrings(client.GrantTypes)
+	client.Audiences = cloneStrings(client.Audiences)
+	client.AuthorizationDetailsTypes = cloneStrings(client.AuthorizationDetailsTypes)
+	return &client
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// consentRepository implements storage.ConsentRepository in memory
+type consentRepository struct {
+	*store
+}
+
+func (r *consentRepository) GetGrant(ctx context.Context, userID, clientID string) (*storage.ConsentGrant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	grant, ok := r.consents[[2]string{userID, clientID}]
+	if !ok {
+		return nil, nil
+	}
+	grant.Scopes = cloneStrings(grant.Scopes)
+	return &grant, nil
+}
+
+func (r *consentRepository) ListByUser(ctx context.Context, userID string) ([]*storage.ConsentGrant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owned := make(map[[2]string]storage.ConsentGrant)
+	for key, grant := range r.consents {
+		if key[0] == userID {
+			grant.Scopes = cloneStrings(grant.Scopes)
+			owned[key] = grant
+		}
+	}
+	return sortedValues(owned, func(a, b *storage.ConsentGrant) bool { return a.CreatedAt.Before(b.CreatedAt) }), nil
+}
+
+// SaveGrant creates or replaces a grant's scopes, keeping the original creation time
+func (r *consentRepository) SaveGrant(ctx context.Context, grant *storage.ConsentGrant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{grant.UserID, grant.ClientID}
+	now := time.Now()
+	stored := storage.ConsentGrant{
+		UserID:    grant.UserID,
+		ClientID:  grant.ClientID,
+		Scopes:    cloneStrings(grant.Scopes),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if existing, ok := r.consents[key]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	r.consents[key] = stored
+	grant.UpdatedAt = now
+
+	return nil
+}
+
+func (r *consentRepository) DeleteGrant(ctx context.Context, userID, clientID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{userID, clientID}
+	if _, ok := r.consents[key]; !ok {
+		return fmt.Errorf("consent grant not found")
+	}
+	delete(r.consents, key)
+
+	return nil
+}
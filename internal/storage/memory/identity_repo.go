@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// identityRepository implements storage.IdentityRepository in memory
+type identityRepository struct {
+	*store
+}
+
+func (r *identityRepository) GetIdentity(ctx context.Context, provider, subject string) (*storage.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *identityRepository) ListByUser(ctx context.Context, userID string) ([]*storage.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owned := make(map[string]storage.UserIdentity)
+	for id, identity := range r.identities {
+		if identity.UserID == userID && identity.UnlinkedAt == nil {
+			owned[id] = identity
+		}
+	}
+	return sortedValues(owned, func(a, b *storage.UserIdentity) bool { return a.CreatedAt.Before(b.CreatedAt) }), nil
+}
+
+func (r *identityRepository) CreateIdentity(ctx context.Context, identity *storage.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.identities[identity.ID]; ok {
+		return fmt.Errorf("failed to create identity: identity %s already exists", identity.ID)
+	}
+	for _, other := range r.identities {
+		if other.Provider == identity.Provider && other.Subject == identity.Subject {
+			return fmt.Errorf("failed to create identity: %s account is already linked", identity.Provider)
+		}
+	}
+
+	now := time.Now()
+	identity.CreatedAt = now
+	identity.UpdatedAt = now
+	r.identities[identity.ID] = *identity
+
+	return nil
+}
+
+func (r *identityRepository) UpdateProfile(ctx context.Context, identity *storage.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.identities[identity.ID]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	stored.Email = identity.Email
+	stored.EmailVerified = identity.EmailVerified
+	stored.RawProfile = identity.RawProfile
+	stored.UpdatedAt = now
+	r.identities[identity.ID] = stored
+	identity.UpdatedAt = now
+
+	return nil
+}
+
+func (r *identityRepository) UnlinkIdentity(ctx context.Context, userID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[id]
+	if !ok || identity.UserID != userID || identity.UnlinkedAt != nil {
+		return fmt.Errorf("identity not found")
+	}
+	now := time.Now()
+	identity.UnlinkedAt = &now
+	identity.UpdatedAt = now
+	r.identities[id] = identity
+
+	return nil
+}
+
+func (r *identityRepository) RelinkIdentity(ctx context.Context, id, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[id]
+	if !ok {
+		return nil
+	}
+	identity.UserID = userID
+	identity.UnlinkedAt = nil
+	identity.UpdatedAt = time.Now()
+	r.identities[id] = identity
+
+	return nil
+}
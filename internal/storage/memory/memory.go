@@ -0,0 +1,116 @@
+// Package memory implements the storage repositories in memory, for unit tests and local experiments
+// The repositories mirror the database ones: lookups of missing rows return nil, orderings match the
+// SQL queries, and deleting a user removes the rows the schema cascades to. Nothing is persisted.
+package memory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"oauth-golang/internal/storage"
+)
+
+// store holds every table; all repositories created by one NewRepositories call share it
+type store struct {
+	mu sync.Mutex
+
+	users         map[string]storage.User
+	clients       map[string]storage.OAuthClient
+	scopes        map[string]storage.Scope
+	resources     map[string]storage.ProtectedResource
+	claimRules    []storage.ClaimRule
+	nextRuleID    uint
+	refreshTokens map[string]storage.RefreshToken // by token
+	accessTokens  map[string]storage.AccessToken  // by token hash
+	revokedTokens map[string]time.Time            // token hash to expiry
+	mfa           map[string]storage.MFAEnrollment
+	credentials   map[string]storage.WebAuthnCredential
+	identities    map[string]storage.UserIdentity
+	consents      map[[2]string]storage.ConsentGrant // by user ID and client ID
+	sessions      map[string]storage.LoginSession
+	roles         map[string]storage.Role
+	groups        map[string]storage.Group
+	groupMembers  map[[2]string]storage.GroupMember // by group ID and user ID
+	userRoles     map[[2]string]storage.UserRole    // by user ID and role ID
+	groupRoles    map[[2]string]storage.GroupRole   // by group ID and role ID
+}
+
+// NewRepositories creates every repository on a new, empty in-memory store
+func NewRepositories() *storage.Repositories {
+	s := &store{
+		users:         make(map[string]storage.User),
+		clients:       make(map[string]storage.OAuthClient),
+		scopes:        make(map[string]storage.Scope),
+		resources:     make(map[string]storage.ProtectedResource),
+		refreshTokens: make(map[string]storage.RefreshToken),
+		accessTokens:  make(map[string]storage.AccessToken),
+		revokedTokens: make(map[string]time.Time),
+		mfa:           make(map[string]storage.MFAEnrollment),
+		credentials:   make(map[string]storage.WebAuthnCredential),
+		identities:    make(map[string]storage.UserIdentity),
+		consents:      make(map[[2]string]storage.ConsentGrant),
+		sessions:      make(map[string]storage.LoginSession),
+		roles:         make(map[string]storage.Role),
+		groups:        make(map[string]storage.Group),
+		groupMembers:  make(map[[2]string]storage.GroupMember),
+		userRoles:     make(map[[2]string]storage.UserRole),
+		groupRoles:    make(map[[2]string]storage.GroupRole),
+	}
+
+	return &storage.Repositories{
+		Users:      &userRepository{s},
+		Clients:    &clientRepository{s},
+		Scopes:     &scopeRepository{s},
+		Resources:  &resourceRepository{s},
+		ClaimRules: &claimRuleRepository{s},
+		Tokens:     &tokenRepository{s},
+		MFA:        &mfaRepository{s},
+		WebAuthn:   &webAuthnRepository{s},
+		Identities: &identityRepository{s},
+		Consents:   &consentRepository{s},
+		Sessions:   &sessionRepository{s},
+		RBAC:       &rbacRepository{s},
+	}
+}
+
+// AddProtectedResource registers a protected resource; the storage interface is read-only
+// because resources are managed in the database directly
+func AddProtectedResource(repos *storage.Repositories, resource storage.ProtectedResource) {
+	r := repos.Resources.(*resourceRepository)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	resource.Scopes = cloneStrings(resource.Scopes)
+	resource.CreatedAt, resource.UpdatedAt = now, now
+	r.resources[resource.Identifier] = resource
+}
+
+// cloneStrings copies an array column so callers cannot change stored rows through it
+func cloneStrings(values []string) pq.StringArray {
+	if values == nil {
+		return nil
+	}
+	return append(pq.StringArray{}, values...)
+}
+
+// sortedValues returns the map's values sorted with less
+func sortedValues[K comparable, V any](rows map[K]V, less func(a, b *V) bool) []*V {
+	values := make([]*V, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, &row)
+	}
+	sort.Slice(values, func(i, j int) bool { return less(values[i], values[j]) })
+	return values
+}
+
+// hashToken creates a SHA-256 hash of a token, like the database repository does
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
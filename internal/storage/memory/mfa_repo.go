@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// mfaRepository implements storage.MFARepository in memory
+type mfaRepository struct {
+	*store
+}
+
+func (r *mfaRepository) GetEnrollment(ctx context.Context, userID string) (*storage.MFAEnrollment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.mfa[userID]
+	if !ok {
+		return nil, nil
+	}
+	enrollment.RecoveryCodes = cloneStrings(enrollment.RecoveryCodes)
+	return &enrollment, nil
+}
+
+// SaveEnrollment creates or replaces a user's enrolment, keeping the original creation time
+func (r *mfaRepository) SaveEnrollment(ctx context.Context, enrollment *storage.MFAEnrollment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	stored := *enrollment
+	stored.RecoveryCodes = cloneStrings(enrollment.RecoveryCodes)
+	stored.CreatedAt = now
+	if existing, ok := r.mfa[enrollment.UserID]; ok {
+		stored.CreatedAt = existing.CreatedAt
+	}
+	stored.UpdatedAt = now
+	r.mfa[enrollment.UserID] = stored
+	enrollment.UpdatedAt = now
+
+	return nil
+}
+
+func (r *mfaRepository) ConfirmEnrollment(ctx context.Context, userID string, step int64) error {
+	r.update(userID, func(enrollment *storage.MFAEnrollment) {
+		enrollment.Confirmed = true
+		enrollment.LastUsedStep = step
+	})
+	return nil
+}
+
+// UpdateLastUsedStep records step only if it is later than the last one used
+func (r *mfaRepository) UpdateLastUsedStep(ctx context.Context, userID string, step int64) (bool, error) {
+	updated := false
+	r.update(userID, func(enrollment *storage.MFAEnrollment) {
+		if enrollment.LastUsedStep < step {
+			enrollment.LastUsedStep = step
+			updated = true
+		}
+	})
+	return updated, nil
+}
+
+// ReplaceRecoveryCodes replaces the recovery codes only if they are still previous
+func (r *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, previous, codes []string) (bool, error) {
+	replaced := false
+	r.update(userID, func(enrollment *storage.MFAEnrollment) {
+		if slices.Equal(enrollment.RecoveryCodes, previous) {
+			enrollment.RecoveryCodes = cloneStrings(codes)
+			replaced = true
+		}
+	})
+	return replaced, nil
+}
+
+func (r *mfaRepository) DeleteEnrollment(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.mfa, userID)
+	return nil
+}
+
+// update applies change to a user's enrolment, if there is one
+func (r *mfaRepository) update(userID string, change func(enrollment *storage.MFAEnrollment)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.mfa[userID]
+	if !ok {
+		return
+	}
+	change(&enrollment)
+	enrollment.UpdatedAt = time.Now()
+	r.mfa[userID] = enrollment
+}
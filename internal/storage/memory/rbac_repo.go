@@ -0,0 +1,341 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// rbacRepository implements storage.RBACRepository in memory
+// Deleting a role or group removes its memberships and assignments, as the foreign keys do
+type rbacRepository struct {
+	*store
+}
+
+func (r *rbacRepository) CreateRole(ctx context.Context, role *storage.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.roles[role.ID]; ok {
+		return fmt.Errorf("failed to create role: role %s already exists", role.ID)
+	}
+	for _, other := range r.roles {
+		if other.ClientID == role.ClientID && other.Name == role.Name {
+			return fmt.Errorf("failed to create role: role %s already exists", role.Name)
+		}
+	}
+
+	now := time.Now()
+	role.CreatedAt = now
+	role.UpdatedAt = now
+	r.roles[role.ID] = *role
+
+	return nil
+}
+
+func (r *rbacRepository) GetRole(ctx context.Context, id string) (*storage.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role, ok := r.roles[id]
+	if !ok {
+		return nil, nil
+	}
+	return &role, nil
+}
+
+func (r *rbacRepository) ListRoles(ctx context.Context) ([]*storage.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return sortedValues(r.roles, roleLess), nil
+}
+
+func (r *rbacRepository) DeleteRole(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.roles[id]; !ok {
+		return fmt.Errorf("role not found")
+	}
+	delete(r.roles, id)
+	for key := range r.userRoles {
+		if key[1] == id {
+			delete(r.userRoles, key)
+		}
+	}
+	for key := range r.groupRoles {
+		if key[1] == id {
+			delete(r.groupRoles, key)
+		}
+	}
+
+	return nil
+}
+
+func (r *rbacRepository) CreateGroup(ctx context.Context, group *storage.Group) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[group.ID]; ok {
+		return fmt.Errorf("failed to create group: group %s already exists", group.ID)
+	}
+	for _, other := range r.groups {
+		if other.Name == group.Name {
+			return fmt.Errorf("failed to create group: group %s already exists", group.Name)
+		}
+	}
+
+	now := time.Now()
+	group.CreatedAt = now
+	group.UpdatedAt = now
+	r.groups[group.ID] = *group
+
+	return nil
+}
+
+func (r *rbacRepository) GetGroup(ctx context.Context, id string) (*storage.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	group, ok := r.groups[id]
+	if !ok {
+		return nil, nil
+	}
+	return &group, nil
+}
+
+func (r *rbacRepository) ListGroups(ctx context.Context) ([]*storage.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return sortedValues(r.groups, groupLess), nil
+}
+
+func (r *rbacRepository) DeleteGroup(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[id]; !ok {
+		return fmt.Errorf("group not found")
+	}
+	delete(r.groups, id)
+	for key := range r.groupMembers {
+		if key[0] == id {
+			delete(r.groupMembers, key)
+		}
+	}
+	for key := range r.groupRoles {
+		if key[0] == id {
+			delete(r.groupRoles, key)
+		}
+	}
+
+	return nil
+}
+
+func (r *rbacRepository) AddGroupMember(ctx context.Context, groupID, userID, source string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkExists(groupID, "", userID); err != nil {
+		return fmt.Errorf("failed to add group member: %w", err)
+	}
+	r.addMember(groupID, userID, source, time.Now())
+
+	return nil
+}
+
+func (r *rbacRepository) RemoveGroupMember(ctx context.Context, groupID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{groupID, userID}
+	if _, ok := r.groupMembers[key]; !ok {
+		return fmt.Errorf("group member not found")
+	}
+	delete(r.groupMembers, key)
+
+	return nil
+}
+
+func (r *rbacRepository) ListGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := make(map[[2]string]storage.GroupMember)
+	for key, member := range r.groupMembers {
+		if key[0] == groupID {
+			members[key] = member
+		}
+	}
+
+	var userIDs []string
+	for _, member := range sortedValues(members, func(a, b *storage.GroupMember) bool { return a.CreatedAt.Before(b.CreatedAt) }) {
+		userIDs = append(userIDs, member.UserID)
+	}
+	return userIDs, nil
+}
+
+func (r *rbacRepository) ListUserGroups(ctx context.Context, userID string) ([]*storage.Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	groups := make(map[string]storage.Group)
+	for key := range r.groupMembers {
+		if key[1] == userID {
+			groups[key[0]] = r.groups[key[0]]
+		}
+	}
+	return sortedValues(groups, groupLess), nil
+}
+
+// SyncExternalGroups makes the user's Google memberships match the given Workspace group emails
+// Only groups with a matching external ID are joined; memberships added by an administrator are kept
+func (r *rbacRepository) SyncExternalGroups(ctx context.Context, userID string, externalIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matching := make(map[string]bool)
+	for id, group := range r.groups {
+		if slices.Contains(externalIDs, group.ExternalID) {
+			matching[id] = true
+		}
+	}
+
+	for key, member := range r.groupMembers {
+		if key[1] == userID && member.Source == storage.MembershipSourceGoogle && !matching[key[0]] {
+			delete(r.groupMembers, key)
+		}
+	}
+
+	if len(matching) > 0 {
+		if err := r.checkExists("", "", userID); err != nil {
+			return fmt.Errorf("failed to add group memberships: %w", err)
+		}
+	}
+	now := time.Now()
+	for groupID := range matching {
+		r.addMember(groupID, userID, storage.MembershipSourceGoogle, now)
+	}
+
+	return nil
+}
+
+func (r *rbacRepository) AssignUserRole(ctx context.Context, userID, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkExists("", roleID, userID); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	key := [2]string{userID, roleID}
+	if _, ok := r.userRoles[key]; !ok {
+		r.userRoles[key] = storage.UserRole{UserID: userID, RoleID: roleID, CreatedAt: time.Now()}
+	}
+
+	return nil
+}
+
+func (r *rbacRepository) UnassignUserRole(ctx context.Context, userID, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{userID, roleID}
+	if _, ok := r.userRoles[key]; !ok {
+		return fmt.Errorf("role assignment not found")
+	}
+	delete(r.userRoles, key)
+
+	return nil
+}
+
+func (r *rbacRepository) AssignGroupRole(ctx context.Context, groupID, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkExists(groupID, roleID, ""); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	key := [2]string{groupID, roleID}
+	if _, ok := r.groupRoles[key]; !ok {
+		r.groupRoles[key] = storage.GroupRole{GroupID: groupID, RoleID: roleID, CreatedAt: time.Now()}
+	}
+
+	return nil
+}
+
+func (r *rbacRepository) UnassignGroupRole(ctx context.Context, groupID, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{groupID, roleID}
+	if _, ok := r.groupRoles[key]; !ok {
+		return fmt.Errorf("role assignment not found")
+	}
+	delete(r.groupRoles, key)
+
+	return nil
+}
+
+// ListUserRoles returns the roles assigned to the user directly or through any of their groups
+func (r *rbacRepository) ListUserRoles(ctx context.Context, userID string) ([]*storage.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	roles := make(map[string]storage.Role)
+	for key := range r.userRoles {
+		if key[0] == userID {
+			roles[key[1]] = r.roles[key[1]]
+		}
+	}
+	for memberKey := range r.groupMembers {
+		if memberKey[1] != userID {
+			continue
+		}
+		for roleKey := range r.groupRoles {
+			if roleKey[0] == memberKey[0] {
+				roles[roleKey[1]] = r.roles[roleKey[1]]
+			}
+		}
+	}
+	return sortedValues(roles, roleLess), nil
+}
+
+// addMember adds a membership unless the user already is a member, whatever the source
+func (r *rbacRepository) addMember(groupID, userID, source string, now time.Time) {
+	key := [2]string{groupID, userID}
+	if _, ok := r.groupMembers[key]; !ok {
+		r.groupMembers[key] = storage.GroupMember{GroupID: groupID, UserID: userID, Source: source, CreatedAt: now}
+	}
+}
+
+// checkExists fails like a foreign key violation when a non-empty group, role or user ID is unknown
+func (r *rbacRepository) checkExists(groupID, roleID, userID string) error {
+	if _, ok := r.groups[groupID]; groupID != "" && !ok {
+		return fmt.Errorf("group %s does not exist", groupID)
+	}
+	if _, ok := r.roles[roleID]; roleID != "" && !ok {
+		return fmt.Errorf("role %s does not exist", roleID)
+	}
+	if _, ok := r.users[userID]; userID != "" && !ok {
+		return fmt.Errorf("user %s does not exist", userID)
+	}
+	return nil
+}
+
+// roleLess orders roles like the SQL queries: global roles first, then by client and name
+func roleLess(a, b *storage.Role) bool {
+	if a.ClientID != b.ClientID {
+		return a.ClientID < b.ClientID
+	}
+	return a.Name < b.Name
+}
+
+// groupLess orders groups by name
+func groupLess(a, b *storage.Group) bool {
+	return a.Name < b.Name
+}
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+
+	"oauth-golang/internal/storage"
+)
+
+// resourceRepository implements storage.ResourceRepository in memory
+// Resources are added with AddProtectedResource
+type resourceRepository struct {
+	*store
+}
+
+func (r *resourceRepository) GetProtectedResource(ctx context.Context, identifier string) (*storage.ProtectedResource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resource, ok := r.resources[identifier]
+	if !ok {
+		return nil, nil
+	}
+	resource.Scopes = cloneStrings(resource.Scopes)
+	return &resource, nil
+}
+
+func (r *resourceRepository) ListProtectedResources(ctx context.Context) ([]*storage.ProtectedResource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	resources := sortedValues(r.resources, func(a, b *storage.ProtectedResource) bool { return a.Identifier < b.Identifier })
+	for _, resource := range resources {
+		resource.Scopes = cloneStrings(resource.Scopes)
+	}
+	return resources, nil
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// scopeRepository implements storage.ScopeRepository in memory
+type scopeRepository struct {
+	*store
+}
+
+func (r *scopeRepository) GetScope(ctx context.Context, name string) (*storage.Scope, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scope, ok := r.scopes[name]
+	if !ok {
+		return nil, nil
+	}
+	return &scope, nil
+}
+
+func (r *scopeRepository) ListScopes(ctx context.Context) ([]*storage.Scope, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return sortedValues(r.scopes, func(a, b *storage.Scope) bool { return a.Name < b.Name }), nil
+}
+
+func (r *scopeRepository) CreateScope(ctx context.Context, scope *storage.Scope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.scopes[scope.Name]; ok {
+		return fmt.Errorf("failed to create scope: scope %s already exists", scope.Name)
+	}
+
+	if scope.Type == "" {
+		scope.Type = storage.ScopeTypeAPI
+	}
+	now := time.Now()
+	scope.CreatedAt = now
+	scope.UpdatedAt = now
+	r.scopes[scope.Name] = *scope
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// sessionRepository implements storage.SessionRepository in memory
+type sessionRepository struct {
+	*store
+}
+
+func (r *sessionRepository) CreateSession(ctx context.Context, session *storage.LoginSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[session.ID]; ok {
+		return fmt.Errorf("failed to create session: session %s already exists", session.ID)
+	}
+
+	now := time.Now()
+	session.LastSeenAt = now
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	stored := *session
+	stored.AMR = cloneStrings(session.AMR)
+	stored.ClientIDs = nil
+	stored.Revoked = false
+	r.sessions[session.ID] = stored
+
+	return nil
+}
+
+func (r *sessionRepository) GetSession(ctx context.Context, id string) (*storage.LoginSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return copySession(session), nil
+}
+
+func (r *sessionRepository) ListActiveByUser(ctx context.Context, userID string) ([]*storage.LoginSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	active := make(map[string]storage.LoginSession)
+	for id, session := range r.sessions {
+		if session.UserID == userID && !session.Revoked && session.ExpiresAt.After(now) {
+			active[id] = *copySession(session)
+		}
+	}
+	return sortedValues(active, func(a, b *storage.LoginSession) bool { return a.LastSeenAt.After(b.LastSeenAt) }), nil
+}
+
+func (r *sessionRepository) AddClient(ctx context.Context, id, clientID string) error {
+	r.update(id, func(session *storage.LoginSession) bool {
+		if slices.Contains(session.ClientIDs, clientID) {
+			return false
+		}
+		session.ClientIDs = append(cloneStrings(session.ClientIDs), clientID)
+		return true
+	})
+	return nil
+}
+
+func (r *sessionRepository) TouchSession(ctx context.Context, id string) error {
+	r.update(id, func(session *storage.LoginSession) bool {
+		session.LastSeenAt = time.Now()
+		return true
+	})
+	return nil
+}
+
+func (r *sessionRepository) RevokeSession(ctx context.Context, id string) error {
+	r.update(id, func(session *storage.LoginSession) bool {
+		session.Revoked = true
+		return true
+	})
+	return nil
+}
+
+// update applies change to a session, if there is one, and stores it when change reports a change
+func (r *sessionRepository) update(id string, change func(session *storage.LoginSession) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || !change(&session) {
+		return
+	}
+	session.UpdatedAt = time.Now()
+	r.sessions[id] = session
+}
+
+// copySession copies a session including its array fields
+func copySession(session storage.LoginSession) *storage.LoginSession {
+	session.AMR = cloneStrings(session.AMR)
+	session.ClientIDs = cloneStrings(session.ClientIDs)
+	return &session
+}
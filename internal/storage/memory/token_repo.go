@@ -0,0 +1,265 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// tokenRepository implements storage.TokenRepository in memory
+// Access tokens and revoked tokens are keyed by hash, as in the database
+type tokenRepository struct {
+	*store
+}
+
+func (r *tokenRepository) StoreRefreshToken(ctx context.Context, rt *storage.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.refreshTokens[rt.Token]; ok {
+		return fmt.Errorf("failed to store refresh token: token already exists")
+	}
+	for _, other := range r.refreshTokens {
+		if other.ID == rt.ID {
+			return fmt.Errorf("failed to store refresh token: ID %s already exists", rt.ID)
+		}
+	}
+
+	now := time.Now()
+	rt.CreatedAt = now
+	rt.UpdatedAt = now
+	stored := *rt
+	stored.Resources = cloneStrings(rt.Resources)
+	stored.LastUsedAt = nil
+	stored.Revoked = false
+	r.refreshTokens[rt.Token] = stored
+
+	return nil
+}
+
+func (r *tokenRepository) StoreAccessToken(ctx context.Context, token string, at *storage.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at.TokenHash = hashToken(token)
+	if _, ok := r.accessTokens[at.TokenHash]; ok {
+		return fmt.Errorf("failed to store access token: token already exists")
+	}
+
+	now := time.Now()
+	at.CreatedAt = now
+	at.UpdatedAt = now
+	stored := *at
+	stored.Revoked = false
+	r.accessTokens[at.TokenHash] = stored
+
+	return nil
+}
+
+func (r *tokenRepository) GetAccessToken(ctx context.Context, token string) (*storage.AccessToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at, ok := r.accessTokens[hashToken(token)]
+	if !ok {
+		return nil, nil
+	}
+	return &at, nil
+}
+
+func (r *tokenRepository) RevokeAccessToken(ctx context.Context, token string) error {
+	r.revokeAccessTokens(func(at *storage.AccessToken) bool { return at.TokenHash == hashToken(token) })
+	return nil
+}
+
+func (r *tokenRepository) RevokeClientAccessTokens(ctx context.Context, userID, clientID string) error {
+	r.revokeAccessTokens(func(at *storage.AccessToken) bool { return at.UserID == userID && at.ClientID == clientID })
+	return nil
+}
+
+func (r *tokenRepository) RevokeSessionAccessTokens(ctx context.Context, sessionID string) error {
+	r.revokeAccessTokens(func(at *storage.AccessToken) bool { return at.SessionID == sessionID })
+	return nil
+}
+
+func (r *tokenRepository) RevokeUserAccessTokens(ctx context.Context, userID string) error {
+	r.revokeAccessTokens(func(at *storage.AccessToken) bool { return at.UserID == userID })
+	return nil
+}
+
+func (r *tokenRepository) RevokeAllClientAccessTokens(ctx context.Context, clientID string) error {
+	r.revokeAccessTokens(func(at *storage.AccessToken) bool { return at.ClientID == clientID })
+	return nil
+}
+
+func (r *tokenRepository) DeleteExpiredAccessTokens(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, at := range r.accessTokens {
+		if at.ExpiresAt.Before(now) {
+			delete(r.accessTokens, key)
+		}
+	}
+	return nil
+}
+
+func (r *tokenRepository) GetRefreshToken(ctx context.Context, token string) (*storage.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt, ok := r.refreshTokens[token]
+	if !ok {
+		return nil, nil
+	}
+	rt.Resources = cloneStrings(rt.Resources)
+	return &rt, nil
+}
+
+func (r *tokenRepository) ListActiveByUser(ctx context.Context, userID string) ([]*storage.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	active := make(map[string]storage.RefreshToken)
+	for key, rt := range r.refreshTokens {
+		if rt.UserID == userID && !rt.Revoked && rt.ExpiresAt.After(now) {
+			rt.Resources = cloneStrings(rt.Resources)
+			active[key] = rt
+		}
+	}
+	return sortedValues(active, func(a, b *storage.RefreshToken) bool { return a.CreatedAt.After(b.CreatedAt) }), nil
+}
+
+func (r *tokenRepository) TouchRefreshToken(ctx context.Context, token, ipAddress, userAgent string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt, ok := r.refreshTokens[token]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	rt.LastUsedAt = &now
+	rt.IPAddress = ipAddress
+	rt.UserAgent = userAgent
+	rt.UpdatedAt = now
+	r.refreshTokens[token] = rt
+
+	return nil
+}
+
+func (r *tokenRepository) RevokeRefreshTokenByID(ctx context.Context, userID, id string) error {
+	revoked := r.revokeRefreshTokens(func(rt *storage.RefreshToken) bool { return rt.ID == id && rt.UserID == userID }, true)
+	if revoked == 0 {
+		return fmt.Errorf("refresh token not found")
+	}
+	return nil
+}
+
+func (r *tokenRepository) RevokeRefreshToken(ctx context.Context, token string) error {
+	r.revokeRefreshTokens(func(rt *storage.RefreshToken) bool { return rt.Token == token }, true)
+	return nil
+}
+
+func (r *tokenRepository) RevokeClientRefreshTokens(ctx context.Context, userID, clientID string) error {
+	r.revokeRefreshTokens(func(rt *storage.RefreshToken) bool { return rt.UserID == userID && rt.ClientID == clientID }, false)
+	return nil
+}
+
+func (r *tokenRepository) RevokeSessionRefreshTokens(ctx context.Context, sessionID string) error {
+	r.revokeRefreshTokens(func(rt *storage.RefreshToken) bool { return rt.SessionID == sessionID }, false)
+	return nil
+}
+
+func (r *tokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	r.revokeRefreshTokens(func(rt *storage.RefreshToken) bool { return rt.UserID == userID }, false)
+	return nil
+}
+
+func (r *tokenRepository) RevokeAllClientRefreshTokens(ctx context.Context, clientID string) error {
+	r.revokeRefreshTokens(func(rt *storage.RefreshToken) bool { return rt.ClientID == clientID }, false)
+	return nil
+}
+
+func (r *tokenRepository) DeleteExpiredRefreshTokens(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, rt := range r.refreshTokens {
+		if rt.ExpiresAt.Before(now) {
+			delete(r.refreshTokens, key)
+		}
+	}
+	return nil
+}
+
+func (r *tokenRepository) RevokeToken(ctx context.Context, token string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokenHash := hashToken(token)
+	if _, ok := r.revokedTokens[tokenHash]; !ok {
+		r.revokedTokens[tokenHash] = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+func (r *tokenRepository) IsTokenRevoked(ctx context.Context, token string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expiresAt, ok := r.revokedTokens[hashToken(token)]
+	return ok && expiresAt.After(time.Now()), nil
+}
+
+func (r *tokenRepository) DeleteExpiredRevokedTokens(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, expiresAt := range r.revokedTokens {
+		if expiresAt.Before(now) {
+			delete(r.revokedTokens, key)
+		}
+	}
+	return nil
+}
+
+// revokeAccessTokens revokes every access token matching that is not revoked yet
+func (r *tokenRepository) revokeAccessTokens(match func(at *storage.AccessToken) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, at := range r.accessTokens {
+		if !at.Revoked && match(&at) {
+			at.Revoked = true
+			at.UpdatedAt = now
+			r.accessTokens[key] = at
+		}
+	}
+}
+
+// revokeRefreshTokens revokes every refresh token matching and returns how many matched
+// With again, tokens already revoked match too and are revoked again, as the single-token queries do
+func (r *tokenRepository) revokeRefreshTokens(match func(rt *storage.RefreshToken) bool, again bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	matched := 0
+	for key, rt := range r.refreshTokens {
+		if (again || !rt.Revoked) && match(&rt) {
+			rt.Revoked = true
+			rt.UpdatedAt = now
+			r.refreshTokens[key] = rt
+			matched++
+		}
+	}
+	return matched
+}
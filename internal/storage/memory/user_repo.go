@@ -0,0 +1,189 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// userRepository implements storage.UserRepository in memory
+type userRepository struct {
+	*store
+}
+
+func (r *userRepository) GetUserByID(ctx context.Context, id string) (*storage.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*storage.User, error) {
+	return r.findUser(func(user *storage.User) bool { return user.Email == email })
+}
+
+func (r *userRepository) GetUserByGoogleID(ctx context.Context, googleID string) (*storage.User, error) {
+	return r.findUser(func(user *storage.User) bool { return user.GoogleID == googleID })
+}
+
+func (r *userRepository) CreateUser(ctx context.Context, user *storage.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.ID]; ok {
+		return fmt.Errorf("failed to create user: user %s already exists", user.ID)
+	}
+	if err := r.checkUnique(user); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	stored := *user
+	stored.Disabled = false
+	r.users[user.ID] = stored
+
+	return nil
+}
+
+func (r *userRepository) UpdateUser(ctx context.Context, user *storage.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return nil
+	}
+	if err := r.checkUnique(user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	now := time.Now()
+	stored.Email = user.Email
+	stored.EmailVerified = user.EmailVerified
+	stored.Name = user.Name
+	stored.GivenName = user.GivenName
+	stored.FamilyName = user.FamilyName
+	stored.Picture = user.Picture
+	stored.GoogleID = user.GoogleID
+	stored.UpdatedAt = now
+	r.users[user.ID] = stored
+	user.UpdatedAt = now
+
+	return nil
+}
+
+// DeleteUser removes the user and, like the foreign keys do, everything that belongs to them
+func (r *userRepository) DeleteUser(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users, id)
+	for key, identity := range r.identities {
+		if identity.UserID == id {
+			delete(r.identities, key)
+		}
+	}
+	for key, credential := range r.credentials {
+		if credential.UserID == id {
+			delete(r.credentials, key)
+		}
+	}
+	for key := range r.consents {
+		if key[0] == id {
+			delete(r.consents, key)
+		}
+	}
+	for key, session := range r.sessions {
+		if session.UserID == id {
+			delete(r.sessions, key)
+		}
+	}
+	for key := range r.groupMembers {
+		if key[1] == id {
+			delete(r.groupMembers, key)
+		}
+	}
+	for key := range r.userRoles {
+		if key[0] == id {
+			delete(r.userRoles, key)
+		}
+	}
+
+	return nil
+}
+
+func (r *userRepository) ListUsers(ctx context.Context, search string, limit, offset int) ([]*storage.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	search = strings.ToLower(search)
+	matching := make(map[string]storage.User)
+	for id, user := range r.users {
+		if search == "" || strings.Contains(strings.ToLower(user.Email), search) || strings.Contains(strings.ToLower(user.Name), search) {
+			matching[id] = user
+		}
+	}
+
+	users := sortedValues(matching, func(a, b *storage.User) bool { return a.CreatedAt.After(b.CreatedAt) })
+	if offset >= len(users) {
+		return nil, nil
+	}
+	users = users[offset:]
+	if limit < len(users) {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (r *userRepository) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return fmt.Errorf("user not found")
+	}
+	user.Disabled = disabled
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+
+	return nil
+}
+
+// findUser returns a copy of the first user matching, or nil
+func (r *userRepository) findUser(match func(user *storage.User) bool) (*storage.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if match(&user) {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkUnique enforces the unique email and Google ID indexes against other users
+func (r *userRepository) checkUnique(user *storage.User) error {
+	for id, other := range r.users {
+		if id == user.ID {
+			continue
+		}
+		if user.Email != "" && other.Email == user.Email {
+			return fmt.Errorf("email %s is already in use", user.Email)
+		}
+		if user.GoogleID != "" && other.GoogleID == user.GoogleID {
+			return fmt.Errorf("google ID %s is already in use", user.GoogleID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"oauth-golang/internal/storage"
+)
+
+// webAuthnRepository implements storage.WebAuthnRepository in memory
+type webAuthnRepository struct {
+	*store
+}
+
+func (r *webAuthnRepository) ListByUser(ctx context.Context, userID string) ([]*storage.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owned := make(map[string]storage.WebAuthnCredential)
+	for id, credential := range r.credentials {
+		if credential.UserID == userID {
+			credential.Transports = cloneStrings(credential.Transports)
+			owned[id] = credential
+		}
+	}
+	return sortedValues(owned, func(a, b *storage.WebAuthnCredential) bool { return a.CreatedAt.Before(b.CreatedAt) }), nil
+}
+
+func (r *webAuthnRepository) CreateCredential(ctx context.Context, credential *storage.WebAuthnCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.credentials[credential.ID]; ok {
+		return fmt.Errorf("failed to create WebAuthn credential: credential already exists")
+	}
+
+	now := time.Now()
+	credential.CreatedAt = now
+	credential.LastUsedAt = now
+	stored := *credential
+	stored.Transports = cloneStrings(credential.Transports)
+	stored.CloneWarning = false
+	r.credentials[credential.ID] = stored
+
+	return nil
+}
+
+func (r *webAuthnRepository) RecordAssertion(ctx context.Context, id string, signCount int64, backupState bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	credential, ok := r.credentials[id]
+	if !ok {
+		return nil
+	}
+	credential.SignCount = signCount
+	credential.BackupState = backupState
+	credential.LastUsedAt = time.Now()
+	r.credentials[id] = credential
+
+	return nil
+}
+
+func (r *webAuthnRepository) FlagCloneWarning(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	credential, ok := r.credentials[id]
+	if !ok {
+		return nil
+	}
+	credential.CloneWarning = true
+	r.credentials[id] = credential
+
+	return nil
+}
+
+func (r *webAuthnRepository) DeleteCredential(ctx context.Context, userID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	credential, ok := r.credentials[id]
+	if !ok || credential.UserID != userID {
+		return fmt.Errorf("credential not found")
+	}
+	delete(r.credentials, id)
+
+	return nil
+}
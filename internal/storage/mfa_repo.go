@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MFAEnrollment represents a user's TOTP authenticator enrolment
+type MFAEnrollment struct {
+	UserID        string
+	Secret        string
+	Confirmed     bool
+	RecoveryCodes pq.StringArray // bcrypt hashes, never plaintext
+	LastUsedStep  int64          // last accepted TOTP time step, for replay protection
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// MFARepository stores MFA enrolments
+type MFARepository interface {
+	GetEnrollment(ctx context.Context, userID string) (*MFAEnrollment, error)
+	SaveEnrollment(ctx context.Context, enrollment *MFAEnrollment) error
+	ConfirmEnrollment(ctx context.Context, userID string, step int64) error
+	UpdateLastUsedStep(ctx context.Context, userID string, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID string, previous, codes []string) (bool, error)
+	DeleteEnrollment(ctx context.Context, userID string) error
+}
+
+// mfaRepository implements MFARepository with database/sql
+// DB INTERACTION: All methods interact with the mfa_enrollments table
+type mfaRepository struct {
+	db *sql.DB
+}
+
+// NewMFARepository creates a new MFA repository
+func NewMFARepository(db *sql.DB) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+// GetEnrollment retrieves the MFA enrolment for a user
+// INPUT FROM DB: Queries mfa_enrollments table by user ID
+func (r *mfaRepository) GetEnrollment(ctx context.Context, userID string) (*MFAEnrollment, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT user_id, secret, confirmed, recovery_codes, last_used_step, created_at, updated_at
+		FROM mfa_enrollments
+		WHERE user_id = $1
+	`
+
+	enrollment := &MFAEnrollment{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&enrollment.UserID,
+		&enrollment.Secret,
+		&enrollment.Confirmed,
+		&enrollment.RecoveryCodes,
+		&enrollment.LastUsedStep,
+		&enrollment.CreatedAt,
+		&enrollment.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MFA enrollment: %w", err)
+	}
+
+	return enrollment, nil
+}
+
+// SaveEnrollment creates or replaces a user's MFA enrolment
+// OUTPUT TO DB: Upserts row in mfa_enrollments table
+func (r *mfaRepository) SaveEnrollment(ctx context.Context, enrollment *MFAEnrollment) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO mfa_enrollments (user_id, secret, confirmed, recovery_codes, last_used_step, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret,
+			confirmed = EXCLUDED.confirmed,
+			recovery_codes = EXCLUDED.recovery_codes,
+			last_used_step = EXCLUDED.last_used_step,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx,
+		query,
+		enrollment.UserID,
+		enrollment.Secret,
+		enrollment.Confirmed,
+		enrollment.RecoveryCodes,
+		enrollment.LastUsedStep,
+		now,
+		now,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save MFA enrollment: %w", err)
+	}
+
+	enrollment.UpdatedAt = now
+
+	return nil
+}
+
+// ConfirmEnrollment marks an enrolment as confirmed after the first valid code
+// OUTPUT TO DB: Updates confirmed flag in mfa_enrollments table
+func (r *mfaRepository) ConfirmEnrollment(ctx context.Context, userID string, step int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE mfa_enrollments
+		SET confirmed = true, last_used_step = $2, updated_at = $3
+		WHERE user_id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, step, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to confirm MFA enrollment: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLastUsedStep records the most recently accepted TOTP time step
+// The step is only recorded if it is later than the last one used, so of two concurrent
+// verifications of the same code only one succeeds; the result reports whether it was recorded
+// OUTPUT TO DB: Conditionally updates last_used_step in mfa_enrollments table
+func (r *mfaRepository) UpdateLastUsedStep(ctx context.Context, userID string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE mfa_enrollments
+		SET last_used_step = $2, updated_at = $3
+		WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, step, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to update MFA step: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update MFA step: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ReplaceRecoveryCodes replaces the stored recovery code hashes if they are still previous
+// A concurrent change makes it fail rather than be overwritten; the result reports whether it was replaced
+// OUTPUT TO DB: Conditionally updates recovery_codes in mfa_enrollments table
+func (r *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, previous, codes []string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE mfa_enrollments
+		SET recovery_codes = $3, updated_at = $4
+		WHERE user_id = $1 AND recovery_codes = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, pq.StringArray(previous), pq.StringArray(codes), time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to update recovery codes: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update recovery codes: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// DeleteEnrollment removes a user's MFA enrolment
+// OUTPUT TO DB: Deletes row from mfa_enrollments table
+func (r *mfaRepository) DeleteEnrollment(ctx context.Context, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM mfa_enrollments WHERE user_id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete MFA enrollment: %w", err)
+	}
+
+	return nil
+}
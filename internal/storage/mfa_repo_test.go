@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestMFARepositoryConditionalUpdates(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "oauth.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	if _, err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	repos := NewRepositories(db)
+	if err := repos.Users.CreateUser(ctx, &User{ID: "user-1", Email: "user@example.com"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	codes := []string{"hash-1", "hash-2", "hash-3"}
+	if err := repos.MFA.SaveEnrollment(ctx, &MFAEnrollment{UserID: "user-1", Secret: "secret", Confirmed: true, RecoveryCodes: codes, LastUsedStep: 10}); err != nil {
+		t.Fatalf("SaveEnrollment: %v", err)
+	}
+
+	steps := []struct {
+		step int64
+		want bool
+	}{
+		{9, false},
+		{10, false},
+		{11, true},
+		{11, false},
+	}
+	for _, tt := range steps {
+		recorded, err := repos.MFA.UpdateLastUsedStep(ctx, "user-1", tt.step)
+		if err != nil {
+			t.Fatalf("UpdateLastUsedStep(%d): %v", tt.step, err)
+		}
+		if recorded != tt.want {
+			t.Errorf("UpdateLastUsedStep(%d) = %v, want %v", tt.step, recorded, tt.want)
+		}
+	}
+
+	// Only the first of two replacements based on the same codes succeeds
+	if replaced, err := repos.MFA.ReplaceRecoveryCodes(ctx, "user-1", codes, []string{"hash-2", "hash-3"}); err != nil || !replaced {
+		t.Fatalf("ReplaceRecoveryCodes: %v, %v", replaced, err)
+	}
+	if replaced, err := repos.MFA.ReplaceRecoveryCodes(ctx, "user-1", codes, []string{"hash-1", "hash-3"}); err != nil || replaced {
+		t.Fatalf("stale ReplaceRecoveryCodes: %v, %v", replaced, err)
+	}
+
+	enrollment, err := repos.MFA.GetEnrollment(ctx, "user-1")
+	if err != nil || enrollment == nil {
+		t.Fatalf("GetEnrollment: %+v, %v", enrollment, err)
+	}
+	if enrollment.LastUsedStep != 11 || len(enrollment.RecoveryCodes) != 2 || enrollment.RecoveryCodes[0] != "hash-2" {
+		t.Errorf("got step %d and codes %v", enrollment.LastUsedStep, enrollment.RecoveryCodes)
+	}
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each driver has its own migrations directory; both must define the same versions
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock held while migrating, so replicas starting
+// at the same time apply each migration once
+const migrationLockID int64 = 0x6f61757468 // "oauth"
+
+// ErrUnknownSchema means the database has migrations this build does not know, usually because a
+// newer release already migrated it
+var ErrUnknownSchema = errors.New("database schema is newer than this build")
+
+// ErrPendingMigrations means the database has not been migrated to this build's schema yet
+var ErrPendingMigrations = errors.New("database schema has pending migrations")
+
+// Migration is one versioned schema change, read from migrations/<driver>/<version>_<name>.up.sql and .down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a built-in migration and when it was applied; AppliedAt is nil while pending
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// String returns the migration's file name without direction, e.g. "0002_revoked_tokens"
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Migrations returns the migrations built into the binary for a driver, oldest first
+func Migrations(driver string) ([]Migration, error) {
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, _ := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		versionText, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil || version <= 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		data, err := migrationFiles.ReadFile(dir + "/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration, each in its own transaction, and returns the ones applied
+// OUTPUT TO DB: Creates schema_migrations and runs migrations while holding the advisory lock
+func MigrateUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	d := dialectOf(db)
+	migrations, err := Migrations(d.driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = withMigrationLock(ctx, db, d, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn, d)
+		if err != nil {
+			return err
+		}
+		if err := checkKnownVersions(versions, migrations); err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the latest steps applied migrations, newest first, and returns the ones reverted
+// OUTPUT TO DB: Runs down migrations while holding the advisory lock
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	d := dialectOf(db)
+	migrations, err := Migrations(d.driver)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	err = withMigrationLock(ctx, db, d, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn, d)
+		if err != nil {
+			return err
+		}
+		if err := checkKnownVersions(versions, migrations); err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			if _, ok := versions[migrations[i].Version]; !ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, migrations[i], false); err != nil {
+				return err
+			}
+			reverted = append(reverted, migrations[i])
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus returns every built-in migration with when it was applied
+// INPUT FROM DB: Queries schema_migrations table
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	d := dialectOf(db)
+	migrations, err := Migrations(d.driver)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	versions, err := appliedVersions(ctx, conn, d)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKnownVersions(versions, migrations); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		state := MigrationState{Migration: migration}
+		if appliedAt, ok := versions[migration.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// CheckSchema verifies the database is at exactly this build's schema version
+// It returns ErrUnknownSchema or ErrPendingMigrations (wrapped) otherwise
+// INPUT FROM DB: Queries schema_migrations table
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	states, err := MigrationStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending = append(pending, state.String())
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %s", ErrPendingMigrations, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// withMigrationLock runs fn on one connection holding the migration advisory lock, if the dialect has one
+// Session-level advisory locks belong to a connection, so everything must run on conn
+func withMigrationLock(ctx context.Context, db *sql.DB, d dialect, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if d.lock != "" {
+		if _, err := conn.ExecContext(ctx, d.lock, migrationLockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), d.unlock, migrationLockID)
+	}
+
+	if _, err := conn.ExecContext(ctx, d.createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// runMigration applies (up) or reverts (down) one migration and records it, in a single transaction
+// OUTPUT TO DB: Runs the migration SQL and inserts into or deletes from schema_migrations
+func runMigration(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record, args := migration.Up,
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		[]interface{}{migration.Version, migration.Name, time.Now()}
+	if !up {
+		script, record, args = migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, []interface{}{migration.Version}
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %s failed: %w", migration, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration, err)
+	}
+	return tx.Commit()
+}
+
+// appliedVersions returns the applied migration versions with their time; none before the first migration
+// INPUT FROM DB: Queries schema_migrations table
+func appliedVersions(ctx context.Context, conn *sql.Conn, d dialect) (map[int]time.Time, error) {
+	versions := make(map[int]time.Time)
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, d.migrationsTableExists).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if !exists {
+		return versions, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// checkKnownVersions fails with ErrUnknownSchema when a version was applied that this build does not ship
+func checkKnownVersions(versions map[int]time.Time, migrations []Migration) error {
+	known := make(map[int]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+
+	var unknown []int
+	for version := range versions {
+		if !known[version] {
+			unknown = append(unknown, version)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Ints(unknown)
+		return fmt.Errorf("%w: unknown migration versions %v", ErrUnknownSchema, unknown)
+	}
+	return nil
+}
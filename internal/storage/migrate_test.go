@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// gormBaselineSchema is the DDL GORM AutoMigrate ran for the User, OAuthClient and RefreshToken
+// models before versioned migrations existed
+var gormBaselineSchema = []string{
+	`CREATE TABLE "users" ("id" uuid,"email" text NOT NULL,"email_verified" boolean,"name" text,"given_name" text,` +
+		`"family_name" text,"google_id" text,"picture" text,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("id"))`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_google_id" ON "users" ("google_id")`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email")`,
+	`CREATE TABLE "o_auth_clients" ("client_id" text,"client_secret" text,"client_name" text,"client_type" text,` +
+		`"redirect_uris" text[],"grant_types" text[],"scope" text,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("client_id"))`,
+	`CREATE TABLE "refresh_tokens" ("token" text,"user_id" text,"client_id" text,"scope" text,"expires_at" timestamptz,` +
+		`"revoked" boolean,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("token"))`,
+}
+
+func TestMigrationsDefineSameVersions(t *testing.T) {
+	postgres, err := Migrations(DriverPostgres)
+	if err != nil {
+		t.Fatalf("Migrations(postgres): %v", err)
+	}
+	sqlite, err := Migrations(DriverSQLite)
+	if err != nil {
+		t.Fatalf("Migrations(sqlite): %v", err)
+	}
+
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("got %d postgres and %d sqlite migrations", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].String() != sqlite[i].String() {
+			t.Errorf("migration %d: postgres %s, sqlite %s", i, postgres[i], sqlite[i])
+		}
+	}
+}
+
+func TestSQLiteMigrateUpDownUp(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "oauth.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := Migrations(DriverSQLite)
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+
+	if err := CheckSchema(ctx, db); err == nil {
+		t.Fatal("CheckSchema passed on an empty database")
+	}
+	if applied, err := MigrateUp(ctx, db); err != nil || len(applied) != len(migrations) {
+		t.Fatalf("MigrateUp: applied %d of %d, %v", len(applied), len(migrations), err)
+	}
+	if err := CheckSchema(ctx, db); err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+	if applied, err := MigrateUp(ctx, db); err != nil || len(applied) != 0 {
+		t.Fatalf("second MigrateUp: applied %d, %v", len(applied), err)
+	}
+
+	if reverted, err := MigrateDown(ctx, db, len(migrations)); err != nil || len(reverted) != len(migrations) {
+		t.Fatalf("MigrateDown: reverted %d of %d, %v", len(reverted), len(migrations), err)
+	}
+	if applied, err := MigrateUp(ctx, db); err != nil || len(applied) != len(migrations) {
+		t.Fatalf("MigrateUp after MigrateDown: applied %d, %v", len(applied), err)
+	}
+
+	repos := NewRepositories(db)
+	Seed(ctx, repos)
+	if client, err := repos.Clients.GetClientByID(ctx, "demo-frontend"); err != nil || client == nil {
+		t.Fatalf("seeded client: %+v, %v", client, err)
+	}
+}
+
+// TestPostgresMigrateUpAdoptsGORMSchema upgrades a database created by GORM AutoMigrate
+// It runs when TEST_POSTGRES_URL names a Postgres database; the test works in a schema of its own
+func TestPostgresMigrateUpAdoptsGORMSchema(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	ctx := context.Background()
+	schema := "migrate_test_" + uuid.NewString()[:8]
+
+	admin, err := Open(DriverPostgres, dsn)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer admin.Close()
+	if _, err := admin.ExecContext(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	defer admin.ExecContext(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+
+	db, err := Open(DriverPostgres, withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	for _, statement := range gormBaselineSchema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			t.Fatalf("baseline schema: %v", err)
+		}
+	}
+
+	// Rows as the baseline release wrote them
+	userID := uuid.NewString()
+	now := time.Now()
+	mustExec(t, db, `INSERT INTO users (id, email, email_verified, name, given_name, family_name, google_id, picture, created_at, updated_at)
+		VALUES ($1, 'user@example.com', true, 'User', '', '', 'google-1', '', $2, $2)`, userID, now)
+	mustExec(t, db, `INSERT INTO o_auth_clients (client_id, client_secret, client_name, client_type, redirect_uris, grant_types, scope, created_at, updated_at)
+		VALUES ('demo-frontend', 'dev-secret', 'Demo Frontend App', 'public', '{http://localhost:3000/callback}', '{authorization_code,refresh_token}', 'openid profile email', $1, $1)`, now)
+	mustExec(t, db, `INSERT INTO refresh_tokens (token, user_id, client_id, scope, expires_at, revoked, created_at, updated_at)
+		VALUES ('baseline-refresh-token', $1, 'demo-frontend', 'openid', $2, false, $3, $3)`, userID, now.Add(time.Hour), now)
+
+	if _, err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if err := CheckSchema(ctx, db); err != nil {
+		t.Fatalf("CheckSchema: %v", err)
+	}
+
+	repos := NewRepositories(db)
+	Seed(ctx, repos)
+
+	user, err := repos.Users.GetUserByID(ctx, userID)
+	if err != nil || user == nil || user.Disabled {
+		t.Fatalf("baseline user: %+v, %v", user, err)
+	}
+	client, err := repos.Clients.GetClientByID(ctx, "demo-frontend")
+	if err != nil || client == nil || client.SubjectType != "public" || client.FirstParty {
+		t.Fatalf("baseline client: %+v, %v", client, err)
+	}
+	token, err := repos.Tokens.GetRefreshToken(ctx, "baseline-refresh-token")
+	if err != nil || token == nil || token.ID == "" {
+		t.Fatalf("baseline refresh token: %+v, %v", token, err)
+	}
+	if err := repos.Tokens.StoreRefreshToken(ctx, &RefreshToken{
+		Token: "new-refresh-token", ID: uuid.NewString(), UserID: userID, ClientID: "demo-frontend",
+		Scope: "openid", SessionID: uuid.NewString(), ExpiresAt: now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("StoreRefreshToken: %v", err)
+	}
+	if err := repos.Tokens.RevokeRefreshTokenByID(ctx, userID, token.ID); err != nil {
+		t.Fatalf("RevokeRefreshTokenByID: %v", err)
+	}
+}
+
+// withSearchPath points every connection of a Postgres DSN at one schema
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return fmt.Sprintf("%s search_path=%s", dsn, schema)
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
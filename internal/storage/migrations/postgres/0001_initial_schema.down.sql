@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS group_roles;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS claim_rules;
+DROP TABLE IF EXISTS protected_resources;
+DROP TABLE IF EXISTS access_tokens;
+DROP TABLE IF EXISTS login_sessions;
+DROP TABLE IF EXISTS scopes;
+DROP TABLE IF EXISTS consent_grants;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS webauthn_credentials;
+DROP TABLE IF EXISTS mfa_enrollments;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS o_auth_clients;
+DROP TABLE IF EXISTS users;
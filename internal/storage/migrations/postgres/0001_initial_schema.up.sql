@@ -0,0 +1,248 @@
+-- users, o_auth_clients and refresh_tokens are created as GORM AutoMigrate created them before
+-- versioned migrations existed, so databases set up that way are adopted by IF NOT EXISTS.
+-- The columns added since then are added separately, for new and adopted databases alike.
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid PRIMARY KEY,
+    email text NOT NULL,
+    email_verified boolean,
+    name text,
+    given_name text,
+    family_name text,
+    google_id text,
+    picture text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_google_id ON users (google_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS o_auth_clients (
+    client_id text PRIMARY KEY,
+    client_secret text,
+    client_name text,
+    client_type text,
+    redirect_uris text[],
+    grant_types text[],
+    scope text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+ALTER TABLE o_auth_clients
+    ADD COLUMN IF NOT EXISTS post_logout_redirect_uris text[],
+    ADD COLUMN IF NOT EXISTS require_mfa boolean,
+    ADD COLUMN IF NOT EXISTS first_party boolean,
+    ADD COLUMN IF NOT EXISTS subject_type text DEFAULT 'public',
+    ADD COLUMN IF NOT EXISTS sector_identifier_uri text,
+    ADD COLUMN IF NOT EXISTS backchannel_logout_uri text,
+    ADD COLUMN IF NOT EXISTS backchannel_logout_session_required boolean,
+    ADD COLUMN IF NOT EXISTS frontchannel_logout_uri text,
+    ADD COLUMN IF NOT EXISTS frontchannel_logout_session_required boolean,
+    ADD COLUMN IF NOT EXISTS access_token_lifetime bigint,
+    ADD COLUMN IF NOT EXISTS refresh_token_lifetime bigint,
+    ADD COLUMN IF NOT EXISTS refresh_token_idle_lifetime bigint,
+    ADD COLUMN IF NOT EXISTS id_token_lifetime bigint,
+    ADD COLUMN IF NOT EXISTS auth_code_lifetime bigint,
+    ADD COLUMN IF NOT EXISTS access_token_format text,
+    ADD COLUMN IF NOT EXISTS resource_server boolean,
+    ADD COLUMN IF NOT EXISTS audiences text[],
+    ADD COLUMN IF NOT EXISTS introspection_encryption_key text,
+    ADD COLUMN IF NOT EXISTS authorization_details_types text[];
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token text PRIMARY KEY,
+    user_id text,
+    client_id text,
+    scope text,
+    expires_at timestamptz,
+    revoked boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS id text,
+    ADD COLUMN IF NOT EXISTS resources text[],
+    ADD COLUMN IF NOT EXISTS authorization_details jsonb,
+    ADD COLUMN IF NOT EXISTS session_id text,
+    ADD COLUMN IF NOT EXISTS ip_address text,
+    ADD COLUMN IF NOT EXISTS user_agent text,
+    ADD COLUMN IF NOT EXISTS last_used_at timestamptz;
+
+-- Tokens issued before refresh tokens had a public ID get one, so they can be listed and revoked
+UPDATE refresh_tokens SET id = gen_random_uuid()::text WHERE id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_id ON refresh_tokens (id);
+
+CREATE TABLE IF NOT EXISTS mfa_enrollments (
+    user_id text PRIMARY KEY,
+    secret text NOT NULL,
+    confirmed boolean,
+    recovery_codes text[],
+    last_used_step bigint,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id text PRIMARY KEY,
+    user_id uuid NOT NULL,
+    name text,
+    public_key bytea NOT NULL,
+    attestation_type text,
+    aa_guid bytea,
+    sign_count bigint,
+    transports text[],
+    backup_eligible boolean,
+    backup_state boolean,
+    clone_warning boolean,
+    created_at timestamptz,
+    last_used_at timestamptz,
+    CONSTRAINT fk_webauthn_credentials_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text,
+    email_verified boolean,
+    raw_profile jsonb,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identity_provider_subject ON user_identities (provider, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS consent_grants (
+    user_id uuid,
+    client_id text,
+    scopes text[],
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (user_id, client_id),
+    CONSTRAINT fk_consent_grants_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS scopes (
+    name text PRIMARY KEY,
+    description text,
+    type text NOT NULL DEFAULT 'api',
+    "default" boolean,
+    consent_required boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS login_sessions (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    auth_time timestamptz,
+    amr text[],
+    acr text,
+    client_ids text[],
+    ip_address text,
+    user_agent text,
+    expires_at timestamptz,
+    last_seen_at timestamptz,
+    revoked boolean,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_login_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_login_sessions_user_id ON login_sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+    token_hash text PRIMARY KEY,
+    user_id text,
+    client_id text,
+    scope text,
+    session_id text,
+    claims jsonb,
+    expires_at timestamptz,
+    revoked boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_session_id ON access_tokens (session_id);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_client_id ON access_tokens (client_id);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user_id ON access_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS protected_resources (
+    identifier text PRIMARY KEY,
+    name text,
+    scopes text[],
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS claim_rules (
+    id bigserial PRIMARY KEY,
+    client_id text,
+    scope text,
+    claim_name text NOT NULL,
+    source text NOT NULL,
+    value text,
+    targets text[],
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_claim_rules_client_id ON claim_rules (client_id);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id uuid PRIMARY KEY,
+    client_id text,
+    name text NOT NULL,
+    description text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role_client_name ON roles (client_id, name);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id uuid PRIMARY KEY,
+    name text NOT NULL,
+    description text,
+    external_id text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_groups_external_id ON groups (external_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_name ON groups (name);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id uuid,
+    user_id uuid,
+    source text NOT NULL DEFAULT 'manual',
+    created_at timestamptz,
+    PRIMARY KEY (group_id, user_id),
+    CONSTRAINT fk_group_members_group FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    CONSTRAINT fk_group_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id uuid,
+    role_id uuid,
+    created_at timestamptz,
+    PRIMARY KEY (user_id, role_id),
+    CONSTRAINT fk_user_roles_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_roles_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_roles (
+    group_id uuid,
+    role_id uuid,
+    created_at timestamptz,
+    PRIMARY KEY (group_id, role_id),
+    CONSTRAINT fk_group_roles_group FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    CONSTRAINT fk_group_roles_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
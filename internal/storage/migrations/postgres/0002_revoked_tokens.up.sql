@@ -0,0 +1,9 @@
+-- Denylist used by TokenRepository.RevokeToken. AutoMigrate never created it;
+-- IF NOT EXISTS keeps tables created by hand from the README.
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    token_hash text PRIMARY KEY,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
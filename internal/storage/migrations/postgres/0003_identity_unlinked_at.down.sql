@@ -0,0 +1 @@
+ALTER TABLE user_identities DROP COLUMN unlinked_at;
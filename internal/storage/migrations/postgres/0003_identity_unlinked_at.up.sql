@@ -0,0 +1,4 @@
+-- Unlinking keeps the identity row so a removed Google account is not
+-- silently re-linked by email on its next login.
+
+ALTER TABLE user_identities ADD COLUMN unlinked_at timestamptz;
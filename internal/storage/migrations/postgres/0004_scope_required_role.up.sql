@@ -0,0 +1,5 @@
+-- A scope with required_role is only granted to users holding that global role.
+-- The admin scope was seeded without one, so existing rows are bound here.
+
+ALTER TABLE scopes ADD COLUMN required_role text NOT NULL DEFAULT '';
+UPDATE scopes SET required_role = 'admin' WHERE name = 'admin';
@@ -0,0 +1,238 @@
+-- SQLite version of postgres/0001_initial_schema.up.sql.
+-- Arrays are stored in their Postgres text form ({a,b}), JSON as text and timestamps as datetime text.
+
+CREATE TABLE IF NOT EXISTS users (
+    id text PRIMARY KEY,
+    email text NOT NULL,
+    email_verified boolean,
+    name text,
+    given_name text,
+    family_name text,
+    google_id text,
+    picture text,
+    disabled boolean NOT NULL DEFAULT false,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_google_id ON users (google_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS o_auth_clients (
+    client_id text PRIMARY KEY,
+    client_secret text,
+    client_name text,
+    client_type text,
+    redirect_uris text,
+    post_logout_redirect_uris text,
+    grant_types text,
+    scope text,
+    require_mfa boolean,
+    first_party boolean,
+    subject_type text DEFAULT 'public',
+    sector_identifier_uri text,
+    backchannel_logout_uri text,
+    backchannel_logout_session_required boolean,
+    frontchannel_logout_uri text,
+    frontchannel_logout_session_required boolean,
+    access_token_lifetime bigint,
+    refresh_token_lifetime bigint,
+    refresh_token_idle_lifetime bigint,
+    id_token_lifetime bigint,
+    auth_code_lifetime bigint,
+    access_token_format text,
+    resource_server boolean,
+    audiences text,
+    introspection_encryption_key text,
+    authorization_details_types text,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token text PRIMARY KEY,
+    id text,
+    user_id text,
+    client_id text,
+    scope text,
+    resources text,
+    authorization_details text,
+    session_id text,
+    ip_address text,
+    user_agent text,
+    expires_at datetime,
+    last_used_at datetime,
+    revoked boolean,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_id ON refresh_tokens (id);
+
+CREATE TABLE IF NOT EXISTS mfa_enrollments (
+    user_id text PRIMARY KEY,
+    secret text NOT NULL,
+    confirmed boolean,
+    recovery_codes text,
+    last_used_step bigint,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id text PRIMARY KEY,
+    user_id text NOT NULL,
+    name text,
+    public_key blob NOT NULL,
+    attestation_type text,
+    aa_guid blob,
+    sign_count bigint,
+    transports text,
+    backup_eligible boolean,
+    backup_state boolean,
+    clone_warning boolean,
+    created_at datetime,
+    last_used_at datetime,
+    CONSTRAINT fk_webauthn_credentials_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id text PRIMARY KEY,
+    user_id text NOT NULL,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text,
+    email_verified boolean,
+    raw_profile text,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identity_provider_subject ON user_identities (provider, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS consent_grants (
+    user_id text,
+    client_id text,
+    scopes text,
+    created_at datetime,
+    updated_at datetime,
+    PRIMARY KEY (user_id, client_id),
+    CONSTRAINT fk_consent_grants_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS scopes (
+    name text PRIMARY KEY,
+    description text,
+    type text NOT NULL DEFAULT 'api',
+    "default" boolean,
+    consent_required boolean,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS login_sessions (
+    id text PRIMARY KEY,
+    user_id text NOT NULL,
+    auth_time datetime,
+    amr text,
+    acr text,
+    client_ids text,
+    ip_address text,
+    user_agent text,
+    expires_at datetime,
+    last_seen_at datetime,
+    revoked boolean,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT fk_login_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_login_sessions_user_id ON login_sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS access_tokens (
+    token_hash text PRIMARY KEY,
+    user_id text,
+    client_id text,
+    scope text,
+    session_id text,
+    claims text,
+    expires_at datetime,
+    revoked boolean,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_session_id ON access_tokens (session_id);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_client_id ON access_tokens (client_id);
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user_id ON access_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS protected_resources (
+    identifier text PRIMARY KEY,
+    name text,
+    scopes text,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS claim_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    client_id text,
+    scope text,
+    claim_name text NOT NULL,
+    source text NOT NULL,
+    value text,
+    targets text,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_claim_rules_client_id ON claim_rules (client_id);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id text PRIMARY KEY,
+    client_id text,
+    name text NOT NULL,
+    description text,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role_client_name ON roles (client_id, name);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id text PRIMARY KEY,
+    name text NOT NULL,
+    description text,
+    external_id text,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_groups_external_id ON groups (external_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_name ON groups (name);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id text,
+    user_id text,
+    source text NOT NULL DEFAULT 'manual',
+    created_at datetime,
+    PRIMARY KEY (group_id, user_id),
+    CONSTRAINT fk_group_members_group FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    CONSTRAINT fk_group_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id text,
+    role_id text,
+    created_at datetime,
+    PRIMARY KEY (user_id, role_id),
+    CONSTRAINT fk_user_roles_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_roles_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_roles (
+    group_id text,
+    role_id text,
+    created_at datetime,
+    PRIMARY KEY (group_id, role_id),
+    CONSTRAINT fk_group_roles_group FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    CONSTRAINT fk_group_roles_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
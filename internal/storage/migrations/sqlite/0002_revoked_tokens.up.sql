@@ -0,0 +1,8 @@
+-- Denylist used by TokenRepository.RevokeToken.
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    token_hash text PRIMARY KEY,
+    expires_at datetime NOT NULL,
+    created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
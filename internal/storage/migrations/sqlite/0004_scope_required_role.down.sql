@@ -0,0 +1 @@
+ALTER TABLE scopes DROP COLUMN required_role;
@@ -0,0 +1,585 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Group membership sources
+const (
+	MembershipSourceManual = "manual" // added by an administrator
+	MembershipSourceGoogle = "google" // mirrored from Google Workspace at login
+)
+
+// AdminRole is the global role a user must hold to be granted the admin scope and use the admin API
+const AdminRole = "admin"
+
+// Role is a named permission set; roles with a client ID only apply to that client's tokens
+type Role struct {
+	ID          string
+	ClientID    string // empty applies to every client
+	Name        string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Group is a set of users; roles assigned to a group apply to all of its members
+type Group struct {
+	ID          string
+	Name        string
+	Description string
+	ExternalID  string // Google Workspace group email mirrored into this group; empty for none
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// GroupMember records that a user belongs to a group
+type GroupMember struct {
+	GroupID   string
+	UserID    string
+	Source    string // "manual" or "google"
+	CreatedAt time.Time
+}
+
+// UserRole assigns a role directly to a user
+type UserRole struct {
+	UserID    string
+	RoleID    string
+	CreatedAt time.Time
+}
+
+// GroupRole assigns a role to every member of a group
+type GroupRole struct {
+	GroupID   string
+	RoleID    string
+	CreatedAt time.Time
+}
+
+// RBACRepository stores roles, groups and their assignments
+type RBACRepository interface {
+	CreateRole(ctx context.Context, role *Role) error
+	GetRole(ctx context.Context, id string) (*Role, error)
+	ListRoles(ctx context.Context) ([]*Role, error)
+	DeleteRole(ctx context.Context, id string) error
+	CreateGroup(ctx context.Context, group *Group) error
+	GetGroup(ctx context.Context, id string) (*Group, error)
+	ListGroups(ctx context.Context) ([]*Group, error)
+	DeleteGroup(ctx context.Context, id string) error
+	AddGroupMember(ctx context.Context, groupID, userID, source string) error
+	RemoveGroupMember(ctx context.Context, groupID, userID string) error
+	ListGroupMembers(ctx context.Context, groupID string) ([]string, error)
+	ListUserGroups(ctx context.Context, userID string) ([]*Group, error)
+	SyncExternalGroups(ctx context.Context, userID string, externalIDs []string) error
+	AssignUserRole(ctx context.Context, userID, roleID string) error
+	UnassignUserRole(ctx context.Context, userID, roleID string) error
+	AssignGroupRole(ctx context.Context, groupID, roleID string) error
+	UnassignGroupRole(ctx context.Context, groupID, roleID string) error
+	ListUserRoles(ctx context.Context, userID string) ([]*Role, error)
+}
+
+// rbacRepository implements RBACRepository with database/sql
+// DB INTERACTION: All methods interact with the roles, groups, group_members, user_roles and group_roles tables
+type rbacRepository struct {
+	db *sql.DB
+}
+
+// NewRBACRepository creates a new RBAC repository
+func NewRBACRepository(db *sql.DB) RBACRepository {
+	return &rbacRepository{db: db}
+}
+
+// CreateRole inserts a new role
+// OUTPUT TO DB: Inserts row into roles table
+func (r *rbacRepository) CreateRole(ctx context.Context, role *Role) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO roles (id, client_id, name, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, role.ID, role.ClientID, role.Name, role.Description, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+
+	role.CreatedAt = now
+	role.UpdatedAt = now
+
+	return nil
+}
+
+// GetRole retrieves a role by ID
+// INPUT FROM DB: Queries roles table
+func (r *rbacRepository) GetRole(ctx context.Context, id string) (*Role, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, COALESCE(client_id, ''), name, COALESCE(description, ''), created_at, updated_at
+		FROM roles
+		WHERE id = $1
+	`
+
+	role := &Role{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&role.ID,
+		&role.ClientID,
+		&role.Name,
+		&role.Description,
+		&role.CreatedAt,
+		&role.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return role, nil
+}
+
+// ListRoles retrieves all roles, global roles first
+// INPUT FROM DB: Queries roles table
+func (r *rbacRepository) ListRoles(ctx context.Context) ([]*Role, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, COALESCE(client_id, ''), name, COALESCE(description, ''), created_at, updated_at
+		FROM roles
+		ORDER BY COALESCE(client_id, ''), name
+	`
+
+	return r.queryRoles(ctx, query)
+}
+
+// DeleteRole removes a role and its assignments
+// OUTPUT TO DB: Deletes row from roles table; assignments cascade
+func (r *rbacRepository) DeleteRole(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM roles WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("role not found")
+	}
+
+	return nil
+}
+
+// CreateGroup inserts a new group
+// OUTPUT TO DB: Inserts row into groups table
+func (r *rbacRepository) CreateGroup(ctx context.Context, group *Group) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO groups (id, name, description, external_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, group.ID, group.Name, group.Description, group.ExternalID, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+
+	group.CreatedAt = now
+	group.UpdatedAt = now
+
+	return nil
+}
+
+// GetGroup retrieves a group by ID
+// INPUT FROM DB: Queries groups table
+func (r *rbacRepository) GetGroup(ctx context.Context, id string) (*Group, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, name, COALESCE(description, ''), COALESCE(external_id, ''), created_at, updated_at
+		FROM groups
+		WHERE id = $1
+	`
+
+	group := &Group{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&group.ID,
+		&group.Name,
+		&group.Description,
+		&group.ExternalID,
+		&group.CreatedAt,
+		&group.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	return group, nil
+}
+
+// ListGroups retrieves all groups
+// INPUT FROM DB: Queries groups table
+func (r *rbacRepository) ListGroups(ctx context.Context) ([]*Group, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, name, COALESCE(description, ''), COALESCE(external_id, ''), created_at, updated_at
+		FROM groups
+		ORDER BY name
+	`
+
+	return r.queryGroups(ctx, query)
+}
+
+// DeleteGroup removes a group, its memberships and role assignments
+// OUTPUT TO DB: Deletes row from groups table; memberships and assignments cascade
+func (r *rbacRepository) DeleteGroup(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("group not found")
+	}
+
+	return nil
+}
+
+// AddGroupMember adds a user to a group; adding an existing member is a no-op
+// OUTPUT TO DB: Inserts row into group_members table
+func (r *rbacRepository) AddGroupMember(ctx context.Context, groupID, userID, source string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO group_members (group_id, user_id, source, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, groupID, userID, source, time.Now()); err != nil {
+		return fmt.Errorf("failed to add group member: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveGroupMember removes a user from a group
+// OUTPUT TO DB: Deletes row from group_members table
+func (r *rbacRepository) RemoveGroupMember(ctx context.Context, groupID, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove group member: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("group member not found")
+	}
+
+	return nil
+}
+
+// ListGroupMembers retrieves the IDs of a group's members
+// INPUT FROM DB: Queries group_members table by group ID
+func (r *rbacRepository) ListGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id FROM group_members WHERE group_id = $1 ORDER BY created_at ASC`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
+
+// ListUserGroups retrieves the groups a user belongs to
+// INPUT FROM DB: Queries groups joined with group_members by user ID
+func (r *rbacRepository) ListUserGroups(ctx context.Context, userID string) ([]*Group, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT g.id, g.name, COALESCE(g.description, ''), COALESCE(g.external_id, ''), g.created_at, g.updated_at
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1
+		ORDER BY g.name
+	`
+
+	return r.queryGroups(ctx, query, userID)
+}
+
+// SyncExternalGroups makes the user's Google memberships match the given Workspace group emails
+// Only groups with a matching external_id are joined; memberships added by an administrator are kept
+// OUTPUT TO DB: Deletes and inserts group_members rows in one transaction
+func (r *rbacRepository) SyncExternalGroups(ctx context.Context, userID string, externalIDs []string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The groups are matched here rather than with an array parameter so the queries run on every dialect
+	matching, err := externalGroupIDs(ctx, tx, externalIDs)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT group_id FROM group_members WHERE user_id = $1 AND source = $2`, userID, MembershipSourceGoogle)
+	if err != nil {
+		return fmt.Errorf("failed to list group memberships: %w", err)
+	}
+	var stale []string
+	for rows.Next() {
+		var groupID string
+		if err := rows.Scan(&groupID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan group membership: %w", err)
+		}
+		if !matching[groupID] {
+			stale = append(stale, groupID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list group memberships: %w", err)
+	}
+
+	for _, groupID := range stale {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`, groupID, userID); err != nil {
+			return fmt.Errorf("failed to remove stale group memberships: %w", err)
+		}
+	}
+
+	add := `
+		INSERT INTO group_members (group_id, user_id, source, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`
+	now := time.Now()
+	for groupID := range matching {
+		if _, err := tx.ExecContext(ctx, add, groupID, userID, MembershipSourceGoogle, now); err != nil {
+			return fmt.Errorf("failed to add group memberships: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// externalGroupIDs returns the IDs of the groups whose external_id is one of externalIDs
+// INPUT FROM DB: Queries groups table
+func externalGroupIDs(ctx context.Context, tx *sql.Tx, externalIDs []string) (map[string]bool, error) {
+	wanted := make(map[string]bool, len(externalIDs))
+	for _, externalID := range externalIDs {
+		wanted[externalID] = true
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, external_id FROM groups WHERE COALESCE(external_id, '') <> ''`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list external groups: %w", err)
+	}
+	defer rows.Close()
+
+	matching := make(map[string]bool)
+	for rows.Next() {
+		var id, externalID string
+		if err := rows.Scan(&id, &externalID); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		if wanted[externalID] {
+			matching[id] = true
+		}
+	}
+	return matching, rows.Err()
+}
+
+// AssignUserRole assigns a role directly to a user; assigning it twice is a no-op
+// OUTPUT TO DB: Inserts row into user_roles table
+func (r *rbacRepository) AssignUserRole(ctx context.Context, userID, roleID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_roles (user_id, role_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role_id) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, roleID, time.Now()); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	return nil
+}
+
+// UnassignUserRole removes a role assigned directly to a user
+// OUTPUT TO DB: Deletes row from user_roles table
+func (r *rbacRepository) UnassignUserRole(ctx context.Context, userID, roleID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`, userID, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to unassign role: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("role assignment not found")
+	}
+
+	return nil
+}
+
+// AssignGroupRole assigns a role to a group; assigning it twice is a no-op
+// OUTPUT TO DB: Inserts row into group_roles table
+func (r *rbacRepository) AssignGroupRole(ctx context.Context, groupID, roleID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO group_roles (group_id, role_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, role_id) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, groupID, roleID, time.Now()); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	return nil
+}
+
+// UnassignGroupRole removes a role from a group
+// OUTPUT TO DB: Deletes row from group_roles table
+func (r *rbacRepository) UnassignGroupRole(ctx context.Context, groupID, roleID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM group_roles WHERE group_id = $1 AND role_id = $2`, groupID, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to unassign role: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("role assignment not found")
+	}
+
+	return nil
+}
+
+// ListUserRoles retrieves the roles a user holds, directly or through a group, for every client
+// INPUT FROM DB: Queries roles joined with user_roles, group_roles and group_members by user ID
+func (r *rbacRepository) ListUserRoles(ctx context.Context, userID string) ([]*Role, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, COALESCE(client_id, ''), name, COALESCE(description, ''), created_at, updated_at
+		FROM roles
+		WHERE id IN (
+			SELECT role_id FROM user_roles WHERE user_id = $1
+			UNION
+			SELECT gr.role_id FROM group_roles gr
+			JOIN group_members m ON m.group_id = gr.group_id
+			WHERE m.user_id = $1
+		)
+		ORDER BY COALESCE(client_id, ''), name
+	`
+
+	return r.queryRoles(ctx, query, userID)
+}
+
+// queryRoles runs a query selecting role columns and scans the rows
+func (r *rbacRepository) queryRoles(ctx context.Context, query string, args ...interface{}) ([]*Role, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		role := &Role{}
+		err := rows.Scan(
+			&role.ID,
+			&role.ClientID,
+			&role.Name,
+			&role.Description,
+			&role.CreatedAt,
+			&role.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// queryGroups runs a query selecting group columns and scans the rows
+func (r *rbacRepository) queryGroups(ctx context.Context, query string, args ...interface{}) ([]*Group, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []*Group
+	for rows.Next() {
+		group := &Group{}
+		err := rows.Scan(
+			&group.ID,
+			&group.Name,
+			&group.Description,
+			&group.ExternalID,
+			&group.CreatedAt,
+			&group.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
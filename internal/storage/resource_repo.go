@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ProtectedResource represents an API clients may request access tokens for (RFC 8707)
+// Its Identifier is the value of the "resource" parameter and becomes the access token "aud"
+type ProtectedResource struct {
+	Identifier string // absolute URI without a fragment, e.g. https://api.example.com
+	Name       string // shown to the user on the consent screen
+	// Scopes are the scopes meaningful at this resource; access tokens for it carry no others
+	// Empty means any granted scope is passed through
+	Scopes    pq.StringArray
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AllowsScope reports whether an access token for this resource may carry the given scope
+func (r *ProtectedResource) AllowsScope(scope string) bool {
+	if len(r.Scopes) == 0 {
+		return true
+	}
+	for _, allowed := range r.Scopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceRepository stores the protected resources clients may request tokens for
+type ResourceRepository interface {
+	GetProtectedResource(ctx context.Context, identifier string) (*ProtectedResource, error)
+	ListProtectedResources(ctx context.Context) ([]*ProtectedResource, error)
+}
+
+// resourceRepository implements ResourceRepository with database/sql
+// DB INTERACTION: All methods interact with the protected_resources table
+type resourceRepository struct {
+	db *sql.DB
+}
+
+// NewResourceRepository creates a new protected resource repository
+func NewResourceRepository(db *sql.DB) ResourceRepository {
+	return &resourceRepository{db: db}
+}
+
+// GetProtectedResource retrieves a protected resource by identifier
+// Returns nil if the resource is not registered
+// INPUT FROM DB: Queries protected_resources table by identifier
+func (r *resourceRepository) GetProtectedResource(ctx context.Context, identifier string) (*ProtectedResource, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT identifier, COALESCE(name, ''), scopes, created_at, updated_at
+		FROM protected_resources
+		WHERE identifier = $1
+	`
+
+	resource := &ProtectedResource{}
+	err := r.db.QueryRowContext(ctx, query, identifier).Scan(
+		&resource.Identifier,
+		&resource.Name,
+		&resource.Scopes,
+		&resource.CreatedAt,
+		&resource.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get protected resource: %w", err)
+	}
+
+	return resource, nil
+}
+
+// ListProtectedResources retrieves all registered protected resources
+// INPUT FROM DB: Queries protected_resources table
+func (r *resourceRepository) ListProtectedResources(ctx context.Context) ([]*ProtectedResource, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT identifier, COALESCE(name, ''), scopes, created_at, updated_at
+		FROM protected_resources
+		ORDER BY identifier
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list protected resources: %w", err)
+	}
+	defer rows.Close()
+
+	var resources []*ProtectedResource
+	for rows.Next() {
+		resource := &ProtectedResource{}
+		err := rows.Scan(
+			&resource.Identifier,
+			&resource.Name,
+			&resource.Scopes,
+			&resource.CreatedAt,
+			&resource.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan protected resource: %w", err)
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, rows.Err()
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Scope types
+const (
+	ScopeTypeOIDC = "oidc" // identity scopes defined by OpenID Connect
+	ScopeTypeAPI  = "api"  // scopes protecting our own APIs
+)
+
+// Scope represents a scope clients may request
+type Scope struct {
+	Name            string
+	Description     string // shown to the user on the consent screen
+	Type            string // "oidc" or "api"
+	Default         bool   // granted when a request has no scope parameter
+	ConsentRequired bool   // the user must approve this scope for third-party clients
+	RequiredRole    string // global role a user must hold to be granted this scope; empty for none
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// ScopeRepository stores the scopes clients may request
+type ScopeRepository interface {
+	GetScope(ctx context.Context, name string) (*Scope, error)
+	ListScopes(ctx context.Context) ([]*Scope, error)
+	CreateScope(ctx context.Context, scope *Scope) error
+}
+
+// scopeRepository implements ScopeRepository with database/sql
+// DB INTERACTION: All methods interact with the scopes table
+type scopeRepository struct {
+	db *sql.DB
+}
+
+// NewScopeRepository creates a new scope repository
+func NewScopeRepository(db *sql.DB) ScopeRepository {
+	return &scopeRepository{db: db}
+}
+
+// GetScope retrieves a scope by name
+// Returns nil if the scope is not registered
+// INPUT FROM DB: Queries scopes table by name
+func (r *scopeRepository) GetScope(ctx context.Context, name string) (*Scope, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT name, COALESCE(description, ''), type, COALESCE("default", false), COALESCE(consent_required, false), required_role, created_at, updated_at
+		FROM scopes
+		WHERE name = $1
+	`
+
+	scope := &Scope{}
+	err := r.db.QueryRowContext(ctx, query, name).Scan(
+		&scope.Name,
+		&scope.Description,
+		&scope.Type,
+		&scope.Default,
+		&scope.ConsentRequired,
+		&scope.RequiredRole,
+		&scope.CreatedAt,
+		&scope.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scope: %w", err)
+	}
+
+	return scope, nil
+}
+
+// ListScopes retrieves all registered scopes
+// INPUT FROM DB: Queries scopes table
+func (r *scopeRepository) ListScopes(ctx context.Context) ([]*Scope, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT name, COALESCE(description, ''), type, COALESCE("default", false), COALESCE(consent_required, false), required_role, created_at, updated_at
+		FROM scopes
+		ORDER BY name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scopes: %w", err)
+	}
+	defer rows.Close()
+
+	var scopes []*Scope
+	for rows.Next() {
+		scope := &Scope{}
+		err := rows.Scan(
+			&scope.Name,
+			&scope.Description,
+			&scope.Type,
+			&scope.Default,
+			&scope.ConsentRequired,
+			&scope.RequiredRole,
+			&scope.CreatedAt,
+			&scope.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scope: %w", err)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, rows.Err()
+}
+
+// CreateScope registers a scope
+// OUTPUT TO DB: Inserts scope into scopes table
+func (r *scopeRepository) CreateScope(ctx context.Context, scope *Scope) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO scopes (name, description, type, "default", consent_required, required_role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+	`
+
+	if scope.Type == "" {
+		scope.Type = ScopeTypeAPI
+	}
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, scope.Name, scope.Description, scope.Type, scope.Default, scope.ConsentRequired, scope.RequiredRole, now)
+	if err != nil {
+		return fmt.Errorf("failed to create scope: %w", err)
+	}
+
+	scope.CreatedAt = now
+	scope.UpdatedAt = now
+
+	return nil
+}
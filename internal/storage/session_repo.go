@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// LoginSession represents a user's single sign-on session at the authorization server
+type LoginSession struct {
+	ID         string
+	UserID     string
+	AuthTime   time.Time      // when the user last actively authenticated
+	AMR        pq.StringArray // authentication methods references (RFC 8176)
+	ACR        string
+	ClientIDs  pq.StringArray // clients that obtained tokens under this session
+	IPAddress  string
+	UserAgent  string
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+	Revoked    bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SessionRepository stores login sessions
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *LoginSession) error
+	GetSession(ctx context.Context, id string) (*LoginSession, error)
+	ListActiveByUser(ctx context.Context, userID string) ([]*LoginSession, error)
+	AddClient(ctx context.Context, id, clientID string) error
+	TouchSession(ctx context.Context, id string) error
+	RevokeSession(ctx context.Context, id string) error
+}
+
+// sessionRepository implements SessionRepository with database/sql
+// DB INTERACTION: All methods interact with the login_sessions table
+type sessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+// CreateSession stores a new login session
+// OUTPUT TO DB: Inserts session into login_sessions table
+func (r *sessionRepository) CreateSession(ctx context.Context, session *LoginSession) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO login_sessions (id, user_id, auth_time, amr, acr, ip_address, user_agent, expires_at, last_seen_at, revoked, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx,
+		query,
+		session.ID,
+		session.UserID,
+		session.AuthTime,
+		session.AMR,
+		session.ACR,
+		session.IPAddress,
+		session.UserAgent,
+		session.ExpiresAt,
+		now,
+		false,
+		now,
+		now,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	session.LastSeenAt = now
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	return nil
+}
+
+// GetSession retrieves a login session by ID
+// INPUT FROM DB: Queries login_sessions table
+func (r *sessionRepository) GetSession(ctx context.Context, id string) (*LoginSession, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, auth_time, amr, acr, client_ids, ip_address, user_agent, expires_at, last_seen_at, revoked, created_at, updated_at
+		FROM login_sessions
+		WHERE id = $1
+	`
+
+	session := &LoginSession{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.AuthTime,
+		&session.AMR,
+		&session.ACR,
+		&session.ClientIDs,
+		&session.IPAddress,
+		&session.UserAgent,
+		&session.ExpiresAt,
+		&session.LastSeenAt,
+		&session.Revoked,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// ListActiveByUser retrieves the sessions of a user that are neither revoked nor expired
+// INPUT FROM DB: Queries login_sessions table by user ID
+func (r *sessionRepository) ListActiveByUser(ctx context.Context, userID string) ([]*LoginSession, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, auth_time, amr, acr, client_ids, ip_address, user_agent, expires_at, last_seen_at, revoked, created_at, updated_at
+		FROM login_sessions
+		WHERE user_id = $1 AND revoked = false AND expires_at > $2
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*LoginSession
+	for rows.Next() {
+		session := &LoginSession{}
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.AuthTime,
+			&session.AMR,
+			&session.ACR,
+			&session.ClientIDs,
+			&session.IPAddress,
+			&session.UserAgent,
+			&session.ExpiresAt,
+			&session.LastSeenAt,
+			&session.Revoked,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// AddClient records that a client obtained tokens under a session
+// The list is compared and swapped so concurrent calls for the same session do not lose a client
+// OUTPUT TO DB: Appends client ID to login_sessions.client_ids if not already present
+func (r *sessionRepository) AddClient(ctx context.Context, id, clientID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE login_sessions
+		SET client_ids = $2, updated_at = $3
+		WHERE id = $1 AND client_ids IS NOT DISTINCT FROM $4
+	`
+
+	for attempt := 0; attempt < 3; attempt++ {
+		var clientIDs pq.StringArray
+		err := r.db.QueryRowContext(ctx, `SELECT client_ids FROM login_sessions WHERE id = $1`, id).Scan(&clientIDs)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add client to session: %w", err)
+		}
+		if slices.Contains(clientIDs, clientID) {
+			return nil
+		}
+
+		updated := append(append(pq.StringArray{}, clientIDs...), clientID)
+		result, err := r.db.ExecContext(ctx, query, id, updated, time.Now(), clientIDs)
+		if err != nil {
+			return fmt.Errorf("failed to add client to session: %w", err)
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to add client to session: session kept changing")
+}
+
+// TouchSession records that a session was just used
+// OUTPUT TO DB: Updates last_seen_at in login_sessions table
+func (r *sessionRepository) TouchSession(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `UPDATE login_sessions SET last_seen_at = $2, updated_at = $2 WHERE id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, id, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeSession ends a login session
+// OUTPUT TO DB: Updates revoked flag in login_sessions table
+func (r *sessionRepository) RevokeSession(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `UPDATE login_sessions SET revoked = true, updated_at = $2 WHERE id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, id, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriverName is the database/sql name of sqliteDriver
+const sqliteDriverName = "oauth-sqlite"
+
+func init() {
+	sql.Register(sqliteDriverName, sqliteDriver{})
+}
+
+// openSQLite opens a SQLite database; dsn is a file path or ":memory:", optionally with driver parameters
+// Foreign keys are enabled for the cascades the schema relies on. Everything runs on one connection:
+// SQLite has a single writer anyway, and an in-memory database only exists on the connection that created it.
+func openSQLite(dsn string) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	dsn += separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+
+	db, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	return db, nil
+}
+
+// sqliteDriver wraps the pure Go SQLite driver so every time is written in UTC
+// SQLite compares timestamps as text, which only orders correctly when they share an offset
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := (&sqlite.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn.(sqliteDriverConn)}, nil
+}
+
+// sqliteDriverConn is what the SQLite driver's connections implement and sqliteConn passes through
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// sqliteConn is a SQLite connection converting time arguments to UTC
+type sqliteConn struct {
+	sqliteDriverConn
+}
+
+// CheckNamedValue converts times to UTC and leaves every other argument to the default conversion
+func (c *sqliteConn) CheckNamedValue(value *driver.NamedValue) error {
+	if t, ok := value.Value.(time.Time); ok {
+		value.Value = t.UTC()
+		return nil
+	}
+	return driver.ErrSkip
+}
@@ -1,52 +1,113 @@
 package storage
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // RefreshToken represents a refresh token in the database
 type RefreshToken struct {
-	Token     string `gorm:"primaryKey"`
+	Token     string
+	ID        string // public identifier; the token itself is never listed
+	UserID    string
+	ClientID  string
+	Scope     string
+	Resources pq.StringArray // resources authorized for the grant (RFC 8707)
+	// AuthorizationDetails is the JSON authorization_details authorized for the grant (RFC 9396)
+	AuthorizationDetails string
+	SessionID            string // SSO session the token was issued under, if any
+	IPAddress            string // where the token was requested from
+	UserAgent            string
+	ExpiresAt            time.Time
+	LastUsedAt           *time.Time
+	Revoked              bool
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+// AccessToken records an issued access token: an opaque reference, or a JWT kept for revocation
+// Only the SHA-256 of the token is stored; Claims holds the JSON claims it stands for
+type AccessToken struct {
+	TokenHash string
 	UserID    string
 	ClientID  string
 	Scope     string
+	SessionID string
+	Claims    string
 	ExpiresAt time.Time
 	Revoked   bool
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
-// TokenRepository handles database operations for tokens
-// DB INTERACTION: All methods interact with refresh_tokens and revoked_tokens tables
-type TokenRepository struct {
+// TokenRepository stores tokens
+type TokenRepository interface {
+	StoreRefreshToken(ctx context.Context, rt *RefreshToken) error
+	StoreAccessToken(ctx context.Context, token string, at *AccessToken) error
+	GetAccessToken(ctx context.Context, token string) (*AccessToken, error)
+	RevokeAccessToken(ctx context.Context, token string) error
+	RevokeClientAccessTokens(ctx context.Context, userID, clientID string) error
+	RevokeSessionAccessTokens(ctx context.Context, sessionID string) error
+	RevokeUserAccessTokens(ctx context.Context, userID string) error
+	RevokeAllClientAccessTokens(ctx context.Context, clientID string) error
+	DeleteExpiredAccessTokens(ctx context.Context) error
+	GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error)
+	ListActiveByUser(ctx context.Context, userID string) ([]*RefreshToken, error)
+	TouchRefreshToken(ctx context.Context, token, ipAddress, userAgent string) error
+	RevokeRefreshTokenByID(ctx context.Context, userID, id string) error
+	RevokeRefreshToken(ctx context.Context, token string) error
+	RevokeClientRefreshTokens(ctx context.Context, userID, clientID string) error
+	RevokeSessionRefreshTokens(ctx context.Context, sessionID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+	RevokeAllClientRefreshTokens(ctx context.Context, clientID string) error
+	DeleteExpiredRefreshTokens(ctx context.Context) error
+	RevokeToken(ctx context.Context, token string, ttl time.Duration) error
+	IsTokenRevoked(ctx context.Context, token string) (bool, error)
+	DeleteExpiredRevokedTokens(ctx context.Context) error
+}
+
+// tokenRepository implements TokenRepository with database/sql
+// DB INTERACTION: All methods interact with refresh_tokens, access_tokens and revoked_tokens tables
+type tokenRepository struct {
 	db *sql.DB
 }
 
 // NewTokenRepository creates a new token repository
-func NewTokenRepository(db *sql.DB) *TokenRepository {
-	return &TokenRepository{db: db}
+func NewTokenRepository(db *sql.DB) TokenRepository {
+	return &tokenRepository{db: db}
 }
 
 // StoreRefreshToken stores a refresh token
 // OUTPUT TO DB: Inserts token into refresh_tokens table
-func (r *TokenRepository) StoreRefreshToken(token, userID string, expiresAt time.Time) error {
+func (r *tokenRepository) StoreRefreshToken(ctx context.Context, rt *RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
-		INSERT INTO refresh_tokens (token, user_id, client_id, scope, expires_at, revoked, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO refresh_tokens (token, id, user_id, client_id, scope, resources, authorization_details, session_id, ip_address, user_agent, expires_at, revoked, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 
 	now := time.Now()
-	_, err := r.db.Exec(
+	_, err := r.db.ExecContext(ctx,
 		query,
-		token,
-		userID,
-		"oauth-service",
-		"openid email profile",
-		expiresAt,
+		rt.Token,
+		rt.ID,
+		rt.UserID,
+		rt.ClientID,
+		rt.Scope,
+		rt.Resources,
+		nullableJSON(rt.AuthorizationDetails),
+		rt.SessionID,
+		rt.IPAddress,
+		rt.UserAgent,
+		rt.ExpiresAt,
 		false,
 		now,
 		now,
@@ -56,33 +117,214 @@ func (r *TokenRepository) StoreRefreshToken(token, userID string, expiresAt time
 		return fmt.Errorf("failed to store refresh token: %w", err)
 	}
 
+	rt.CreatedAt = now
+	rt.UpdatedAt = now
+
 	return nil
 }
 
-// GetRefreshToken retrieves a refresh token
-// INPUT FROM DB: Queries refresh_tokens table
-func (r *TokenRepository) GetRefreshToken(token string) (*RefreshToken, error) {
+// StoreAccessToken stores an access token under its hash
+// OUTPUT TO DB: Inserts token into access_tokens table
+func (r *tokenRepository) StoreAccessToken(ctx context.Context, token string, at *AccessToken) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT token, user_id, client_id, scope, expires_at, revoked, created_at, updated_at
-		FROM refresh_tokens
-		WHERE token = $1
+		INSERT INTO access_tokens (token_hash, user_id, client_id, scope, session_id, claims, expires_at, revoked, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
-	rt := &RefreshToken{}
-	err := r.db.QueryRow(query, token).Scan(
-		&rt.Token,
-		&rt.UserID,
-		&rt.ClientID,
-		&rt.Scope,
-		&rt.ExpiresAt,
-		&rt.Revoked,
-		&rt.CreatedAt,
-		&rt.UpdatedAt,
+	now := time.Now()
+	at.TokenHash = hashToken(token)
+	_, err := r.db.ExecContext(ctx,
+		query,
+		at.TokenHash,
+		at.UserID,
+		at.ClientID,
+		at.Scope,
+		at.SessionID,
+		at.Claims,
+		at.ExpiresAt,
+		false,
+		now,
+		now,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to store access token: %w", err)
+	}
+
+	at.CreatedAt = now
+	at.UpdatedAt = now
+
+	return nil
+}
+
+// GetAccessToken retrieves an access token by the token value; returns nil if unknown
+// INPUT FROM DB: Queries access_tokens table by token hash
+func (r *tokenRepository) GetAccessToken(ctx context.Context, token string) (*AccessToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT token_hash, user_id, client_id, scope, COALESCE(session_id, ''), claims, expires_at, revoked, created_at, updated_at
+		FROM access_tokens
+		WHERE token_hash = $1
+	`
+
+	at := &AccessToken{}
+	err := r.db.QueryRowContext(ctx, query, hashToken(token)).Scan(
+		&at.TokenHash,
+		&at.UserID,
+		&at.ClientID,
+		&at.Scope,
+		&at.SessionID,
+		&at.Claims,
+		&at.ExpiresAt,
+		&at.Revoked,
+		&at.CreatedAt,
+		&at.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	return at, nil
+}
+
+// RevokeAccessToken revokes an access token; it stops resolving immediately
+// OUTPUT TO DB: Updates revoked flag in access_tokens table
+func (r *tokenRepository) RevokeAccessToken(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE access_tokens
+		SET revoked = true, updated_at = $2
+		WHERE token_hash = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, hashToken(token), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeClientAccessTokens revokes every access token a client holds for a user
+// OUTPUT TO DB: Updates revoked flag in access_tokens table
+func (r *tokenRepository) RevokeClientAccessTokens(ctx context.Context, userID, clientID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE access_tokens
+		SET revoked = true, updated_at = $3
+		WHERE user_id = $1 AND client_id = $2 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, clientID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeSessionAccessTokens revokes every access token issued under an SSO session
+// OUTPUT TO DB: Updates revoked flag in access_tokens table
+func (r *tokenRepository) RevokeSessionAccessTokens(ctx context.Context, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE access_tokens
+		SET revoked = true, updated_at = $2
+		WHERE session_id = $1 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, sessionID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserAccessTokens revokes every access token issued for a user
+// OUTPUT TO DB: Updates revoked flag in access_tokens table
+func (r *tokenRepository) RevokeUserAccessTokens(ctx context.Context, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE access_tokens
+		SET revoked = true, updated_at = $2
+		WHERE user_id = $1 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke user access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllClientAccessTokens revokes every access token issued to a client, for all users
+// OUTPUT TO DB: Updates revoked flag in access_tokens table
+func (r *tokenRepository) RevokeAllClientAccessTokens(ctx context.Context, clientID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE access_tokens
+		SET revoked = true, updated_at = $2
+		WHERE client_id = $1 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, clientID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke client access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredAccessTokens deletes expired access tokens
+// OUTPUT TO DB: Deletes expired tokens from access_tokens table
+func (r *tokenRepository) DeleteExpiredAccessTokens(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM access_tokens WHERE expires_at < $1`
+
+	_, err := r.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired access tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token
+// INPUT FROM DB: Queries refresh_tokens table
+func (r *tokenRepository) GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE token = $1
+	`
+
+	rt, err := scanRefreshToken(r.db.QueryRowContext(ctx, query, token))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get refresh token: %w", err)
 	}
@@ -90,16 +332,94 @@ func (r *TokenRepository) GetRefreshToken(token string) (*RefreshToken, error) {
 	return rt, nil
 }
 
+// ListActiveByUser retrieves a user's refresh tokens that are neither revoked nor expired
+// INPUT FROM DB: Queries refresh_tokens table by user ID
+func (r *tokenRepository) ListActiveByUser(ctx context.Context, userID string) ([]*RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE user_id = $1 AND revoked = false AND expires_at > $2
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refresh tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*RefreshToken
+	for rows.Next() {
+		rt, err := scanRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, rt)
+	}
+
+	return tokens, nil
+}
+
+// TouchRefreshToken records that a refresh token was just used and from where
+// OUTPUT TO DB: Updates last_used_at, ip_address and user_agent in refresh_tokens table
+func (r *tokenRepository) TouchRefreshToken(ctx context.Context, token, ipAddress, userAgent string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE refresh_tokens
+		SET last_used_at = $2, ip_address = $3, user_agent = $4, updated_at = $2
+		WHERE token = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, token, time.Now(), ipAddress, userAgent)
+	if err != nil {
+		return fmt.Errorf("failed to touch refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenByID revokes one of a user's refresh tokens by its public ID
+// OUTPUT TO DB: Updates revoked flag in refresh_tokens table
+func (r *tokenRepository) RevokeRefreshTokenByID(ctx context.Context, userID, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked = true, updated_at = $3
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("refresh token not found")
+	}
+
+	return nil
+}
+
 // RevokeRefreshToken marks a refresh token as revoked
 // OUTPUT TO DB: Updates revoked flag in refresh_tokens table
-func (r *TokenRepository) RevokeRefreshToken(token string) error {
+func (r *tokenRepository) RevokeRefreshToken(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
 		UPDATE refresh_tokens
 		SET revoked = true, updated_at = $2
 		WHERE token = $1
 	`
 
-	_, err := r.db.Exec(query, token, time.Now())
+	_, err := r.db.ExecContext(ctx, query, token, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to revoke refresh token: %w", err)
 	}
@@ -107,12 +427,95 @@ func (r *TokenRepository) RevokeRefreshToken(token string) error {
 	return nil
 }
 
+// RevokeClientRefreshTokens revokes every refresh token a client holds for a user
+// OUTPUT TO DB: Updates revoked flag in refresh_tokens table
+func (r *tokenRepository) RevokeClientRefreshTokens(ctx context.Context, userID, clientID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked = true, updated_at = $3
+		WHERE user_id = $1 AND client_id = $2 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, clientID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke client refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeSessionRefreshTokens revokes every refresh token issued under an SSO session
+// OUTPUT TO DB: Updates revoked flag in refresh_tokens table
+func (r *tokenRepository) RevokeSessionRefreshTokens(ctx context.Context, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked = true, updated_at = $2
+		WHERE session_id = $1 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, sessionID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke session refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token a user holds
+// OUTPUT TO DB: Updates revoked flag in refresh_tokens table
+func (r *tokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked = true, updated_at = $2
+		WHERE user_id = $1 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke user refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllClientRefreshTokens revokes every refresh token issued to a client, for all users
+// OUTPUT TO DB: Updates revoked flag in refresh_tokens table
+func (r *tokenRepository) RevokeAllClientRefreshTokens(ctx context.Context, clientID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked = true, updated_at = $2
+		WHERE client_id = $1 AND revoked = false
+	`
+
+	_, err := r.db.ExecContext(ctx, query, clientID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to revoke client refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
 // DeleteExpiredRefreshTokens deletes expired refresh tokens
 // OUTPUT TO DB: Deletes expired tokens from refresh_tokens table
-func (r *TokenRepository) DeleteExpiredRefreshTokens() error {
+func (r *tokenRepository) DeleteExpiredRefreshTokens(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `DELETE FROM refresh_tokens WHERE expires_at < $1`
 
-	_, err := r.db.Exec(query, time.Now())
+	_, err := r.db.ExecContext(ctx, query, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to delete expired refresh tokens: %w", err)
 	}
@@ -122,7 +525,10 @@ func (r *TokenRepository) DeleteExpiredRefreshTokens() error {
 
 // RevokeToken adds a token to the revoked tokens list (blacklist)
 // OUTPUT TO DB: Inserts token hash into revoked_tokens table
-func (r *TokenRepository) RevokeToken(token string, ttl time.Duration) error {
+func (r *tokenRepository) RevokeToken(ctx context.Context, token string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	// Hash the token before storing for privacy
 	tokenHash := hashToken(token)
 	expiresAt := time.Now().Add(ttl)
@@ -133,7 +539,7 @@ func (r *TokenRepository) RevokeToken(token string, ttl time.Duration) error {
 		ON CONFLICT (token_hash) DO NOTHING
 	`
 
-	_, err := r.db.Exec(query, tokenHash, expiresAt, time.Now())
+	_, err := r.db.ExecContext(ctx, query, tokenHash, expiresAt, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to revoke token: %w", err)
 	}
@@ -143,7 +549,10 @@ func (r *TokenRepository) RevokeToken(token string, ttl time.Duration) error {
 
 // IsTokenRevoked checks if a token is revoked
 // INPUT FROM DB: Queries revoked_tokens table
-func (r *TokenRepository) IsTokenRevoked(token string) (bool, error) {
+func (r *tokenRepository) IsTokenRevoked(ctx context.Context, token string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	tokenHash := hashToken(token)
 
 	query := `
@@ -154,7 +563,7 @@ func (r *TokenRepository) IsTokenRevoked(token string) (bool, error) {
 	`
 
 	var exists bool
-	err := r.db.QueryRow(query, tokenHash, time.Now()).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check if token is revoked: %w", err)
 	}
@@ -164,10 +573,13 @@ func (r *TokenRepository) IsTokenRevoked(token string) (bool, error) {
 
 // DeleteExpiredRevokedTokens deletes expired entries from revoked tokens
 // OUTPUT TO DB: Deletes expired tokens from revoked_tokens table
-func (r *TokenRepository) DeleteExpiredRevokedTokens() error {
+func (r *tokenRepository) DeleteExpiredRevokedTokens(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `DELETE FROM revoked_tokens WHERE expires_at < $1`
 
-	_, err := r.db.Exec(query, time.Now())
+	_, err := r.db.ExecContext(ctx, query, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to delete expired revoked tokens: %w", err)
 	}
@@ -175,37 +587,58 @@ func (r *TokenRepository) DeleteExpiredRevokedTokens() error {
 	return nil
 }
 
-// GetUserByID retrieves a user by ID (helper method)
-// INPUT FROM DB: Queries users table
-func (r *TokenRepository) GetUserByID(userID string) (*User, error) {
-	query := `
-		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
+// refreshTokenColumns lists the refresh_tokens columns in the order scanRefreshToken reads them
+// Columns added after the table was first created may be NULL on older rows
+const refreshTokenColumns = `token, COALESCE(id, ''), user_id, client_id, scope, resources, COALESCE(CAST(authorization_details AS text), ''), COALESCE(session_id, ''),
+		COALESCE(ip_address, ''), COALESCE(user_agent, ''), expires_at, last_used_at, revoked, created_at, updated_at`
+
+// nullableJSON stores an empty JSON column as NULL; jsonb does not accept the empty string
+func nullableJSON(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
 
-	user := &User{}
-	err := r.db.QueryRow(query, userID).Scan(
-		&user.ID,
-		&user.Email,
-		&user.EmailVerified,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.GoogleID,
-		&user.CreatedAt,
-		&user.UpdatedAt,
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRefreshToken reads one refresh token row; returns nil if there is no row
+func scanRefreshToken(row rowScanner) (*RefreshToken, error) {
+	rt := &RefreshToken{}
+	var lastUsedAt sql.NullTime
+	err := row.Scan(
+		&rt.Token,
+		&rt.ID,
+		&rt.UserID,
+		&rt.ClientID,
+		&rt.Scope,
+		&rt.Resources,
+		&rt.AuthorizationDetails,
+		&rt.SessionID,
+		&rt.IPAddress,
+		&rt.UserAgent,
+		&rt.ExpiresAt,
+		&lastUsedAt,
+		&rt.Revoked,
+		&rt.CreatedAt,
+		&rt.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, fmt.Errorf("failed to scan refresh token: %w", err)
 	}
 
-	return user, nil
+	if lastUsedAt.Valid {
+		rt.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return rt, nil
 }
 
 // hashToken creates a SHA-256 hash of a token
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -8,40 +9,56 @@ import (
 
 // User represents a user in the database
 type User struct {
-	ID            string `gorm:"primaryKey;type:uuid"`
-	Email         string `gorm:"uniqueIndex;not null"`
+	ID            string
+	Email         string
 	EmailVerified bool
 	Name          string
 	GivenName     string
 	FamilyName    string
-	GoogleID      string `gorm:"uniqueIndex"`
+	GoogleID      string
 	Picture       string
+	Disabled      bool // disabled users cannot sign in or use their tokens
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
 
-// UserRepository handles database operations for users
+// UserRepository stores users
+type UserRepository interface {
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByGoogleID(ctx context.Context, googleID string) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id string) error
+	ListUsers(ctx context.Context, search string, limit, offset int) ([]*User, error)
+	SetDisabled(ctx context.Context, id string, disabled bool) error
+}
+
+// userRepository implements UserRepository with database/sql
 // DB INTERACTION: All methods interact with the users table
-type UserRepository struct {
+type userRepository struct {
 	db *sql.DB
 }
 
 // NewUserRepository creates a new user repository
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sql.DB) UserRepository {
+	return &userRepository{db: db}
 }
 
 // GetUserByID retrieves a user by ID
 // INPUT FROM DB: Queries users table by ID
-func (r *UserRepository) GetUserByID(id string) (*User, error) {
+func (r *userRepository) GetUserByID(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, created_at, updated_at
+		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, disabled, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
 
 	user := &User{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
 		&user.EmailVerified,
@@ -50,6 +67,7 @@ func (r *UserRepository) GetUserByID(id string) (*User, error) {
 		&user.FamilyName,
 		&user.Picture,
 		&user.GoogleID,
+		&user.Disabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -66,15 +84,18 @@ func (r *UserRepository) GetUserByID(id string) (*User, error) {
 
 // GetUserByEmail retrieves a user by email
 // INPUT FROM DB: Queries users table by email
-func (r *UserRepository) GetUserByEmail(email string) (*User, error) {
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, created_at, updated_at
+		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, disabled, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
 
 	user := &User{}
-	err := r.db.QueryRow(query, email).Scan(
+	err := r.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.EmailVerified,
@@ -83,6 +104,7 @@ func (r *UserRepository) GetUserByEmail(email string) (*User, error) {
 		&user.FamilyName,
 		&user.Picture,
 		&user.GoogleID,
+		&user.Disabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -99,15 +121,18 @@ func (r *UserRepository) GetUserByEmail(email string) (*User, error) {
 
 // GetUserByGoogleID retrieves a user by Google ID
 // INPUT FROM DB: Queries users table by google_id
-func (r *UserRepository) GetUserByGoogleID(googleID string) (*User, error) {
+func (r *userRepository) GetUserByGoogleID(ctx context.Context, googleID string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, created_at, updated_at
+		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, disabled, created_at, updated_at
 		FROM users
 		WHERE google_id = $1
 	`
 
 	user := &User{}
-	err := r.db.QueryRow(query, googleID).Scan(
+	err := r.db.QueryRowContext(ctx, query, googleID).Scan(
 		&user.ID,
 		&user.Email,
 		&user.EmailVerified,
@@ -116,6 +141,7 @@ func (r *UserRepository) GetUserByGoogleID(googleID string) (*User, error) {
 		&user.FamilyName,
 		&user.Picture,
 		&user.GoogleID,
+		&user.Disabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -132,14 +158,17 @@ func (r *UserRepository) GetUserByGoogleID(googleID string) (*User, error) {
 
 // CreateUser creates a new user
 // OUTPUT TO DB: Inserts new user into users table
-func (r *UserRepository) CreateUser(user *User) error {
+func (r *userRepository) CreateUser(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
 		INSERT INTO users (id, email, email_verified, name, given_name, family_name, picture, google_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
 	now := time.Now()
-	_, err := r.db.Exec(
+	_, err := r.db.ExecContext(ctx,
 		query,
 		user.ID,
 		user.Email,
@@ -165,7 +194,10 @@ func (r *UserRepository) CreateUser(user *User) error {
 
 // UpdateUser updates an existing user
 // OUTPUT TO DB: Updates user record in users table
-func (r *UserRepository) UpdateUser(user *User) error {
+func (r *userRepository) UpdateUser(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
 		UPDATE users
 		SET email = $2, email_verified = $3, name = $4, given_name = $5, family_name = $6, picture = $7, google_id = $8, updated_at = $9
@@ -173,7 +205,7 @@ func (r *UserRepository) UpdateUser(user *User) error {
 	`
 
 	now := time.Now()
-	_, err := r.db.Exec(
+	_, err := r.db.ExecContext(ctx,
 		query,
 		user.ID,
 		user.Email,
@@ -197,10 +229,13 @@ func (r *UserRepository) UpdateUser(user *User) error {
 
 // DeleteUser deletes a user
 // OUTPUT TO DB: Deletes user from users table
-func (r *UserRepository) DeleteUser(id string) error {
+func (r *userRepository) DeleteUser(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `DELETE FROM users WHERE id = $1`
 
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -208,17 +243,22 @@ func (r *UserRepository) DeleteUser(id string) error {
 	return nil
 }
 
-// ListUsers lists all users with pagination
+// ListUsers lists users with pagination, newest first
+// A non-empty search matches the email or name case-insensitively
 // INPUT FROM DB: Queries users table with limit and offset
-func (r *UserRepository) ListUsers(limit, offset int) ([]*User, error) {
+func (r *userRepository) ListUsers(ctx context.Context, search string, limit, offset int) ([]*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
 	query := `
-		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, created_at, updated_at
+		SELECT id, email, email_verified, name, given_name, family_name, picture, google_id, disabled, created_at, updated_at
 		FROM users
+		WHERE $1 = '' OR LOWER(email) LIKE '%' || LOWER($1) || '%' OR LOWER(name) LIKE '%' || LOWER($1) || '%'
 		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, search, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
@@ -236,6 +276,7 @@ func (r *UserRepository) ListUsers(limit, offset int) ([]*User, error) {
 			&user.FamilyName,
 			&user.Picture,
 			&user.GoogleID,
+			&user.Disabled,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -247,3 +288,23 @@ func (r *UserRepository) ListUsers(limit, offset int) ([]*User, error) {
 
 	return users, nil
 }
+
+// SetDisabled disables or re-enables a user
+// OUTPUT TO DB: Updates disabled flag in users table
+func (r *userRepository) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `UPDATE users SET disabled = $2, updated_at = $3 WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, disabled, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
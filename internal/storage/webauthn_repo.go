@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// WebAuthnCredential represents a registered WebAuthn authenticator (passkey or security key)
+type WebAuthnCredential struct {
+	ID              string // base64url-encoded credential ID
+	UserID          string
+	Name            string
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       int64
+	Transports      pq.StringArray
+	BackupEligible  bool
+	BackupState     bool
+	CloneWarning    bool // set when the signature counter went backwards; the credential is refused afterwards
+	CreatedAt       time.Time
+	LastUsedAt      time.Time
+}
+
+// WebAuthnRepository stores WebAuthn credentials
+type WebAuthnRepository interface {
+	ListByUser(ctx context.Context, userID string) ([]*WebAuthnCredential, error)
+	CreateCredential(ctx context.Context, credential *WebAuthnCredential) error
+	RecordAssertion(ctx context.Context, id string, signCount int64, backupState bool) error
+	FlagCloneWarning(ctx context.Context, id string) error
+	DeleteCredential(ctx context.Context, userID, id string) error
+}
+
+// webAuthnRepository implements WebAuthnRepository with database/sql
+// DB INTERACTION: All methods interact with the webauthn_credentials table
+type webAuthnRepository struct {
+	db *sql.DB
+}
+
+// NewWebAuthnRepository creates a new WebAuthn credential repository
+func NewWebAuthnRepository(db *sql.DB) WebAuthnRepository {
+	return &webAuthnRepository{db: db}
+}
+
+// ListByUser retrieves all credentials registered by a user
+// INPUT FROM DB: Queries webauthn_credentials table by user ID
+func (r *webAuthnRepository) ListByUser(ctx context.Context, userID string) ([]*WebAuthnCredential, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, name, public_key, attestation_type, aa_guid, sign_count, transports,
+			backup_eligible, backup_state, clone_warning, created_at, last_used_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WebAuthn credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []*WebAuthnCredential
+	for rows.Next() {
+		credential := &WebAuthnCredential{}
+		err := rows.Scan(
+			&credential.ID,
+			&credential.UserID,
+			&credential.Name,
+			&credential.PublicKey,
+			&credential.AttestationType,
+			&credential.AAGUID,
+			&credential.SignCount,
+			&credential.Transports,
+			&credential.BackupEligible,
+			&credential.BackupState,
+			&credential.CloneWarning,
+			&credential.CreatedAt,
+			&credential.LastUsedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan WebAuthn credential: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+// CreateCredential stores a newly registered credential
+// OUTPUT TO DB: Inserts credential into webauthn_credentials table
+func (r *webAuthnRepository) CreateCredential(ctx context.Context, credential *WebAuthnCredential) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO webauthn_credentials (id, user_id, name, public_key, attestation_type, aa_guid, sign_count, transports,
+			backup_eligible, backup_state, clone_warning, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx,
+		query,
+		credential.ID,
+		credential.UserID,
+		credential.Name,
+		credential.PublicKey,
+		credential.AttestationType,
+		credential.AAGUID,
+		credential.SignCount,
+		credential.Transports,
+		credential.BackupEligible,
+		credential.BackupState,
+		false,
+		now,
+		now,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create WebAuthn credential: %w", err)
+	}
+
+	credential.CreatedAt = now
+	credential.LastUsedAt = now
+
+	return nil
+}
+
+// RecordAssertion updates the signature counter and backup state after a successful assertion
+// OUTPUT TO DB: Updates sign_count and last_used_at in webauthn_credentials table
+func (r *webAuthnRepository) RecordAssertion(ctx context.Context, id string, signCount int64, backupState bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE webauthn_credentials
+		SET sign_count = $2, backup_state = $3, last_used_at = $4
+		WHERE id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, id, signCount, backupState, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update WebAuthn credential: %w", err)
+	}
+
+	return nil
+}
+
+// FlagCloneWarning marks a credential as possibly cloned
+// OUTPUT TO DB: Sets clone_warning in webauthn_credentials table
+func (r *webAuthnRepository) FlagCloneWarning(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `UPDATE webauthn_credentials SET clone_warning = true WHERE id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to flag WebAuthn credential: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCredential removes a credential belonging to a user
+// OUTPUT TO DB: Deletes credential from webauthn_credentials table
+func (r *webAuthnRepository) DeleteCredential(ctx context.Context, userID, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete WebAuthn credential: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("credential not found")
+	}
+
+	return nil
+}
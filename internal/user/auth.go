@@ -1,80 +1,286 @@
 package user
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
 
 	"oauth-golang/internal/models"
 	"oauth-golang/internal/storage"
-	"oauth-golang/pkg/utils"
 )
 
+// ProviderGoogle is the identity provider name for Google accounts
+const ProviderGoogle = "google"
+
+// ErrEmailConflict is returned when an upstream identity's email belongs to an existing
+// account but cannot be trusted for automatic linking
+var ErrEmailConflict = errors.New("an account with this email already exists; sign in to it and link this identity")
+
+// ErrUserDisabled is returned when a disabled user tries to sign in
+var ErrUserDisabled = errors.New("this account has been disabled")
+
+// ErrIdentityLinked is returned when linking an identity that already belongs to another user
+var ErrIdentityLinked = errors.New("this identity is already linked to another account")
+
+// ErrIdentityUnlinked is returned when signing in with an identity the user removed from their account
+var ErrIdentityUnlinked = errors.New("this account was unlinked; sign in with a linked account and link it again")
+
 // AuthService handles user authentication operations
 type AuthService struct {
-	userRepo *storage.UserRepository
+	userRepo     storage.UserRepository
+	identityRepo storage.IdentityRepository
+	rbacRepo     storage.RBACRepository
 }
 
 // NewAuthService creates a new authentication service
-func NewAuthService(userRepo *storage.UserRepository) *AuthService {
+func NewAuthService(userRepo storage.UserRepository, identityRepo storage.IdentityRepository, rbacRepo storage.RBACRepository) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		rbacRepo:     rbacRepo,
 	}
 }
 
-// CreateOrUpdateUser creates a new user or updates an existing one from Google OAuth info
-// OUTPUT TO DB: Creates or updates user via userRepo
-func (s *AuthService) CreateOrUpdateUser(userID string, googleUserInfo *models.GoogleUserInfo) (*storage.User, error) {
-	// Check if user exists by Google ID
-	existingUser, err := s.userRepo.GetUserByGoogleID(googleUserInfo.ID)
+// CreateOrUpdateUser resolves the local user for a Google login, creating one if needed
+// Users are matched by linked identity first; an email match only links automatically
+// when both the upstream and the local email are verified
+// When the login fetched the user's Google Workspace groups, their group memberships are mirrored
+// OUTPUT TO DB: Creates or updates user and identity via userRepo and identityRepo, memberships via rbacRepo
+func (s *AuthService) CreateOrUpdateUser(ctx context.Context, googleUserInfo *models.GoogleUserInfo) (*storage.User, error) {
+	rawProfile, err := json.Marshal(googleUserInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %w", err)
+	}
+
+	// Known identity: refresh its profile and return the owning user
+	identity, err := s.identityRepo.GetIdentity(ctx, ProviderGoogle, googleUserInfo.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing identity: %w", err)
+	}
+	if identity != nil && identity.UnlinkedAt != nil {
+		return nil, ErrIdentityUnlinked
+	}
+	if identity != nil {
+		identity.Email = googleUserInfo.Email
+		identity.EmailVerified = googleUserInfo.VerifiedEmail
+		identity.RawProfile = string(rawProfile)
+		if err := s.identityRepo.UpdateProfile(ctx, identity); err != nil {
+			return nil, err
+		}
+
+		existingUser, err := s.userRepo.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load linked user: %w", err)
+		}
+		if existingUser == nil {
+			return nil, fmt.Errorf("linked user not found")
+		}
+		if existingUser.Disabled {
+			return nil, ErrUserDisabled
+		}
+
+		// Only the identity the account was created with keeps the profile in sync
+		if existingUser.GoogleID == googleUserInfo.ID {
+			applyGoogleProfile(existingUser, googleUserInfo)
+			if err := s.userRepo.UpdateUser(ctx, existingUser); err != nil {
+				return nil, fmt.Errorf("failed to update user: %w", err)
+			}
+		}
+		if err := s.syncWorkspaceGroups(ctx, existingUser.ID, googleUserInfo); err != nil {
+			return nil, err
+		}
+		return existingUser, nil
+	}
+
+	// Accounts created before identities existed are matched by Google ID once and backfilled
+	existingUser, err := s.userRepo.GetUserByGoogleID(ctx, googleUserInfo.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existing user: %w", err)
 	}
+	if existingUser != nil {
+		linked, err := s.identityRepo.ListByUser(ctx, existingUser.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(linked) > 0 {
+			// The account has identities and this one is not among them: it was unlinked,
+			// so it must not be matched again by Google ID or by email
+			return nil, ErrIdentityUnlinked
+		}
+	}
 
-	// If user doesn't exist by Google ID, check by email
+	// Fall back to email, but never link on an unverified address
 	if existingUser == nil {
-		existingUser, err = s.userRepo.GetUserByEmail(googleUserInfo.Email)
+		existingUser, err = s.userRepo.GetUserByEmail(ctx, googleUserInfo.Email)
 		if err != nil {
 			return nil, fmt.Errorf("failed to check user by email: %w", err)
 		}
+		if existingUser != nil && (!googleUserInfo.VerifiedEmail || !existingUser.EmailVerified) {
+			return nil, ErrEmailConflict
+		}
+	}
+	if existingUser != nil && existingUser.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	if existingUser == nil {
+		// Create new user; the UUID is the immutable subject and never changes afterwards
+		existingUser = &storage.User{ID: uuid.NewString()}
+		applyGoogleProfile(existingUser, googleUserInfo)
+		if err := s.userRepo.CreateUser(ctx, existingUser); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
 	}
 
-	// Build user object
-	user := &storage.User{
-		Email:         googleUserInfo.Email,
-		EmailVerified: googleUserInfo.VerifiedEmail,
-		Name:          googleUserInfo.Name,
-		GivenName:     googleUserInfo.GivenName,
-		FamilyName:    googleUserInfo.FamilyName,
-		Picture:       googleUserInfo.Picture,
-		GoogleID:      googleUserInfo.ID,
+	if err := s.createIdentity(ctx, existingUser.ID, googleUserInfo, string(rawProfile)); err != nil {
+		return nil, err
+	}
+	if err := s.syncWorkspaceGroups(ctx, existingUser.ID, googleUserInfo); err != nil {
+		return nil, err
 	}
 
-	if existingUser != nil {
-		// Update existing user
-		user.ID = existingUser.ID
-		if err := s.userRepo.UpdateUser(user); err != nil {
-			return nil, fmt.Errorf("failed to update user: %w", err)
+	return existingUser, nil
+}
+
+// IsAdmin reports whether a user holds the global admin role, directly or through a group
+// INPUT FROM DB: Queries roles via rbacRepo
+func (s *AuthService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	return hasGlobalRole(ctx, s.rbacRepo, userID, storage.AdminRole)
+}
+
+// syncWorkspaceGroups mirrors the Workspace groups fetched at login into local group memberships
+// Nothing changes when the groups were not fetched (Groups is nil)
+func (s *AuthService) syncWorkspaceGroups(ctx context.Context, userID string, googleUserInfo *models.GoogleUserInfo) error {
+	if googleUserInfo.Groups == nil {
+		return nil
+	}
+
+	emails := make([]string, 0, len(googleUserInfo.Groups))
+	for _, email := range googleUserInfo.Groups {
+		emails = append(emails, strings.ToLower(email))
+	}
+	if err := s.rbacRepo.SyncExternalGroups(ctx, userID, emails); err != nil {
+		return fmt.Errorf("failed to sync workspace groups: %w", err)
+	}
+	return nil
+}
+
+// LinkIdentity explicitly links a Google identity to an already signed-in user
+// OUTPUT TO DB: Inserts identity via identityRepo
+func (s *AuthService) LinkIdentity(ctx context.Context, userID string, googleUserInfo *models.GoogleUserInfo) (*storage.UserIdentity, error) {
+	existing, err := s.identityRepo.GetIdentity(ctx, ProviderGoogle, googleUserInfo.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.UnlinkedAt != nil {
+		// Linking again is an explicit choice, so a removed identity may move to this user
+		if err := s.identityRepo.RelinkIdentity(ctx, existing.ID, userID); err != nil {
+			return nil, err
 		}
-	} else {
-		// Create new user with generated ID
-		user.ID = utils.GenerateRandomString(16)
-		if err := s.userRepo.CreateUser(user); err != nil {
-			return nil, fmt.Errorf("failed to create user: %w", err)
+		return s.identityRepo.GetIdentity(ctx, ProviderGoogle, googleUserInfo.ID)
+	}
+	if existing != nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityLinked
 		}
+		return existing, nil
+	}
+
+	rawProfile, err := json.Marshal(googleUserInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile: %w", err)
+	}
+
+	if err := s.createIdentity(ctx, userID, googleUserInfo, string(rawProfile)); err != nil {
+		return nil, err
+	}
+
+	return s.identityRepo.GetIdentity(ctx, ProviderGoogle, googleUserInfo.ID)
+}
+
+// UnlinkIdentity removes a linked identity, refusing to remove the last one
+// The identity is remembered as unlinked so it cannot sign in again until explicitly re-linked
+// OUTPUT TO DB: Marks identity unlinked via identityRepo
+func (s *AuthService) UnlinkIdentity(ctx context.Context, userID, identityID string) error {
+	identities, err := s.identityRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(identities) <= 1 {
+		return fmt.Errorf("cannot unlink the only identity on the account")
+	}
+
+	return s.identityRepo.UnlinkIdentity(ctx, userID, identityID)
+}
+
+// ListIdentities returns the identities linked to a user
+// INPUT FROM DB: Queries identities via identityRepo
+func (s *AuthService) ListIdentities(ctx context.Context, userID string) ([]*storage.UserIdentity, error) {
+	return s.identityRepo.ListByUser(ctx, userID)
+}
+
+// createIdentity stores a Google identity for a user
+func (s *AuthService) createIdentity(ctx context.Context, userID string, googleUserInfo *models.GoogleUserInfo, rawProfile string) error {
+	err := s.identityRepo.CreateIdentity(ctx, &storage.UserIdentity{
+		ID:            uuid.NewString(),
+		UserID:        userID,
+		Provider:      ProviderGoogle,
+		Subject:       googleUserInfo.ID,
+		Email:         googleUserInfo.Email,
+		EmailVerified: googleUserInfo.VerifiedEmail,
+		RawProfile:    rawProfile,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
 	}
+	return nil
+}
 
-	return user, nil
+// applyGoogleProfile copies Google profile fields onto a user
+func applyGoogleProfile(user *storage.User, googleUserInfo *models.GoogleUserInfo) {
+	user.Email = googleUserInfo.Email
+	user.EmailVerified = googleUserInfo.VerifiedEmail
+	user.Name = googleUserInfo.Name
+	user.GivenName = googleUserInfo.GivenName
+	user.FamilyName = googleUserInfo.FamilyName
+	user.Picture = googleUserInfo.Picture
+	user.GoogleID = googleUserInfo.ID
 }
 
 // GetUser retrieves a user by ID
 // INPUT FROM DB: Queries user via userRepo
-func (s *AuthService) GetUser(userID string) (*storage.User, error) {
-	return s.userRepo.GetUserByID(userID)
+func (s *AuthService) GetUser(ctx context.Context, userID string) (*storage.User, error) {
+	return s.userRepo.GetUserByID(ctx, userID)
 }
 
 // GetUserByEmail retrieves a user by email
 // INPUT FROM DB: Queries user via userRepo
-func (s *AuthService) GetUserByEmail(email string) (*storage.User, error) {
-	return s.userRepo.GetUserByEmail(email)
+func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*storage.User, error) {
+	return s.userRepo.GetUserByEmail(ctx, email)
+}
+
+// ListUsers returns users newest first; a non-empty search matches email or name
+// INPUT FROM DB: Queries users via userRepo
+func (s *AuthService) ListUsers(ctx context.Context, search string, limit, offset int) ([]*storage.User, error) {
+	return s.userRepo.ListUsers(ctx, search, limit, offset)
+}
+
+// SetUserDisabled disables or re-enables a user
+// Disabling does not end sessions or revoke tokens; callers do that with the session and token services
+// OUTPUT TO DB: Updates user via userRepo
+func (s *AuthService) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	return s.userRepo.SetDisabled(ctx, userID, disabled)
+}
+
+// DeleteUser deletes a user; identities, sessions, passkeys, consents and memberships go with it
+// Revoke the user's tokens first: refresh and access token rows are not tied to the user row
+// OUTPUT TO DB: Deletes user via userRepo
+func (s *AuthService) DeleteUser(ctx context.Context, userID string) error {
+	return s.userRepo.DeleteUser(ctx, userID)
 }
 
 // AuthenticateUser authenticates a user (placeholder for future password-based auth)
@@ -0,0 +1,201 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"oauth-golang/internal/models"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+)
+
+func newAuthService() (*AuthService, *storage.Repositories) {
+	repos := memory.NewRepositories()
+	return NewAuthService(repos.Users, repos.Identities, repos.RBAC), repos
+}
+
+func googleUser(id, email string, verified bool) *models.GoogleUserInfo {
+	return &models.GoogleUserInfo{ID: id, Email: email, VerifiedEmail: verified, Name: "Test User"}
+}
+
+func TestCreateOrUpdateUserCreatesAndMatchesIdentity(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newAuthService()
+
+	created, err := service.CreateOrUpdateUser(ctx, googleUser("g-1", "user@example.com", true))
+	if err != nil {
+		t.Fatalf("CreateOrUpdateUser: %v", err)
+	}
+	if created.ID == "" || created.GoogleID != "g-1" {
+		t.Fatalf("unexpected user: %+v", created)
+	}
+
+	// The same identity signs in to the same user, even after an email change
+	info := googleUser("g-1", "renamed@example.com", true)
+	again, err := service.CreateOrUpdateUser(ctx, info)
+	if err != nil {
+		t.Fatalf("CreateOrUpdateUser: %v", err)
+	}
+	if again.ID != created.ID {
+		t.Fatalf("got user %s, want %s", again.ID, created.ID)
+	}
+	if again.Email != "renamed@example.com" {
+		t.Errorf("profile not refreshed: email %q", again.Email)
+	}
+
+	identities, err := service.ListIdentities(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("ListIdentities: %v", err)
+	}
+	if len(identities) != 1 || identities[0].Subject != "g-1" {
+		t.Fatalf("got identities %+v, want one for g-1", identities)
+	}
+}
+
+func TestCreateOrUpdateUserEmailLinking(t *testing.T) {
+	tests := []struct {
+		name          string
+		localVerified bool
+		upstreamVer   bool
+		wantErr       error
+	}{
+		{"both verified links", true, true, nil},
+		{"unverified upstream email", true, false, ErrEmailConflict},
+		{"unverified local email", false, true, ErrEmailConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			service, repos := newAuthService()
+
+			existing := &storage.User{ID: "user-1", Email: "user@example.com", EmailVerified: tt.localVerified}
+			if err := repos.Users.CreateUser(ctx, existing); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			user, err := service.CreateOrUpdateUser(ctx, googleUser("g-2", "user@example.com", tt.upstreamVer))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if user.ID != existing.ID {
+				t.Fatalf("got user %s, want %s", user.ID, existing.ID)
+			}
+
+			identity, err := repos.Identities.GetIdentity(ctx, ProviderGoogle, "g-2")
+			if err != nil || identity == nil || identity.UserID != existing.ID {
+				t.Fatalf("identity not linked to existing user: %+v, %v", identity, err)
+			}
+		})
+	}
+}
+
+func TestCreateOrUpdateUserRejectsDisabledUser(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newAuthService()
+
+	user, err := service.CreateOrUpdateUser(ctx, googleUser("g-1", "user@example.com", true))
+	if err != nil {
+		t.Fatalf("CreateOrUpdateUser: %v", err)
+	}
+	if err := service.SetUserDisabled(ctx, user.ID, true); err != nil {
+		t.Fatalf("SetUserDisabled: %v", err)
+	}
+
+	if _, err := service.CreateOrUpdateUser(ctx, googleUser("g-1", "user@example.com", true)); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("got error %v, want ErrUserDisabled", err)
+	}
+}
+
+func TestLinkAndUnlinkIdentity(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newAuthService()
+
+	user, err := service.CreateOrUpdateUser(ctx, googleUser("g-1", "user@example.com", true))
+	if err != nil {
+		t.Fatalf("CreateOrUpdateUser: %v", err)
+	}
+	primary, err := service.ListIdentities(ctx, user.ID)
+	if err != nil || len(primary) != 1 {
+		t.Fatalf("ListIdentities: %+v, %v", primary, err)
+	}
+
+	if err := service.UnlinkIdentity(ctx, user.ID, primary[0].ID); err == nil {
+		t.Fatal("unlinked the only identity on the account")
+	}
+
+	second, err := service.LinkIdentity(ctx, user.ID, googleUser("g-2", "other@example.com", true))
+	if err != nil {
+		t.Fatalf("LinkIdentity: %v", err)
+	}
+	if second.UserID != user.ID {
+		t.Fatalf("identity linked to %s, want %s", second.UserID, user.ID)
+	}
+
+	// Another account cannot take an identity that is still linked
+	other, err := service.CreateOrUpdateUser(ctx, googleUser("g-3", "third@example.com", true))
+	if err != nil {
+		t.Fatalf("CreateOrUpdateUser: %v", err)
+	}
+	if _, err := service.LinkIdentity(ctx, other.ID, googleUser("g-2", "other@example.com", true)); !errors.Is(err, ErrIdentityLinked) {
+		t.Fatalf("got error %v, want ErrIdentityLinked", err)
+	}
+
+	if err := service.UnlinkIdentity(ctx, user.ID, second.ID); err != nil {
+		t.Fatalf("UnlinkIdentity: %v", err)
+	}
+	if identities, _ := service.ListIdentities(ctx, user.ID); len(identities) != 1 {
+		t.Fatalf("got %d identities after unlink, want 1", len(identities))
+	}
+
+	// An unlinked identity cannot sign in, not even through a matching verified email
+	if _, err := service.CreateOrUpdateUser(ctx, googleUser("g-2", "other@example.com", true)); !errors.Is(err, ErrIdentityUnlinked) {
+		t.Fatalf("got error %v, want ErrIdentityUnlinked", err)
+	}
+
+	// Linking again is explicit and may move the identity to the signed-in user
+	relinked, err := service.LinkIdentity(ctx, other.ID, googleUser("g-2", "other@example.com", true))
+	if err != nil {
+		t.Fatalf("LinkIdentity after unlink: %v", err)
+	}
+	if relinked.UserID != other.ID || relinked.UnlinkedAt != nil {
+		t.Fatalf("unexpected relinked identity: %+v", relinked)
+	}
+
+	signedIn, err := service.CreateOrUpdateUser(ctx, googleUser("g-2", "other@example.com", true))
+	if err != nil {
+		t.Fatalf("CreateOrUpdateUser after relink: %v", err)
+	}
+	if signedIn.ID != other.ID {
+		t.Fatalf("got user %s, want %s", signedIn.ID, other.ID)
+	}
+}
+
+func TestCreateOrUpdateUserRejectsUnlinkedLegacyGoogleID(t *testing.T) {
+	ctx := context.Background()
+	service, repos := newAuthService()
+
+	// Created with g-1, which was later unlinked in favour of g-2
+	user, err := service.CreateOrUpdateUser(ctx, googleUser("g-1", "user@example.com", true))
+	if err != nil {
+		t.Fatalf("CreateOrUpdateUser: %v", err)
+	}
+	if _, err := service.LinkIdentity(ctx, user.ID, googleUser("g-2", "user@example.com", true)); err != nil {
+		t.Fatalf("LinkIdentity: %v", err)
+	}
+	first, err := repos.Identities.GetIdentity(ctx, ProviderGoogle, "g-1")
+	if err != nil || first == nil {
+		t.Fatalf("GetIdentity: %+v, %v", first, err)
+	}
+	if err := service.UnlinkIdentity(ctx, user.ID, first.ID); err != nil {
+		t.Fatalf("UnlinkIdentity: %v", err)
+	}
+
+	if _, err := service.CreateOrUpdateUser(ctx, googleUser("g-1", "user@example.com", true)); !errors.Is(err, ErrIdentityUnlinked) {
+		t.Fatalf("got error %v, want ErrIdentityUnlinked", err)
+	}
+}
@@ -0,0 +1,224 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/pkg/utils"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued at enrolment
+	recoveryCodeCount = 10
+
+	// recoveryCodeLength is the number of digits in each recovery code
+	recoveryCodeLength = 10
+
+	// recoveryCodeAttempts bounds how often consuming a recovery code is retried after a concurrent change
+	recoveryCodeAttempts = 3
+)
+
+// MFAEnrollmentResult is returned when a user starts TOTP enrolment
+// Recovery codes are only ever available in plaintext here
+type MFAEnrollmentResult struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"otpauth_uri"`
+	RecoveryCodes   []string `json:"recovery_codes"`
+}
+
+// MFAService handles TOTP enrolment and verification
+// DB INTERACTION: Reads and writes enrolments via mfaRepo
+type MFAService struct {
+	mfaRepo storage.MFARepository
+	hasher  *security.Hasher
+	issuer  string
+}
+
+// NewMFAService creates a new MFA service
+func NewMFAService(mfaRepo storage.MFARepository, issuer string) *MFAService {
+	return &MFAService{
+		mfaRepo: mfaRepo,
+		hasher:  security.NewHasher(),
+		issuer:  issuer,
+	}
+}
+
+// IsEnrolled reports whether the user has a confirmed TOTP authenticator
+// INPUT FROM DB: Queries enrolment via mfaRepo
+func (s *MFAService) IsEnrolled(ctx context.Context, userID string) (bool, error) {
+	enrollment, err := s.mfaRepo.GetEnrollment(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return enrollment != nil && enrollment.Confirmed, nil
+}
+
+// BeginEnrollment generates a new TOTP secret and recovery codes for the user
+// The enrolment stays unconfirmed until ConfirmEnrollment succeeds
+// OUTPUT TO DB: Stores the pending enrolment via mfaRepo
+func (s *MFAService) BeginEnrollment(ctx context.Context, user *storage.User) (*MFAEnrollmentResult, error) {
+	existing, err := s.mfaRepo.GetEnrollment(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Confirmed {
+		return nil, fmt.Errorf("MFA is already enrolled")
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, hashedCodes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment := &storage.MFAEnrollment{
+		UserID:        user.ID,
+		Secret:        secret,
+		Confirmed:     false,
+		RecoveryCodes: hashedCodes,
+	}
+	if err := s.mfaRepo.SaveEnrollment(ctx, enrollment); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollmentResult{
+		Secret:          secret,
+		ProvisioningURI: security.TOTPProvisioningURI(s.issuer, user.Email, secret),
+		RecoveryCodes:   recoveryCodes,
+	}, nil
+}
+
+// ConfirmEnrollment activates a pending enrolment once the user proves possession of the authenticator
+// OUTPUT TO DB: Marks enrolment as confirmed via mfaRepo
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID, code string) error {
+	enrollment, err := s.mfaRepo.GetEnrollment(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if enrollment == nil {
+		return fmt.Errorf("no pending MFA enrollment")
+	}
+	if enrollment.Confirmed {
+		return fmt.Errorf("MFA is already enrolled")
+	}
+
+	step, ok := security.ValidateTOTPCode(enrollment.Secret, code, time.Now())
+	if !ok {
+		return fmt.Errorf("invalid verification code")
+	}
+
+	return s.mfaRepo.ConfirmEnrollment(ctx, userID, step)
+}
+
+// Verify checks a TOTP or recovery code for an enrolled user
+// Returns the authentication method used ("otp" or "recovery")
+// DB INTERACTION: Records the used TOTP step or consumes the recovery code
+func (s *MFAService) Verify(ctx context.Context, userID, code string) (string, error) {
+	enrollment, err := s.mfaRepo.GetEnrollment(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if enrollment == nil || !enrollment.Confirmed {
+		return "", fmt.Errorf("MFA is not enrolled")
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	// TOTP codes are short; anything longer can only be a recovery code
+	if len(code) == security.TOTPDigits {
+		step, ok := security.ValidateTOTPCode(enrollment.Secret, code, time.Now())
+		if !ok {
+			return "", fmt.Errorf("invalid verification code")
+		}
+		if step <= enrollment.LastUsedStep {
+			return "", fmt.Errorf("verification code already used")
+		}
+		// Recording the step fails if a concurrent request used this step first
+		recorded, err := s.mfaRepo.UpdateLastUsedStep(ctx, userID, step)
+		if err != nil {
+			return "", err
+		}
+		if !recorded {
+			return "", fmt.Errorf("verification code already used")
+		}
+		return "otp", nil
+	}
+
+	if err := s.consumeRecoveryCode(ctx, enrollment, code); err != nil {
+		return "", err
+	}
+	return "recovery", nil
+}
+
+// consumeRecoveryCode removes the recovery code matching code, so it cannot be used again
+// The codes are replaced only if no concurrent request changed them since they were read;
+// otherwise they are read again, and a code another request consumed is no longer found
+// DB INTERACTION: Reads and conditionally replaces the recovery codes via mfaRepo
+func (s *MFAService) consumeRecoveryCode(ctx context.Context, enrollment *storage.MFAEnrollment, code string) error {
+	for attempt := 0; attempt < recoveryCodeAttempts; attempt++ {
+		if attempt > 0 {
+			var err error
+			enrollment, err = s.mfaRepo.GetEnrollment(ctx, enrollment.UserID)
+			if err != nil {
+				return err
+			}
+			if enrollment == nil || !enrollment.Confirmed {
+				return fmt.Errorf("MFA is not enrolled")
+			}
+		}
+
+		match := -1
+		for i, hash := range enrollment.RecoveryCodes {
+			if s.hasher.VerifyPassword(code, hash) {
+				match = i
+				break
+			}
+		}
+		if match < 0 {
+			return fmt.Errorf("invalid verification code")
+		}
+
+		remaining := append([]string{}, enrollment.RecoveryCodes[:match]...)
+		remaining = append(remaining, enrollment.RecoveryCodes[match+1:]...)
+		replaced, err := s.mfaRepo.ReplaceRecoveryCodes(ctx, enrollment.UserID, enrollment.RecoveryCodes, remaining)
+		if err != nil {
+			return err
+		}
+		if replaced {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("recovery codes changed concurrently, try again")
+}
+
+// Disable removes the user's MFA enrolment
+// OUTPUT TO DB: Deletes enrolment via mfaRepo
+func (s *MFAService) Disable(ctx context.Context, userID string) error {
+	return s.mfaRepo.DeleteEnrollment(ctx, userID)
+}
+
+// generateRecoveryCodes returns plaintext recovery codes and their bcrypt hashes
+func (s *MFAService) generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		codes[i] = utils.GenerateRandomCode(recoveryCodeLength)
+		hash, err := s.hasher.HashPassword(codes[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes[i] = hash
+	}
+
+	return codes, hashes, nil
+}
@@ -0,0 +1,186 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oauth-golang/internal/security"
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+)
+
+// enrolledMFA returns an MFA service with a pending enrolment for a test user
+func enrolledMFA(t *testing.T) (*MFAService, *MFAEnrollmentResult, string) {
+	t.Helper()
+
+	service := NewMFAService(memory.NewRepositories().MFA, "test")
+	user := &storage.User{ID: "user-1", Email: "user@example.com"}
+
+	result, err := service.BeginEnrollment(context.Background(), user)
+	if err != nil {
+		t.Fatalf("BeginEnrollment: %v", err)
+	}
+	return service, result, user.ID
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := security.GenerateTOTPCode(secret, at)
+	if err != nil {
+		t.Fatalf("GenerateTOTPCode: %v", err)
+	}
+	return code
+}
+
+func TestMFAConfirmEnrollment(t *testing.T) {
+	ctx := context.Background()
+	service, result, userID := enrolledMFA(t)
+
+	if enrolled, _ := service.IsEnrolled(ctx, userID); enrolled {
+		t.Fatal("pending enrolment reported as enrolled")
+	}
+	if _, err := service.Verify(ctx, userID, totpCode(t, result.Secret, time.Now())); err == nil {
+		t.Fatal("Verify succeeded before enrolment was confirmed")
+	}
+
+	// A code two steps away is outside the accepted skew
+	if err := service.ConfirmEnrollment(ctx, userID, totpCode(t, result.Secret, time.Now().Add(-2*security.TOTPPeriod))); err == nil {
+		t.Fatal("ConfirmEnrollment accepted a stale code")
+	}
+
+	if err := service.ConfirmEnrollment(ctx, userID, totpCode(t, result.Secret, time.Now())); err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	if enrolled, err := service.IsEnrolled(ctx, userID); err != nil || !enrolled {
+		t.Fatalf("got enrolled=%v err=%v, want enrolled", enrolled, err)
+	}
+
+	if err := service.ConfirmEnrollment(ctx, userID, totpCode(t, result.Secret, time.Now())); err == nil {
+		t.Fatal("ConfirmEnrollment succeeded twice")
+	}
+	if _, err := service.BeginEnrollment(ctx, &storage.User{ID: userID}); err == nil {
+		t.Fatal("BeginEnrollment replaced a confirmed enrolment")
+	}
+}
+
+func TestMFAVerifyRejectsReplay(t *testing.T) {
+	ctx := context.Background()
+	service, result, userID := enrolledMFA(t)
+
+	now := time.Now()
+	confirmCode := totpCode(t, result.Secret, now)
+	if err := service.ConfirmEnrollment(ctx, userID, confirmCode); err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+
+	// The step used to confirm counts as used
+	if _, err := service.Verify(ctx, userID, confirmCode); err == nil {
+		t.Fatal("Verify accepted the code used to confirm enrolment")
+	}
+
+	nextCode := totpCode(t, result.Secret, now.Add(security.TOTPPeriod))
+	method, err := service.Verify(ctx, userID, nextCode)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if method != "otp" {
+		t.Errorf("got method %q, want otp", method)
+	}
+
+	if _, err := service.Verify(ctx, userID, nextCode); err == nil {
+		t.Fatal("Verify accepted a replayed code")
+	}
+	if _, err := service.Verify(ctx, userID, confirmCode); err == nil {
+		t.Fatal("Verify accepted a code older than the last used step")
+	}
+}
+
+func TestMFARecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	service, result, userID := enrolledMFA(t)
+
+	if len(result.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(result.RecoveryCodes), recoveryCodeCount)
+	}
+	if err := service.ConfirmEnrollment(ctx, userID, totpCode(t, result.Secret, time.Now())); err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+
+	code := result.RecoveryCodes[0]
+	method, err := service.Verify(ctx, userID, code)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if method != "recovery" {
+		t.Errorf("got method %q, want recovery", method)
+	}
+
+	if _, err := service.Verify(ctx, userID, code); err == nil {
+		t.Fatal("recovery code accepted twice")
+	}
+
+	// The other codes are unaffected
+	if _, err := service.Verify(ctx, userID, result.RecoveryCodes[1]); err != nil {
+		t.Fatalf("Verify with a second recovery code: %v", err)
+	}
+	if _, err := service.Verify(ctx, userID, "0000000000"); err == nil {
+		t.Fatal("unknown recovery code accepted")
+	}
+}
+
+// concurrentVerify runs Verify with the same code from several requests at once and counts the successes
+func concurrentVerify(service *MFAService, userID, code string) int {
+	const requests = 8
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.Verify(context.Background(), userID, code); err == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return int(succeeded.Load())
+}
+
+func TestMFAVerifyConcurrentReplay(t *testing.T) {
+	ctx := context.Background()
+	service, result, userID := enrolledMFA(t)
+
+	now := time.Now()
+	if err := service.ConfirmEnrollment(ctx, userID, totpCode(t, result.Secret, now.Add(-security.TOTPPeriod))); err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+
+	if succeeded := concurrentVerify(service, userID, totpCode(t, result.Secret, now)); succeeded != 1 {
+		t.Errorf("TOTP code accepted %d times concurrently, want once", succeeded)
+	}
+	if succeeded := concurrentVerify(service, userID, result.RecoveryCodes[0]); succeeded != 1 {
+		t.Errorf("recovery code accepted %d times concurrently, want once", succeeded)
+	}
+
+	// Concurrent requests with different recovery codes all succeed
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.Verify(ctx, userID, result.RecoveryCodes[i+1])
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("recovery code %d: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"oauth-golang/internal/storage"
+)
+
+// RBACService manages roles, groups and their assignments, and supplies the "roles" and "groups"
+// claims (it implements oauth.MembershipSource) and role-bound scopes (oauth.RoleSource)
+type RBACService struct {
+	rbacRepo storage.RBACRepository
+}
+
+// NewRBACService creates a new RBAC service
+func NewRBACService(rbacRepo storage.RBACRepository) *RBACService {
+	return &RBACService{
+		rbacRepo: rbacRepo,
+	}
+}
+
+// Memberships is everything a user holds: their groups and their roles for every client
+type Memberships struct {
+	Roles  []*storage.Role
+	Groups []*storage.Group
+}
+
+// Roles returns the names of the roles a user holds for a client, including global roles
+// INPUT FROM DB: Queries roles via rbacRepo
+func (s *RBACService) Roles(ctx context.Context, userID, clientID string) ([]string, error) {
+	roles, err := s.rbacRepo.ListUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, role := range roles {
+		if role.ClientID != "" && role.ClientID != clientID {
+			continue
+		}
+		if !seen[role.Name] {
+			seen[role.Name] = true
+			names = append(names, role.Name)
+		}
+	}
+	return names, nil
+}
+
+// HasGlobalRole reports whether a user holds a global role, directly or through a group
+// INPUT FROM DB: Queries roles via rbacRepo
+func (s *RBACService) HasGlobalRole(ctx context.Context, userID, name string) (bool, error) {
+	return hasGlobalRole(ctx, s.rbacRepo, userID, name)
+}
+
+// hasGlobalRole reports whether a user holds the named role without a client restriction
+func hasGlobalRole(ctx context.Context, rbacRepo storage.RBACRepository, userID, name string) (bool, error) {
+	roles, err := rbacRepo.ListUserRoles(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if role.ClientID == "" && role.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Groups returns the names of the groups a user belongs to
+// INPUT FROM DB: Queries groups via rbacRepo
+func (s *RBACService) Groups(ctx context.Context, userID string) ([]string, error) {
+	groups, err := s.rbacRepo.ListUserGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return names, nil
+}
+
+// GetMemberships returns a user's groups and roles
+// INPUT FROM DB: Queries roles and groups via rbacRepo
+func (s *RBACService) GetMemberships(ctx context.Context, userID string) (*Memberships, error) {
+	roles, err := s.rbacRepo.ListUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.rbacRepo.ListUserGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Memberships{Roles: roles, Groups: groups}, nil
+}
+
+// CreateRole creates a role; an empty clientID makes it apply to every client
+// OUTPUT TO DB: Inserts role via rbacRepo
+func (s *RBACService) CreateRole(ctx context.Context, clientID, name, description string) (*storage.Role, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return nil, fmt.Errorf("role name is required and must not contain spaces")
+	}
+
+	role := &storage.Role{
+		ID:          uuid.NewString(),
+		ClientID:    clientID,
+		Name:        name,
+		Description: description,
+	}
+	if err := s.rbacRepo.CreateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// GetRole retrieves a role by ID
+// INPUT FROM DB: Queries role via rbacRepo
+func (s *RBACService) GetRole(ctx context.Context, roleID string) (*storage.Role, error) {
+	return s.rbacRepo.GetRole(ctx, roleID)
+}
+
+// ListRoles returns all roles
+// INPUT FROM DB: Queries roles via rbacRepo
+func (s *RBACService) ListRoles(ctx context.Context) ([]*storage.Role, error) {
+	return s.rbacRepo.ListRoles(ctx)
+}
+
+// DeleteRole deletes a role and removes it from every user and group
+// OUTPUT TO DB: Deletes role via rbacRepo
+func (s *RBACService) DeleteRole(ctx context.Context, roleID string) error {
+	return s.rbacRepo.DeleteRole(ctx, roleID)
+}
+
+// CreateGroup creates a group; externalID names the Google Workspace group mirrored into it, if any
+// OUTPUT TO DB: Inserts group via rbacRepo
+func (s *RBACService) CreateGroup(ctx context.Context, name, description, externalID string) (*storage.Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("group name is required")
+	}
+
+	group := &storage.Group{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Description: description,
+		ExternalID:  strings.ToLower(strings.TrimSpace(externalID)),
+	}
+	if err := s.rbacRepo.CreateGroup(ctx, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// GetGroup retrieves a group by ID
+// INPUT FROM DB: Queries group via rbacRepo
+func (s *RBACService) GetGroup(ctx context.Context, groupID string) (*storage.Group, error) {
+	return s.rbacRepo.GetGroup(ctx, groupID)
+}
+
+// ListGroups returns all groups
+// INPUT FROM DB: Queries groups via rbacRepo
+func (s *RBACService) ListGroups(ctx context.Context) ([]*storage.Group, error) {
+	return s.rbacRepo.ListGroups(ctx)
+}
+
+// DeleteGroup deletes a group with its memberships and role assignments
+// OUTPUT TO DB: Deletes group via rbacRepo
+func (s *RBACService) DeleteGroup(ctx context.Context, groupID string) error {
+	return s.rbacRepo.DeleteGroup(ctx, groupID)
+}
+
+// ListGroupMembers returns the IDs of a group's members
+// INPUT FROM DB: Queries group members via rbacRepo
+func (s *RBACService) ListGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	return s.rbacRepo.ListGroupMembers(ctx, groupID)
+}
+
+// AddGroupMember adds a user to a group
+// OUTPUT TO DB: Inserts membership via rbacRepo
+func (s *RBACService) AddGroupMember(ctx context.Context, groupID, userID string) error {
+	return s.rbacRepo.AddGroupMember(ctx, groupID, userID, storage.MembershipSourceManual)
+}
+
+// RemoveGroupMember removes a user from a group
+// Memberships mirrored from Google Workspace come back at the user's next login while they are in the Workspace group
+// OUTPUT TO DB: Deletes membership via rbacRepo
+func (s *RBACService) RemoveGroupMember(ctx context.Context, groupID, userID string) error {
+	return s.rbacRepo.RemoveGroupMember(ctx, groupID, userID)
+}
+
+// AssignRole assigns a role to a user or, when groupID is set, to a group
+// OUTPUT TO DB: Inserts assignment via rbacRepo
+func (s *RBACService) AssignRole(ctx context.Context, roleID, userID, groupID string) error {
+	switch {
+	case userID != "" && groupID == "":
+		return s.rbacRepo.AssignUserRole(ctx, userID, roleID)
+	case groupID != "" && userID == "":
+		return s.rbacRepo.AssignGroupRole(ctx, groupID, roleID)
+	default:
+		return fmt.Errorf("exactly one of user_id and group_id is required")
+	}
+}
+
+// UnassignRole removes a role from a user or, when groupID is set, from a group
+// OUTPUT TO DB: Deletes assignment via rbacRepo
+func (s *RBACService) UnassignRole(ctx context.Context, roleID, userID, groupID string) error {
+	switch {
+	case userID != "" && groupID == "":
+		return s.rbacRepo.UnassignUserRole(ctx, userID, roleID)
+	case groupID != "" && userID == "":
+		return s.rbacRepo.UnassignGroupRole(ctx, groupID, roleID)
+	default:
+		return fmt.Errorf("exactly one of user_id and group_id is required")
+	}
+}
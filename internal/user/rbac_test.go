@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+)
+
+// newRBACFixture gives user-1 a global role, a role for "app" and, through the "ops" group, a role for "other"
+func newRBACFixture(t *testing.T) *RBACService {
+	t.Helper()
+
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	for _, id := range []string{"user-1", "user-2"} {
+		if err := repos.Users.CreateUser(ctx, &storage.User{ID: id, Email: id + "@example.com"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	service := NewRBACService(repos.RBAC)
+	mustRole := func(clientID, name string) string {
+		role, err := service.CreateRole(ctx, clientID, name, "")
+		if err != nil {
+			t.Fatalf("CreateRole: %v", err)
+		}
+		return role.ID
+	}
+
+	auditor := mustRole("", "auditor")
+	editor := mustRole("app", "editor")
+	deployer := mustRole("other", "deployer")
+	oncall := mustRole("", "oncall")
+
+	group, err := service.CreateGroup(ctx, "ops", "", "")
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	for _, step := range []error{
+		service.AssignRole(ctx, auditor, "user-1", ""),
+		service.AssignRole(ctx, editor, "user-1", ""),
+		service.AddGroupMember(ctx, group.ID, "user-1"),
+		service.AssignRole(ctx, deployer, "", group.ID),
+		service.AssignRole(ctx, oncall, "", group.ID),
+		// Holding a role directly and through a group still yields it once
+		service.AssignRole(ctx, auditor, "", group.ID),
+	} {
+		if step != nil {
+			t.Fatalf("setup: %v", step)
+		}
+	}
+	return service
+}
+
+func TestRBACRolesForClient(t *testing.T) {
+	service := newRBACFixture(t)
+
+	tests := []struct {
+		clientID string
+		want     []string
+	}{
+		{"app", []string{"auditor", "editor", "oncall"}},
+		{"other", []string{"auditor", "deployer", "oncall"}},
+		{"unrelated", []string{"auditor", "oncall"}},
+	}
+	for _, tt := range tests {
+		roles, err := service.Roles(context.Background(), "user-1", tt.clientID)
+		if err != nil {
+			t.Fatalf("Roles: %v", err)
+		}
+		sort.Strings(roles)
+		if !reflect.DeepEqual(roles, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.clientID, roles, tt.want)
+		}
+	}
+
+	if roles, err := service.Roles(context.Background(), "user-2", "app"); err != nil || len(roles) != 0 {
+		t.Errorf("user without assignments: got %v, %v", roles, err)
+	}
+}
+
+func TestRBACGroupsAndGlobalRoles(t *testing.T) {
+	service := newRBACFixture(t)
+	ctx := context.Background()
+
+	if groups, err := service.Groups(ctx, "user-1"); err != nil || !reflect.DeepEqual(groups, []string{"ops"}) {
+		t.Errorf("Groups = %v, %v; want [ops]", groups, err)
+	}
+
+	// Only roles without a client count as global, whether held directly or through a group
+	for name, want := range map[string]bool{"auditor": true, "oncall": true, "editor": false, "deployer": false} {
+		got, err := service.HasGlobalRole(ctx, "user-1", name)
+		if err != nil {
+			t.Fatalf("HasGlobalRole: %v", err)
+		}
+		if got != want {
+			t.Errorf("HasGlobalRole(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
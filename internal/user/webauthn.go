@@ -0,0 +1,360 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"oauth-golang/internal/storage"
+	"oauth-golang/pkg/utils"
+)
+
+// ceremonyTTL bounds how long a begun registration or assertion may take to finish
+const ceremonyTTL = 5 * time.Minute
+
+// webauthnUser adapts storage.User and its credentials to the webauthn.User interface
+type webauthnUser struct {
+	user        *storage.User
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte                         { return []byte(u.user.ID) }
+func (u *webauthnUser) WebAuthnName() string                       { return u.user.Email }
+func (u *webauthnUser) WebAuthnDisplayName() string                { return u.user.Name }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// ceremony holds server-side state between the begin and finish steps
+type ceremony struct {
+	userID    string
+	data      *webauthn.SessionData
+	createdAt time.Time
+}
+
+// WebAuthnService handles passkey registration and assertion ceremonies
+// DB INTERACTION: Reads and writes credentials via webauthnRepo
+type WebAuthnService struct {
+	webauthn     *webauthn.WebAuthn
+	webauthnRepo storage.WebAuthnRepository
+	userRepo     storage.UserRepository
+	ceremonies   map[string]*ceremony
+	mu           sync.Mutex
+}
+
+// NewWebAuthnService creates a new WebAuthn service for the given relying party
+func NewWebAuthnService(
+	rpID, rpDisplayName string,
+	rpOrigins []string,
+	webauthnRepo storage.WebAuthnRepository,
+	userRepo storage.UserRepository,
+) (*WebAuthnService, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpDisplayName,
+		RPOrigins:     rpOrigins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure WebAuthn: %w", err)
+	}
+
+	service := &WebAuthnService{
+		webauthn:     wa,
+		webauthnRepo: webauthnRepo,
+		userRepo:     userRepo,
+		ceremonies:   make(map[string]*ceremony),
+	}
+
+	// Start cleanup goroutine for abandoned ceremonies
+	go service.cleanupExpired()
+
+	return service, nil
+}
+
+// HasCredentials reports whether the user has at least one usable credential
+// INPUT FROM DB: Queries credentials via webauthnRepo
+func (s *WebAuthnService) HasCredentials(ctx context.Context, userID string) (bool, error) {
+	credentials, err := s.webauthnRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, credential := range credentials {
+		if !credential.CloneWarning {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListCredentials returns the user's registered credentials
+// INPUT FROM DB: Queries credentials via webauthnRepo
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID string) ([]*storage.WebAuthnCredential, error) {
+	return s.webauthnRepo.ListByUser(ctx, userID)
+}
+
+// DeleteCredential removes one of the user's credentials
+// OUTPUT TO DB: Deletes credential via webauthnRepo
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID, credentialID string) error {
+	return s.webauthnRepo.DeleteCredential(ctx, userID, credentialID)
+}
+
+// BeginRegistration starts a registration ceremony for a signed-in user
+// Returns the ceremony ID and the options to pass to navigator.credentials.create()
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, user *storage.User) (string, *protocol.CredentialCreation, error) {
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	options, data, err := s.webauthn.BeginRegistration(
+		waUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(waUser.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin registration: %w", err)
+	}
+
+	return s.storeCeremony(user.ID, data), options, nil
+}
+
+// FinishRegistration verifies the attestation response and stores the new credential
+// OUTPUT TO DB: Inserts credential via webauthnRepo
+func (s *WebAuthnService) FinishRegistration(user *storage.User, ceremonyID, name string, r *http.Request) (*storage.WebAuthnCredential, error) {
+	ctx := r.Context()
+	c := s.takeCeremony(ceremonyID)
+	if c == nil || c.userID != user.ID {
+		return nil, fmt.Errorf("invalid or expired registration ceremony")
+	}
+
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.FinishRegistration(waUser, *c.data, r)
+	if err != nil {
+		return nil, fmt.Errorf("registration failed: %w", err)
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	stored := &storage.WebAuthnCredential{
+		ID:              base64.RawURLEncoding.EncodeToString(credential.ID),
+		UserID:          user.ID,
+		Name:            name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.webauthnRepo.CreateCredential(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// BeginLogin starts a passwordless (discoverable credential) assertion ceremony
+func (s *WebAuthnService) BeginLogin() (string, *protocol.CredentialAssertion, error) {
+	options, data, err := s.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin login: %w", err)
+	}
+
+	return s.storeCeremony("", data), options, nil
+}
+
+// FinishLogin verifies a passwordless assertion and returns the authenticated user
+// DB INTERACTION: Resolves the user from the credential's user handle and updates the counter
+func (s *WebAuthnService) FinishLogin(ceremonyID string, r *http.Request) (*storage.User, error) {
+	ctx := r.Context()
+	c := s.takeCeremony(ceremonyID)
+	if c == nil {
+		return nil, fmt.Errorf("invalid or expired login ceremony")
+	}
+
+	var resolved *webauthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err := s.userRepo.GetUserByID(ctx, string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, fmt.Errorf("unknown user")
+		}
+		resolved, err = s.loadUser(ctx, user)
+		return resolved, err
+	}
+
+	_, credential, err := s.webauthn.FinishPasskeyLogin(handler, *c.data, r)
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+
+	if err := s.recordAssertion(ctx, credential); err != nil {
+		return nil, err
+	}
+	if resolved.user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	return resolved.user, nil
+}
+
+// BeginSecondFactor starts an assertion ceremony restricted to the user's own credentials
+func (s *WebAuthnService) BeginSecondFactor(ctx context.Context, user *storage.User) (string, *protocol.CredentialAssertion, error) {
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(waUser.credentials) == 0 {
+		return "", nil, fmt.Errorf("no security keys registered")
+	}
+
+	options, data, err := s.webauthn.BeginLogin(waUser)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin assertion: %w", err)
+	}
+
+	return s.storeCeremony(user.ID, data), options, nil
+}
+
+// FinishSecondFactor verifies an assertion made as a second factor
+// OUTPUT TO DB: Updates the credential's signature counter
+func (s *WebAuthnService) FinishSecondFactor(user *storage.User, ceremonyID string, r *http.Request) error {
+	ctx := r.Context()
+	c := s.takeCeremony(ceremonyID)
+	if c == nil || c.userID != user.ID {
+		return fmt.Errorf("invalid or expired assertion ceremony")
+	}
+
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	credential, err := s.webauthn.FinishLogin(waUser, *c.data, r)
+	if err != nil {
+		return fmt.Errorf("assertion failed: %w", err)
+	}
+
+	return s.recordAssertion(ctx, credential)
+}
+
+// recordAssertion persists the new signature counter, refusing credentials that look cloned
+func (s *WebAuthnService) recordAssertion(ctx context.Context, credential *webauthn.Credential) error {
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+
+	if credential.Authenticator.CloneWarning {
+		if err := s.webauthnRepo.FlagCloneWarning(ctx, id); err != nil {
+			return err
+		}
+		return fmt.Errorf("authenticator signature counter did not increase; credential disabled")
+	}
+
+	return s.webauthnRepo.RecordAssertion(ctx, id, int64(credential.Authenticator.SignCount), credential.Flags.BackupState)
+}
+
+// loadUser builds the webauthn.User for a stored user, skipping credentials flagged as cloned
+func (s *WebAuthnService) loadUser(ctx context.Context, user *storage.User) (*webauthnUser, error) {
+	stored, err := s.webauthnRepo.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	waUser := &webauthnUser{user: user}
+	for _, credential := range stored {
+		if credential.CloneWarning {
+			continue
+		}
+
+		id, err := base64.RawURLEncoding.DecodeString(credential.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored credential ID: %w", err)
+		}
+
+		transports := make([]protocol.AuthenticatorTransport, len(credential.Transports))
+		for i, transport := range credential.Transports {
+			transports[i] = protocol.AuthenticatorTransport(transport)
+		}
+
+		waUser.credentials = append(waUser.credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.AAGUID,
+				SignCount: uint32(credential.SignCount),
+			},
+		})
+	}
+
+	return waUser, nil
+}
+
+// storeCeremony saves ceremony state and returns its ID
+func (s *WebAuthnService) storeCeremony(userID string, data *webauthn.SessionData) string {
+	id := utils.GenerateRandomString(32)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ceremonies[id] = &ceremony{userID: userID, data: data, createdAt: time.Now()}
+
+	return id
+}
+
+// takeCeremony retrieves and removes ceremony state (one-time use)
+func (s *WebAuthnService) takeCeremony(id string) *ceremony {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.ceremonies[id]
+	if !ok {
+		return nil
+	}
+	delete(s.ceremonies, id)
+
+	if time.Since(c.createdAt) > ceremonyTTL {
+		return nil
+	}
+	return c
+}
+
+// cleanupExpired removes abandoned ceremonies
+func (s *WebAuthnService) cleanupExpired() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		for id, c := range s.ceremonies {
+			if time.Since(c.createdAt) > ceremonyTTL {
+				delete(s.ceremonies, id)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
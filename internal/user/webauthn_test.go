@@ -0,0 +1,277 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+
+	"oauth-golang/internal/storage"
+	"oauth-golang/internal/storage/memory"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:8080"
+)
+
+// softAuthenticator is a platform authenticator holding one ES256 passkey in memory
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	signCount  uint32
+}
+
+func newSoftAuthenticator(t *testing.T, userID string) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{t: t, key: key, id: id, userHandle: []byte(userID)}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// authenticatorData builds the authenticator data with user presence and verification set
+func (a *softAuthenticator) authenticatorData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags := byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	if attested != nil {
+		flags |= byte(protocol.FlagAttestedCredentialData)
+	}
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(ceremonyType string, challenge protocol.URLEncodedBase64) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": b64(challenge),
+		"origin":    testOrigin,
+	})
+	return data
+}
+
+// create answers navigator.credentials.create() with "none" attestation
+func (a *softAuthenticator) create(options *protocol.CredentialCreation) *http.Request {
+	a.t.Helper()
+
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal public key: %v", err)
+	}
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(attested),
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal attestation: %v", err)
+	}
+
+	return a.request(map[string]interface{}{
+		"clientDataJSON":    b64(a.clientData("webauthn.create", options.Response.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// get answers navigator.credentials.get() with the given signature counter
+func (a *softAuthenticator) get(options *protocol.CredentialAssertion, signCount uint32) *http.Request {
+	a.t.Helper()
+
+	a.signCount = signCount
+	authData := a.authenticatorData(nil)
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("SignASN1: %v", err)
+	}
+
+	return a.request(map[string]interface{}{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) request(response map[string]interface{}) *http.Request {
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":       b64(a.id),
+		"rawId":    b64(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	return httptest.NewRequest(http.MethodPost, "/webauthn", bytes.NewReader(body))
+}
+
+// registeredPasskey returns a WebAuthn service with a passkey registered for user-1
+func registeredPasskey(t *testing.T) (*WebAuthnService, *storage.Repositories, *storage.User, *softAuthenticator) {
+	t.Helper()
+
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	user := &storage.User{ID: "user-1", Email: "user@example.com", Name: "User One"}
+	if err := repos.Users.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	service, err := NewWebAuthnService(testRPID, "Test", []string{testOrigin}, repos.WebAuthn, repos.Users)
+	if err != nil {
+		t.Fatalf("NewWebAuthnService: %v", err)
+	}
+
+	authenticator := newSoftAuthenticator(t, user.ID)
+	ceremonyID, options, err := service.BeginRegistration(ctx, user)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	stored, err := service.FinishRegistration(user, ceremonyID, "Laptop", authenticator.create(options))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if stored.ID != b64(authenticator.id) || stored.Name != "Laptop" {
+		t.Fatalf("stored credential %+v, want ID %s named Laptop", stored, b64(authenticator.id))
+	}
+	return service, repos, user, authenticator
+}
+
+func TestWebAuthnPasskeyLogin(t *testing.T) {
+	ctx := context.Background()
+	service, repos, user, authenticator := registeredPasskey(t)
+
+	ceremonyID, options, err := service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	got, err := service.FinishLogin(ceremonyID, authenticator.get(options, 1))
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Fatalf("logged in as %s, want %s", got.ID, user.ID)
+	}
+
+	credentials, err := repos.WebAuthn.ListByUser(ctx, user.ID)
+	if err != nil || len(credentials) != 1 {
+		t.Fatalf("ListByUser = %d credentials, %v", len(credentials), err)
+	}
+	if credentials[0].SignCount != 1 {
+		t.Errorf("sign count = %d, want 1", credentials[0].SignCount)
+	}
+
+	// Ceremonies are one-time: the same assertion cannot be replayed
+	if _, err := service.FinishLogin(ceremonyID, authenticator.get(options, 2)); err == nil {
+		t.Error("FinishLogin accepted a used ceremony")
+	}
+
+	// A registration ceremony belongs to the user who began it
+	ceremonyID, creation, err := service.BeginRegistration(ctx, user)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	other := &storage.User{ID: "user-2"}
+	if _, err := service.FinishRegistration(other, ceremonyID, "", newSoftAuthenticator(t, other.ID).create(creation)); err == nil {
+		t.Error("FinishRegistration accepted another user's ceremony")
+	}
+}
+
+func TestWebAuthnSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	service, _, user, authenticator := registeredPasskey(t)
+
+	ceremonyID, options, err := service.BeginSecondFactor(ctx, user)
+	if err != nil {
+		t.Fatalf("BeginSecondFactor: %v", err)
+	}
+	if len(options.Response.AllowedCredentials) != 1 {
+		t.Fatalf("got %d allowed credentials, want the user's one", len(options.Response.AllowedCredentials))
+	}
+	if err := service.FinishSecondFactor(user, ceremonyID, authenticator.get(options, 1)); err != nil {
+		t.Fatalf("FinishSecondFactor: %v", err)
+	}
+
+	// Users without passkeys cannot start the ceremony
+	if _, _, err := service.BeginSecondFactor(ctx, &storage.User{ID: "user-2"}); err == nil {
+		t.Error("BeginSecondFactor succeeded without credentials")
+	}
+}
+
+func TestWebAuthnClonedAuthenticatorIsDisabled(t *testing.T) {
+	ctx := context.Background()
+	service, _, user, authenticator := registeredPasskey(t)
+
+	login := func(signCount uint32) error {
+		ceremonyID, options, err := service.BeginLogin()
+		if err != nil {
+			t.Fatalf("BeginLogin: %v", err)
+		}
+		_, err = service.FinishLogin(ceremonyID, authenticator.get(options, signCount))
+		return err
+	}
+
+	if err := login(5); err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	// A counter that does not increase means a copy of the key is in use
+	if err := login(5); err == nil {
+		t.Fatal("login with a repeated signature counter succeeded")
+	}
+	if has, err := service.HasCredentials(ctx, user.ID); err != nil || has {
+		t.Errorf("HasCredentials = %v, %v; want the cloned credential disabled", has, err)
+	}
+	if err := login(6); err == nil {
+		t.Error("disabled credential still signs in")
+	}
+}
+
+func TestWebAuthnLoginRejectsDisabledUser(t *testing.T) {
+	ctx := context.Background()
+	service, repos, user, authenticator := registeredPasskey(t)
+	if err := repos.Users.SetDisabled(ctx, user.ID, true); err != nil {
+		t.Fatalf("SetDisabled: %v", err)
+	}
+
+	ceremonyID, options, err := service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := service.FinishLogin(ceremonyID, authenticator.get(options, 1)); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("FinishLogin err = %v, want ErrUserDisabled", err)
+	}
+}